@@ -71,6 +71,24 @@ var CLI struct {
 		Inputs []string `arg type:"existingpath" help:"Input files to plot."`
 	} `cmd help:"Plot average bias across one or more MLPX files over time."`
 
+	ExportMat struct {
+		Input  string `arg:"" name:"input" short:"i" type:"path" default:"-" help:"Input MLPX file to export, or '-' for standard input."`
+		Output string `name:"output" short:"o" type:"path" default:"-" help:"Output file to which the MATLAB MAT-file will be written. Specify '-' for standard output."`
+	} `cmd:"" help:"Export an existing MLPX file as a MATLAB MAT-file, with each layer's weights as a matrix of neurons by predecessor neurons."`
+
+	ExportNpz struct {
+		Input  string `arg:"" name:"input" short:"i" type:"path" default:"-" help:"Input MLPX file to export, or '-' for standard input."`
+		Output string `name:"output" short:"o" type:"path" default:"-" help:"Output file to which the NumPy .npz archive will be written. Specify '-' for standard output."`
+	} `cmd:"" help:"Export an existing MLPX file as a NumPy .npz archive, with arrays named snapshot/layer/field, and weights shaped neurons by predecessor neurons."`
+
+	ImportNpz struct {
+		Input    string `arg:"" required:"" type:"existingpath" help:"MLPX file into which the snapshot is imported. It must have at least one snapshot, whose topology is used."`
+		Archive  string `arg:"" required:"" type:"existingpath" help:"NumPy .npz archive to import, laid out as export-npz writes them."`
+		Output   string `name:"output" short:"o" type:"path" default:"-" help:"Output file to which the resulting MLPX will be written. Specify '-' for standard output."`
+		Snapshot string `name:"snapshot" short:"s" help:"ID of the new snapshot. Defaults to the next snapshot ID."`
+		From     string `name:"from" short:"f" help:"Snapshot within the archive to import. May be omitted if the archive has only one."`
+	} `cmd:"" help:"Import the arrays of a NumPy .npz archive as a new snapshot of an existing MLPX file."`
+
 	Seed string `name:"seed" short:"S" default:"-" help:"Seed for random number generator, as an integer. You may wish to set this if you want to reproducible generate the same MLPX multiple times. Use '-' for the current system time."`
 
 	Version bool `name:"version" short:"V" default:"false" help:"Display version and exit"`
@@ -322,6 +340,148 @@ func main() {
 		}
 		os.Exit(0)
 
+	} else if (ctx.Command() == "export-mat") || (ctx.Command() == "export-mat <input>") {
+		data := []byte{}
+
+		if CLI.ExportMat.Input == getDashDir() {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			var err error
+			data, err = ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+				os.Exit(1)
+			}
+
+		} else {
+			var err error
+			data, err = ioutil.ReadFile(CLI.ExportMat.Input)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		m, err := mlpx.FromJSON(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		if CLI.ExportMat.Output == getDashDir() {
+			mat, err := m.ToMAT()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate MAT-file: %v\n", err)
+				os.Exit(1)
+			}
+
+			_, err = os.Stdout.Write(mat)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			err := m.WriteMAT(CLI.ExportMat.Output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		os.Exit(0)
+
+	} else if (ctx.Command() == "export-npz") || (ctx.Command() == "export-npz <input>") {
+		data := []byte{}
+
+		if CLI.ExportNpz.Input == getDashDir() {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			var err error
+			data, err = ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+				os.Exit(1)
+			}
+
+		} else {
+			var err error
+			data, err = ioutil.ReadFile(CLI.ExportNpz.Input)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		m, err := mlpx.FromJSON(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		if CLI.ExportNpz.Output == getDashDir() {
+			npz, err := m.ToNPZ()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate .npz archive: %v\n", err)
+				os.Exit(1)
+			}
+
+			_, err = os.Stdout.Write(npz)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			err := m.WriteNPZ(CLI.ExportNpz.Output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		os.Exit(0)
+
+	} else if ctx.Command() == "import-npz <input> <archive>" {
+		m, err := mlpx.ReadJSON(CLI.ImportNpz.Input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read MLPX file '%s': %v\n", CLI.ImportNpz.Input, err)
+			os.Exit(1)
+		}
+
+		id, err := m.ReadNPZ(CLI.ImportNpz.Archive, CLI.ImportNpz.Snapshot, CLI.ImportNpz.From)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to import '%s': %v\n", CLI.ImportNpz.Archive, err)
+			os.Exit(1)
+		}
+
+		err = m.Validate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Imported snapshot '%s' is invalid: %v\n", id, err)
+			os.Exit(2)
+		}
+
+		if CLI.ImportNpz.Output == getDashDir() {
+			data, err := m.ToJSON()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate JSON: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Print(string(data))
+			fmt.Print("")
+		} else {
+			err := m.WriteJSON(CLI.ImportNpz.Output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		os.Exit(0)
+
 	} else {
 		fmt.Fprintf(os.Stderr, "Don't understand how to parse that command.\n")
 		panic(ctx.Command())
@@ -0,0 +1,283 @@
+package mlpx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"unicode/utf16"
+)
+
+// This file implements writing MLPX objects as MATLAB Level 5 MAT-files, which
+// may be loaded by MATLAB, GNU Octave, and SciPy.
+
+// matHeaderText is the descriptive text at the start of the MAT-file.
+const matHeaderText = "MATLAB 5.0 MAT-file, Platform: Go, Created by: mlpx"
+
+// MAT-file data types and array classes
+const (
+	miInt8   = 1
+	miUint16 = 4
+	miInt32  = 5
+	miUint32 = 6
+	miDouble = 9
+	miMatrix = 14
+
+	mxCell   = 1
+	mxStruct = 2
+	mxChar   = 4
+	mxDouble = 6
+)
+
+// matMatrix is a two-dimensional array of doubles in column-major order.
+type matMatrix struct {
+	rows, cols int
+	data       []float64
+}
+
+// matField is a field of a matStruct.
+type matField struct {
+	name  string
+	value interface{}
+}
+
+// matStruct is a 1×1 MATLAB structure.
+type matStruct []matField
+
+// matCell is a column cell array.
+type matCell []interface{}
+
+// matColumn converts an optional list to a column vector, which is empty if
+// the list is nil.
+func matColumn(list *[]float64) *matMatrix {
+	if list == nil {
+		return &matMatrix{}
+	}
+	return &matMatrix{rows: len(*list), cols: 1, data: *list}
+}
+
+// matElement appends a data element to buf, using the compact format for data
+// of 4 bytes or less, and padding it to a multiple of 8 bytes.
+func matElement(buf *bytes.Buffer, typ uint32, data []byte) {
+	le := binary.LittleEndian
+	tag := make([]byte, 8)
+
+	if len(data) > 0 && len(data) <= 4 {
+		le.PutUint32(tag, uint32(len(data))<<16|typ)
+		copy(tag[4:], data)
+		buf.Write(tag)
+		return
+	}
+
+	le.PutUint32(tag, typ)
+	le.PutUint32(tag[4:], uint32(len(data)))
+	buf.Write(tag)
+	buf.Write(data)
+	if len(data)%8 != 0 {
+		buf.Write(make([]byte, 8-len(data)%8))
+	}
+}
+
+// matArray appends a value, which may be a float64, string, *matMatrix,
+// matStruct, or matCell, to buf as a miMATRIX data element.
+func matArray(buf *bytes.Buffer, name string, value interface{}) {
+	le := binary.LittleEndian
+	var class uint32
+	var rows, cols int
+	body := &bytes.Buffer{}
+
+	switch v := value.(type) {
+	case float64:
+		matArray(buf, name, &matMatrix{rows: 1, cols: 1, data: []float64{v}})
+		return
+
+	case *matMatrix:
+		class = mxDouble
+		rows, cols = v.rows, v.cols
+		data := make([]byte, 8*len(v.data))
+		for i, x := range v.data {
+			le.PutUint64(data[8*i:], math.Float64bits(x))
+		}
+		matElement(body, miDouble, data)
+
+	case string:
+		units := utf16.Encode([]rune(v))
+		class = mxChar
+		if len(units) > 0 {
+			rows, cols = 1, len(units)
+		}
+		data := make([]byte, 2*len(units))
+		for i, u := range units {
+			le.PutUint16(data[2*i:], u)
+		}
+		matElement(body, miUint16, data)
+
+	case matStruct:
+		class = mxStruct
+		rows, cols = 1, 1
+
+		length := 1
+		for _, f := range v {
+			if len(f.name)+1 > length {
+				length = len(f.name) + 1
+			}
+		}
+
+		data := make([]byte, 4)
+		le.PutUint32(data, uint32(length))
+		matElement(body, miInt32, data)
+
+		names := make([]byte, length*len(v))
+		for i, f := range v {
+			copy(names[i*length:], f.name)
+		}
+		matElement(body, miInt8, names)
+
+		for _, f := range v {
+			matArray(body, "", f.value)
+		}
+
+	case matCell:
+		class = mxCell
+		rows, cols = len(v), 1
+		for _, c := range v {
+			matArray(body, "", c)
+		}
+
+	default:
+		panic(fmt.Sprintf("cannot write %T to a MAT-file", value))
+	}
+
+	contents := &bytes.Buffer{}
+
+	flags := make([]byte, 8)
+	le.PutUint32(flags, class)
+	matElement(contents, miUint32, flags)
+
+	dims := make([]byte, 8)
+	le.PutUint32(dims, uint32(rows))
+	le.PutUint32(dims[4:], uint32(cols))
+	matElement(contents, miInt32, dims)
+
+	matElement(contents, miInt8, []byte(name))
+
+	contents.Write(body.Bytes())
+
+	matElement(buf, miMatrix, contents.Bytes())
+}
+
+// MATWeights returns the layer's weights as a matrix in column-major order,
+// with a row for each neuron in the layer and a column for each neuron in its
+// predecessor, see WeightDimensions(). The input layer's weights are returned
+// as a column.
+func (layer *Layer) MATWeights() ([]int, []float64, error) {
+	if layer.Weights == nil {
+		return []int{0, 0}, []float64{}, nil
+	}
+
+	weights := *layer.Weights
+
+	dims, err := layer.WeightDimensions()
+	if err != nil {
+		return []int{len(weights), 1}, weights, nil
+	}
+
+	rows, cols := dims[0], dims[1]
+	if len(weights) != rows*cols {
+		return nil, nil, fmt.Errorf("Layer '%s' has %d weights, but should have %d×%d", layer.ID, len(weights), rows, cols)
+	}
+
+	data := make([]float64, len(weights))
+	for j := 0; j < rows; j++ {
+		for i := 0; i < cols; i++ {
+			data[j+i*rows] = weights[j*cols+i]
+		}
+	}
+
+	return dims, data, nil
+}
+
+// ToMAT converts an existing MLPX object to a MATLAB Level 5 MAT-file and
+// returns it.
+//
+// The file has a single variable, snapshots, which is a cell array with a
+// struct for each snapshot in sorted order. Each snapshot has the fields id,
+// alpha, and layers, which is a cell array with a struct for each layer in
+// sorted order. Each layer has the fields id, predecessor, successor,
+// neurons, activation_function, weights, biases, outputs, activations, and
+// deltas. The weights are a matrix of neurons × predecessor neurons, see
+// MATWeights(), and the other lists are column vectors. Lists which are
+// absent are empty.
+func (mlp *MLPX) ToMAT() ([]byte, error) {
+	snapshots := matCell{}
+
+	for _, snapid := range mlp.SortedSnapshotIDs() {
+		snap := mlp.Snapshots[snapid]
+
+		layers := matCell{}
+		for _, layerid := range snap.SortedLayerIDs() {
+			layer := snap.Layers[layerid]
+
+			dims, weights, err := layer.MATWeights()
+			if err != nil {
+				return nil, fmt.Errorf("Snapshot '%s': %v", snapid, err)
+			}
+
+			layers = append(layers, matStruct{
+				{"id", layerid},
+				{"predecessor", layer.Predecessor},
+				{"successor", layer.Successor},
+				{"neurons", float64(layer.Neurons)},
+				{"activation_function", layer.ActivationFunction},
+				{"weights", &matMatrix{rows: dims[0], cols: dims[1], data: weights}},
+				{"biases", matColumn(layer.Biases)},
+				{"outputs", matColumn(layer.Outputs)},
+				{"activations", matColumn(layer.Activations)},
+				{"deltas", matColumn(layer.Deltas)},
+			})
+		}
+
+		snapshots = append(snapshots, matStruct{
+			{"id", snapid},
+			{"alpha", snap.Alpha},
+			{"layers", layers},
+		})
+	}
+
+	buf := &bytes.Buffer{}
+
+	header := make([]byte, 128)
+	copy(header, matHeaderText)
+	for i := len(matHeaderText); i < 116; i++ {
+		header[i] = ' '
+	}
+	binary.LittleEndian.PutUint16(header[124:], 0x0100)
+	copy(header[126:], "IM")
+	buf.Write(header)
+
+	matArray(buf, "snapshots", snapshots)
+
+	return buf.Bytes(), nil
+}
+
+// WriteMAT calls ToMAT() and then overwrites the specified path with it's
+// return.
+func (mlp *MLPX) WriteMAT(path string) error {
+	b, err := mlp.ToMAT()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
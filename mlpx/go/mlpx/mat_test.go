@@ -0,0 +1,78 @@
+package mlpx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMATWeights(t *testing.T) {
+	m := getTestMLPX1()
+	m.Snapshots["0"].MustMakeLayer("wide", 3, "hidden0", "")
+	wide := m.Snapshots["0"].Layers["wide"]
+	wide.Weights = &[]float64{1, 2, 3, 4, 5, 6}
+
+	dims, data, err := wide.MATWeights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(dims, []int{3, 2}) || !cmp.Equal(data, []float64{1, 3, 5, 2, 4, 6}) {
+		t.Errorf("weights are %v %v", dims, data)
+	}
+
+	dims, data, err = m.Snapshots["0"].Layers["output"].MATWeights()
+	if err != nil || !cmp.Equal(dims, []int{0, 0}) || len(data) != 0 {
+		t.Errorf("missing weights are %v %v %v", dims, data, err)
+	}
+
+	wide.Weights = &[]float64{1, 2, 3}
+	_, _, err = wide.MATWeights()
+	if err == nil {
+		t.Errorf("wrong number of weights should have errored")
+	}
+
+	m.Snapshots["0"].Layers["hidden0"].Weights = &[]float64{1}
+	_, err = m.ToMAT()
+	if err == nil {
+		t.Errorf("wrong number of weights should have errored")
+	}
+}
+
+func TestToMAT(t *testing.T) {
+	m := getTestMLPX1()
+
+	data, err := m.ToMAT()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(data, []byte("MATLAB 5.0 MAT-file")) || string(data[124:128]) != "\x00\x01IM" {
+		t.Errorf("header is %q", data[:128])
+	}
+
+	le := binary.LittleEndian
+	if le.Uint32(data[128:]) != miMatrix || int(le.Uint32(data[132:])) != len(data)-136 {
+		t.Errorf("MAT-file does not contain a single variable")
+	}
+	if !bytes.Contains(data, []byte("snapshots")) {
+		t.Errorf("MAT-file does not contain the snapshots variable")
+	}
+
+	// the weights of hidden0 are transposed into column-major order
+	weights := []byte{miDouble, 0, 0, 0, 32, 0, 0, 0}
+	for _, w := range []float64{1.5, 3.5, 2.5, 4} {
+		b := make([]byte, 8)
+		le.PutUint64(b, math.Float64bits(w))
+		weights = append(weights, b...)
+	}
+	if !bytes.Contains(data, weights) {
+		t.Errorf("MAT-file does not contain the weights of hidden0")
+	}
+
+	if len(data)%8 != 0 {
+		t.Errorf("MAT-file is %d bytes", len(data))
+	}
+}
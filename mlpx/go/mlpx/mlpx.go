@@ -689,6 +689,27 @@ func (layer *Layer) EnsureWeights() {
 	}
 }
 
+// WeightDimensions returns the dimensions of the layer's weights matrix, being
+// the number of neurons in the layer, followed by the number of neurons in its
+// predecessor, so that the weights list may be viewed with
+// github.com/herclab/tnx/go/tnx/tensor using these dimensions.
+//
+// Note that this is the transpose of the weights matrix of an mlplayer node in
+// tnx(4), which is the number of neurons in the predecessor by the number in
+// the layer. A tensor of these dimensions is converted to that layout by its
+// Transpose() method.
+//
+// An error is returned if the predecessor layer does not exist, as is the case
+// for the input layer.
+func (layer *Layer) WeightDimensions() ([]int, error) {
+	pred, ok := layer.Parent.Layers[layer.Predecessor]
+	if !ok {
+		return nil, fmt.Errorf("Layer '%s' has no predecessor '%s'", layer.ID, layer.Predecessor)
+	}
+
+	return []int{layer.Neurons, pred.Neurons}, nil
+}
+
 // EnsureOutputs guarantees that the outputs matrix for the layer is non-nil
 func (layer *Layer) EnsureOutputs() {
 	if layer.Outputs == nil {
@@ -345,3 +345,21 @@ func TestIsomorphicDuplicate(t *testing.T) {
 		t.Errorf("Original and duplicated MLPXes differ")
 	}
 }
+
+func TestWeightDimensions(t *testing.T) {
+	m := getTestMLPX1()
+	m.Snapshots["0"].MustMakeLayer("wide", 5, "hidden0", "")
+
+	dims, err := m.Snapshots["0"].Layers["wide"].WeightDimensions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(dims, []int{5, 2}) {
+		t.Errorf("weight dimensions are %v, expected [5 2]", dims)
+	}
+
+	_, err = m.Snapshots["0"].Layers["input"].WeightDimensions()
+	if err == nil {
+		t.Errorf("input layer should not have weight dimensions")
+	}
+}
@@ -0,0 +1,444 @@
+package mlpx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file implements writing MLPX objects as NumPy .npz archives, which may
+// be loaded with numpy.load(), and importing such archives as new snapshots.
+
+// npyMagic begins every .npy file.
+const npyMagic = "\x93NUMPY"
+
+// NPZFields lists the layer fields which are stored in .npz archives.
+var NPZFields = []string{"weights", "biases", "outputs", "activations", "deltas"}
+
+var (
+	npyDescrPattern   = regexp.MustCompile(`['"]descr['"]\s*:\s*['"]([^'"]*)['"]`)
+	npyFortranPattern = regexp.MustCompile(`['"]fortran_order['"]\s*:\s*(True|False)`)
+	npyShapePattern   = regexp.MustCompile(`['"]shape['"]\s*:\s*\(([^)]*)\)`)
+)
+
+// npyArray is an N-dimensional array in C order.
+type npyArray struct {
+	shape []int
+	data  []float64
+}
+
+// NPZKey returns the key under which a field of a layer of a snapshot is
+// stored in an .npz archive.
+func NPZKey(snapid, layerid, field string) string {
+	return snapid + "/" + layerid + "/" + field
+}
+
+// field returns a pointer to the named field of the layer, which must be one
+// of NPZFields.
+func (layer *Layer) field(name string) (**[]float64, error) {
+	switch name {
+	case "weights":
+		return &layer.Weights, nil
+	case "biases":
+		return &layer.Biases, nil
+	case "outputs":
+		return &layer.Outputs, nil
+	case "activations":
+		return &layer.Activations, nil
+	case "deltas":
+		return &layer.Deltas, nil
+	}
+
+	return nil, fmt.Errorf("Layers have no field '%s'", name)
+}
+
+// npzShape returns the shape which the named field of the layer has in an .npz
+// archive. Weights have a row for each neuron of the layer, and a column for
+// each neuron of its predecessor. Everything else, including the weights of
+// the input layer, has an element for each neuron.
+func (layer *Layer) npzShape(name string) []int {
+	if name == "weights" {
+		dims, err := layer.WeightDimensions()
+		if err == nil {
+			return dims
+		}
+	}
+
+	return []int{layer.Neurons}
+}
+
+// encodeNPY encodes an array of float64s as a version 1.0 .npy file.
+func encodeNPY(shape []int, data []float64) []byte {
+	dims := make([]string, len(shape))
+	for i, d := range shape {
+		dims[i] = strconv.Itoa(d)
+	}
+	s := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		s += ","
+	}
+
+	// the data is aligned to 64 bytes, as numpy.save() does
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%s), }", s)
+	length := len(npyMagic) + 4 + len(header) + 1
+	header += strings.Repeat(" ", (64-length%64)%64) + "\n"
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{1, 0})
+	binary.Write(buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+
+	b := make([]byte, 8)
+	for _, x := range data {
+		binary.LittleEndian.PutUint64(b, math.Float64bits(x))
+		buf.Write(b)
+	}
+
+	return buf.Bytes()
+}
+
+// decodeNPY decodes a .npy file of floating point or integer values.
+func decodeNPY(data []byte) (*npyArray, error) {
+	if len(data) < 12 || string(data[:6]) != npyMagic {
+		return nil, fmt.Errorf("Not a .npy file")
+	}
+
+	var header string
+	switch data[6] {
+	case 1:
+		length := int(binary.LittleEndian.Uint16(data[8:]))
+		if 10+length > len(data) {
+			return nil, fmt.Errorf(".npy header is truncated")
+		}
+		header, data = string(data[10:10+length]), data[10+length:]
+	case 2, 3:
+		length := int(binary.LittleEndian.Uint32(data[8:]))
+		if 12+length > len(data) {
+			return nil, fmt.Errorf(".npy header is truncated")
+		}
+		header, data = string(data[12:12+length]), data[12+length:]
+	default:
+		return nil, fmt.Errorf("Unsupported .npy version %d.%d", data[6], data[7])
+	}
+
+	descr := npyDescrPattern.FindStringSubmatch(header)
+	fortran := npyFortranPattern.FindStringSubmatch(header)
+	shape := npyShapePattern.FindStringSubmatch(header)
+	if descr == nil || fortran == nil || shape == nil || len(descr[1]) < 3 {
+		return nil, fmt.Errorf("Invalid .npy header %q", strings.TrimSpace(header))
+	}
+
+	a := &npyArray{shape: []int{}}
+	size := 1
+	for _, d := range strings.Split(shape[1], ",") {
+		if strings.TrimSpace(d) == "" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(d))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid .npy shape (%s)", shape[1])
+		}
+		a.shape = append(a.shape, n)
+		size *= n
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if descr[1][0] == '>' {
+		order = binary.BigEndian
+	}
+	kind := descr[1][1]
+	width, err := strconv.Atoi(descr[1][2:])
+	if err != nil || !strings.ContainsRune("fiu", rune(kind)) ||
+		(width != 1 && width != 2 && width != 4 && width != 8) || (kind == 'f' && width < 4) {
+		return nil, fmt.Errorf("Unsupported .npy data type '%s'", descr[1])
+	}
+
+	if len(data) < size*width {
+		return nil, fmt.Errorf(".npy data is truncated")
+	}
+
+	a.data = make([]float64, size)
+	for i := range a.data {
+		b := data[i*width:]
+		var bits uint64
+		switch width {
+		case 1:
+			bits = uint64(b[0])
+		case 2:
+			bits = uint64(order.Uint16(b))
+		case 4:
+			bits = uint64(order.Uint32(b))
+		case 8:
+			bits = order.Uint64(b)
+		}
+
+		switch {
+		case kind == 'f' && width == 4:
+			a.data[i] = float64(math.Float32frombits(uint32(bits)))
+		case kind == 'f':
+			a.data[i] = math.Float64frombits(bits)
+		case kind == 'i':
+			shift := uint(64 - 8*width)
+			a.data[i] = float64(int64(bits<<shift) >> shift)
+		default:
+			a.data[i] = float64(bits)
+		}
+	}
+
+	// arrays in Fortran order, such as transposed arrays, are reordered
+	// by walking their multi-indices in C order
+	if fortran[1] == "True" {
+		reordered := make([]float64, size)
+		index := make([]int, len(a.shape))
+		for i := range reordered {
+			f, stride := 0, 1
+			for d := range a.shape {
+				f += index[d] * stride
+				stride *= a.shape[d]
+			}
+			reordered[i] = a.data[f]
+
+			for d := len(a.shape) - 1; d >= 0; d-- {
+				index[d]++
+				if index[d] < a.shape[d] {
+					break
+				}
+				index[d] = 0
+			}
+		}
+		a.data = reordered
+	}
+
+	return a, nil
+}
+
+// ToNPZ converts an existing MLPX object to a NumPy .npz archive and returns
+// it.
+//
+// Each field of each layer of each snapshot which is present is stored under
+// the key snapshot/layer/field, see NPZKey() and NPZFields. The weights have
+// the shape (neurons, predecessor neurons), as given by WeightDimensions(),
+// and the other fields have the shape (neurons,). The alpha value of each
+// snapshot is stored as a scalar under the key snapshot/alpha.
+func (mlp *MLPX) ToNPZ() ([]byte, error) {
+	arrays := map[string][]byte{}
+
+	for _, snapid := range mlp.SortedSnapshotIDs() {
+		snap := mlp.Snapshots[snapid]
+		if strings.Contains(snapid, "/") {
+			return nil, fmt.Errorf("Snapshot ID '%s' may not contain '/' in an .npz archive", snapid)
+		}
+
+		arrays[snapid+"/alpha"] = encodeNPY([]int{}, []float64{snap.Alpha})
+
+		for _, layerid := range snap.SortedLayerIDs() {
+			layer := snap.Layers[layerid]
+			if strings.Contains(layerid, "/") {
+				return nil, fmt.Errorf("Layer ID '%s' may not contain '/' in an .npz archive", layerid)
+			}
+
+			for _, name := range NPZFields {
+				field, _ := layer.field(name)
+				if *field == nil {
+					continue
+				}
+
+				shape := layer.npzShape(name)
+				size := 1
+				for _, d := range shape {
+					size *= d
+				}
+				if size != len(**field) {
+					return nil, fmt.Errorf("Snapshot '%s' layer '%s' has %d %s, but should have shape %v",
+						snapid, layerid, len(**field), name, shape)
+				}
+
+				arrays[NPZKey(snapid, layerid, name)] = encodeNPY(shape, **field)
+			}
+		}
+	}
+
+	keys := []string{}
+	for key := range arrays {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	for _, key := range keys {
+		f, err := z.CreateHeader(&zip.FileHeader{
+			Name:     key + ".npy",
+			Method:   zip.Store,
+			Modified: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = f.Write(arrays[key])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := z.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteNPZ calls ToNPZ() and then overwrites the specified path with it's
+// return.
+func (mlp *MLPX) WriteNPZ(path string) error {
+	b, err := mlp.ToNPZ()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// ImportNPZ reads an in-memory .npz archive, laid out as ToNPZ() writes them,
+// and stores the arrays of its snapshot from as a new snapshot with the given
+// id, which is isomorphic to the latest snapshot, and has the same activation
+// functions. If from is empty, the archive must contain a single snapshot. If
+// id is empty, NextSnapshotID() is used. The ID of the new snapshot is
+// returned.
+//
+// The archive need not contain every field of every layer, but each array it
+// does contain must have the shape which ToNPZ() would give it. If the archive
+// has no alpha value, that of the latest snapshot is used.
+func (mlp *MLPX) ImportNPZ(data []byte, id, from string) (string, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
+	arrays := map[string]*npyArray{}
+	snapids := map[string]bool{}
+	for _, f := range z.File {
+		key := strings.TrimSuffix(f.Name, ".npy")
+		snapid := strings.Split(key, "/")[0]
+		snapids[snapid] = true
+		if from != "" && snapid != from {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+
+		arrays[key], err = decodeNPY(b)
+		if err != nil {
+			return "", fmt.Errorf("Array '%s': %v", key, err)
+		}
+	}
+
+	if from == "" {
+		if len(snapids) != 1 {
+			found := []string{}
+			for snapid := range snapids {
+				found = append(found, snapid)
+			}
+			return "", fmt.Errorf("Archive has %d snapshots %v, the one to import must be specified",
+				len(found), SortSnapshotIDs(found))
+		}
+		for snapid := range snapids {
+			from = snapid
+		}
+	} else if !snapids[from] {
+		return "", fmt.Errorf("Archive has no snapshot '%s'", from)
+	}
+
+	latest, err := mlp.Latest()
+	if err != nil {
+		return "", err
+	}
+
+	if id == "" {
+		id = mlp.NextSnapshotID()
+	}
+
+	err = mlp.MakeIsomorphicSnapshot(id, latest.ID)
+	if err != nil {
+		return "", err
+	}
+	snap := mlp.Snapshots[id]
+	for layerid, layer := range snap.Layers {
+		layer.ActivationFunction = latest.Layers[layerid].ActivationFunction
+	}
+
+	for key, a := range arrays {
+		err = snap.importNPY(strings.TrimPrefix(key, from+"/"), a)
+		if err != nil {
+			delete(mlp.Snapshots, id)
+			return "", fmt.Errorf("Array '%s': %v", key, err)
+		}
+	}
+
+	return id, nil
+}
+
+// importNPY stores an array from an .npz archive, whose key is relative to the
+// snapshot.
+func (snapshot *Snapshot) importNPY(key string, a *npyArray) error {
+	if key == "alpha" {
+		if len(a.data) != 1 {
+			return fmt.Errorf("Alpha must be a scalar, not shape %v", a.shape)
+		}
+		snapshot.Alpha = a.data[0]
+		return nil
+	}
+
+	parts := strings.Split(key, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("Keys must be of the form snapshot/layer/field")
+	}
+
+	layer, ok := snapshot.Layers[parts[0]]
+	if !ok {
+		return fmt.Errorf("Snapshot has no layer '%s'", parts[0])
+	}
+
+	field, err := layer.field(parts[1])
+	if err != nil {
+		return err
+	}
+
+	shape := layer.npzShape(parts[1])
+	if len(a.shape) != len(shape) || a.shape[0] != shape[0] || (len(shape) == 2 && a.shape[1] != shape[1]) {
+		return fmt.Errorf("Shape is %v, but layer '%s' requires %v", a.shape, layer.ID, shape)
+	}
+
+	*field = &a.data
+	return nil
+}
+
+// ReadNPZ is a utility function which reads an .npz archive from disk, then
+// calls ImportNPZ() on it.
+func (mlp *MLPX) ReadNPZ(path, id, from string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return mlp.ImportNPZ(data, id, from)
+}
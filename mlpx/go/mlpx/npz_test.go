@@ -0,0 +1,155 @@
+package mlpx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// npzArchive builds an .npz archive of the given .npy files.
+func npzArchive(t *testing.T, files map[string][]byte) []byte {
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	for name, data := range files {
+		f, err := z.Create(name + ".npy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(data)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// npyFile builds a version 1.0 .npy file with the given header and data.
+func npyFile(header string, data string) []byte {
+	b := []byte("\x93NUMPY\x01\x00")
+	b = append(b, byte(len(header)), byte(len(header)>>8))
+	return append(append(b, header...), data...)
+}
+
+func TestToNPZ(t *testing.T) {
+	m := getTestMLPX1()
+
+	data, err := m.ToNPZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, f := range z.File {
+		names = append(names, f.Name)
+	}
+	expect := []string{"0/alpha.npy", "0/hidden0/weights.npy", "0/output/outputs.npy"}
+	if !cmp.Equal(names, expect) {
+		t.Fatalf("archive contains %v, expected %v", names, expect)
+	}
+
+	rc, err := z.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := decodeNPY(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(a.shape, []int{2, 2}) || !cmp.Equal(a.data, []float64{1.5, 2.5, 3.5, 4}) {
+		t.Errorf("weights are %v %v", a.shape, a.data)
+	}
+
+	m.Snapshots["0"].Layers["hidden0"].Weights = &[]float64{1, 2, 3}
+	if _, err := m.ToNPZ(); err == nil {
+		t.Errorf("wrong number of weights should have errored")
+	}
+}
+
+func TestImportNPZ(t *testing.T) {
+	m := getTestMLPX1()
+
+	data, err := m.ToNPZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.ImportNPZ(data, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "1" {
+		t.Errorf("imported snapshot is '%s'", id)
+	}
+
+	for layerid, layer := range m.Snapshots["0"].Layers {
+		diff := layer.Diff(m.Snapshots["1"].Layers[layerid], "\t", 0)
+		if len(diff) > 0 {
+			t.Errorf("imported layer '%s' differs: %v", layerid, diff)
+		}
+	}
+
+	err = m.Validate()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// weights saved by NumPy as a transposed array are in Fortran order,
+	// and biases may be of any numeric type
+	weights := npyFile("{'descr': '<i4', 'fortran_order': True, 'shape': (2, 2), }\n",
+		"\x01\x00\x00\x00\x03\x00\x00\x00\x02\x00\x00\x00\x04\x00\x00\x00")
+	biases := npyFile("{'descr': '<f4', 'fortran_order': False, 'shape': (2,), }\n",
+		"\x00\x00\xc0\x3f\x00\x00\x00\x40")
+	archive := npzArchive(t, map[string][]byte{
+		"trained/hidden0/weights": weights,
+		"trained/hidden0/biases":  biases,
+	})
+
+	_, err = m.ImportNPZ(archive, "python", "trained")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := m.Snapshots["python"].Layers["hidden0"]
+	if !cmp.Equal(*layer.Weights, []float64{1, 2, 3, 4}) || !cmp.Equal(*layer.Biases, []float64{1.5, 2}) {
+		t.Errorf("imported weights %v and biases %v", *layer.Weights, *layer.Biases)
+	}
+	if m.Snapshots["python"].Alpha != 0.1 {
+		t.Errorf("imported alpha is %f", m.Snapshots["python"].Alpha)
+	}
+
+	cases := []struct {
+		archive []byte
+		from    string
+	}{
+		{[]byte("not a zip file"), ""},
+		{archive, "missing"},
+		{npzArchive(t, map[string][]byte{"a/alpha": data[:0], "b/alpha": data[:0]}), ""},
+		{npzArchive(t, map[string][]byte{"x/hidden1/weights": weights}), ""},
+		{npzArchive(t, map[string][]byte{"x/hidden0/gradients": weights}), ""},
+		{npzArchive(t, map[string][]byte{"x/output/outputs": weights}), ""},
+		{npzArchive(t, map[string][]byte{"x/alpha": biases}), ""},
+	}
+
+	for i, c := range cases {
+		before := len(m.Snapshots)
+		if _, err := m.ImportNPZ(c.archive, "", c.from); err == nil {
+			t.Errorf("Test case %d should have errored", i)
+		}
+		if len(m.Snapshots) != before {
+			t.Errorf("Test case %d left a snapshot behind", i)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/herclab/tnx/go/tnx"
+	"github.com/herclab/tnx/go/tnx/schema"
+)
+
+// readTNX loads a TNX file, using '-' to mean standard input.
+func readTNX(path string) (*schema.TNX, error) {
+	if path == "-" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return schema.FromJSON(data)
+	}
+
+	return schema.ReadJSON(path)
+}
+
+// writeOutput writes data to the given path, using '-' to mean standard
+// output.
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+var CLI struct {
+	HLS struct {
+		Input               string   `arg:"" name:"input" default:"-" help:"Input TNX file, or '-' for standard input."`
+		Output              string   `name:"output" short:"o" default:"-" help:"Output C++ file, or '-' for standard output."`
+		Snapshot            string   `name:"snapshot" short:"s" help:"TNX file to take weights and biases from, rather than the input file."`
+		Top                 string   `name:"top" short:"t" default:"tnx_top" help:"Name of the generated top-level function."`
+		DataType            string   `name:"type" short:"T" default:"float" help:"C++ type used for all values."`
+		Optimize            bool     `name:"optimize" short:"O" help:"Run the default optimization passes on the graph before generating code."`
+		AllowMissingWeights bool     `name:"allow-missing-weights" help:"Fill weights and biases which are not defined with zeros, rather than failing."`
+		NoDefaultPragmas    bool     `name:"no-default-pragmas" help:"Do not emit any of the default pragmas."`
+		TopPragmas          []string `name:"top-pragma" help:"Additional pragma for the top-level function."`
+		PortPragmas         []string `name:"port-pragma" help:"Additional pragma for each top-level port, {port} is replaced with the port name."`
+		FunctionPragmas     []string `name:"function-pragma" help:"Additional pragma for each node function."`
+		LoopPragmas         []string `name:"loop-pragma" help:"Additional pragma for the outermost loop of each node function."`
+		ArrayPragmas        []string `name:"array-pragma" help:"Additional pragma for each weight or bias array, {array} is replaced with the array name."`
+	} `cmd:"" name:"hls" help:"Generate Vitis-HLS-style C++ from a TNX file."`
+
+	Diff struct {
+		Base       string  `arg:"" required:"" type:"path" help:"Path to a TNX file which is used as the baseline for the comparison."`
+		Other      string  `arg:"" required:"" type:"path" help:"Path to a TNX file which will be compared to the baseline."`
+		Indent     string  `name:"indent" default:"\t" short:"I" help:"Specify the indent that should be used to show hierarchy."`
+		Epsilon    float64 `name:"epsilon" short:"e" default:"0.00001" help:"Epsilon value to use when comparing floating point numbers."`
+		Isomorphic bool    `name:"isomorphic" short:"r" help:"Match nodes by the structure of the graph rather than by ID, so graphs whose IDs were renamed can be compared."`
+	} `cmd:"" name:"diff" help:"Compare two TNX files."`
+
+	Version bool `name:"version" short:"V" default:"false" help:"Display version and exit"`
+}
+
+func main() {
+	ctx := kong.Parse(&CLI)
+
+	if CLI.Version {
+		fmt.Printf("tnx v0.0.1-git\n")
+		os.Exit(0)
+	}
+
+	switch ctx.Command() {
+	case "hls", "hls <input>":
+		t, err := readTNX(CLI.HLS.Input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		opts := tnx.DefaultHLSOptions()
+		opts.Top = CLI.HLS.Top
+		opts.DataType = CLI.HLS.DataType
+		opts.AllowMissingWeights = CLI.HLS.AllowMissingWeights
+
+		if CLI.HLS.NoDefaultPragmas {
+			opts.Pragmas = tnx.HLSPragmas{}
+		}
+		opts.Pragmas.Top = append(opts.Pragmas.Top, CLI.HLS.TopPragmas...)
+		opts.Pragmas.Port = append(opts.Pragmas.Port, CLI.HLS.PortPragmas...)
+		opts.Pragmas.Function = append(opts.Pragmas.Function, CLI.HLS.FunctionPragmas...)
+		opts.Pragmas.Loop = append(opts.Pragmas.Loop, CLI.HLS.LoopPragmas...)
+		opts.Pragmas.Array = append(opts.Pragmas.Array, CLI.HLS.ArrayPragmas...)
+
+		if CLI.HLS.Snapshot != "" {
+			opts.Snapshot, err = schema.ReadJSON(CLI.HLS.Snapshot)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read snapshot file '%s': %v\n", CLI.HLS.Snapshot, err)
+				os.Exit(1)
+			}
+
+			err = schema.ValidateSchema(opts.Snapshot.Schema)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Snapshot file '%s' is invalid: %v\n", CLI.HLS.Snapshot, err)
+				os.Exit(1)
+			}
+		}
+
+		if CLI.HLS.Optimize {
+			err = tnx.Optimize(t)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to optimize graph: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		code, err := tnx.GenerateHLS(t, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate HLS code: %v\n", err)
+			os.Exit(1)
+		}
+
+		err = writeOutput(CLI.HLS.Output, []byte(code))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "diff <base> <other>":
+		base, err := readTNX(CLI.Diff.Base)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read TNX file '%s': %v\n", CLI.Diff.Base, err)
+			os.Exit(1)
+		}
+
+		other, err := readTNX(CLI.Diff.Other)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read TNX file '%s': %v\n", CLI.Diff.Other, err)
+			os.Exit(1)
+		}
+
+		expanded, err := strconv.Unquote(fmt.Sprintf("\"%s\"", CLI.Diff.Indent))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to expand indent: '%s': %v\n", CLI.Diff.Indent, err)
+			os.Exit(1)
+		}
+
+		var diffs []string
+		if CLI.Diff.Isomorphic {
+			diffs, err = tnx.IsomorphicDiff(base, other, expanded, CLI.Diff.Epsilon)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to match graphs: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			diffs = tnx.Diff(base, other, expanded, CLI.Diff.Epsilon)
+		}
+
+		for _, d := range diffs {
+			fmt.Println(d)
+		}
+
+		// as with diff(1), the exit code is 1 if there are any
+		// differences, since a count would wrap modulo 256
+		if len(diffs) > 0 {
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Don't understand how to parse that command.\n")
+		panic(ctx.Command())
+	}
+}
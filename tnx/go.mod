@@ -3,7 +3,9 @@ module github.com/herclab/tnx
 go 1.13
 
 require (
+	github.com/alecthomas/kong v0.2.11
 	github.com/google/go-cmp v0.5.0
 	github.com/kr/pretty v0.2.0
 	github.com/ryboe/q v1.0.11
+	gonum.org/v1/gonum v0.8.2
 )
@@ -0,0 +1,706 @@
+package tnx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/herclab/tnx/go/tnx/schema"
+)
+
+// This file implements comparison of TNX graphs, in the same style as the
+// diff routines of the MLPX library.
+//
+// Diff() matches nodes, links, parameters and snapshots between the two
+// graphs by their IDs. IsomorphicDiff() first searches for a renaming of the
+// other graph's IDs which makes its topology identical to the base graph, and
+// then compares them as Diff() does. This is useful for comparing graphs
+// which were exported by different tools, which may have chosen different
+// IDs for the same network.
+
+// diffList compares two lists of floating point values, reporting how many
+// differ by more than epsilon, and by how much on average. The header will
+// only be shown if there is a difference.
+func diffList(base, other []float64, indent string, epsilon float64, header string) []string {
+	if len(base) != len(other) {
+		return []string{header,
+			fmt.Sprintf("%sLists are of different lengths: base %d, other %d", indent, len(base), len(other))}
+	}
+
+	ndiff := 0
+	averagediff := 0.0
+	for i, v := range base {
+		diff := math.Abs(v - other[i])
+		if diff > epsilon {
+			ndiff++
+			averagediff += diff
+		}
+	}
+
+	if ndiff > 0 {
+		averagediff = averagediff / float64(ndiff)
+		return []string{header,
+			fmt.Sprintf("%s%d values differ, with an average difference of %f", indent, ndiff, averagediff)}
+	}
+
+	return []string{}
+}
+
+// diffOptionalList is a wrapper around diffList for lists which may be nil.
+func diffOptionalList(base, other *[]float64, indent string, epsilon float64, header string) []string {
+	if base != nil && other == nil {
+		return []string{header, fmt.Sprintf("%sOther list is nil, base is non-nil", indent)}
+	}
+
+	if base == nil && other != nil {
+		return []string{header, fmt.Sprintf("%sBase list is nil, other is non-nil", indent)}
+	}
+
+	if base == nil && other == nil {
+		return []string{}
+	}
+
+	return diffList(*base, *other, indent, epsilon, header)
+}
+
+// sortedIDs returns the keys of the given set in sorted order.
+func sortedIDs(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// compareKeys reports which keys are only present in one of base or other,
+// and returns the sorted list of keys present in both.
+func compareKeys(base, other map[string]bool, what string) ([]string, []string) {
+	diffs := []string{}
+	common := []string{}
+
+	for _, k := range sortedIDs(base) {
+		if other[k] {
+			common = append(common, k)
+		} else {
+			diffs = append(diffs, fmt.Sprintf("base TNX has %s '%s', but other TNX does not", what, k))
+		}
+	}
+
+	for _, k := range sortedIDs(other) {
+		if !base[k] {
+			diffs = append(diffs, fmt.Sprintf("other TNX has %s '%s', but base TNX does not", what, k))
+		}
+	}
+
+	return diffs, common
+}
+
+// indentDiffs prefixes each difference with indent, and then prepends the
+// header, unless there are no differences.
+func indentDiffs(diffs []string, indent, header string) []string {
+	if len(diffs) == 0 {
+		return diffs
+	}
+
+	for i, v := range diffs {
+		diffs[i] = fmt.Sprintf("%s%s", indent, v)
+	}
+
+	return append([]string{header}, diffs...)
+}
+
+func optionalString(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("'%s'", *s)
+}
+
+func optionalInt(i *int) string {
+	if i == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%d", *i)
+}
+
+func optionalInts(l *[]int) string {
+	if l == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%v", *l)
+}
+
+// diffNodes compares the node definitions in the topology of the given graphs.
+func diffNodes(base, other *schema.TNX, indent string) []string {
+	baseIDs := make(map[string]bool)
+	for _, n := range base.Topology.Nodes {
+		baseIDs[n.ID] = true
+	}
+	otherIDs := make(map[string]bool)
+	for _, n := range other.Topology.Nodes {
+		otherIDs[n.ID] = true
+	}
+
+	diffs, common := compareKeys(baseIDs, otherIDs, "node")
+
+	for _, id := range common {
+		b, _ := base.LookupNodeByID(id)
+		o, _ := other.LookupNodeByID(id)
+
+		nodeDiffs := []string{}
+		if b.Operation != o.Operation {
+			nodeDiffs = append(nodeDiffs,
+				fmt.Sprintf("Operations do not match: base '%s', other '%s'", b.Operation, o.Operation))
+		}
+
+		if strings.Join(b.Inputs, "\x00") != strings.Join(o.Inputs, "\x00") {
+			nodeDiffs = append(nodeDiffs,
+				fmt.Sprintf("Inputs do not match: base %v, other %v", b.Inputs, o.Inputs))
+		}
+
+		if strings.Join(b.Outputs, "\x00") != strings.Join(o.Outputs, "\x00") {
+			nodeDiffs = append(nodeDiffs,
+				fmt.Sprintf("Outputs do not match: base %v, other %v", b.Outputs, o.Outputs))
+		}
+
+		diffs = append(diffs, indentDiffs(nodeDiffs, indent, fmt.Sprintf("Node ID '%s' differs", id))...)
+	}
+
+	return diffs
+}
+
+// diffLinks compares the links in the topology of the given graphs. A target
+// which is fed by different sources in each graph is reported as having been
+// re-wired, rather than as an added and removed link.
+func diffLinks(base, other *schema.TNX) []string {
+	baseSources := linkSources(base)
+	otherSources := linkSources(other)
+	for _, s := range baseSources {
+		sort.Strings(s)
+	}
+	for _, s := range otherSources {
+		sort.Strings(s)
+	}
+
+	targets := make(map[string]bool)
+	for k := range baseSources {
+		targets[k] = true
+	}
+	for k := range otherSources {
+		targets[k] = true
+	}
+
+	diffs := []string{}
+	for _, target := range sortedIDs(targets) {
+		b, o := baseSources[target], otherSources[target]
+		switch {
+		case len(o) == 0:
+			for _, s := range b {
+				diffs = append(diffs,
+					fmt.Sprintf("base TNX has link '%s' -> '%s', but other TNX does not", s, target))
+			}
+		case len(b) == 0:
+			for _, s := range o {
+				diffs = append(diffs,
+					fmt.Sprintf("other TNX has link '%s' -> '%s', but base TNX does not", s, target))
+			}
+		case strings.Join(b, "\x00") != strings.Join(o, "\x00"):
+			diffs = append(diffs,
+				fmt.Sprintf("Link target '%s' is re-wired: base sources %v, other sources %v", target, b, o))
+		}
+	}
+
+	return diffs
+}
+
+// diffParameter compares the parametrizations of a single node.
+func diffParameter(base, other *schema.Parameter, indent string, epsilon float64) []string {
+	if base == nil {
+		base = &schema.Parameter{}
+	}
+	if other == nil {
+		other = &schema.Parameter{}
+	}
+
+	diffs := []string{}
+
+	if optionalInts(base.Dimensions) != optionalInts(other.Dimensions) {
+		diffs = append(diffs, fmt.Sprintf("Dimensions do not match: base %s, other %s",
+			optionalInts(base.Dimensions), optionalInts(other.Dimensions)))
+	}
+
+	if optionalInt(base.Neurons) != optionalInt(other.Neurons) {
+		diffs = append(diffs, fmt.Sprintf("Neurons do not match: base %s, other %s",
+			optionalInt(base.Neurons), optionalInt(other.Neurons)))
+	}
+
+	if optionalInt(base.Axis) != optionalInt(other.Axis) {
+		diffs = append(diffs, fmt.Sprintf("Axes do not match: base %s, other %s",
+			optionalInt(base.Axis), optionalInt(other.Axis)))
+	}
+
+	if optionalString(base.Activation) != optionalString(other.Activation) {
+		diffs = append(diffs, fmt.Sprintf("Activations do not match: base %s, other %s",
+			optionalString(base.Activation), optionalString(other.Activation)))
+	}
+
+	diffs = append(diffs, diffOptionalList(base.Weights, other.Weights, indent, epsilon, "Weight lists do not match")...)
+	diffs = append(diffs, diffOptionalList(base.Biases, other.Biases, indent, epsilon, "Bias lists do not match")...)
+	diffs = append(diffs, diffOptionalList(base.Deltas, other.Deltas, indent, epsilon, "Delta lists do not match")...)
+
+	return diffs
+}
+
+// diffParameters compares the parameters tables of the given graphs.
+func diffParameters(base, other *schema.TNX, indent string, epsilon float64) []string {
+	baseIDs := make(map[string]bool)
+	for k := range base.Parameters {
+		baseIDs[k] = true
+	}
+	otherIDs := make(map[string]bool)
+	for k := range other.Parameters {
+		otherIDs[k] = true
+	}
+
+	diffs, common := compareKeys(baseIDs, otherIDs, "parameters for")
+
+	for _, id := range common {
+		paramDiffs := diffParameter(base.Parameters[id], other.Parameters[id], indent, epsilon)
+		diffs = append(diffs, indentDiffs(paramDiffs, indent, fmt.Sprintf("Parameters for '%s' differ", id))...)
+	}
+
+	return diffs
+}
+
+// diffSnapshot compares the matrices of a single snapshot.
+func diffSnapshot(base, other *schema.Snapshot, indent string, epsilon float64) []string {
+	baseNames := make(map[string]bool)
+	if base != nil {
+		for k, m := range base.Matrix {
+			if m != nil {
+				baseNames[k] = true
+			}
+		}
+	}
+	otherNames := make(map[string]bool)
+	if other != nil {
+		for k, m := range other.Matrix {
+			if m != nil {
+				otherNames[k] = true
+			}
+		}
+	}
+
+	diffs, common := compareKeys(baseNames, otherNames, "matrix")
+
+	for _, name := range common {
+		b, o := base.Matrix[name], other.Matrix[name]
+		header := fmt.Sprintf("Matrix '%s' differs", name)
+
+		if fmt.Sprintf("%v", b.Dimensions) != fmt.Sprintf("%v", o.Dimensions) {
+			diffs = append(diffs, header,
+				fmt.Sprintf("%sDimensions do not match: base %v, other %v", indent, b.Dimensions, o.Dimensions))
+			continue
+		}
+
+		diffs = append(diffs, diffList(b.Data, o.Data, indent, epsilon, header)...)
+	}
+
+	return diffs
+}
+
+// diffSnapshots compares the snapshots tables of the given graphs.
+func diffSnapshots(base, other *schema.TNX, indent string, epsilon float64) []string {
+	baseIDs := make(map[string]bool)
+	for k := range base.Snapshots {
+		baseIDs[k] = true
+	}
+	otherIDs := make(map[string]bool)
+	for k := range other.Snapshots {
+		otherIDs[k] = true
+	}
+
+	diffs, common := compareKeys(baseIDs, otherIDs, "snapshot for")
+
+	for _, id := range common {
+		snapDiffs := diffSnapshot(base.Snapshots[id], other.Snapshots[id], indent, epsilon)
+		diffs = append(diffs, indentDiffs(snapDiffs, indent, fmt.Sprintf("Snapshot for '%s' differs", id))...)
+	}
+
+	return diffs
+}
+
+// Diff returns a list of human-readable differences between the base and
+// other graphs. If the list is empty, then the graphs are equivalent.
+//
+// Nodes, links, parameters and snapshots are matched between the graphs by
+// their IDs. See IsomorphicDiff() for comparing graphs whose IDs differ.
+//
+// The indent parameter will be used to indent any hierarchical data, if
+// applicable. The suggested value is "\t".
+//
+// The epsilon parameter defines the maximum difference of two floating point
+// numbers before this algorithm considers them to be different. This should
+// usually be a very small number.
+func Diff(base, other *schema.TNX, indent string, epsilon float64) []string {
+	diffs := []string{}
+
+	if strings.Join(base.Schema, " ") != strings.Join(other.Schema, " ") {
+		diffs = append(diffs, fmt.Sprintf("Schemas do not match: base %v, other %v", base.Schema, other.Schema))
+	}
+
+	diffs = append(diffs, diffNodes(base, other, indent)...)
+	diffs = append(diffs, diffLinks(base, other)...)
+	diffs = append(diffs, diffParameters(base, other, indent, epsilon)...)
+	diffs = append(diffs, diffSnapshots(base, other, indent, epsilon)...)
+
+	return diffs
+}
+
+// IsomorphicDiff is like Diff(), but first renames the IDs of other to match
+// base, as determined by MatchIsomorphic(). Differences are reported in terms
+// of the base graph's IDs. An error is returned if the topologies of the two
+// graphs are not isomorphic.
+func IsomorphicDiff(base, other *schema.TNX, indent string, epsilon float64) ([]string, error) {
+	mapping, err := MatchIsomorphic(base, other)
+	if err != nil {
+		return nil, err
+	}
+
+	return Diff(base, Rename(other, mapping), indent, epsilon), nil
+}
+
+// Rename returns a copy of the given graph where every node, input and output
+// ID which appears as a key in mapping is replaced with the corresponding
+// value, including in the links, parameters and snapshots tables, and in
+// activation references. The topology, parameters and snapshots tables are
+// copied, but the parameters and matrices themselves are shared with the
+// original, except where an activation reference is renamed.
+func Rename(t *schema.TNX, mapping map[string]string) *schema.TNX {
+	rename := func(id string) string {
+		if r, ok := mapping[id]; ok {
+			return r
+		}
+		return id
+	}
+
+	renameAll := func(ids []string) []string {
+		if ids == nil {
+			return nil
+		}
+		r := make([]string, len(ids))
+		for i, id := range ids {
+			r[i] = rename(id)
+		}
+		return r
+	}
+
+	result := &schema.TNX{
+		Schema:     append([]string{}, t.Schema...),
+		Parameters: make(map[string]*schema.Parameter),
+		Snapshots:  make(map[string]*schema.Snapshot),
+	}
+
+	for _, n := range t.Topology.Nodes {
+		result.Topology.Nodes = append(result.Topology.Nodes, schema.Node{
+			ID:        rename(n.ID),
+			Operation: n.Operation,
+			Inputs:    renameAll(n.Inputs),
+			Outputs:   renameAll(n.Outputs),
+		})
+	}
+
+	for _, l := range t.Topology.Links {
+		result.Topology.Links = append(result.Topology.Links, schema.Link{
+			Source: rename(l.Source),
+			Target: rename(l.Target),
+		})
+	}
+
+	for id, p := range t.Parameters {
+		if p != nil && p.Activation != nil {
+			copied := *p
+			activation := rename(*p.Activation)
+			copied.Activation = &activation
+			p = &copied
+		}
+		result.Parameters[rename(id)] = p
+	}
+
+	for id, s := range t.Snapshots {
+		result.Snapshots[rename(id)] = s
+	}
+
+	return result
+}
+
+// isoGraph is an index-based representation of a TNX topology which is used
+// for finding isomorphisms.
+type isoGraph struct {
+	t     *schema.TNX
+	nodes []*schema.Node
+
+	// edges contains a key for each link, see isoEdge
+	edges map[string]bool
+
+	// adjacent lists, for each node, the indices of each node it shares a
+	// link with, in either direction
+	adjacent [][]int
+
+	// colors is the current refined label of each node
+	colors []string
+}
+
+// isoEdge returns the key used to represent a link from output o of node u
+// to input i of node v.
+func isoEdge(u, o, v, i int) string {
+	return fmt.Sprintf("%d:%d:%d:%d", u, o, v, i)
+}
+
+// isoSignature describes the properties of a node which must be identical in
+// an isomorphic graph, not including its links.
+func isoSignature(t *schema.TNX, n *schema.Node) string {
+	sig := fmt.Sprintf("%s|%d|%d", n.Operation, len(n.Inputs), len(n.Outputs))
+	if p, ok := t.Parameters[n.ID]; ok && p != nil {
+		sig += fmt.Sprintf("|%s|%s|%s|%v",
+			optionalInts(p.Dimensions), optionalInt(p.Neurons), optionalInt(p.Axis), p.Activation != nil)
+	}
+	return sig
+}
+
+func newIsoGraph(t *schema.TNX) (*isoGraph, error) {
+	g := &isoGraph{
+		t:     t,
+		edges: make(map[string]bool),
+	}
+
+	type port struct{ node, index int }
+	outputs := make(map[string]port)
+	inputs := make(map[string]port)
+	for i := range t.Topology.Nodes {
+		n := &t.Topology.Nodes[i]
+		g.nodes = append(g.nodes, n)
+		g.colors = append(g.colors, isoSignature(t, n))
+		for j, id := range n.Inputs {
+			inputs[id] = port{i, j}
+		}
+		for j, id := range n.Outputs {
+			outputs[id] = port{i, j}
+		}
+	}
+
+	g.adjacent = make([][]int, len(g.nodes))
+	for _, l := range t.Topology.Links {
+		src, ok := outputs[l.Source]
+		if !ok {
+			return nil, fmt.Errorf("Link source '%s' is not an output", l.Source)
+		}
+		dst, ok := inputs[l.Target]
+		if !ok {
+			return nil, fmt.Errorf("Link target '%s' is not an input", l.Target)
+		}
+
+		key := isoEdge(src.node, src.index, dst.node, dst.index)
+		if g.edges[key] {
+			return nil, fmt.Errorf("Link '%s' -> '%s' is duplicated", l.Source, l.Target)
+		}
+		g.edges[key] = true
+		g.adjacent[src.node] = append(g.adjacent[src.node], dst.node)
+		g.adjacent[dst.node] = append(g.adjacent[dst.node], src.node)
+	}
+
+	return g, nil
+}
+
+// refine computes a new label for each node from its current label and the
+// labels of its neighbors, along with which ports connect them.
+func (g *isoGraph) refine() []string {
+	neighbors := make([][]string, len(g.nodes))
+	for key := range g.edges {
+		var u, o, v, i int
+		fmt.Sscanf(key, "%d:%d:%d:%d", &u, &o, &v, &i)
+		neighbors[u] = append(neighbors[u], fmt.Sprintf("out%d>%d:%s", o, i, g.colors[v]))
+		neighbors[v] = append(neighbors[v], fmt.Sprintf("in%d<%d:%s", i, o, g.colors[u]))
+	}
+
+	colors := make([]string, len(g.nodes))
+	for n := range g.nodes {
+		sort.Strings(neighbors[n])
+		colors[n] = fmt.Sprintf("%s(%s)", g.colors[n], strings.Join(neighbors[n], ","))
+	}
+	return colors
+}
+
+// compress replaces the labels in both graphs with short canonical names, so
+// that they remain comparable between graphs without growing on each round.
+// It returns the number of distinct labels.
+func compress(a, b []string) int {
+	names := make(map[string]string)
+	all := append(append([]string{}, a...), b...)
+	sort.Strings(all)
+	for _, c := range all {
+		if _, ok := names[c]; !ok {
+			names[c] = fmt.Sprintf("c%d", len(names))
+		}
+	}
+
+	for i := range a {
+		a[i] = names[a[i]]
+	}
+	for i := range b {
+		b[i] = names[b[i]]
+	}
+
+	return len(names)
+}
+
+// MatchIsomorphic searches for a mapping from the IDs of other to the IDs of
+// base which, when applied with Rename(), makes the topologies of the two
+// graphs identical. Two nodes are only matched if they have the same
+// operation, number of inputs and outputs, dimensions, neurons and axis
+// parameters, and inputs and outputs are matched by their position in the
+// node's input or output list. Where more than one mapping is possible, nodes
+// which already share an ID are preferred.
+//
+// The mapping includes every node, input and output ID of other. An error is
+// returned if no such mapping exists.
+func MatchIsomorphic(base, other *schema.TNX) (map[string]string, error) {
+	b, err := newIsoGraph(base)
+	if err != nil {
+		return nil, fmt.Errorf("Base graph: %v", err)
+	}
+
+	o, err := newIsoGraph(other)
+	if err != nil {
+		return nil, fmt.Errorf("Other graph: %v", err)
+	}
+
+	if len(b.nodes) != len(o.nodes) {
+		return nil, fmt.Errorf("Graphs are not isomorphic: base has %d nodes, other has %d", len(b.nodes), len(o.nodes))
+	}
+
+	if len(b.edges) != len(o.edges) {
+		return nil, fmt.Errorf("Graphs are not isomorphic: base has %d links, other has %d", len(b.edges), len(o.edges))
+	}
+
+	// Refine the node labels until they stop distinguishing any more
+	// nodes, so that the search only needs to consider candidates with
+	// identical labels.
+	classes := compress(b.colors, o.colors)
+	for range b.nodes {
+		bc, oc := b.refine(), o.refine()
+		n := compress(bc, oc)
+		b.colors, o.colors = bc, oc
+		if n == classes {
+			break
+		}
+		classes = n
+	}
+
+	// search for a matching using backtracking, visiting nodes in an
+	// order where each node is adjacent to an earlier one if possible,
+	// so that inconsistent choices are rejected early
+	order := []int{}
+	visited := make([]bool, len(b.nodes))
+	for start := range b.nodes {
+		if visited[start] {
+			continue
+		}
+		visited[start] = true
+		queue := []int{start}
+		for len(queue) > 0 {
+			u := queue[0]
+			queue = queue[1:]
+			order = append(order, u)
+			for _, v := range b.adjacent[u] {
+				if !visited[v] {
+					visited[v] = true
+					queue = append(queue, v)
+				}
+			}
+		}
+	}
+
+	// the edges of each base node, so consistency can be checked
+	type edge struct{ u, o, v, i int }
+	incident := make([][]edge, len(b.nodes))
+	for key := range b.edges {
+		var e edge
+		fmt.Sscanf(key, "%d:%d:%d:%d", &e.u, &e.o, &e.v, &e.i)
+		incident[e.u] = append(incident[e.u], e)
+		if e.v != e.u {
+			incident[e.v] = append(incident[e.v], e)
+		}
+	}
+
+	match := make([]int, len(b.nodes))
+	for i := range match {
+		match[i] = -1
+	}
+	used := make([]bool, len(o.nodes))
+
+	var search func(depth int) bool
+	search = func(depth int) bool {
+		if depth == len(order) {
+			return true
+		}
+		u := order[depth]
+
+		candidates := []int{}
+		for v := range o.nodes {
+			if used[v] || o.colors[v] != b.colors[u] {
+				continue
+			}
+			if o.nodes[v].ID == b.nodes[u].ID {
+				candidates = append([]int{v}, candidates...)
+			} else {
+				candidates = append(candidates, v)
+			}
+		}
+
+		for _, v := range candidates {
+			match[u] = v
+			consistent := true
+			for _, e := range incident[u] {
+				if match[e.u] < 0 || match[e.v] < 0 {
+					continue
+				}
+				if !o.edges[isoEdge(match[e.u], e.o, match[e.v], e.i)] {
+					consistent = false
+					break
+				}
+			}
+
+			if consistent {
+				used[v] = true
+				if search(depth + 1) {
+					return true
+				}
+				used[v] = false
+			}
+			match[u] = -1
+		}
+
+		return false
+	}
+
+	if !search(0) {
+		return nil, fmt.Errorf("Graphs are not isomorphic")
+	}
+
+	mapping := make(map[string]string)
+	for u, v := range match {
+		bn, on := b.nodes[u], o.nodes[v]
+		mapping[on.ID] = bn.ID
+		for i := range on.Inputs {
+			mapping[on.Inputs[i]] = bn.Inputs[i]
+		}
+		for i := range on.Outputs {
+			mapping[on.Outputs[i]] = bn.Outputs[i]
+		}
+	}
+
+	return mapping, nil
+}
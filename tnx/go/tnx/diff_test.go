@@ -0,0 +1,200 @@
+package tnx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/herclab/tnx/go/tnx/schema"
+)
+
+func loadHLSTestGraph(t *testing.T) *schema.TNX {
+	g, err := schema.FromJSON([]byte(hlsTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// renamedHLSTestGraph is hlsTestGraph with every ID changed, and with the
+// nodes listed in a different order.
+func renamedHLSTestGraph(t *testing.T) *schema.TNX {
+	r := strings.NewReplacer(
+		`"in"`, `"source"`,
+		`"in->`, `"source->`,
+		`"h1`, `"dense_0`,
+		`"a1`, `"relu_0`,
+		`"h2`, `"dense_1`,
+		`"a2`, `"sigmoid_0`,
+		`"out"`, `"sink"`,
+		`"out<-`, `"sink<-`,
+	)
+
+	g, err := schema.FromJSON([]byte(r.Replace(hlsTestGraph)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, j := 0, len(g.Topology.Nodes)-1; i < j; i, j = i+1, j-1 {
+		g.Topology.Nodes[i], g.Topology.Nodes[j] = g.Topology.Nodes[j], g.Topology.Nodes[i]
+	}
+	g.InvalidateLookupCaches()
+
+	return g
+}
+
+func TestDiff(t *testing.T) {
+	base := loadHLSTestGraph(t)
+
+	diffs := Diff(base, loadHLSTestGraph(t), "\t", 0.0001)
+	if len(diffs) != 0 {
+		t.Errorf("identical graphs should not differ: %v", diffs)
+	}
+
+	cases := []struct {
+		name   string
+		modify func(*schema.TNX)
+		expect []string
+	}{
+		{"changed operation", func(g *schema.TNX) {
+			g.Topology.Nodes[2].Operation = "tanh"
+		}, []string{"Node ID 'a1' differs", "\tOperations do not match: base 'relu', other 'tanh'"}},
+
+		{"changed weight", func(g *schema.TNX) {
+			g.Snapshots["h1"].Matrix["weights"].Data[0] = 0.6
+		}, []string{"Snapshot for 'h1' differs", "\tMatrix 'weights' differs", "\t\t1 values differ, with an average difference of 0.100000"}},
+
+		{"changed weight within epsilon", func(g *schema.TNX) {
+			g.Snapshots["h1"].Matrix["weights"].Data[0] = 0.50001
+		}, []string{}},
+
+		{"changed neurons", func(g *schema.TNX) {
+			n := 3
+			g.Parameters["h2"].Neurons = &n
+		}, []string{"Parameters for 'h2' differ", "\tNeurons do not match: base 2, other 3"}},
+
+		{"removed snapshot matrix", func(g *schema.TNX) {
+			delete(g.Snapshots["h2"].Matrix, "biases")
+		}, []string{"Snapshot for 'h2' differs", "\tbase TNX has matrix 'biases', but other TNX does not"}},
+
+		{"re-wired link", func(g *schema.TNX) {
+			g.Topology.Links[2].Source = "h1->o"
+		}, []string{"Link target 'h2<-i' is re-wired: base sources [a1->o], other sources [h1->o]"}},
+
+		{"removed node", func(g *schema.TNX) {
+			g.RemoveNode("a2")
+		}, []string{
+			"base TNX has node 'a2', but other TNX does not",
+			"base TNX has link 'h2->o' -> 'a2<-i', but other TNX does not",
+			"base TNX has link 'a2->o' -> 'out<-i', but other TNX does not",
+			"base TNX has parameters for 'a2', but other TNX does not",
+			"Parameters for 'h2' differ",
+			"\tActivations do not match: base 'a2', other <nil>",
+		}},
+	}
+
+	for _, c := range cases {
+		other := loadHLSTestGraph(t)
+		c.modify(other)
+		other.InvalidateLookupCaches()
+
+		diffs := Diff(base, other, "\t", 0.0001)
+		if strings.Join(diffs, "\n") != strings.Join(c.expect, "\n") {
+			t.Errorf("Test case '%s': diffs were\n%s\nexpected\n%s",
+				c.name, strings.Join(diffs, "\n"), strings.Join(c.expect, "\n"))
+		}
+	}
+}
+
+func TestIsomorphicDiff(t *testing.T) {
+	base := loadHLSTestGraph(t)
+	other := renamedHLSTestGraph(t)
+
+	if len(Diff(base, other, "\t", 0.0001)) == 0 {
+		t.Errorf("renamed graphs should differ when matched by ID")
+	}
+
+	mapping, err := MatchIsomorphic(base, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for from, to := range map[string]string{"dense_0": "h1", "sigmoid_0->o": "a2->o", "sink<-i": "out<-i"} {
+		if mapping[from] != to {
+			t.Errorf("'%s' was mapped to '%s', expected '%s'", from, mapping[from], to)
+		}
+	}
+
+	diffs, err := IsomorphicDiff(base, other, "\t", 0.0001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("renamed graphs should not differ: %v", diffs)
+	}
+
+	// numeric differences are reported using the base IDs
+	other.Snapshots["dense_1"].Matrix["biases"].Data[1] = 1
+	diffs, err = IsomorphicDiff(base, other, "\t", 0.0001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) == 0 || diffs[0] != "Snapshot for 'h2' differs" {
+		t.Errorf("unexpected diffs %v", diffs)
+	}
+
+	// structurally different graphs cannot be matched
+	other = renamedHLSTestGraph(t)
+	other.Topology.Nodes[3].Operation = "sigmoid"
+	_, err = IsomorphicDiff(base, other, "\t", 0.0001)
+	if err == nil {
+		t.Errorf("graphs with different operations should not be isomorphic")
+	}
+
+	other = renamedHLSTestGraph(t)
+	other.Topology.Links[2].Source = "dense_0->o"
+	_, err = IsomorphicDiff(base, other, "\t", 0.0001)
+	if err == nil {
+		t.Errorf("re-wired graphs should not be isomorphic")
+	}
+}
+
+// TestMatchIsomorphicSymmetric ensures that nodes which are interchangeable
+// are matched by ID where possible.
+func TestMatchIsomorphicSymmetric(t *testing.T) {
+	g, err := schema.FromJSON([]byte(symmetricTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapping, err := MatchIsomorphic(g, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for from, to := range mapping {
+		if from != to {
+			t.Errorf("'%s' should map to itself, not '%s'", from, to)
+		}
+	}
+}
+
+// symmetricTestGraph has two identical branches from the same input, so
+// either branch could be matched to the other.
+const symmetricTestGraph = `
+{
+	"schema": ["tnx", "0"],
+	"topology": {
+		"nodes": [
+			{ "id": "in", "operation": "input", "outputs": ["in->o"] },
+			{ "id": "x", "operation": "relu", "inputs": ["x<-i"], "outputs": ["x->o"] },
+			{ "id": "y", "operation": "relu", "inputs": ["y<-i"], "outputs": ["y->o"] },
+			{ "id": "xout", "operation": "output", "inputs": ["xout<-i"] },
+			{ "id": "yout", "operation": "output", "inputs": ["yout<-i"] }
+		],
+		"links": [
+			{ "source": "in->o", "target": "x<-i" },
+			{ "source": "in->o", "target": "y<-i" },
+			{ "source": "x->o", "target": "xout<-i" },
+			{ "source": "y->o", "target": "yout<-i" }
+		]
+	}
+}
+`
@@ -0,0 +1,627 @@
+package tnx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/herclab/tnx/go/tnx/schema"
+	"github.com/herclab/tnx/go/tnx/tensor"
+)
+
+// This file implements generation of Vitis-HLS-style C++ from a TNX graph.
+//
+// Each node becomes a single function, and each link becomes an hls::stream
+// which connects the function for its source node to the function for its
+// target node. Every node function consumes exactly one sample (that is, one
+// full matrix) from each of its inputs per call, and produces one sample on
+// each of its outputs. The top-level function instantiates the streams and
+// calls each node function in topological order, such that it can be used as
+// a dataflow region.
+//
+// When not compiled by an HLS tool (that is, when __SYNTHESIS__ is not
+// defined), the generated code provides a minimal software implementation of
+// hls::stream, so it can be compiled and tested with an ordinary C++
+// compiler.
+
+// HLSPragmas describes the pragmas which are emitted into generated HLS code.
+// Each string is emitted as-is following "#pragma ". Pragmas may contain
+// the placeholders "{port}" and "{array}", which are replaced as described
+// for each field.
+type HLSPragmas struct {
+	// Top is emitted once at the start of the top-level function.
+	Top []string
+
+	// Port is emitted at the start of the top-level function once for
+	// each of its ports, with {port} replaced by the port name.
+	Port []string
+
+	// Function is emitted at the start of each node function.
+	Function []string
+
+	// Loop is emitted at the start of the body of the outermost loop of
+	// each node function.
+	Loop []string
+
+	// Array is emitted at the start of each node function once for each
+	// weight or bias array it uses, with {array} replaced by the array
+	// name.
+	Array []string
+}
+
+// DefaultHLSPragmas returns the pragmas which are used by the tnx(1) tool if
+// the user does not specify any.
+func DefaultHLSPragmas() HLSPragmas {
+	return HLSPragmas{
+		Top:      []string{"HLS DATAFLOW"},
+		Port:     []string{"HLS INTERFACE axis port={port}"},
+		Function: []string{"HLS INLINE off"},
+		Loop:     []string{"HLS PIPELINE II=1"},
+		Array:    []string{},
+	}
+}
+
+// HLSOptions is used to control GenerateHLS().
+type HLSOptions struct {
+	// Top is the name of the top-level function.
+	Top string
+
+	// DataType is the C++ type used for all values, for example "float"
+	// or "ap_fixed<16,6>". If a non-builtin type is used, the user is
+	// responsible for making sure it is defined.
+	DataType string
+
+	// Snapshot is the TNX object from whose snapshots table weights and
+	// biases are taken. If it is nil, the snapshots of the graph itself
+	// are used. Each of its snapshots must be of a node, input, or output
+	// of the graph, and each matrix must have the dimensions the graph
+	// requires.
+	Snapshot *schema.TNX
+
+	// Pragmas describes the pragmas to emit.
+	Pragmas HLSPragmas
+
+	// AllowMissingWeights causes weights and biases which are not defined
+	// by either the snapshot or the parameters to be filled with zeros,
+	// rather than producing an error.
+	AllowMissingWeights bool
+}
+
+// DefaultHLSOptions returns a reasonable default set of options for
+// GenerateHLS().
+func DefaultHLSOptions() *HLSOptions {
+	return &HLSOptions{
+		Top:      "tnx_top",
+		DataType: "float",
+		Pragmas:  DefaultHLSPragmas(),
+	}
+}
+
+// hlsActivations maps each activation operation to the name of the helper
+// function in the generated code that implements it.
+var hlsActivations = map[string]string{
+	"identity": "tnx_identity",
+	"relu":     "tnx_relu",
+	"sigmoid":  "tnx_sigmoid",
+	"tanh":     "tnx_tanh",
+}
+
+const hlsPrologue = `#include <cmath>
+
+#ifdef __SYNTHESIS__
+#include "hls_stream.h"
+#else
+#include <queue>
+namespace hls {
+// Minimal software stand-in for hls::stream, used when not synthesizing.
+template <typename T> class stream {
+public:
+	stream() {}
+	stream(const char *name) { (void)name; }
+	void write(const T &v) { q.push(v); }
+	T read() {
+		T v = q.front();
+		q.pop();
+		return v;
+	}
+	bool empty() const { return q.empty(); }
+
+private:
+	std::queue<T> q;
+};
+} // namespace hls
+#endif
+
+static inline data_t tnx_identity(data_t x) { return x; }
+static inline data_t tnx_relu(data_t x) { return x > (data_t)0 ? x : (data_t)0; }
+static inline data_t tnx_sigmoid(data_t x) { return (data_t)1 / ((data_t)1 + std::exp(-x)); }
+static inline data_t tnx_tanh(data_t x) { return std::tanh(x); }
+`
+
+// hlsIdentifier converts an arbitrary TNX ID into a valid C identifier.
+func hlsIdentifier(id string) string {
+	var b strings.Builder
+	for _, r := range id {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// hlsProduct returns the number of elements in a matrix of the given
+// dimensions.
+func hlsProduct(dims []int) int {
+	p := 1
+	for _, d := range dims {
+		p *= d
+	}
+	return p
+}
+
+// hlsEqualDimensions returns true if a matrix of dimensions got can be used
+// where one of dimensions want is expected, that is if they are the same, or
+// if got is a vector of n elements where want is a 1 by n matrix.
+func hlsEqualDimensions(got, want []int) bool {
+	if len(got) == 1 && len(want) == 2 && want[0] == 1 {
+		want = want[1:]
+	}
+
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TopologicalOrder returns the IDs of all nodes in the graph, ordered such
+// that every node occurs after all nodes which are linked to its inputs.
+// Nodes which are otherwise unordered retain the order in which they appear
+// in the topology. An error is returned if the graph contains a cycle.
+func TopologicalOrder(t *schema.TNX) ([]string, error) {
+	outputOwner := make(map[string]string)
+	inputOwner := make(map[string]string)
+	for _, n := range t.Topology.Nodes {
+		for _, id := range n.Outputs {
+			outputOwner[id] = n.ID
+		}
+		for _, id := range n.Inputs {
+			inputOwner[id] = n.ID
+		}
+	}
+
+	indegree := make(map[string]int)
+	successors := make(map[string][]string)
+	for _, l := range t.Topology.Links {
+		source, sok := outputOwner[l.Source]
+		target, tok := inputOwner[l.Target]
+		if !sok || !tok {
+			return nil, fmt.Errorf("Link %v does not connect an output to an input", l)
+		}
+		indegree[target]++
+		successors[source] = append(successors[source], target)
+	}
+
+	order := make([]string, 0, len(t.Topology.Nodes))
+	done := make(map[string]bool)
+	for len(order) < len(t.Topology.Nodes) {
+		progress := false
+		for _, n := range t.Topology.Nodes {
+			if done[n.ID] || indegree[n.ID] > 0 {
+				continue
+			}
+
+			done[n.ID] = true
+			order = append(order, n.ID)
+			for _, s := range successors[n.ID] {
+				indegree[s]--
+			}
+			progress = true
+		}
+
+		if !progress {
+			return nil, fmt.Errorf("Graph contains a cycle")
+		}
+	}
+
+	return order, nil
+}
+
+// hlsGenerator holds the state used while generating HLS code for a single
+// graph.
+type hlsGenerator struct {
+	t    *schema.TNX
+	opts *HLSOptions
+	b    strings.Builder
+
+	// names of generated functions, by node ID
+	functions map[string]string
+
+	// names of top-level ports, by node ID
+	ports map[string]string
+
+	// the stream names which feed each input ID
+	inputStreams map[string]string
+
+	// the stream names which are fed by each output ID
+	outputStreams map[string][]string
+}
+
+func (g *hlsGenerator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.b, format, args...)
+}
+
+func (g *hlsGenerator) pragmas(indent string, pragmas []string, placeholder, value string) {
+	for _, p := range pragmas {
+		if placeholder != "" {
+			p = strings.Replace(p, placeholder, value, -1)
+		}
+		g.printf("%s#pragma %s\n", indent, p)
+	}
+}
+
+// matrix retrieves the named snapshot matrix for the given node, checking
+// that it has the expected dimensions. If the snapshot does not define it, the
+// fallback parameter list is used instead, if any.
+func (g *hlsGenerator) matrix(nodeID, name string, fallback *[]float64, dims []int) (*tensor.Tensor, error) {
+	snap := g.opts.Snapshot
+	if snap == nil {
+		snap = g.t
+	}
+
+	var data []float64
+	if s, ok := snap.Snapshots[nodeID]; ok && s != nil {
+		if m, ok := s.Matrix[name]; ok && m != nil {
+			if hlsProduct(m.Dimensions) != len(m.Data) {
+				return nil, fmt.Errorf("Snapshot matrix '%s' of node '%s' has dimensions %v, but %d data elements",
+					name, nodeID, m.Dimensions, len(m.Data))
+			}
+			if !hlsEqualDimensions(m.Dimensions, dims) {
+				return nil, fmt.Errorf("Snapshot matrix '%s' of node '%s' has dimensions %v, but should have %v",
+					name, nodeID, m.Dimensions, dims)
+			}
+			data = m.Data
+		}
+	}
+
+	if data == nil && fallback != nil {
+		data = *fallback
+	}
+
+	if data == nil {
+		if !g.opts.AllowMissingWeights {
+			return nil, fmt.Errorf("Node '%s' has no '%s' defined in either the snapshot or the parameters", nodeID, name)
+		}
+		data = make([]float64, hlsProduct(dims))
+	}
+
+	if len(data) != hlsProduct(dims) {
+		return nil, fmt.Errorf("Node '%s' has %d '%s' values, expected %d", nodeID, len(data), name, hlsProduct(dims))
+	}
+
+	return tensor.New(dims, data)
+}
+
+// literal formats a floating point value as a C++ literal.
+func (g *hlsGenerator) literal(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// signature emits the start of a node function, including its pragmas.
+func (g *hlsGenerator) signature(n *schema.Node, params []string, arrays []string) {
+	g.printf("void %s(%s) {\n", g.functions[n.ID], strings.Join(params, ", "))
+	g.pragmas("", g.opts.Pragmas.Function, "", "")
+	for _, a := range arrays {
+		g.pragmas("", g.opts.Pragmas.Array, "{array}", a)
+	}
+}
+
+// streamParams returns the parameter list for a node function, and the names
+// of the parameters which correspond to each input, and each output.
+func (g *hlsGenerator) streamParams(n *schema.Node) ([]string, []string, [][]string) {
+	params := []string{}
+	ins := []string{}
+	outs := [][]string{}
+
+	for i := range n.Inputs {
+		name := fmt.Sprintf("in%d", i)
+		ins = append(ins, name)
+		params = append(params, fmt.Sprintf("hls::stream<data_t> &%s", name))
+	}
+
+	for i, oid := range n.Outputs {
+		names := []string{}
+		for j := range g.outputStreams[oid] {
+			name := fmt.Sprintf("out%d_%d", i, j)
+			names = append(names, name)
+			params = append(params, fmt.Sprintf("hls::stream<data_t> &%s", name))
+		}
+		outs = append(outs, names)
+	}
+
+	return params, ins, outs
+}
+
+func (g *hlsGenerator) writeAll(indent string, outs []string, value string) {
+	for _, o := range outs {
+		g.printf("%s%s.write(%s);\n", indent, o, value)
+	}
+}
+
+func (g *hlsGenerator) inputNode(n *schema.Node) error {
+	dims, err := g.t.GetEffectiveDimensions(n.Outputs[0])
+	if err != nil {
+		return err
+	}
+
+	params, _, outs := g.streamParams(n)
+	params = append([]string{"hls::stream<data_t> &port"}, params...)
+
+	g.signature(n, params, nil)
+	g.printf("loop:\n\tfor (int i = 0; i < %d; i++) {\n", hlsProduct(*dims))
+	g.pragmas("\t\t", g.opts.Pragmas.Loop, "", "")
+	g.printf("\t\tdata_t x = port.read();\n")
+	g.writeAll("\t\t", outs[0], "x")
+	g.printf("\t}\n}\n\n")
+	return nil
+}
+
+func (g *hlsGenerator) outputNode(n *schema.Node) error {
+	dims, err := g.t.GetEffectiveDimensions(n.Inputs[0])
+	if err != nil {
+		return err
+	}
+
+	params, ins, _ := g.streamParams(n)
+	params = append(params, "hls::stream<data_t> &port")
+
+	g.signature(n, params, nil)
+	g.printf("loop:\n\tfor (int i = 0; i < %d; i++) {\n", hlsProduct(*dims))
+	g.pragmas("\t\t", g.opts.Pragmas.Loop, "", "")
+	g.printf("\t\tport.write(%s.read());\n", ins[0])
+	g.printf("\t}\n}\n\n")
+	return nil
+}
+
+func (g *hlsGenerator) elementwiseNode(n *schema.Node, activation string) error {
+	if len(n.Inputs) != 1 || len(n.Outputs) != 1 {
+		return fmt.Errorf("Node '%s' must have exactly one input and one output", n.ID)
+	}
+
+	dims, err := g.t.GetEffectiveDimensions(n.Inputs[0])
+	if err != nil {
+		return err
+	}
+
+	params, ins, outs := g.streamParams(n)
+
+	g.signature(n, params, nil)
+	g.printf("loop:\n\tfor (int i = 0; i < %d; i++) {\n", hlsProduct(*dims))
+	g.pragmas("\t\t", g.opts.Pragmas.Loop, "", "")
+	g.printf("\t\tdata_t y = %s(%s.read());\n", hlsActivations[activation], ins[0])
+	g.writeAll("\t\t", outs[0], "y")
+	g.printf("\t}\n}\n\n")
+	return nil
+}
+
+func (g *hlsGenerator) mlpLayerNode(n *schema.Node) error {
+	if len(n.Inputs) != 1 || len(n.Outputs) != 1 {
+		return fmt.Errorf("Node '%s' must have exactly one input and one output", n.ID)
+	}
+
+	activation := "identity"
+	if n.Operation != "mlplayer" {
+		activation = strings.TrimPrefix(n.Operation, schema.FusedMLPLayerPrefix)
+		if _, ok := hlsActivations[activation]; !ok {
+			return fmt.Errorf("Node '%s' fuses unsupported activation '%s'", n.ID, activation)
+		}
+	}
+
+	inDims, err := g.t.GetEffectiveDimensions(n.Inputs[0])
+	if err != nil {
+		return err
+	}
+	k := hlsProduct(*inDims)
+
+	param, err := g.t.GetParameters(n.ID)
+	if err != nil {
+		return err
+	}
+	neurons := *param.Neurons
+
+	weights, err := g.matrix(n.ID, "weights", param.Weights, []int{k, neurons})
+	if err != nil {
+		return err
+	}
+
+	biases, err := g.matrix(n.ID, "biases", param.Biases, []int{neurons})
+	if err != nil {
+		return err
+	}
+
+	name := hlsIdentifier(n.ID)
+	warray := fmt.Sprintf("%s_weights", name)
+	barray := fmt.Sprintf("%s_biases", name)
+
+	// weights are k x n, see tnx(4)
+	g.printf("static const data_t %s[%d][%d] = {\n", warray, k, neurons)
+	for j := 0; j < k; j++ {
+		row := make([]string, neurons)
+		for i := 0; i < neurons; i++ {
+			row[i] = g.literal(weights.MustAt(j, i))
+		}
+		g.printf("\t{%s},\n", strings.Join(row, ", "))
+	}
+	g.printf("};\n\n")
+
+	row := make([]string, neurons)
+	for i := 0; i < neurons; i++ {
+		row[i] = g.literal(biases.MustAt(i))
+	}
+	g.printf("static const data_t %s[%d] = {%s};\n\n", barray, neurons, strings.Join(row, ", "))
+
+	params, ins, outs := g.streamParams(n)
+
+	g.signature(n, params, []string{warray, barray})
+	g.printf("\tdata_t x[%d];\n", k)
+	g.printf("read:\n\tfor (int j = 0; j < %d; j++) {\n", k)
+	g.printf("\t\tx[j] = %s.read();\n\t}\n", ins[0])
+	g.printf("neurons:\n\tfor (int i = 0; i < %d; i++) {\n", neurons)
+	g.pragmas("\t\t", g.opts.Pragmas.Loop, "", "")
+	g.printf("\t\tdata_t acc = %s[i];\n", barray)
+	g.printf("\tmac:\n\t\tfor (int j = 0; j < %d; j++) {\n", k)
+	g.printf("\t\t\tacc += x[j] * %s[j][i];\n\t\t}\n", warray)
+	g.printf("\t\tdata_t y = %s(acc);\n", hlsActivations[activation])
+	g.writeAll("\t\t", outs[0], "y")
+	g.printf("\t}\n}\n\n")
+	return nil
+}
+
+// GenerateHLS generates Vitis-HLS-style C++ source code implementing the
+// given graph, which must be valid. If opts is nil, DefaultHLSOptions() is
+// used.
+//
+// The generated top-level function takes one stream argument for each input
+// node followed by one for each output node, in the order they are defined in
+// the topology. Each port is named after its node.
+func GenerateHLS(t *schema.TNX, opts *HLSOptions) (string, error) {
+	if opts == nil {
+		opts = DefaultHLSOptions()
+	}
+
+	err := schema.Validate(t)
+	if err != nil {
+		return "", err
+	}
+
+	order, err := TopologicalOrder(t)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Snapshot != nil {
+		for id := range opts.Snapshot.Snapshots {
+			if _, err := t.LookupNodeByID(id); err != nil && !t.IsIO(id) {
+				return "", fmt.Errorf("Snapshot '%s' does not reference a valid node, input, or output ID of the graph", id)
+			}
+		}
+	}
+
+	g := &hlsGenerator{
+		t:             t,
+		opts:          opts,
+		functions:     make(map[string]string),
+		ports:         make(map[string]string),
+		inputStreams:  make(map[string]string),
+		outputStreams: make(map[string][]string),
+	}
+
+	for i, l := range t.Topology.Links {
+		name := fmt.Sprintf("link%d", i)
+		if _, ok := g.inputStreams[l.Target]; ok {
+			return "", fmt.Errorf("Input '%s' has multiple sources", l.Target)
+		}
+		g.inputStreams[l.Target] = name
+		g.outputStreams[l.Source] = append(g.outputStreams[l.Source], name)
+	}
+
+	for i, n := range t.Topology.Nodes {
+		ident := hlsIdentifier(n.ID)
+		g.functions[n.ID] = fmt.Sprintf("%s_%d_%s", opts.Top, i, ident)
+		if n.Operation == "input" || n.Operation == "output" {
+			g.ports[n.ID] = fmt.Sprintf("%s_%d", ident, i)
+		}
+
+		for _, id := range n.Inputs {
+			if _, ok := g.inputStreams[id]; !ok && n.Operation != "output" {
+				return "", fmt.Errorf("Input '%s' of node '%s' is not connected", id, n.ID)
+			}
+		}
+	}
+
+	g.printf("// Generated from a TNX graph, do not edit.\n\n")
+	g.printf("typedef %s data_t;\n\n", opts.DataType)
+	g.printf("%s\n", hlsPrologue)
+
+	for _, id := range order {
+		n, err := t.LookupNodeByID(id)
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case n.Operation == "input":
+			err = g.inputNode(n)
+		case n.Operation == "output":
+			if _, ok := g.inputStreams[n.Inputs[0]]; !ok {
+				return "", fmt.Errorf("Output node '%s' is not connected", n.ID)
+			}
+			err = g.outputNode(n)
+		case schema.IsMLPLayerOperation(n.Operation):
+			err = g.mlpLayerNode(n)
+		default:
+			if _, ok := hlsActivations[n.Operation]; !ok {
+				return "", fmt.Errorf("Node '%s' uses operation '%s', which is not supported for HLS generation", n.ID, n.Operation)
+			}
+			err = g.elementwiseNode(n, n.Operation)
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// top-level function
+	params := []string{}
+	portNames := []string{}
+	for _, op := range []string{"input", "output"} {
+		for _, n := range t.Topology.Nodes {
+			if n.Operation == op {
+				params = append(params, fmt.Sprintf("hls::stream<data_t> &%s", g.ports[n.ID]))
+				portNames = append(portNames, g.ports[n.ID])
+			}
+		}
+	}
+
+	g.printf("void %s(%s) {\n", opts.Top, strings.Join(params, ", "))
+	for _, p := range portNames {
+		g.pragmas("", opts.Pragmas.Port, "{port}", p)
+	}
+	g.pragmas("", opts.Pragmas.Top, "", "")
+
+	for i, l := range t.Topology.Links {
+		g.printf("\thls::stream<data_t> link%d(%s);\n", i, strconv.Quote(fmt.Sprintf("%s -> %s", l.Source, l.Target)))
+	}
+
+	for _, id := range order {
+		n, err := t.LookupNodeByID(id)
+		if err != nil {
+			return "", err
+		}
+
+		args := []string{}
+		if n.Operation == "input" {
+			args = append(args, g.ports[n.ID])
+		}
+		for _, iid := range n.Inputs {
+			args = append(args, g.inputStreams[iid])
+		}
+		for _, oid := range n.Outputs {
+			args = append(args, g.outputStreams[oid]...)
+		}
+		if n.Operation == "output" {
+			args = append(args, g.ports[n.ID])
+		}
+
+		g.printf("\t%s(%s);\n", g.functions[n.ID], strings.Join(args, ", "))
+	}
+	g.printf("}\n")
+
+	return g.b.String(), nil
+}
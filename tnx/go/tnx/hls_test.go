@@ -0,0 +1,259 @@
+package tnx
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/herclab/tnx/go/tnx/schema"
+)
+
+// hlsTestGraph is a 3-2-2 MLP with a ReLU hidden layer and a sigmoid output
+// layer.
+const hlsTestGraph = `
+{
+	"schema": ["tnx", "0"],
+	"topology": {
+		"nodes": [
+			{ "id": "in", "operation": "input", "outputs": ["in->o"] },
+			{ "id": "h1", "operation": "mlplayer", "inputs": ["h1<-i"], "outputs": ["h1->o"] },
+			{ "id": "a1", "operation": "relu", "inputs": ["a1<-i"], "outputs": ["a1->o"] },
+			{ "id": "h2", "operation": "mlplayer", "inputs": ["h2<-i"], "outputs": ["h2->o"] },
+			{ "id": "a2", "operation": "sigmoid", "inputs": ["a2<-i"], "outputs": ["a2->o"] },
+			{ "id": "out", "operation": "output", "inputs": ["out<-i"] }
+		],
+		"links": [
+			{ "source": "in->o", "target": "h1<-i" },
+			{ "source": "h1->o", "target": "a1<-i" },
+			{ "source": "a1->o", "target": "h2<-i" },
+			{ "source": "h2->o", "target": "a2<-i" },
+			{ "source": "a2->o", "target": "out<-i" }
+		]
+	},
+	"parameters": {
+		"in": { "dimensions": [3] },
+		"h1": { "neurons": 2, "activation": "a1" },
+		"a1": { },
+		"h2": { "neurons": 2, "activation": "a2" },
+		"a2": { },
+		"out": { "dimensions": [2] }
+	},
+	"snapshots": {
+		"h1": { "matrix": {
+			"weights": { "dimensions": [3, 2], "data": [0.5, -1, 0.25, 2, -0.75, 0.5] },
+			"biases": { "dimensions": [2], "data": [0.1, -0.2] }
+		} },
+		"h2": { "matrix": {
+			"weights": { "dimensions": [2, 2], "data": [1, -1, 0.5, 0.5] },
+			"biases": { "dimensions": [2], "data": [0, 0.3] }
+		} }
+	}
+}
+`
+
+// hlsReference computes the expected output of hlsTestGraph in Go.
+func hlsReference(x []float64) []float64 {
+	layer := func(x, w, b []float64, n int, act func(float64) float64) []float64 {
+		y := make([]float64, n)
+		for i := 0; i < n; i++ {
+			acc := b[i]
+			for j := range x {
+				acc += x[j] * w[j*n+i]
+			}
+			y[i] = act(acc)
+		}
+		return y
+	}
+	relu := func(v float64) float64 { return math.Max(v, 0) }
+	sigmoid := func(v float64) float64 { return 1 / (1 + math.Exp(-v)) }
+
+	h := layer(x, []float64{0.5, -1, 0.25, 2, -0.75, 0.5}, []float64{0.1, -0.2}, 2, relu)
+	return layer(h, []float64{1, -1, 0.5, 0.5}, []float64{0, 0.3}, 2, sigmoid)
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	g, err := schema.FromJSON([]byte(hlsTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reverse the node list, so the order has to be computed
+	for i, j := 0, len(g.Topology.Nodes)-1; i < j; i, j = i+1, j-1 {
+		g.Topology.Nodes[i], g.Topology.Nodes[j] = g.Topology.Nodes[j], g.Topology.Nodes[i]
+	}
+
+	order, err := TopologicalOrder(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "in h1 a1 h2 a2 out"
+	if strings.Join(order, " ") != expect {
+		t.Errorf("order was %v, expected %s", order, expect)
+	}
+
+	g.AddLink("out<-i", "in->o")
+	g.AddLink("a2->o", "h1<-i")
+	_, err = TopologicalOrder(g)
+	if err == nil {
+		t.Errorf("invalid links should have errored")
+	}
+}
+
+func TestGenerateHLS(t *testing.T) {
+	g, err := schema.FromJSON([]byte(hlsTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultHLSOptions()
+	opts.Pragmas.Array = []string{"HLS ARRAY_PARTITION variable={array} complete dim=2"}
+
+	code, err := GenerateHLS(g, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		"#pragma HLS DATAFLOW",
+		"#pragma HLS INTERFACE axis port=in_0",
+		"#pragma HLS INTERFACE axis port=out_5",
+		"#pragma HLS PIPELINE II=1",
+		"#pragma HLS ARRAY_PARTITION variable=h1_weights complete dim=2",
+		"static const data_t h1_weights[3][2]",
+		"static const data_t h2_biases[2] = {0, 0.3};",
+		"void tnx_top(hls::stream<data_t> &in_0, hls::stream<data_t> &out_5)",
+	} {
+		if !strings.Contains(code, s) {
+			t.Errorf("generated code does not contain '%s'", s)
+		}
+	}
+
+	// the fused graph should produce identical results
+	fused, err := schema.FromJSON([]byte(hlsTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Optimize(fused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fusedCode, err := GenerateHLS(fused, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cxx, err := exec.LookPath("c++")
+	if err != nil {
+		t.Skip("no C++ compiler available, skipping compilation of generated code")
+	}
+
+	input := []float64{1, -2, 0.5}
+	expect := hlsReference(input)
+
+	for name, src := range map[string]string{"unfused": code, "fused": fusedCode} {
+		dir, err := ioutil.TempDir("", "tnx-hls")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		harness := src + `
+#include <cstdio>
+int main(void) {
+	hls::stream<data_t> in, out;
+	in.write(1); in.write(-2); in.write(0.5);
+	tnx_top(in, out);
+	while (!out.empty()) {
+		printf("%.9f\n", (double)out.read());
+	}
+	return 0;
+}
+`
+		srcPath := filepath.Join(dir, "tnx.cpp")
+		binPath := filepath.Join(dir, "tnx")
+		err = ioutil.WriteFile(srcPath, []byte(harness), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := exec.Command(cxx, "-o", binPath, srcPath).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: failed to compile generated code: %v\n%s", name, err, out)
+		}
+
+		out, err = exec.Command(binPath).Output()
+		if err != nil {
+			t.Fatalf("%s: failed to run generated code: %v", name, err)
+		}
+
+		lines := strings.Fields(string(out))
+		if len(lines) != len(expect) {
+			t.Fatalf("%s: expected %d outputs, got %v", name, len(expect), lines)
+		}
+
+		for i, l := range lines {
+			v, err := strconv.ParseFloat(l, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(v-expect[i]) > 0.00001 {
+				t.Errorf("%s: output %d is %f, expected %f", name, i, v, expect[i])
+			}
+		}
+	}
+}
+
+func TestGenerateHLSMissingWeights(t *testing.T) {
+	g, err := schema.FromJSON([]byte(hlsTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(g.Snapshots, "h2")
+
+	_, err = GenerateHLS(g, nil)
+	if err == nil {
+		t.Errorf("missing weights should have errored")
+	}
+
+	opts := DefaultHLSOptions()
+	opts.AllowMissingWeights = true
+	code, err := GenerateHLS(g, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(code, "static const data_t h2_biases[2] = {0, 0};") {
+		t.Errorf("missing biases were not zero-filled")
+	}
+
+	// weights may also come from a separate snapshot
+	snap, err := schema.FromJSON([]byte(hlsTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = DefaultHLSOptions()
+	opts.Snapshot = snap
+	_, err = GenerateHLS(g, opts)
+	if err != nil {
+		t.Errorf("weights from separate snapshot should not have errored: %v", err)
+	}
+
+	// weights stored as neurons by inputs, rather than inputs by neurons
+	snap.Snapshots["h1"].Matrix["weights"].Dimensions = []int{2, 3}
+	_, err = GenerateHLS(g, opts)
+	if err == nil {
+		t.Errorf("transposed weights should have errored")
+	}
+
+	snap.Snapshots["h1"].Matrix["weights"].Dimensions = []int{3, 2}
+	snap.Snapshots["h3"] = snap.Snapshots["h1"]
+	_, err = GenerateHLS(g, opts)
+	if err == nil {
+		t.Errorf("snapshot of a node which is not in the graph should have errored")
+	}
+}
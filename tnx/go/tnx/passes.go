@@ -0,0 +1,321 @@
+package tnx
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/herclab/tnx/go/tnx/schema"
+)
+
+// This file implements a simple framework for graph optimization passes, which
+// rewrite a TNX object in place. Passes are intended to simplify imported
+// graphs before further processing, such as generating hardware from them.
+//
+// Every pass must leave the parameters and snapshots tables consistent with
+// the topology. In general, parameters and snapshots which refer to a node,
+// input, or output which has been removed are dropped, see
+// schema.PruneDangling().
+
+// Pass is a single graph optimization pass. It should modify the given TNX in
+// place, and return true if and only if it changed anything. If an error is
+// returned, the TNX may have been partially modified.
+type Pass func(*schema.TNX) (bool, error)
+
+// Passes - This table is initialized with the built-in passes, keyed by name,
+// but users may register additional ones.
+var Passes = map[string]Pass{
+	"dead-node-elimination": EliminateDeadNodes,
+	"identity-removal":      RemoveIdentities,
+	"activation-fusion":     FuseActivations,
+}
+
+// DefaultPasses is the list of pass names which Optimize() runs if none are
+// explicitly given.
+var DefaultPasses = []string{
+	"identity-removal",
+	"activation-fusion",
+	"dead-node-elimination",
+}
+
+// FusableActivations is the set of operations which FuseActivations() will
+// fold into a preceding mlplayer node.
+var FusableActivations = map[string]bool{
+	"relu":    true,
+	"sigmoid": true,
+	"tanh":    true,
+}
+
+// FusedOperation returns the operation name used for an mlplayer node which
+// has had the given activation operation fused into it.
+func FusedOperation(activation string) string {
+	return schema.FusedMLPLayerPrefix + activation
+}
+
+// Optimize runs the named passes in order, repeating the entire list until
+// none of them modifies the graph any longer. If no names are given,
+// DefaultPasses is used.
+func Optimize(t *schema.TNX, names ...string) error {
+	if len(names) == 0 {
+		names = DefaultPasses
+	}
+
+	passes := make([]Pass, len(names))
+	for i, name := range names {
+		p, ok := Passes[name]
+		if !ok {
+			return fmt.Errorf("Unknown pass '%s'", name)
+		}
+		passes[i] = p
+	}
+
+	// Every built-in pass removes at least one node when it makes a
+	// change, so this bound can only be reached by a misbehaving
+	// user-defined pass.
+	limit := len(t.Topology.Nodes) + 1
+	for iter := 0; iter <= limit; iter++ {
+		changed := false
+		for i, p := range passes {
+			c, err := p(t)
+			if err != nil {
+				return fmt.Errorf("Pass '%s' failed: %v", names[i], err)
+			}
+			changed = changed || c
+		}
+
+		if !changed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Passes failed to converge after %d iterations", limit)
+}
+
+// linkTargets returns a table mapping each output ID to the list of input IDs
+// which it is linked to.
+func linkTargets(t *schema.TNX) map[string][]string {
+	targets := make(map[string][]string)
+	for _, l := range t.Topology.Links {
+		targets[l.Source] = append(targets[l.Source], l.Target)
+	}
+	return targets
+}
+
+// linkSources returns a table mapping each input ID to the list of output IDs
+// which are linked to it.
+func linkSources(t *schema.TNX) map[string][]string {
+	sources := make(map[string][]string)
+	for _, l := range t.Topology.Links {
+		sources[l.Target] = append(sources[l.Target], l.Source)
+	}
+	return sources
+}
+
+// EliminateDeadNodes removes every node from which no output node can be
+// reached by following links. Any links, parameters, and snapshots referring
+// to removed nodes are dropped.
+func EliminateDeadNodes(t *schema.TNX) (bool, error) {
+	// map each input and output ID to the node which owns it
+	inputOwner := make(map[string]string)
+	outputOwner := make(map[string]string)
+	for _, n := range t.Topology.Nodes {
+		for _, id := range n.Inputs {
+			inputOwner[id] = n.ID
+		}
+		for _, id := range n.Outputs {
+			outputOwner[id] = n.ID
+		}
+	}
+
+	// predecessors[n] is the list of node IDs with a link into node n
+	predecessors := make(map[string][]string)
+	for _, l := range t.Topology.Links {
+		source, sok := outputOwner[l.Source]
+		target, tok := inputOwner[l.Target]
+		if sok && tok {
+			predecessors[target] = append(predecessors[target], source)
+		}
+	}
+
+	// walk backwards from each output node
+	live := make(map[string]bool)
+	queue := []string{}
+	for _, n := range t.Topology.Nodes {
+		if n.Operation == "output" {
+			live[n.ID] = true
+			queue = append(queue, n.ID)
+		}
+	}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, p := range predecessors[id] {
+			if !live[p] {
+				live[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	dead := []string{}
+	for _, n := range t.Topology.Nodes {
+		if !live[n.ID] {
+			dead = append(dead, n.ID)
+		}
+	}
+
+	for _, id := range dead {
+		err := t.RemoveNode(id)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return len(dead) > 0, nil
+}
+
+// RemoveIdentities removes every identity node which has exactly one input
+// and one output. Whatever is linked to the identity node's input is instead
+// linked directly to everything its output was linked to. Parameters and
+// snapshots of removed identity nodes and their inputs and outputs are
+// dropped, and activation parameters referring to them are cleared.
+func RemoveIdentities(t *schema.TNX) (bool, error) {
+	changed := false
+
+	for {
+		var identity *schema.Node
+		for i := range t.Topology.Nodes {
+			n := &t.Topology.Nodes[i]
+			if n.Operation == "identity" && len(n.Inputs) == 1 && len(n.Outputs) == 1 {
+				identity = n
+				break
+			}
+		}
+
+		if identity == nil {
+			return changed, nil
+		}
+
+		id := identity.ID
+		sources := linkSources(t)[identity.Inputs[0]]
+		targets := linkTargets(t)[identity.Outputs[0]]
+
+		err := t.RemoveNode(id)
+		if err != nil {
+			return true, err
+		}
+
+		for _, s := range sources {
+			for _, tgt := range targets {
+				t.AddLink(s, tgt)
+			}
+		}
+
+		changed = true
+	}
+}
+
+// FuseActivations merges each mlplayer node whose only output feeds exactly
+// one activation node (see FusableActivations) into a single node, with the
+// operation given by FusedOperation().
+//
+// The fused node keeps the ID, input, parameters, and node snapshots of the
+// mlplayer node, and takes over the output of the activation node, along with
+// its snapshots. The mlplayer's pre-activation output no longer exists, so
+// snapshots of it are dropped, as are any parameters or snapshots of the
+// activation node itself. The activation parameter of the fused node is
+// cleared, since the activation is now implied by the operation.
+func FuseActivations(t *schema.TNX) (bool, error) {
+	changed := false
+
+	for {
+		targets := linkTargets(t)
+		sources := linkSources(t)
+
+		layerID := ""
+		activationID := ""
+		for _, n := range t.Topology.Nodes {
+			if n.Operation != "mlplayer" || len(n.Outputs) != 1 {
+				continue
+			}
+
+			tgts := targets[n.Outputs[0]]
+			if len(tgts) != 1 {
+				continue
+			}
+
+			a, err := t.LookupNodeByIOID(tgts[0])
+			if err != nil {
+				return changed, err
+			}
+
+			if !FusableActivations[a.Operation] || len(a.Inputs) != 1 || len(a.Outputs) != 1 {
+				continue
+			}
+
+			if len(sources[a.Inputs[0]]) != 1 {
+				continue
+			}
+
+			layerID = n.ID
+			activationID = a.ID
+			break
+		}
+
+		if layerID == "" {
+			return changed, nil
+		}
+
+		layer, err := t.LookupNodeByID(layerID)
+		if err != nil {
+			return changed, err
+		}
+
+		activation, err := t.LookupNodeByID(activationID)
+		if err != nil {
+			return changed, err
+		}
+
+		operation := FusedOperation(activation.Operation)
+		outputs := append([]string{}, activation.Outputs...)
+		oldOutput := layer.Outputs[0]
+		oldInput := activation.Inputs[0]
+
+		nodes := make([]schema.Node, 0, len(t.Topology.Nodes)-1)
+		for _, n := range t.Topology.Nodes {
+			if n.ID == activationID {
+				continue
+			}
+
+			if n.ID == layerID {
+				n.Operation = operation
+				n.Outputs = outputs
+			}
+
+			nodes = append(nodes, n)
+		}
+		t.Topology.Nodes = nodes
+
+		err = t.RemoveLink(oldOutput, oldInput)
+		if err != nil {
+			return true, err
+		}
+
+		if param, ok := t.Parameters[layerID]; ok && param != nil {
+			param.Activation = nil
+		}
+
+		t.PruneDangling()
+		changed = true
+	}
+}
+
+// PassNames returns the sorted list of all registered pass names.
+func PassNames() []string {
+	names := make([]string, 0, len(Passes))
+	for k := range Passes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
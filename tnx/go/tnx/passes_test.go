@@ -0,0 +1,258 @@
+package tnx
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/herclab/tnx/go/tnx/schema"
+)
+
+// passTestGraph is an MLP with an identity node between the input and the
+// first layer, and a dangling layer which does not reach the output.
+const passTestGraph = `
+{
+	"schema": ["tnx", "0"],
+	"topology": {
+		"nodes": [
+			{ "id": "in", "operation": "input", "outputs": ["in->o"] },
+			{ "id": "id", "operation": "identity", "inputs": ["id<-i"], "outputs": ["id->o"] },
+			{ "id": "h1", "operation": "mlplayer", "inputs": ["h1<-i"], "outputs": ["h1->o"] },
+			{ "id": "a1", "operation": "relu", "inputs": ["a1<-i"], "outputs": ["a1->o"] },
+			{ "id": "h2", "operation": "mlplayer", "inputs": ["h2<-i"], "outputs": ["h2->o"] },
+			{ "id": "a2", "operation": "sigmoid", "inputs": ["a2<-i"], "outputs": ["a2->o"] },
+			{ "id": "dead", "operation": "mlplayer", "inputs": ["dead<-i"], "outputs": ["dead->o"] },
+			{ "id": "out", "operation": "output", "inputs": ["out<-i"] }
+		],
+		"links": [
+			{ "source": "in->o", "target": "id<-i" },
+			{ "source": "id->o", "target": "h1<-i" },
+			{ "source": "h1->o", "target": "a1<-i" },
+			{ "source": "a1->o", "target": "h2<-i" },
+			{ "source": "a1->o", "target": "dead<-i" },
+			{ "source": "h2->o", "target": "a2<-i" },
+			{ "source": "a2->o", "target": "out<-i" }
+		]
+	},
+	"parameters": {
+		"in": { "dimensions": [3] },
+		"id": { "neurons": 3 },
+		"h1": { "neurons": 4, "activation": "a1" },
+		"h2": { "neurons": 2, "activation": "a2" },
+		"dead": { "neurons": 7 },
+		"out": { "dimensions": [2] }
+	},
+	"snapshots": {
+		"id->o": { "matrix": { "output": { "dimensions": [3], "data": [1, 2, 3] } } },
+		"h1": { "matrix": { "weights": { "dimensions": [3, 4], "data": [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12] } } },
+		"h1->o": { "matrix": { "output": { "dimensions": [4], "data": [1, 2, 3, 4] } } },
+		"a1->o": { "matrix": { "output": { "dimensions": [4], "data": [1, 2, 3, 4] } } },
+		"dead": { "matrix": { "biases": { "dimensions": [7], "data": [1, 2, 3, 4, 5, 6, 7] } } }
+	}
+}
+`
+
+func loadPassTestGraph(t *testing.T) *schema.TNX {
+	g, err := schema.FromJSON([]byte(passTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func nodeIDs(g *schema.TNX) []string {
+	ids := []string{}
+	for _, n := range g.Topology.Nodes {
+		ids = append(ids, n.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	switch v := m.(type) {
+	case map[string]*schema.Parameter:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]*schema.Snapshot:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestEliminateDeadNodes(t *testing.T) {
+	g := loadPassTestGraph(t)
+
+	changed, err := EliminateDeadNodes(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Errorf("pass should have reported a change")
+	}
+
+	expect := []string{"a1", "a2", "h1", "h2", "id", "in", "out"}
+	if !cmp.Equal(nodeIDs(g), expect) {
+		t.Errorf("nodes after pass: %v, expected %v", nodeIDs(g), expect)
+	}
+
+	for _, l := range g.Topology.Links {
+		if l.Target == "dead<-i" {
+			t.Errorf("link %v into dead node was not removed", l)
+		}
+	}
+
+	if _, ok := g.Parameters["dead"]; ok {
+		t.Errorf("parameters of dead node were not removed")
+	}
+
+	if _, ok := g.Snapshots["dead"]; ok {
+		t.Errorf("snapshots of dead node were not removed")
+	}
+
+	// running it again should be a no-op
+	changed, err = EliminateDeadNodes(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Errorf("second run of pass should not have changed anything")
+	}
+}
+
+func TestRemoveIdentities(t *testing.T) {
+	g := loadPassTestGraph(t)
+
+	changed, err := RemoveIdentities(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Errorf("pass should have reported a change")
+	}
+
+	if _, err := g.LookupNodeByID("id"); err == nil {
+		t.Errorf("identity node was not removed")
+	}
+
+	links, err := g.LookupLinkByEndpoint("h1<-i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Source != "in->o" {
+		t.Errorf("identity node was not rewired, links into h1 are %v", links)
+	}
+
+	if _, ok := g.Parameters["id"]; ok {
+		t.Errorf("parameters of identity node were not removed")
+	}
+
+	if _, ok := g.Snapshots["id->o"]; ok {
+		t.Errorf("snapshots of identity node output were not removed")
+	}
+
+	err = schema.ValidateTopology(g.Topology)
+	if err != nil {
+		t.Errorf("topology is invalid after pass: %v", err)
+	}
+}
+
+func TestFuseActivations(t *testing.T) {
+	g := loadPassTestGraph(t)
+
+	// a1 feeds two nodes, but h1 feeds only a1, so they should still be
+	// fused
+	changed, err := FuseActivations(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Errorf("pass should have reported a change")
+	}
+
+	expect := []string{"dead", "h1", "h2", "id", "in", "out"}
+	if !cmp.Equal(nodeIDs(g), expect) {
+		t.Errorf("nodes after pass: %v, expected %v", nodeIDs(g), expect)
+	}
+
+	h1, err := g.LookupNodeByID("h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h1.Operation != "e:mlplayer+relu" {
+		t.Errorf("h1 has operation '%s' after fusion", h1.Operation)
+	}
+	if !cmp.Equal(h1.Outputs, []string{"a1->o"}) {
+		t.Errorf("h1 has outputs %v after fusion", h1.Outputs)
+	}
+
+	h2, err := g.LookupNodeByID("h2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h2.Operation != "e:mlplayer+sigmoid" {
+		t.Errorf("h2 has operation '%s' after fusion", h2.Operation)
+	}
+
+	if g.Parameters["h1"].Activation != nil {
+		t.Errorf("activation parameter of fused node was not cleared")
+	}
+
+	if *g.Parameters["h1"].Neurons != 4 {
+		t.Errorf("parameters of fused node were not preserved")
+	}
+
+	expectSnaps := []string{"a1->o", "dead", "h1", "id->o"}
+	if !cmp.Equal(sortedKeys(g.Snapshots), expectSnaps) {
+		t.Errorf("snapshots after pass: %v, expected %v", sortedKeys(g.Snapshots), expectSnaps)
+	}
+
+	err = schema.ValidateTopology(g.Topology)
+	if err != nil {
+		t.Errorf("topology is invalid after pass: %v", err)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	g := loadPassTestGraph(t)
+
+	err := Optimize(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"h1", "h2", "in", "out"}
+	if !cmp.Equal(nodeIDs(g), expect) {
+		t.Errorf("nodes after optimization: %v, expected %v", nodeIDs(g), expect)
+	}
+
+	expectParams := []string{"h1", "h2", "in", "out"}
+	if !cmp.Equal(sortedKeys(g.Parameters), expectParams) {
+		t.Errorf("parameters after optimization: %v, expected %v", sortedKeys(g.Parameters), expectParams)
+	}
+
+	expectSnaps := []string{"a1->o", "h1"}
+	if !cmp.Equal(sortedKeys(g.Snapshots), expectSnaps) {
+		t.Errorf("snapshots after optimization: %v, expected %v", sortedKeys(g.Snapshots), expectSnaps)
+	}
+
+	if len(g.Topology.Links) != 3 {
+		t.Errorf("expected 3 links after optimization, got %v", g.Topology.Links)
+	}
+
+	err = schema.ValidateTopology(g.Topology)
+	if err != nil {
+		t.Errorf("topology is invalid after optimization: %v", err)
+	}
+
+	err = Optimize(g, "no-such-pass")
+	if err == nil {
+		t.Errorf("unknown pass name should have errored")
+	}
+}
@@ -25,6 +25,16 @@ func (tnx *TNX) prepareLookupCaches() {
 
 }
 
+// InvalidateLookupCaches discards any cached lookup results. Because cached
+// results point into the Topology's node and link lists, this must be called
+// after any modification of the topology, otherwise later lookups may return
+// stale or incorrect data.
+func (tnx *TNX) InvalidateLookupCaches() {
+	tnx.linkLookupCache = nil
+	tnx.nodeIOLookupCache = nil
+	tnx.nodeLookupCache = nil
+}
+
 // LookupNodeByID retrieves a node matching the given ID. It will return an
 // error if either the ID does not exist, or there is no node with the matching
 // ID.
@@ -36,10 +46,11 @@ func (tnx *TNX) LookupNodeByID(id string) (*Node, error) {
 		return n, nil
 	}
 
-	for _, n := range tnx.Topology.Nodes {
+	for i := range tnx.Topology.Nodes {
+		n := &tnx.Topology.Nodes[i]
 		if n.ID == id {
-			tnx.nodeLookupCache[id] = &n
-			return &n, nil
+			tnx.nodeLookupCache[id] = n
+			return n, nil
 		}
 	}
 
@@ -55,18 +66,19 @@ func (tnx *TNX) LookupNodeByIOID(searchID string) (*Node, error) {
 		return n, nil
 	}
 
-	for _, n := range tnx.Topology.Nodes {
+	for i := range tnx.Topology.Nodes {
+		n := &tnx.Topology.Nodes[i]
 		for _, id := range n.Inputs {
 			if id == searchID {
-				tnx.nodeIOLookupCache[searchID] = &n
-				return &n, nil
+				tnx.nodeIOLookupCache[searchID] = n
+				return n, nil
 			}
 		}
 
 		for _, id := range n.Outputs {
 			if id == searchID {
-				tnx.nodeIOLookupCache[searchID] = &n
-				return &n, nil
+				tnx.nodeIOLookupCache[searchID] = n
+				return n, nil
 			}
 		}
 	}
@@ -198,9 +210,10 @@ func (tnx *TNX) LookupLinkByEndpoint(searchID string) ([]*Link, error) {
 
 	links = make([]*Link, 0)
 
-	for _, l := range tnx.Topology.Links {
+	for i := range tnx.Topology.Links {
+		l := &tnx.Topology.Links[i]
 		if (l.Source == searchID) || (l.Target == searchID) {
-			links = append(links, &l)
+			links = append(links, l)
 		}
 	}
 
@@ -151,7 +151,7 @@ func TestLookupLinkByEndpoint(t *testing.T) {
 	}{
 		{"input->output0", []*Link{&Link{Source: "input->output0", Target: "hidden1<-input0"}}},
 		{"hidden1<-input0", []*Link{&Link{Source: "input->output0", Target: "hidden1<-input0"}}},
-		{"hidden1->output0", []*Link{&Link{Source: "hidden1->output0", Target: "activation1->input0"}}},
+		{"hidden1->output0", []*Link{&Link{Source: "hidden1->output0", Target: "activation1<-input0"}}},
 		{"activation1<-input0", []*Link{&Link{Source: "hidden1->output0", Target: "activation1<-input0"}}},
 	}
 
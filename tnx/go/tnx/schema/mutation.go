@@ -0,0 +1,118 @@
+package schema
+
+import (
+	"fmt"
+)
+
+// This file contains logic for modifying the topology of a TNX object in
+// place, while keeping the parameters and snapshots tables consistent with it.
+// All functions in this file invalidate the lookup caches as needed, so it is
+// safe to perform lookups after calling them.
+
+// IDs returns the set of all node, input, and output IDs defined in the
+// topology.
+func (tnx *TNX) IDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, n := range tnx.Topology.Nodes {
+		ids[n.ID] = true
+		for _, id := range n.Inputs {
+			ids[id] = true
+		}
+		for _, id := range n.Outputs {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// AddLink appends a new link between the given source and target. It does not
+// verify that the source is an output or that the target is an input, see
+// ValidateTopology() for that.
+func (tnx *TNX) AddLink(source, target string) {
+	tnx.Topology.Links = append(tnx.Topology.Links, Link{Source: source, Target: target})
+	tnx.InvalidateLookupCaches()
+}
+
+// RemoveLink removes every link with exactly the given source and target. It
+// returns an error if no such link exists.
+func (tnx *TNX) RemoveLink(source, target string) error {
+	links := make([]Link, 0, len(tnx.Topology.Links))
+	found := false
+	for _, l := range tnx.Topology.Links {
+		if l.Source == source && l.Target == target {
+			found = true
+			continue
+		}
+		links = append(links, l)
+	}
+
+	if !found {
+		return fmt.Errorf("No link from '%s' to '%s' exists", source, target)
+	}
+
+	tnx.Topology.Links = links
+	tnx.InvalidateLookupCaches()
+	return nil
+}
+
+// RemoveNode removes the node with the given ID, along with any links which
+// reference any of its inputs or outputs. Any parameters or snapshots which
+// refer to the node or to its inputs or outputs are dropped, as are any
+// activation parameters of other nodes which reference it.
+func (tnx *TNX) RemoveNode(id string) error {
+	nodes := make([]Node, 0, len(tnx.Topology.Nodes))
+	found := false
+	for _, n := range tnx.Topology.Nodes {
+		if n.ID == id {
+			found = true
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+
+	if !found {
+		return fmt.Errorf("No such node with id '%s'", id)
+	}
+
+	tnx.Topology.Nodes = nodes
+	tnx.InvalidateLookupCaches()
+	tnx.PruneDangling()
+	return nil
+}
+
+// PruneDangling removes any links, parameters, and snapshots which reference
+// IDs that are no longer defined by the topology. Activation parameters which
+// reference a node that no longer exists are cleared.
+//
+// This is used to restore referential integrity after the topology has been
+// modified.
+func (tnx *TNX) PruneDangling() {
+	ids := tnx.IDs()
+
+	links := make([]Link, 0, len(tnx.Topology.Links))
+	for _, l := range tnx.Topology.Links {
+		if ids[l.Source] && ids[l.Target] {
+			links = append(links, l)
+		}
+	}
+	tnx.Topology.Links = links
+
+	for id, param := range tnx.Parameters {
+		if !ids[id] {
+			delete(tnx.Parameters, id)
+			continue
+		}
+
+		if param != nil && param.Activation != nil && !ids[*param.Activation] {
+			param.Activation = nil
+		}
+	}
+
+	for id := range tnx.Snapshots {
+		if !ids[id] {
+			delete(tnx.Snapshots, id)
+		}
+	}
+
+	tnx.InvalidateLookupCaches()
+}
@@ -0,0 +1,121 @@
+package schema
+
+import (
+	"testing"
+)
+
+func makeMutationTestTNX() *TNX {
+	activation := "bar"
+	neurons := 3
+	return &TNX{
+		Schema: []string{"tnx", "0"},
+		Topology: Topology{
+			Nodes: []Node{
+				Node{ID: "foo", Operation: "input", Outputs: []string{"foo->output0"}},
+				Node{ID: "mlp", Operation: "mlplayer", Inputs: []string{"mlp<-input0"}, Outputs: []string{"mlp->output0"}},
+				Node{ID: "bar", Operation: "relu", Inputs: []string{"bar<-input0"}, Outputs: []string{"bar->output0"}},
+				Node{ID: "baz", Operation: "output", Inputs: []string{"baz<-input0"}},
+			},
+			Links: []Link{
+				Link{Source: "foo->output0", Target: "mlp<-input0"},
+				Link{Source: "mlp->output0", Target: "bar<-input0"},
+				Link{Source: "bar->output0", Target: "baz<-input0"},
+			},
+		},
+		Parameters: map[string]*Parameter{
+			"mlp": &Parameter{Neurons: &neurons, Activation: &activation},
+			"bar": &Parameter{},
+		},
+		Snapshots: map[string]*Snapshot{
+			"bar":          &Snapshot{},
+			"bar<-input0":  &Snapshot{},
+			"bar->output0": &Snapshot{},
+			"mlp":          &Snapshot{},
+		},
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	tnx := makeMutationTestTNX()
+
+	// populate the caches, so we can make sure they get invalidated
+	_, err := tnx.LookupNodeByID("baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tnx.RemoveNode("bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tnx.Topology.Nodes) != 3 {
+		t.Errorf("expected 3 nodes after removal, got %d", len(tnx.Topology.Nodes))
+	}
+
+	if len(tnx.Topology.Links) != 1 {
+		t.Errorf("expected 1 link after removal, got %v", tnx.Topology.Links)
+	}
+
+	if _, ok := tnx.Parameters["bar"]; ok {
+		t.Errorf("parameters of removed node were not dropped")
+	}
+
+	if tnx.Parameters["mlp"].Activation != nil {
+		t.Errorf("activation reference to removed node was not cleared")
+	}
+
+	for _, id := range []string{"bar", "bar<-input0", "bar->output0"} {
+		if _, ok := tnx.Snapshots[id]; ok {
+			t.Errorf("snapshot '%s' of removed node was not dropped", id)
+		}
+	}
+
+	if _, ok := tnx.Snapshots["mlp"]; !ok {
+		t.Errorf("snapshot of unrelated node was dropped")
+	}
+
+	n, err := tnx.LookupNodeByID("baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.ID != "baz" {
+		t.Errorf("lookup after removal returned the wrong node '%s'", n.ID)
+	}
+
+	err = tnx.RemoveNode("bar")
+	if err == nil {
+		t.Errorf("removing a nonexistent node should have errored")
+	}
+}
+
+func TestAddRemoveLink(t *testing.T) {
+	tnx := makeMutationTestTNX()
+
+	err := tnx.RemoveLink("mlp->output0", "bar<-input0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links, err := tnx.LookupLinkByEndpoint("bar<-input0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 0 {
+		t.Errorf("link was not removed: %v", links)
+	}
+
+	err = tnx.RemoveLink("mlp->output0", "bar<-input0")
+	if err == nil {
+		t.Errorf("removing a nonexistent link should have errored")
+	}
+
+	tnx.AddLink("mlp->output0", "baz<-input0")
+	links, err = tnx.LookupLinkByEndpoint("baz<-input0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 {
+		t.Errorf("expected two links into baz, got %v", links)
+	}
+}
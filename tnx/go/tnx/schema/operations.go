@@ -0,0 +1,365 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// This file contains the validation logic and shape rules which are specific
+// to individual operations, as described in the Operations section of
+// tnx(4).
+
+// SnapshotMatrixNames lists the matrix names which may be used in a snapshot
+// keyed by the ID of a node implementing the given operation. Matrix names
+// prefixed with "x:" are always allowed.
+var SnapshotMatrixNames = map[string][]string{
+	"mlplayer": []string{"deltas", "weights", "biases"},
+	"lstm":     []string{"weights", "biases", "hidden", "cell"},
+}
+
+// LSTMGates is the number of gates in an LSTM cell. The gates are ordered
+// input, forget, cell, output, see tnx(4).
+const LSTMGates = 4
+
+// isCustom returns true if the given name uses one of the reserved prefixes
+// for user-defined or experimental keys or operations.
+func isCustom(name string) bool {
+	return strings.HasPrefix(name, "x:") || strings.HasPrefix(name, "e:")
+}
+
+// product returns the number of elements in a matrix of the given dimensions.
+func product(dims []int) int {
+	p := 1
+	for _, d := range dims {
+		p *= d
+	}
+	return p
+}
+
+func equalDimensions(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// axis returns the axis parameter of the given node, defaulting to 0.
+func (tnx *TNX) axis(node *Node) int {
+	if param, ok := tnx.Parameters[node.ID]; ok && param != nil && param.Axis != nil {
+		return *param.Axis
+	}
+	return 0
+}
+
+// inputDimensions returns the effective dimensions of each of the inputs of
+// the given node.
+func (tnx *TNX) inputDimensions(node *Node) ([][]int, error) {
+	dims := make([][]int, len(node.Inputs))
+	for i, id := range node.Inputs {
+		d, err := tnx.GetEffectiveDimensions(id)
+		if err != nil {
+			return nil, err
+		}
+		dims[i] = *d
+	}
+	return dims, nil
+}
+
+// concatDimensions computes the output dimensions of a concat node.
+func (tnx *TNX) concatDimensions(node *Node) (*[]int, error) {
+	dims, err := tnx.inputDimensions(node)
+	if err != nil {
+		return nil, err
+	}
+
+	axis := tnx.axis(node)
+	result := append([]int{}, dims[0]...)
+	if axis < 0 || axis >= len(result) {
+		return nil, fmt.Errorf("Concat node '%s' has axis %d, but its inputs have %d dimensions", node.ID, axis, len(result))
+	}
+
+	for i, d := range dims[1:] {
+		if len(d) != len(result) {
+			return nil, fmt.Errorf("Concat node '%s' input %d has dimensions %v, which do not have the same rank as %v",
+				node.ID, i+1, d, dims[0])
+		}
+
+		for j := range d {
+			if j != axis && d[j] != result[j] {
+				return nil, fmt.Errorf("Concat node '%s' input %d has dimensions %v, which do not match %v except along axis %d",
+					node.ID, i+1, d, dims[0], axis)
+			}
+		}
+
+		result[axis] += d[axis]
+	}
+
+	return &result, nil
+}
+
+// checkArity ensures that a node has an acceptable number of inputs and
+// outputs. A maximum of -1 means there is no upper bound.
+func checkArity(node *Node, minIn, maxIn, outputs int) error {
+	if len(node.Inputs) < minIn || (maxIn >= 0 && len(node.Inputs) > maxIn) {
+		if minIn == maxIn {
+			return fmt.Errorf("%s node '%s' must have exactly %d input(s), but has %d",
+				node.Operation, node.ID, minIn, len(node.Inputs))
+		}
+		return fmt.Errorf("%s node '%s' must have at least %d inputs, but has %d",
+			node.Operation, node.ID, minIn, len(node.Inputs))
+	}
+
+	if len(node.Outputs) != outputs {
+		return fmt.Errorf("%s node '%s' must have exactly %d output(s), but has %d",
+			node.Operation, node.ID, outputs, len(node.Outputs))
+	}
+
+	return nil
+}
+
+// checkOneDimensional ensures that the single input of the given node is a
+// one-dimensional matrix.
+func (tnx *TNX) checkOneDimensional(node *Node) error {
+	dims, err := tnx.GetEffectiveDimensions(node.Inputs[0])
+	if err != nil {
+		return err
+	}
+
+	if len(*dims) != 1 {
+		return fmt.Errorf("%s node '%s' requires a one-dimensional input, but its input has dimensions %v",
+			node.Operation, node.ID, *dims)
+	}
+
+	return nil
+}
+
+// SnapshotMatrixDimensions returns the dimensions which the snapshot matrix
+// with the given name must have, for a snapshot keyed by the given node ID.
+func (tnx *TNX) SnapshotMatrixDimensions(nodeID, name string) ([]int, error) {
+	node, err := tnx.LookupNodeByID(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	param, err := tnx.GetParameters(node.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if param.Neurons == nil {
+		return nil, fmt.Errorf("Node ID '%s' omits it's neurons parameter", node.ID)
+	}
+	n := *param.Neurons
+
+	if len(node.Inputs) != 1 {
+		return nil, fmt.Errorf("Node ID '%s' should have exactly one input, but has %d", node.ID, len(node.Inputs))
+	}
+
+	inDims, err := tnx.GetEffectiveDimensions(node.Inputs[0])
+	if err != nil {
+		return nil, err
+	}
+	k := product(*inDims)
+
+	if IsMLPLayerOperation(node.Operation) {
+		switch name {
+		case "weights":
+			return []int{k, n}, nil
+		case "biases", "deltas":
+			return []int{n}, nil
+		}
+	} else if node.Operation == "lstm" {
+		switch name {
+		case "weights":
+			return []int{k + n, LSTMGates * n}, nil
+		case "biases":
+			return []int{LSTMGates * n}, nil
+		case "hidden", "cell":
+			return []int{n}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Operation '%s' of node '%s' does not define a snapshot matrix named '%s'",
+		node.Operation, node.ID, name)
+}
+
+func init() {
+	// Operation validators
+	elementwise := func(tnx *TNX, node *Node) error {
+		return checkArity(node, 1, 1, 1)
+	}
+
+	OperationValidators["tanh"] = elementwise
+
+	OperationValidators["softmax"] = func(tnx *TNX, node *Node) error {
+		err := checkArity(node, 1, 1, 1)
+		if err != nil {
+			return err
+		}
+
+		return tnx.checkOneDimensional(node)
+	}
+
+	OperationValidators["add"] = func(tnx *TNX, node *Node) error {
+		err := checkArity(node, 2, -1, 1)
+		if err != nil {
+			return err
+		}
+
+		dims, err := tnx.inputDimensions(node)
+		if err != nil {
+			return err
+		}
+
+		for i, d := range dims[1:] {
+			if !equalDimensions(d, dims[0]) {
+				return fmt.Errorf("Add node '%s' input %d has dimensions %v, which do not match %v",
+					node.ID, i+1, d, dims[0])
+			}
+		}
+
+		return nil
+	}
+
+	OperationValidators["concat"] = func(tnx *TNX, node *Node) error {
+		err := checkArity(node, 2, -1, 1)
+		if err != nil {
+			return err
+		}
+
+		_, err = tnx.concatDimensions(node)
+		return err
+	}
+
+	OperationValidators["lstm"] = func(tnx *TNX, node *Node) error {
+		err := checkArity(node, 1, 1, 1)
+		if err != nil {
+			return err
+		}
+
+		param, err := tnx.GetParameters(node.ID)
+		if err != nil {
+			return err
+		}
+
+		if param.Neurons == nil {
+			return fmt.Errorf("Parametrization of LSTM node '%s' must define neurons", node.ID)
+		}
+
+		return tnx.checkOneDimensional(node)
+	}
+
+	// Validator for parameter values which are not specific to any
+	// particular operation.
+	ParameterValidators = append(ParameterValidators, func(tnx *TNX, param *Parameter, id string) error {
+		if param.Neurons != nil && *param.Neurons < 1 {
+			return fmt.Errorf("Parametrization of node '%s' must define a positive number of neurons, not %d",
+				id, *param.Neurons)
+		}
+
+		if param.Axis != nil && *param.Axis < 0 {
+			return fmt.Errorf("Parametrization of node '%s' must define a non-negative axis, not %d",
+				id, *param.Axis)
+		}
+
+		if param.Dimensions != nil {
+			for _, d := range *param.Dimensions {
+				if d < 1 {
+					return fmt.Errorf("Parametrization of node '%s' has non-positive dimension in %v",
+						id, *param.Dimensions)
+				}
+			}
+		}
+
+		return nil
+	})
+
+	// Validator for snapshot matrix names and shapes
+	SnapshotValidators = append(SnapshotValidators, func(tnx *TNX, snap *Snapshot, id string) error {
+		if snap == nil {
+			return nil
+		}
+
+		for name, m := range snap.Matrix {
+			if m == nil {
+				continue
+			}
+
+			if product(m.Dimensions) != len(m.Data) {
+				return fmt.Errorf("Snapshot '%s' matrix '%s' has dimensions %v, but %d data elements",
+					id, name, m.Dimensions, len(m.Data))
+			}
+
+			if strings.HasPrefix(name, "x:") {
+				continue
+			}
+
+			var expect *[]int
+			if tnx.IsIO(id) {
+				node, err := tnx.LookupNodeByIOID(id)
+				if err != nil {
+					return err
+				}
+
+				if !((tnx.IsInput(id) && name == "input") || (tnx.IsOutput(id) && name == "output")) {
+					return fmt.Errorf("Snapshot '%s' defines matrix '%s', but the only matrix allowed for an input is 'input', and for an output is 'output'",
+						id, name)
+				}
+
+				if isCustom(node.Operation) && !IsMLPLayerOperation(node.Operation) {
+					continue
+				}
+
+				expect, err = tnx.GetEffectiveDimensions(id)
+				if err != nil {
+					return err
+				}
+
+			} else {
+				node, err := tnx.LookupNodeByID(id)
+				if err != nil {
+					return fmt.Errorf("Snapshot '%s' does not reference a valid node, input, or output ID", id)
+				}
+
+				if isCustom(node.Operation) && !IsMLPLayerOperation(node.Operation) {
+					continue
+				}
+
+				op := node.Operation
+				if IsMLPLayerOperation(op) {
+					op = "mlplayer"
+				}
+
+				allowed := false
+				for _, n := range SnapshotMatrixNames[op] {
+					if n == name {
+						allowed = true
+					}
+				}
+
+				if !allowed {
+					return fmt.Errorf("Snapshot '%s' defines matrix '%s', which is not defined for operation '%s'",
+						id, name, node.Operation)
+				}
+
+				dims, err := tnx.SnapshotMatrixDimensions(id, name)
+				if err != nil {
+					return err
+				}
+				expect = &dims
+			}
+
+			if !equalDimensions(m.Dimensions, *expect) {
+				return fmt.Errorf("Snapshot '%s' matrix '%s' has dimensions %v, but should have %v",
+					id, name, m.Dimensions, *expect)
+			}
+		}
+
+		return nil
+	})
+}
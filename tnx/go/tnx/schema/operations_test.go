@@ -0,0 +1,173 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// operationsTestGraph feeds an input of size 3 through an LSTM with 4 units,
+// then adds that to a tanh of itself, concatenates it with the original
+// input, and applies a softmax.
+const operationsTestGraph = `
+{
+	"schema": ["tnx", "0"],
+	"topology": {
+		"nodes": [
+			{ "id": "in", "operation": "input", "outputs": ["in->o"] },
+			{ "id": "lstm", "operation": "lstm", "inputs": ["lstm<-i"], "outputs": ["lstm->o"] },
+			{ "id": "tanh", "operation": "tanh", "inputs": ["tanh<-i"], "outputs": ["tanh->o"] },
+			{ "id": "add", "operation": "add", "inputs": ["add<-a", "add<-b"], "outputs": ["add->o"] },
+			{ "id": "concat", "operation": "concat", "inputs": ["concat<-a", "concat<-b"], "outputs": ["concat->o"] },
+			{ "id": "softmax", "operation": "softmax", "inputs": ["softmax<-i"], "outputs": ["softmax->o"] },
+			{ "id": "out", "operation": "output", "inputs": ["out<-i"] }
+		],
+		"links": [
+			{ "source": "in->o", "target": "lstm<-i" },
+			{ "source": "in->o", "target": "concat<-b" },
+			{ "source": "lstm->o", "target": "tanh<-i" },
+			{ "source": "lstm->o", "target": "add<-a" },
+			{ "source": "tanh->o", "target": "add<-b" },
+			{ "source": "add->o", "target": "concat<-a" },
+			{ "source": "concat->o", "target": "softmax<-i" },
+			{ "source": "softmax->o", "target": "out<-i" }
+		]
+	},
+	"parameters": {
+		"in": { "dimensions": [3] },
+		"lstm": { "neurons": 4 },
+		"concat": { "axis": 0 },
+		"softmax": { },
+		"out": { "dimensions": [7] }
+	},
+	"snapshots": {
+		"lstm": { "matrix": {
+			"weights": { "dimensions": [7, 16], "data": [
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0
+			] },
+			"biases": { "dimensions": [16], "data": [0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0] },
+			"hidden": { "dimensions": [4], "data": [0, 0, 0, 0] },
+			"cell": { "dimensions": [4], "data": [0, 0, 0, 0] }
+		} },
+		"concat->o": { "matrix": { "output": { "dimensions": [7], "data": [1, 2, 3, 4, 5, 6, 7] } } }
+	}
+}
+`
+
+func loadOperationsTestGraph(t *testing.T) *TNX {
+	tnx, err := FromJSON([]byte(operationsTestGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tnx
+}
+
+func TestOperationDimensions(t *testing.T) {
+	tnx := loadOperationsTestGraph(t)
+
+	cases := []struct {
+		id     string
+		expect []int
+	}{
+		{"lstm<-i", []int{3}},
+		{"lstm->o", []int{4}},
+		{"tanh->o", []int{4}},
+		{"add<-b", []int{4}},
+		{"add->o", []int{4}},
+		{"concat->o", []int{7}},
+		{"softmax->o", []int{7}},
+	}
+
+	for i, c := range cases {
+		actual, err := tnx.GetEffectiveDimensions(c.id)
+		if err != nil {
+			t.Errorf("Test case %d, IOID '%s': unexpected error %v", i, c.id, err)
+			continue
+		}
+
+		if !cmp.Equal(*actual, c.expect) {
+			t.Errorf("Test case %d, IOID '%s': dimensions %v, expected %v", i, c.id, *actual, c.expect)
+		}
+	}
+
+	dims, err := tnx.SnapshotMatrixDimensions("lstm", "weights")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(dims, []int{7, 16}) {
+		t.Errorf("LSTM weights should be 7x16, not %v", dims)
+	}
+}
+
+func TestValidateOperations(t *testing.T) {
+	err := Validate(loadOperationsTestGraph(t))
+	if err != nil {
+		t.Fatalf("valid graph failed validation: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		modify func(*TNX)
+	}{
+		{"lstm without neurons", func(tnx *TNX) {
+			tnx.Parameters["lstm"].Neurons = nil
+		}},
+		{"lstm with bad weights shape", func(tnx *TNX) {
+			tnx.Snapshots["lstm"].Matrix["weights"].Dimensions = []int{16, 7}
+		}},
+		{"lstm with unknown matrix", func(tnx *TNX) {
+			tnx.Snapshots["lstm"].Matrix["deltas"] = &Matrix{Dimensions: []int{4}, Data: []float64{0, 0, 0, 0}}
+		}},
+		{"matrix with wrong amount of data", func(tnx *TNX) {
+			tnx.Snapshots["lstm"].Matrix["hidden"].Data = []float64{0}
+		}},
+		{"output snapshot with wrong shape", func(tnx *TNX) {
+			tnx.Snapshots["concat->o"].Matrix["output"] = &Matrix{Dimensions: []int{4}, Data: []float64{0, 0, 0, 0}}
+		}},
+		{"output snapshot with wrong name", func(tnx *TNX) {
+			tnx.Snapshots["concat->o"].Matrix["input"] = tnx.Snapshots["concat->o"].Matrix["output"]
+		}},
+		{"snapshot of nonexistent ID", func(tnx *TNX) {
+			tnx.Snapshots["nope"] = &Snapshot{Matrix: map[string]*Matrix{"output": &Matrix{}}}
+		}},
+		{"add with one input", func(tnx *TNX) {
+			tnx.Topology.Nodes[3].Inputs = []string{"add<-a"}
+			tnx.Topology.Links = tnx.Topology.Links[:4]
+		}},
+		{"concat with bad axis", func(tnx *TNX) {
+			axis := 1
+			tnx.Parameters["concat"].Axis = &axis
+		}},
+		{"negative axis", func(tnx *TNX) {
+			axis := -1
+			tnx.Parameters["softmax"].Axis = &axis
+		}},
+		{"tanh with two outputs", func(tnx *TNX) {
+			tnx.Topology.Nodes[2].Outputs = append(tnx.Topology.Nodes[2].Outputs, "tanh->o2")
+		}},
+	}
+
+	for _, c := range cases {
+		tnx := loadOperationsTestGraph(t)
+		c.modify(tnx)
+		tnx.InvalidateLookupCaches()
+		err := Validate(tnx)
+		if err == nil {
+			t.Errorf("Test case '%s' should have failed validation", c.name)
+		}
+	}
+
+	// custom matrices are always allowed
+	tnx := loadOperationsTestGraph(t)
+	tnx.Snapshots["lstm"].Matrix["x:foo"] = &Matrix{Dimensions: []int{1}, Data: []float64{0}}
+	err = Validate(tnx)
+	if err != nil {
+		t.Errorf("custom snapshot matrix should be allowed: %v", err)
+	}
+}
@@ -14,6 +14,7 @@ package schema
 
 import (
 	"encoding/json"
+	"io/ioutil"
 )
 
 // NOTE: the TNX parameters and snapshots tables have values as pointers
@@ -27,16 +28,16 @@ import (
 // TNX implements the top level TNX container object.
 type TNX struct {
 	// Topology defines to a topology definition as described in tnx(4)
-	Topology Topology `json: topology`
+	Topology Topology `json:"topology"`
 
 	// Parameters defines a parameters table as described in tnx(4)
-	Parameters map[string]*Parameter `json: parameters`
+	Parameters map[string]*Parameter `json:"parameters"`
 
 	// Snapshots defines a snapshots table as described in tnx(4)
-	Snapshots map[string]*Snapshot `json: snapshots`
+	Snapshots map[string]*Snapshot `json:"snapshots"`
 
 	// Schema is used to record the schema and version of the TNX.
-	Schema []string `json: schema`
+	Schema []string `json:"schema"`
 
 	// These fields are used to cache lookup operations on nodes and links.
 	//
@@ -50,76 +51,80 @@ type TNX struct {
 // Topology represents a TNX topology object.
 type Topology struct {
 	// Nodes is a list of Node objects.
-	Nodes []Node `json: nodes`
+	Nodes []Node `json:"nodes"`
 
 	// Links is a list of Link objects.
-	Links []Link `json: links`
+	Links []Link `json:"links"`
 }
 
 // Node represents a TNX node object.
 type Node struct {
 	// Id should be a unique identification string, not shared by any other
 	// TNX node, input, or output.
-	ID string `json: id`
+	ID string `json:"id"`
 
 	// Operation should be one of the operation strings described in the
 	// TNX specification.
-	Operation string `json: operation`
+	Operation string `json:"operation"`
 
 	// Inputs should be a list of unique identifier strings.
-	Inputs []string `json: inputs`
+	Inputs []string `json:"inputs"`
 
 	// Outputs should be a list of unique identifier strings.
-	Outputs []string `json: outputs`
+	Outputs []string `json:"outputs"`
 }
 
 // Link represents a TNX link object.
 type Link struct {
 	// Source must reference a TNX output ID.
-	Source string `json: source`
+	Source string `json:"source"`
 
 	// Target must reference a TNX output ID.
-	Target string `json: target`
+	Target string `json:"target"`
 }
 
 // Parameter represents the set of all parameters for a specific node. Unused
 // parameters should be left as nil.
 type Parameter struct {
 	// Dimensions represents a dimension list as described in tnx(4)
-	Dimensions *[]int `json: dimensions`
+	Dimensions *[]int `json:"dimensions"`
 
 	// Deltas represents a deltas list as described in tnx(4)
-	Deltas *[]float64 `json: deltas`
+	Deltas *[]float64 `json:"deltas"`
 
 	// Weights represents a weights list as described in tnx(4)
-	Weights *[]float64 `json: weights`
+	Weights *[]float64 `json:"weights"`
 
 	// Biases represents a biases list as described in tnx(4)
-	Biases *[]float64 `json: biases`
+	Biases *[]float64 `json:"biases"`
 
 	// Activation represents an activation reference as described in tnx(4)
-	Activation *string `json: activation`
+	Activation *string `json:"activation"`
 
-	// Neurons represents the number of neurons in an MLP layer as
+	// Neurons represents the number of neurons in an MLP layer, or the
+	// number of units in an LSTM, as described in tnx(4)
+	Neurons *int `json:"neurons"`
+
+	// Axis represents the dimension along which an operation acts, as
 	// described in tnx(4)
-	Neurons *int `json: neurons`
+	Axis *int `json:"axis"`
 }
 
 // Matrix represents a matrix type snapshot value, as described in tnx(4)
 type Matrix struct {
 	// Name represents the matrix name as described in tnx(4)
-	Name string `json: name`
+	Name string `json:"name"`
 
 	// Dimensions represents a dimension list as described in tnx(4)
-	Dimensions []int `json: dimensions`
+	Dimensions []int `json:"dimensions"`
 
 	// Data represents a data list as described in tnx(4)
-	Data []float64 `json: data`
+	Data []float64 `json:"data"`
 }
 
 // Snapshot represents a single snapshot object as described in tnx(4)
 type Snapshot struct {
-	Matrix map[string]*Matrix `json: matrix`
+	Matrix map[string]*Matrix `json:"matrix"`
 }
 
 // FromJSON de-serializes a TNX object from a JSON file. The TNX returned
@@ -132,3 +137,14 @@ func FromJSON(data []byte) (*TNX, error) {
 	}
 	return t, nil
 }
+
+// ReadJSON is a utility function which reads a file from disk, then calls
+// FromJSON() on it. It does not validate the TNX.
+func ReadJSON(path string) (*TNX, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromJSON(data)
+}
@@ -0,0 +1,21 @@
+package schema
+
+import (
+	"github.com/herclab/tnx/go/tnx/tensor"
+)
+
+// Tensor returns a tensor view of the matrix's data, see tensor.New. Changes
+// made through the tensor are visible in the matrix.
+func (m *Matrix) Tensor() (*tensor.Tensor, error) {
+	return tensor.New(m.Dimensions, m.Data)
+}
+
+// MatrixFromTensor creates a new matrix with the given name, sharing the
+// dimensions and data of the given tensor.
+func MatrixFromTensor(name string, t *tensor.Tensor) *Matrix {
+	return &Matrix{
+		Name:       name,
+		Dimensions: t.Dimensions,
+		Data:       t.Data,
+	}
+}
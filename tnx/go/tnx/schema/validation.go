@@ -2,6 +2,7 @@ package schema
 
 import (
 	"fmt"
+	"strings"
 	// "github.com/google/go-cmp/cmp"
 )
 
@@ -16,8 +17,17 @@ import (
 var ParameterValidators []func(*TNX, *Parameter, string) error
 
 // SnapshotValidators - as with ParameterValidators, but instead applies to
-// snapshot objects.
-var SnapshotValidators []func(*TNX, *Snapshot) error
+// snapshot objects. The string given is the node, input, or output ID which
+// the snapshot is keyed by.
+var SnapshotValidators []func(*TNX, *Snapshot, string) error
+
+// OperationValidators - This table is initialized with the official validation
+// functions for each operation, keyed by operation name, but users may add
+// additional ones for their own custom operations. The function for a given
+// operation is run on each node which implements that operation. As with
+// ParameterValidators, these functions should use the TNX object they are
+// given in a read-only capacity.
+var OperationValidators = make(map[string]func(*TNX, *Node) error)
 
 // Validate checks if the TNX is valid. In order for it to have been loaded by
 // the JSON decoder, it must have been well formed. T
@@ -32,6 +42,11 @@ func Validate(tnx *TNX) error {
 		return err
 	}
 
+	err = ValidateOperations(tnx)
+	if err != nil {
+		return err
+	}
+
 	err = ValidateParameters(tnx)
 	if err != nil {
 		return err
@@ -114,6 +129,24 @@ func ValidateTopology(t Topology) error {
 	return nil
 }
 
+// ValidateOperations ensures that each node is valid with respect to the
+// requirements of its operation, see OperationValidators.
+func ValidateOperations(tnx *TNX) error {
+	for i := range tnx.Topology.Nodes {
+		node := &tnx.Topology.Nodes[i]
+		v, ok := OperationValidators[node.Operation]
+		if !ok {
+			continue
+		}
+
+		err := v(tnx, node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ValidateParameters ensures that all parameters are valid
 func ValidateParameters(tnx *TNX) error {
 	for id, param := range tnx.Parameters {
@@ -127,71 +160,111 @@ func ValidateParameters(tnx *TNX) error {
 	return nil
 }
 
+// FusedMLPLayerPrefix is the operation prefix used for mlplayer nodes which
+// have had their activation function fused into them, see the Optimize()
+// function in the parent package. Such operations behave identically to
+// mlplayer for the purpose of determining dimensions.
+const FusedMLPLayerPrefix = "e:mlplayer+"
+
+// IsMLPLayerOperation returns true if the given operation is either mlplayer,
+// or an mlplayer with a fused activation function.
+func IsMLPLayerOperation(op string) bool {
+	return op == "mlplayer" || strings.HasPrefix(op, FusedMLPLayerPrefix)
+}
+
+// IsElementwiseOperation returns true if the given operation has a single
+// input and output with the same dimensions, and computes each output
+// element from only the corresponding input element.
+func IsElementwiseOperation(op string) bool {
+	switch op {
+	case "relu", "identity", "sigmoid", "tanh":
+		return true
+	}
+	return false
+}
+
 // GetEffectiveDimensions retrieves the dimensions list for a given input
 // or output, based on the parameterization of the relevant node.
+//
+// The dimensions of any input other than that of an output node are the
+// dimensions of the output which is linked to it.
 func (tnx *TNX) GetEffectiveDimensions(ioid string) (*[]int, error) {
 	node, err := tnx.LookupNodeByIOID(ioid)
 	if err != nil {
 		return nil, err
 	}
 
-	param, err := tnx.GetParameters(node.ID)
-	if err != nil {
-		return nil, err
-	}
-
 	if (node.Operation == "input") || (node.Operation == "output") {
 		// Note: assumptions about the inputs and outputs of
 		// input and outputnodes are enforced elsewhere.
 
+		param, err := tnx.GetParameters(node.ID)
+		if err != nil {
+			return nil, err
+		}
+
 		if param.Dimensions == nil {
 			return nil, fmt.Errorf("Node ID '%s' omits it's dimension parameter", node.ID)
 		}
 		return param.Dimensions, nil
 
-	} else if node.Operation == "mlplayer" {
+	}
+
+	if IsMLPLayerOperation(node.Operation) || (node.Operation == "lstm") {
+		param, err := tnx.GetParameters(node.ID)
+		if err != nil {
+			return nil, err
+		}
+
 		if param.Neurons == nil {
 			return nil, fmt.Errorf("Node ID '%s' omits it's neurons parameter", node.ID)
 		}
 
-		if tnx.IsInput(ioid) {
-			links, err := tnx.LookupLinkByEndpoint(ioid)
-			if err != nil {
-				return nil, err
-			}
-
-			if len(links) < 1 {
-				return nil, fmt.Errorf("Input IO '%s' is unconnected, cannot compute effective dimensions", ioid)
-			} else if len(links) > 1 {
-				return nil, fmt.Errorf("Input IO '%s' has multiple sources, invalid topology", ioid)
-			}
+		if tnx.IsOutput(ioid) {
+			return &[]int{*param.Neurons}, nil
+		}
 
-			link := links[0]
+	} else if !IsElementwiseOperation(node.Operation) {
+		switch node.Operation {
+		case "softmax", "add", "concat":
+		default:
+			return nil, fmt.Errorf("IOID '%s' implements an unknown operation '%s'", ioid, node.Operation)
+		}
+	}
 
-			// NOTE: we assume that we are the Target, because
-			// this will always be true in a valid TNX file.
-			prevnode, err := tnx.LookupNodeByIOID(link.Source)
-			if err != nil {
-				return nil, err
-			}
+	if tnx.IsInput(ioid) {
+		links, err := tnx.LookupLinkByEndpoint(ioid)
+		if err != nil {
+			return nil, err
+		}
 
-			return tnx.GetEffectiveDimensions(prevnode.ID)
+		if len(links) < 1 {
+			return nil, fmt.Errorf("Input IO '%s' is unconnected, cannot compute effective dimensions", ioid)
+		} else if len(links) > 1 {
+			return nil, fmt.Errorf("Input IO '%s' has multiple sources, invalid topology", ioid)
+		}
 
-		} else if tnx.IsOutput(ioid) {
-			if param.Neurons == nil {
-				return nil, fmt.Errorf("Node ID '%s' omits it's neurons parameter", node.ID)
-			}
+		link := links[0]
 
-			return &[]int{*param.Neurons}, nil
+		// NOTE: we assume that we are the Target, because
+		// this will always be true in a valid TNX file.
+		return tnx.GetEffectiveDimensions(link.Source)
 
-		} else {
+	} else if tnx.IsOutput(ioid) {
+		if len(node.Inputs) < 1 {
+			return nil, fmt.Errorf("Node ID '%s' has no inputs, cannot compute effective dimensions", node.ID)
+		}
 
-			return nil, fmt.Errorf("IOID '%s' does not refer to an input or an output", ioid)
+		if node.Operation == "concat" {
+			return tnx.concatDimensions(node)
 		}
 
+		// all other operations have the same dimensions on their
+		// output as on their (first) input
+		return tnx.GetEffectiveDimensions(node.Inputs[0])
 	}
 
-	return nil, fmt.Errorf("IOID '%s' implements an unknown operation '%s'", ioid, node.Operation)
+	return nil, fmt.Errorf("IOID '%s' does not refer to an input or an output", ioid)
 }
 
 // GetParameters retrieves the parameters for a given node by it's ID.
@@ -282,13 +355,12 @@ func init() {
 				return fmt.Errorf("Link %v references invalid I/O '%s'", link, otherID)
 			}
 
-			otherParam, ok := tnx.Parameters[other.ID]
+			_, ok := tnx.Parameters[other.ID]
 			if !ok {
 				return fmt.Errorf("Node '%s' specifies dimension %v, but connected node '%s' is unparameterized",
 					node.ID, param.Dimensions, other.ID)
 			}
 
-			fmt.Printf("%v", otherParam)
 			return nil
 		}
 
@@ -299,7 +371,15 @@ func init() {
 
 }
 
-// Validate Snapshots ensures that all snapshots are valid
+// ValidateSnapshots ensures that all snapshots are valid
 func ValidateSnapshots(tnx *TNX) error {
+	for id, snap := range tnx.Snapshots {
+		for _, v := range SnapshotValidators {
+			err := v(tnx, snap, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
@@ -0,0 +1,324 @@
+// Package tensor implements an N-dimensional view over flat lists of floating
+// point values, such as TNX snapshot matrices and MLPX weight lists.
+//
+// Data is packed as described in tnx(4): the dimensions with the smallest
+// index are the most major, so a 2-D tensor whose first dimension is the
+// number of rows is stored row-major.
+//
+// An MLPX weight list for a layer with n neurons, whose predecessor has np
+// neurons, can be viewed as a tensor with dimensions [n, np], such that
+// At(j, i) is the weight TO neuron j FROM neuron i of the previous layer, see
+// mlpx(5).
+package tensor
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Tensor is an N-dimensional view over a flat data list.
+type Tensor struct {
+	// Dimensions is the size of the tensor along each of its axes.
+	//
+	// DANGER: modify this field with care, Data must always contain
+	// exactly as many elements as the product of the dimensions.
+	Dimensions []int
+
+	// Data is the packed contents of the tensor.
+	Data []float64
+}
+
+// size returns the number of elements in a tensor of the given dimensions.
+func size(dims []int) int {
+	s := 1
+	for _, d := range dims {
+		s *= d
+	}
+	return s
+}
+
+// checkDimensions ensures that all of the given dimensions are positive.
+func checkDimensions(dims []int) error {
+	for _, d := range dims {
+		if d < 1 {
+			return fmt.Errorf("Dimensions %v contain a non-positive size", dims)
+		}
+	}
+	return nil
+}
+
+// New creates a tensor viewing the given data. The data is not copied, so
+// changes made through Set are visible in the original list, and vice versa.
+// It is an error for the length of data not to match the dimensions.
+func New(dims []int, data []float64) (*Tensor, error) {
+	err := checkDimensions(dims)
+	if err != nil {
+		return nil, err
+	}
+
+	if size(dims) != len(data) {
+		return nil, fmt.Errorf("Dimensions %v require %d elements, but %d were given",
+			dims, size(dims), len(data))
+	}
+
+	return &Tensor{
+		Dimensions: append([]int{}, dims...),
+		Data:       data,
+	}, nil
+}
+
+// MustNew is a wrapper around New which panics if it encounters an error.
+func MustNew(dims []int, data []float64) *Tensor {
+	t, err := New(dims, data)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Zeros creates a new zero-filled tensor of the given dimensions.
+func Zeros(dims ...int) (*Tensor, error) {
+	err := checkDimensions(dims)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(dims, make([]float64, size(dims)))
+}
+
+// Rank returns the number of dimensions of the tensor.
+func (t *Tensor) Rank() int {
+	return len(t.Dimensions)
+}
+
+// Size returns the number of elements in the tensor.
+func (t *Tensor) Size() int {
+	return size(t.Dimensions)
+}
+
+// Strides returns the distance in the data list between consecutive elements
+// along each axis.
+func (t *Tensor) Strides() []int {
+	strides := make([]int, len(t.Dimensions))
+	s := 1
+	for i := len(t.Dimensions) - 1; i >= 0; i-- {
+		strides[i] = s
+		s *= t.Dimensions[i]
+	}
+	return strides
+}
+
+// Offset returns the position in the data list of the element at the given
+// multi-index. It is an error for the index to have the wrong number of
+// components, or for any component to be out of bounds.
+func (t *Tensor) Offset(index ...int) (int, error) {
+	if len(index) != len(t.Dimensions) {
+		return 0, fmt.Errorf("Index %v has %d components, but tensor has %d dimensions",
+			index, len(index), len(t.Dimensions))
+	}
+
+	offset := 0
+	strides := t.Strides()
+	for i, v := range index {
+		if v < 0 || v >= t.Dimensions[i] {
+			return 0, fmt.Errorf("Index %v is out of bounds for dimensions %v", index, t.Dimensions)
+		}
+		offset += v * strides[i]
+	}
+
+	return offset, nil
+}
+
+// Index is the inverse of Offset, returning the multi-index of the element at
+// the given position in the data list.
+func (t *Tensor) Index(offset int) ([]int, error) {
+	if offset < 0 || offset >= t.Size() {
+		return nil, fmt.Errorf("Offset %d is out of bounds for dimensions %v", offset, t.Dimensions)
+	}
+
+	index := make([]int, len(t.Dimensions))
+	for i, s := range t.Strides() {
+		index[i] = offset / s
+		offset %= s
+	}
+
+	return index, nil
+}
+
+// At returns the element at the given multi-index.
+func (t *Tensor) At(index ...int) (float64, error) {
+	offset, err := t.Offset(index...)
+	if err != nil {
+		return 0, err
+	}
+	return t.Data[offset], nil
+}
+
+// MustAt is a wrapper around At which panics if it encounters an error.
+func (t *Tensor) MustAt(index ...int) float64 {
+	v, err := t.At(index...)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Set updates the element at the given multi-index.
+func (t *Tensor) Set(value float64, index ...int) error {
+	offset, err := t.Offset(index...)
+	if err != nil {
+		return err
+	}
+	t.Data[offset] = value
+	return nil
+}
+
+// MustSet is a wrapper around Set which panics if it encounters an error.
+func (t *Tensor) MustSet(value float64, index ...int) {
+	err := t.Set(value, index...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Copy returns a deep copy of the tensor.
+func (t *Tensor) Copy() *Tensor {
+	return &Tensor{
+		Dimensions: append([]int{}, t.Dimensions...),
+		Data:       append([]float64{}, t.Data...),
+	}
+}
+
+// Reshape returns a view of the same data with different dimensions. The new
+// dimensions must describe the same number of elements. Since the data is
+// shared, changes to either tensor are visible in the other.
+func (t *Tensor) Reshape(dims ...int) (*Tensor, error) {
+	err := checkDimensions(dims)
+	if err != nil {
+		return nil, err
+	}
+
+	if size(dims) != t.Size() {
+		return nil, fmt.Errorf("Cannot reshape tensor of dimensions %v to %v", t.Dimensions, dims)
+	}
+
+	return New(dims, t.Data)
+}
+
+// Transpose returns a copy of the tensor with its axes permuted, such that
+// axis i of the result is axis perm[i] of the original. If perm is empty, the
+// order of the axes is reversed, which for a 2-D tensor is the usual matrix
+// transpose.
+func (t *Tensor) Transpose(perm ...int) (*Tensor, error) {
+	if len(perm) == 0 {
+		perm = make([]int, t.Rank())
+		for i := range perm {
+			perm[i] = t.Rank() - 1 - i
+		}
+	}
+
+	if len(perm) != t.Rank() {
+		return nil, fmt.Errorf("Permutation %v has %d axes, but tensor has %d dimensions",
+			perm, len(perm), t.Rank())
+	}
+
+	seen := make([]bool, t.Rank())
+	dims := make([]int, t.Rank())
+	for i, p := range perm {
+		if p < 0 || p >= t.Rank() || seen[p] {
+			return nil, fmt.Errorf("%v is not a permutation of the axes of a %d dimensional tensor",
+				perm, t.Rank())
+		}
+		seen[p] = true
+		dims[i] = t.Dimensions[p]
+	}
+
+	result := &Tensor{Dimensions: dims, Data: make([]float64, t.Size())}
+	strides := t.Strides()
+	for offset := range result.Data {
+		index, _ := result.Index(offset)
+		src := 0
+		for i, p := range perm {
+			src += index[i] * strides[p]
+		}
+		result.Data[offset] = t.Data[src]
+	}
+
+	return result, nil
+}
+
+// Slice returns a copy of the elements of the tensor whose index along the
+// given axis is within [start, end). The result has the same rank as the
+// original.
+func (t *Tensor) Slice(axis, start, end int) (*Tensor, error) {
+	if axis < 0 || axis >= t.Rank() {
+		return nil, fmt.Errorf("Axis %d is out of bounds for dimensions %v", axis, t.Dimensions)
+	}
+
+	if start < 0 || end > t.Dimensions[axis] || start >= end {
+		return nil, fmt.Errorf("Range [%d, %d) is not a valid slice of axis %d with size %d",
+			start, end, axis, t.Dimensions[axis])
+	}
+
+	dims := append([]int{}, t.Dimensions...)
+	dims[axis] = end - start
+
+	// Because of the packing order, the slice is made of contiguous
+	// blocks, one per combination of indices along the preceding axes.
+	inner := t.Strides()[axis]
+	outer := size(t.Dimensions[:axis])
+	data := make([]float64, 0, size(dims))
+	for o := 0; o < outer; o++ {
+		base := o * t.Dimensions[axis] * inner
+		data = append(data, t.Data[base+start*inner:base+end*inner]...)
+	}
+
+	return New(dims, data)
+}
+
+// Select returns a copy of the elements of the tensor whose index along the
+// given axis is i. The result has that axis removed, so it is of one lower
+// rank than the original, unless the original is one-dimensional, in which
+// case the result has the single dimension 1.
+func (t *Tensor) Select(axis, i int) (*Tensor, error) {
+	s, err := t.Slice(axis, i, i+1)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Rank() == 1 {
+		return s, nil
+	}
+
+	dims := append(append([]int{}, t.Dimensions[:axis]...), t.Dimensions[axis+1:]...)
+	return s.Reshape(dims...)
+}
+
+// Dense returns a gonum matrix viewing the same data as a 2-D tensor. Since the
+// data is shared, changes to either are visible in the other.
+func (t *Tensor) Dense() (*mat.Dense, error) {
+	if t.Rank() != 2 {
+		return nil, fmt.Errorf("Only 2-D tensors can be converted to a matrix, not dimensions %v", t.Dimensions)
+	}
+
+	return mat.NewDense(t.Dimensions[0], t.Dimensions[1], t.Data), nil
+}
+
+// FromDense creates a new 2-D tensor containing a copy of the given gonum
+// matrix.
+func FromDense(m mat.Matrix) (*Tensor, error) {
+	r, c := m.Dims()
+	t, err := Zeros(r, c)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			t.Data[i*c+j] = m.At(i, j)
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,231 @@
+package tensor
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gonum.org/v1/gonum/mat"
+)
+
+// counting returns a tensor of the given dimensions whose elements are their
+// own offsets.
+func counting(t *testing.T, dims ...int) *Tensor {
+	data := make([]float64, size(dims))
+	for i := range data {
+		data[i] = float64(i)
+	}
+
+	x, err := New(dims, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+func TestNew(t *testing.T) {
+	_, err := New([]int{2, 3}, make([]float64, 5))
+	if err == nil {
+		t.Errorf("wrong amount of data should have errored")
+	}
+
+	_, err = New([]int{2, 0}, []float64{})
+	if err == nil {
+		t.Errorf("zero dimension should have errored")
+	}
+
+	// the data is a view, not a copy
+	data := []float64{1, 2, 3, 4}
+	x := MustNew([]int{2, 2}, data)
+	x.MustSet(5, 1, 0)
+	if data[2] != 5 {
+		t.Errorf("Set did not modify the underlying data: %v", data)
+	}
+}
+
+func TestAtSet(t *testing.T) {
+	x := counting(t, 2, 3, 4)
+
+	cases := []struct {
+		index  []int
+		expect float64
+	}{
+		{[]int{0, 0, 0}, 0},
+		{[]int{0, 0, 3}, 3},
+		{[]int{0, 1, 0}, 4},
+		{[]int{1, 0, 0}, 12},
+		{[]int{1, 2, 3}, 23},
+	}
+
+	for i, c := range cases {
+		v, err := x.At(c.index...)
+		if err != nil {
+			t.Errorf("Test case %d: unexpected error %v", i, err)
+			continue
+		}
+		if v != c.expect {
+			t.Errorf("Test case %d: At(%v) is %f, expected %f", i, c.index, v, c.expect)
+		}
+
+		index, err := x.Index(int(c.expect))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(index, c.index) {
+			t.Errorf("Test case %d: Index(%f) is %v, expected %v", i, c.expect, index, c.index)
+		}
+	}
+
+	for _, index := range [][]int{{0, 0}, {0, 0, 0, 0}, {2, 0, 0}, {0, 3, 0}, {0, 0, -1}} {
+		_, err := x.At(index...)
+		if err == nil {
+			t.Errorf("At(%v) should have errored", index)
+		}
+		err = x.Set(1, index...)
+		if err == nil {
+			t.Errorf("Set(%v) should have errored", index)
+		}
+	}
+}
+
+func TestReshape(t *testing.T) {
+	x := counting(t, 2, 3, 4)
+
+	y, err := x.Reshape(6, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if y.MustAt(5, 3) != 23 {
+		t.Errorf("reshaped element is %f, expected 23", y.MustAt(5, 3))
+	}
+
+	y.MustSet(-1, 0, 0)
+	if x.MustAt(0, 0, 0) != -1 {
+		t.Errorf("reshape should share data with the original")
+	}
+
+	_, err = x.Reshape(5, 5)
+	if err == nil {
+		t.Errorf("reshape to a different size should have errored")
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	x := counting(t, 2, 3)
+
+	y, err := x.Transpose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(y.Dimensions, []int{3, 2}) || !cmp.Equal(y.Data, []float64{0, 3, 1, 4, 2, 5}) {
+		t.Errorf("transpose is %v %v", y.Dimensions, y.Data)
+	}
+
+	z := counting(t, 2, 3, 4)
+	w, err := z.Transpose(2, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(w.Dimensions, []int{4, 2, 3}) {
+		t.Errorf("permuted dimensions are %v", w.Dimensions)
+	}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 4; k++ {
+				if z.MustAt(i, j, k) != w.MustAt(k, i, j) {
+					t.Errorf("element (%d, %d, %d) was not permuted correctly", i, j, k)
+				}
+			}
+		}
+	}
+
+	for _, perm := range [][]int{{0, 1}, {0, 0, 1}, {0, 1, 3}} {
+		_, err = z.Transpose(perm...)
+		if err == nil {
+			t.Errorf("permutation %v should have errored", perm)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	x := counting(t, 2, 3, 4)
+
+	cases := []struct {
+		axis       int
+		start, end int
+		dims       []int
+		data       []float64
+	}{
+		{0, 1, 2, []int{1, 3, 4}, []float64{12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}},
+		{1, 1, 3, []int{2, 2, 4}, []float64{4, 5, 6, 7, 8, 9, 10, 11, 16, 17, 18, 19, 20, 21, 22, 23}},
+		{2, 2, 3, []int{2, 3, 1}, []float64{2, 6, 10, 14, 18, 22}},
+	}
+
+	for i, c := range cases {
+		s, err := x.Slice(c.axis, c.start, c.end)
+		if err != nil {
+			t.Errorf("Test case %d: unexpected error %v", i, err)
+			continue
+		}
+		if !cmp.Equal(s.Dimensions, c.dims) || !cmp.Equal(s.Data, c.data) {
+			t.Errorf("Test case %d: slice is %v %v, expected %v %v", i, s.Dimensions, s.Data, c.dims, c.data)
+		}
+	}
+
+	s, err := x.Select(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(s.Dimensions, []int{2, 4}) || s.MustAt(1, 3) != 23 {
+		t.Errorf("select is %v %v", s.Dimensions, s.Data)
+	}
+
+	for _, r := range [][]int{{3, 0, 1}, {0, 1, 1}, {0, 0, 3}, {1, -1, 2}} {
+		_, err = x.Slice(r[0], r[1], r[2])
+		if err == nil {
+			t.Errorf("slice %v should have errored", r)
+		}
+	}
+}
+
+func TestDense(t *testing.T) {
+	x := counting(t, 2, 3)
+
+	m, err := x.Dense()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.At(1, 2) != 5 {
+		t.Errorf("matrix element (1, 2) is %f, expected 5", m.At(1, 2))
+	}
+
+	var product mat.Dense
+	product.Mul(m, m.T())
+	y, err := FromDense(&product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(y.Dimensions, []int{2, 2}) || !cmp.Equal(y.Data, []float64{5, 14, 14, 50}) {
+		t.Errorf("product is %v %v", y.Dimensions, y.Data)
+	}
+
+	_, err = counting(t, 2, 3, 4).Dense()
+	if err == nil {
+		t.Errorf("3-D tensor should not convert to a matrix")
+	}
+}
+
+// TestMLPXWeights ensures that an MLPX weight list can be indexed as described
+// in mlpx(5).
+func TestMLPXWeights(t *testing.T) {
+	// 2 neurons, 3 in the previous layer
+	n, np := 2, 3
+	weights := []float64{0, 1, 2, 10, 11, 12}
+	x := MustNew([]int{n, np}, weights)
+	for j := 0; j < n; j++ {
+		for i := 0; i < np; i++ {
+			if x.MustAt(j, i) != weights[j*np+i] {
+				t.Errorf("weight to %d from %d is %f, expected %f", j, i, x.MustAt(j, i), weights[j*np+i])
+			}
+		}
+	}
+}
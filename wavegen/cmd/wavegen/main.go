@@ -1,9 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/herclab/herc-file-formats/wavegen/go/wavegen"
 
@@ -62,7 +71,18 @@ func summarize(wf *wavegen.WaveFile) {
 		fmt.Printf("NO PARAMETER DATA\n\n")
 	}
 
-	if wf.Signal != nil {
+	if wf.Resampling != nil {
+		fmt.Printf("%s\n", wf.Resampling.Summarize())
+	}
+
+	if wf.Channels != nil {
+		summary, err := wf.Channels.Summarize()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate signal summary: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\n", summary)
+	} else if wf.Signal != nil {
 		summary, err := wf.Signal.Summarize()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to generate signal summary: %v\n", err)
@@ -74,6 +94,103 @@ func summarize(wf *wavegen.WaveFile) {
 	}
 }
 
+// csvOptions builds the options for reading or writing delimited text from
+// the CLI arguments, exiting on error.
+func csvOptions(delimiter string, tsv bool, header string, unit string) *wavegen.CSVOptions {
+	opts := &wavegen.CSVOptions{}
+
+	if tsv || delimiter == "tab" || delimiter == "\\t" {
+		opts.Delimiter = '\t'
+	} else if len([]rune(delimiter)) == 1 {
+		opts.Delimiter = []rune(delimiter)[0]
+	} else {
+		fmt.Fprintf(os.Stderr, "Delimiter must be a single character or 'tab', not '%s'\n", delimiter)
+		os.Exit(1)
+	}
+
+	switch header {
+	case "auto":
+		opts.Header = wavegen.CSVHeaderAuto
+	case "yes":
+		opts.Header = wavegen.CSVHeaderPresent
+	case "no":
+		opts.Header = wavegen.CSVHeaderAbsent
+	default:
+		fmt.Fprintf(os.Stderr, "Header must be one of auto, yes, or no, not '%s'\n", header)
+		os.Exit(1)
+	}
+
+	scale, ok := wavegen.TimeUnits[unit]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown time unit '%s'\n", unit)
+		os.Exit(1)
+	}
+	opts.TimeScale = scale
+
+	return opts
+}
+
+// writePeaks writes the dominant peaks of the spectrum of each channel as
+// comments, and if expected is not nil, whether each expected frequency is
+// found among them, returning false if any is not.
+func writePeaks(w io.Writer, names []string, spectra []*wavegen.Spectrum, peaks int, expected []float64) bool {
+	found := true
+
+	for i, sp := range spectra {
+		all := sp.Peaks(0)
+		for j, peak := range all {
+			if j == peaks {
+				break
+			}
+			fmt.Fprintf(w, "# peak %s %d: %fHz %fdB\n", names[i], j+1, peak.Frequency, wavegen.Decibels(peak.Power))
+		}
+
+		for _, f := range expected {
+			peak, ok := sp.FindPeak(f, sp.Resolution)
+			if ok && len(all) > 0 && wavegen.Decibels(all[0].Power)-wavegen.Decibels(peak.Power) <= 60 {
+				fmt.Fprintf(w, "# expected %s %fHz: found at %fHz %fdB\n", names[i], f, peak.Frequency, wavegen.Decibels(peak.Power))
+			} else {
+				fmt.Fprintf(w, "# expected %s %fHz: missing\n", names[i], f)
+				found = false
+			}
+		}
+	}
+
+	return found
+}
+
+// writeSpectra writes the power spectral density of each channel as a table,
+// with a column for the frequency, and one for each channel.
+func writeSpectra(w io.Writer, names []string, spectra []*wavegen.Spectrum) {
+	fmt.Fprintf(w, "# frequency\t%s\n", strings.Join(names, "\t"))
+	for k, f := range spectra[0].Frequencies {
+		fmt.Fprintf(w, "%f", f)
+		for _, sp := range spectra {
+			fmt.Fprintf(w, "\t%g", sp.Power[k])
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// writeSpectrograms writes the spectrogram of each channel as a table, with a
+// column for the time, one for the frequency, and one for each channel. Each
+// segment is separated by a blank line, as gnuplot expects for surfaces.
+func writeSpectrograms(w io.Writer, names []string, spectrograms []*wavegen.Spectrogram) {
+	fmt.Fprintf(w, "# time\tfrequency\t%s\n", strings.Join(names, "\t"))
+	for i, t := range spectrograms[0].Times {
+		if i > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		for k, f := range spectrograms[0].Frequencies {
+			fmt.Fprintf(w, "%f\t%f", t, f)
+			for _, sg := range spectrograms {
+				fmt.Fprintf(w, "\t%g", sg.Power[i][k])
+			}
+			fmt.Fprintf(w, "\n")
+		}
+	}
+}
+
 func main() {
 	parser := argparse.NewParser("wavegen", "synthetic wave generation utility")
 
@@ -91,6 +208,14 @@ func main() {
 	defaultDuration := true
 	defaultGlobalNoise := true
 	defaultGlobalNoiseMagnitude := true
+	defaultKinds := true
+	defaultDutyCycles := true
+	defaultEndFrequencies := true
+	defaultSeed := true
+	defaultAMDepths := true
+	defaultAMRates := true
+	defaultFMDeviations := true
+	defaultFMRates := true
 
 	generateCmd := parser.NewCommand("generate", "generate synthetic data")
 
@@ -124,9 +249,79 @@ func main() {
 			},
 		})
 
+	generateKinds := generateCmd.StringList("k", "kinds",
+		&argparse.Options{
+			Help:    fmt.Sprintf("List of string waveform kinds, one of: %s.", strings.Join(wavegen.WaveformKinds, ", ")),
+			Default: []string{},
+			Validate: func(args []string) error {
+				defaultKinds = false
+				return nil
+			},
+		})
+
+	generateDutyCycles := generateCmd.FloatList("u", "dutycycles",
+		&argparse.Options{
+			Help:    "List of floating point duty cycles for square waves, between 0 and 1.",
+			Default: []float64{},
+			Validate: func(args []string) error {
+				defaultDutyCycles = false
+				return nil
+			},
+		})
+
+	generateEndFrequencies := generateCmd.FloatList("e", "endfrequencies",
+		&argparse.Options{
+			Help:    "List of floating point frequencies reached at the end of the duration by chirps.",
+			Default: []float64{},
+			Validate: func(args []string) error {
+				defaultEndFrequencies = false
+				return nil
+			},
+		})
+
+	generateAMDepths := generateCmd.FloatList("A", "amdepths",
+		&argparse.Options{
+			Help:    "List of floating point amplitude modulation depths.",
+			Default: []float64{},
+			Validate: func(args []string) error {
+				defaultAMDepths = false
+				return nil
+			},
+		})
+
+	generateAMRates := generateCmd.FloatList("r", "amrates",
+		&argparse.Options{
+			Help:    "List of floating point amplitude modulation rates (Hz).",
+			Default: []float64{},
+			Validate: func(args []string) error {
+				defaultAMRates = false
+				return nil
+			},
+		})
+
+	generateFMDeviations := generateCmd.FloatList("F", "fmdeviations",
+		&argparse.Options{
+			Help:    "List of floating point frequency modulation peak deviations (Hz).",
+			Default: []float64{},
+			Validate: func(args []string) error {
+				defaultFMDeviations = false
+				return nil
+			},
+		})
+
+	generateFMRates := generateCmd.FloatList("R", "fmrates",
+		&argparse.Options{
+			Help:    "List of floating point frequency modulation rates (Hz).",
+			Default: []float64{},
+			Validate: func(args []string) error {
+				defaultFMRates = false
+				return nil
+			},
+		})
+
 	generateNoises := generateCmd.StringList("n", "noises",
 		&argparse.Options{
-			Help:    "List of string noise types.",
+			Help:    fmt.Sprintf("List of string noise types, one of: %s.", strings.Join(wavegen.NoiseKinds, ", ")),
 			Default: []string{},
 			Validate: func(args []string) error {
 				defaultNoises = false
@@ -136,7 +331,7 @@ func main() {
 
 	generateNoiseMagnitudes := generateCmd.FloatList("m", "noisemagnitudes",
 		&argparse.Options{
-			Help:    "List of floating point noise magnitudes.",
+			Help:    "List of floating point noise magnitudes, usually the standard deviation.",
 			Default: []float64{},
 			Validate: func(args []string) error {
 				defaultNoiseMagnitudes = false
@@ -176,7 +371,7 @@ func main() {
 
 	generateGlobalNoise := generateCmd.String("N", "globalnoise",
 		&argparse.Options{
-			Help:    "String global noise type.",
+			Help:    fmt.Sprintf("String global noise type, one of: %s.", strings.Join(wavegen.NoiseKinds, ", ")),
 			Default: "none",
 			Validate: func(args []string) error {
 				defaultGlobalNoise = false
@@ -194,8 +389,33 @@ func main() {
 			},
 		})
 
+	generateExpr := generateCmd.String("x", "expr",
+		&argparse.Options{
+			Help: "Expression in terms of the time t to generate, for example '2*sin(2*pi*5*t) + 0.1*gauss()'. It is added to any components given with --frequencies, which default to none if an expression is given.",
+		})
+
+	generateConstants := generateCmd.StringList("c", "constants",
+		&argparse.Options{
+			Help:    "List of constants which may be used in the expression, each of the form name=value.",
+			Default: []string{},
+		})
+
+	generateSeed := generateCmd.Int("S", "seed",
+		&argparse.Options{
+			Help: "Integer seed for noise generation. If omitted, a seed is chosen based on the current time. Either way, it is recorded in the output so the signal can be regenerated.",
+			Validate: func(args []string) error {
+				defaultSeed = false
+				return nil
+			},
+		})
+
 	generateOutput := generateCmd.String("o", "output", &argparse.Options{Help: "Specify output file, or '-' for stdout.", Default: "-"})
 
+	generateFormat := generateCmd.String("t", "format", &argparse.Options{
+		Help:    fmt.Sprintf("Format of the output, one of: %s. Either is written as the signal is generated, so that signals of any length can be generated in constant memory. Binary files can be read by the other sub-commands.", strings.Join(wavegen.StreamFormats, ", ")),
+		Default: "json",
+	})
+
 	generateDisplay := generateCmd.Flag("D", "display", &argparse.Options{Help: "Also interactively display the generated data."})
 
 	generateLoad := generateCmd.String("l", "load",
@@ -222,6 +442,310 @@ func main() {
 
 	interpolateFrequency := interpolateCmd.Float("f", "frequency", &argparse.Options{Help: "Frequency at which to interpolate the data in Hz"})
 
+	interpolateMethod := interpolateCmd.String("m", "method", &argparse.Options{
+		Help:    fmt.Sprintf("Resampling method, one of: %s. The sinc, polyphase, and decimate methods filter out frequencies above the new Nyquist frequency when downsampling. The linear method samples from time 0, and the others from the time of the first sample of the input.", strings.Join(wavegen.ResampleMethods, ", ")),
+		Default: "linear",
+	})
+
+	/****** regenerate sub-command ***************************************/
+	regenerateCmd := parser.NewCommand("regenerate", "Re-generate the signal of a wavegen file from its parameters, including its seed, so that it matches bit-for-bit if generated on the same architecture. The signal of a version 1 file is replaced with a single channel.")
+
+	regenerateInput := regenerateCmd.String("i", "input", &argparse.Options{Help: "File to regenerate, '-' for stdin", Default: "-"})
+
+	regenerateOutput := regenerateCmd.String("o", "output", &argparse.Options{Help: "Where to save regenerated results, '-' for stdout", Default: "-"})
+
+	regenerateVerify := regenerateCmd.Flag("V", "verify", &argparse.Options{Help: "Rather than writing the regenerated file, check that the signal in the file matches its parameters, and exit with a non-zero code if not."})
+
+	regenerateEpsilon := regenerateCmd.Float("e", "epsilon", &argparse.Options{Help: "Maximum difference allowed between samples when verifying. A small value, such as 1e-9, allows for differences in floating point arithmetic if the file was generated on a different architecture.", Default: 0.0})
+
+	/****** import-wav sub-command **************************************/
+	importWAVCmd := parser.NewCommand("import-wav", "Convert a WAV audio file to a wavegen file. Mono files are written as version 0 files, and others as version 1 files with a channel for each audio channel.")
+
+	importWAVInput := importWAVCmd.String("i", "input", &argparse.Options{Help: "WAV file to import, '-' for stdin", Default: "-"})
+
+	importWAVOutput := importWAVCmd.String("o", "output", &argparse.Options{Help: "Where to save the wavegen file, '-' for stdout", Default: "-"})
+
+	/****** export-wav sub-command **************************************/
+	exportWAVCmd := parser.NewCommand("export-wav", "Convert a wavegen file to a WAV audio file, with an audio channel for each channel of the signal.")
+
+	exportWAVInput := exportWAVCmd.String("i", "input", &argparse.Options{Help: "File to export, '-' for stdin", Default: "-"})
+
+	exportWAVOutput := exportWAVCmd.String("o", "output", &argparse.Options{Help: "Where to save the WAV file, '-' for stdout", Default: "-"})
+
+	exportWAVBits := exportWAVCmd.Int("b", "bits", &argparse.Options{Help: "Bits per sample, one of 8, 16, 24, or 32 for PCM, or 32 or 64 for floating point. Defaults to 16 for PCM and 32 for floating point."})
+
+	exportWAVFloat := exportWAVCmd.Flag("F", "float", &argparse.Options{Help: "Write IEEE floating point samples rather than PCM."})
+
+	exportWAVNormalize := exportWAVCmd.Flag("n", "normalize", &argparse.Options{Help: "Scale the signal so that its peak absolute value is full scale, before applying the gain."})
+
+	exportWAVGain := exportWAVCmd.Float("g", "gain", &argparse.Options{Help: "Multiply every sample by this value. PCM samples outside of [-1, 1] are clipped.", Default: 1.0})
+
+	exportWAVResample := exportWAVCmd.Int("r", "resample", &argparse.Options{Help: "Resample the signal to this rate in Hz using linear interpolation before exporting, which is required if it is not uniformly sampled at a whole number of Hz."})
+
+	/****** import-csv sub-command **************************************/
+	importCSVCmd := parser.NewCommand("import-csv", "Convert delimited text, such as CSV or TSV, to a wavegen file. A single value column is written as a version 0 file, and several as a version 1 file with a channel for each.")
+
+	importCSVInput := importCSVCmd.String("i", "input", &argparse.Options{Help: "Delimited text to import, '-' for stdin", Default: "-"})
+
+	importCSVOutput := importCSVCmd.String("o", "output", &argparse.Options{Help: "Where to save the wavegen file, '-' for stdout", Default: "-"})
+
+	importCSVDelimiter := importCSVCmd.String("d", "delimiter", &argparse.Options{Help: "Column delimiter, a single character or 'tab'.", Default: ","})
+
+	importCSVTSV := importCSVCmd.Flag("t", "tsv", &argparse.Options{Help: "Use tab as the delimiter."})
+
+	importCSVHeader := importCSVCmd.String("H", "header", &argparse.Options{Help: "Whether the first row is a header, one of auto, yes, or no. If auto, it is a header if it contains anything other than numbers.", Default: "auto"})
+
+	importCSVComment := importCSVCmd.String("C", "comment", &argparse.Options{Help: "Lines beginning with this character are skipped, or none if empty.", Default: "#"})
+
+	importCSVTimeColumn := importCSVCmd.String("T", "time-column", &argparse.Options{Help: "Name or index, counting from 0, of the time column. Defaults to the first column."})
+
+	importCSVColumns := importCSVCmd.StringList("c", "columns", &argparse.Options{Help: "Names or indices, counting from 0, of the value columns. Defaults to all but the time column.", Default: []string{}})
+
+	importCSVUnit := importCSVCmd.String("u", "time-unit", &argparse.Options{Help: "Unit of the time column, one of s, ms, us, or ns.", Default: "s"})
+
+	importCSVISO8601 := importCSVCmd.Flag("z", "iso8601", &argparse.Options{Help: "The time column holds absolute ISO-8601 timestamps, which are converted to seconds since the first."})
+
+	/****** export-csv sub-command **************************************/
+	exportCSVCmd := parser.NewCommand("export-csv", "Convert a wavegen file to delimited text, such as CSV or TSV, with a column for the time followed by a column for each channel.")
+
+	exportCSVInput := exportCSVCmd.String("i", "input", &argparse.Options{Help: "File to export, '-' for stdin", Default: "-"})
+
+	exportCSVOutput := exportCSVCmd.String("o", "output", &argparse.Options{Help: "Where to save the delimited text, '-' for stdout", Default: "-"})
+
+	exportCSVDelimiter := exportCSVCmd.String("d", "delimiter", &argparse.Options{Help: "Column delimiter, a single character or 'tab'.", Default: ","})
+
+	exportCSVTSV := exportCSVCmd.Flag("t", "tsv", &argparse.Options{Help: "Use tab as the delimiter."})
+
+	exportCSVHeader := exportCSVCmd.String("H", "header", &argparse.Options{Help: "Whether to write a header row, one of yes or no.", Default: "yes"})
+
+	exportCSVTimeColumn := exportCSVCmd.String("T", "time-column", &argparse.Options{Help: "Name of the time column in the header.", Default: "time"})
+
+	exportCSVUnit := exportCSVCmd.String("u", "time-unit", &argparse.Options{Help: "Unit in which to write times, one of s, ms, us, or ns.", Default: "s"})
+
+	/****** import-mat sub-command **************************************/
+	importMATCmd := parser.NewCommand("import-mat", "Convert a MATLAB Level 5 MAT-file to a wavegen file. The samples may be a vector, or a matrix with a channel in each column. A single channel is written as a version 0 file, and several as a version 1 file.")
+
+	importMATInput := importMATCmd.String("i", "input", &argparse.Options{Help: "MAT-file to import, '-' for stdin", Default: "-"})
+
+	importMATOutput := importMATCmd.String("o", "output", &argparse.Options{Help: "Where to save the wavegen file, '-' for stdout", Default: "-"})
+
+	importMATTime := importMATCmd.String("t", "time-variable", &argparse.Options{Help: "Name of the variable holding the times.", Default: "t"})
+
+	importMATSignal := importMATCmd.String("s", "signal-variable", &argparse.Options{Help: "Name of the variable holding the samples.", Default: "s"})
+
+	importMATRate := importMATCmd.Float("r", "sample-rate", &argparse.Options{Help: "Sample rate in Hz from which to compute the times, if the MAT-file has no time variable."})
+
+	/****** export-mat sub-command **************************************/
+	exportMATCmd := parser.NewCommand("export-mat", "Convert a wavegen file to a MATLAB Level 5 MAT-file, with the times in the vector t, the samples in s, which has a column for each channel, and the parameters in the struct parameters.")
+
+	exportMATInput := exportMATCmd.String("i", "input", &argparse.Options{Help: "File to export, '-' for stdin", Default: "-"})
+
+	exportMATOutput := exportMATCmd.String("o", "output", &argparse.Options{Help: "Where to save the MAT-file, '-' for stdout", Default: "-"})
+
+	/****** import-npy sub-command **************************************/
+	importNPYCmd := parser.NewCommand("import-npy", "Convert NumPy arrays of times and samples to a wavegen file. The input is either a directory containing t.npy and s.npy, or a .npz archive with the arrays t and s. The samples may have a column for each channel. A single channel is written as a version 0 file, and several as a version 1 file.")
+
+	importNPYInput := importNPYCmd.String("i", "input", &argparse.Options{Required: true, Help: "Directory or .npz archive to import"})
+
+	importNPYOutput := importNPYCmd.String("o", "output", &argparse.Options{Help: "Where to save the wavegen file, '-' for stdout", Default: "-"})
+
+	/****** export-npy sub-command **************************************/
+	exportNPYCmd := parser.NewCommand("export-npy", "Convert a wavegen file to NumPy arrays, t.npy holding the times, and s.npy holding the samples, with a column for each channel if there are several.")
+
+	exportNPYInput := exportNPYCmd.String("i", "input", &argparse.Options{Help: "File to export, '-' for stdin", Default: "-"})
+
+	exportNPYOutput := exportNPYCmd.String("o", "output", &argparse.Options{Required: true, Help: "Directory in which to save t.npy and s.npy, or with --npz, the .npz archive to write, '-' for stdout"})
+
+	exportNPYNPZ := exportNPYCmd.Flag("z", "npz", &argparse.Options{Help: "Write a single .npz archive with the arrays t and s, rather than a directory."})
+
+	/****** spectrum sub-command ****************************************/
+	spectrumCmd := parser.NewCommand("spectrum", "Estimate the power spectral density of each channel of a wavegen file by Welch's method, or its spectrogram by the short-time Fourier transform, and list the dominant peaks. The output is a table which gnuplot can read, with the peaks listed in comments, and the signal must be uniformly sampled.")
+
+	spectrumInput := spectrumCmd.String("i", "input", &argparse.Options{Help: "File to analyze, '-' for stdin", Default: "-"})
+
+	spectrumOutput := spectrumCmd.String("o", "output", &argparse.Options{Help: "Where to save the table, '-' for stdout", Default: "-"})
+
+	spectrumChannel := spectrumCmd.String("c", "channel", &argparse.Options{Help: "Channel to analyze, or every channel if empty."})
+
+	spectrumWindow := spectrumCmd.String("w", "window", &argparse.Options{
+		Help:    fmt.Sprintf("Window applied to each segment, one of: %s.", strings.Join(wavegen.WindowKinds, ", ")),
+		Default: "hann",
+	})
+
+	spectrumLength := spectrumCmd.Int("l", "segment-length", &argparse.Options{Help: fmt.Sprintf("Number of samples in each segment, 0 for the smaller of %d and the size of the signal.", wavegen.DefaultSegmentLength)})
+
+	spectrumStep := spectrumCmd.Int("s", "step", &argparse.Options{Help: "Number of samples between the start of each segment, 0 for half of the segment length."})
+
+	spectrumPeaks := spectrumCmd.Int("p", "peaks", &argparse.Options{Help: "Number of dominant peaks to list.", Default: 5})
+
+	spectrumSpectrogram := spectrumCmd.Flag("g", "spectrogram", &argparse.Options{Help: "Write the spectrogram of the signal, rather than its power spectral density."})
+
+	spectrumPlot := spectrumCmd.Flag("P", "plot", &argparse.Options{Help: "Plot the power spectral density in dB, rather than writing it as a table."})
+
+	spectrumCheck := spectrumCmd.Flag("x", "check", &argparse.Options{Help: "Check that the frequency of each periodic component in the file's parameters is found within one bin of a peak at most 60dB below the strongest, exiting with an error if not."})
+
+	/****** filter sub-command ******************************************/
+	filterCmd := parser.NewCommand("filter", "Apply a digital filter to every channel of a wavegen file, which must be uniformly sampled. The filter is recorded in the filters of the output, and the parameters are stripped, as they can no longer accurately re-produce the data in the body of the file.")
+
+	filterInput := filterCmd.String("i", "input", &argparse.Options{Help: "File to filter, '-' for stdin", Default: "-"})
+
+	filterOutput := filterCmd.String("o", "output", &argparse.Options{Help: "Where to save filtered results, '-' for stdout", Default: "-"})
+
+	filterKind := filterCmd.String("k", "kind", &argparse.Options{
+		Help:    fmt.Sprintf("Kind of filter, one of: %s.", strings.Join(wavegen.FilterKinds, ", ")),
+		Default: "butterworth",
+	})
+
+	filterResponse := filterCmd.String("r", "response", &argparse.Options{
+		Help:    fmt.Sprintf("Response of fir and butterworth filters, one of: %s.", strings.Join(wavegen.FilterResponses, ", ")),
+		Default: "lowpass",
+	})
+
+	filterCutoffs := filterCmd.FloatList("c", "cutoffs", &argparse.Options{Help: "Cutoff frequencies in Hz of fir and butterworth filters, one for lowpass and highpass responses, and the lower and upper edges of the band for bandpass and bandstop responses."})
+
+	filterOrder := filterCmd.Int("n", "order", &argparse.Options{Help: fmt.Sprintf("Order of butterworth filters, from 1 to %d.", wavegen.MaxButterworthOrder), Default: 4})
+
+	filterTaps := filterCmd.Int("t", "taps", &argparse.Options{Help: fmt.Sprintf("Odd number of coefficients of fir filters, 0 for %d.", wavegen.DefaultFIRTaps)})
+
+	filterWindow := filterCmd.String("w", "window", &argparse.Options{
+		Help:    fmt.Sprintf("Window applied to the coefficients of fir filters, one of: %s.", strings.Join(wavegen.WindowKinds, ", ")),
+		Default: wavegen.DefaultFIRWindow,
+	})
+
+	filterWidth := filterCmd.Int("W", "width", &argparse.Options{Help: "Odd number of samples over which moving-average and median filters are computed."})
+
+	filterZeroPhase := filterCmd.Flag("z", "zero-phase", &argparse.Options{Help: "Remove the delay of fir and butterworth filters. FIR filters are centered on each sample, and butterworth filters are applied forward then backward, which squares their magnitude response."})
+
+	/****** ops sub-command *********************************************/
+	opsCmd := parser.NewCommand("ops", "Combine or edit the signals of wavegen files. Binary operations interpolate the later inputs linearly at the times of the first, and apply to each of its channels together with the channel of the same name in the other inputs, or their only channel. The parameters are stripped, as they can no longer accurately re-produce the data in the body of the file.")
+
+	opsOperations := []string{"add", "subtract", "multiply", "mix", "concat", "slice", "shift", "scale", "window", "normalize", "standardize", "detrend"}
+
+	opsOperation := opsCmd.String("O", "operation", &argparse.Options{
+		Help:     fmt.Sprintf("Operation to apply, one of: %s. add, multiply, mix and concat take any number of inputs, subtract takes two, and the others one.", strings.Join(opsOperations, ", ")),
+		Required: true,
+	})
+
+	opsInputs := opsCmd.StringList("i", "inputs", &argparse.Options{Help: "Files to operate on, in order, '-' for stdin", Default: []string{"-"}})
+
+	opsOutput := opsCmd.String("o", "output", &argparse.Options{Help: "Where to save results, '-' for stdout", Default: "-"})
+
+	opsWeights := opsCmd.FloatList("w", "weights", &argparse.Options{Help: "Weight of each input to mix."})
+
+	opsStart := opsCmd.Float("s", "start", &argparse.Options{Help: "Time in seconds of the first sample to keep when slicing."})
+
+	opsEnd := opsCmd.Float("e", "end", &argparse.Options{Help: "Time in seconds of the last sample to keep when slicing."})
+
+	opsSeconds := opsCmd.Float("t", "seconds", &argparse.Options{Help: "Seconds to shift by, which may be negative, or to taper at either end when windowing."})
+
+	opsGain := opsCmd.Float("g", "gain", &argparse.Options{Help: "Gain to scale by, or the peak absolute value when normalizing.", Default: 1.0})
+
+	opsKind := opsCmd.String("k", "kind", &argparse.Options{
+		Help:    fmt.Sprintf("Window to taper with, one of: %s.", strings.Join(wavegen.WindowKinds, ", ")),
+		Default: "hann",
+	})
+
+	/****** stream sub-command *****************************************/
+	streamCmd := parser.NewCommand("stream", "Play the signal of a wavegen file in real time at its sample rate, as a live sensor would, over standard out, a UNIX socket, a TCP connection, or UDP datagrams. Each sample is framed as binary floats, or as a line of text, holding the value of each channel in order, optionally preceded by its time.")
+
+	streamTransports := []string{"stdout", "unix", "tcp", "udp"}
+
+	streamInput := streamCmd.String("i", "input", &argparse.Options{Help: "File to play, '-' for stdin", Default: "-"})
+
+	streamRegenerate := streamCmd.Flag("r", "regenerate", &argparse.Options{Help: "Play the signal generated from the file's parameters a chunk at a time, rather than its data, so that signals of any length can be played in constant memory."})
+
+	streamDuration := streamCmd.Float("d", "duration", &argparse.Options{Help: "Seconds of signal to generate with --regenerate, rather than the duration in the parameters."})
+
+	streamTransport := streamCmd.String("T", "transport", &argparse.Options{
+		Help:    fmt.Sprintf("How to stream the samples, one of: %s. For unix and tcp, wavegen listens on the address, and plays the signal to the first client to connect. For udp, each batch of samples is sent as a datagram to the address.", strings.Join(streamTransports, ", ")),
+		Default: "stdout",
+	})
+
+	streamAddress := streamCmd.String("a", "address", &argparse.Options{Help: "Path of the UNIX socket, or host:port of the TCP listener or UDP destination."})
+
+	streamFraming := streamCmd.String("f", "framing", &argparse.Options{
+		Help:    fmt.Sprintf("How to frame each sample, one of: %s. Binary floats are little endian, and text values are separated by spaces, with a line for each sample.", strings.Join(wavegen.FramingKinds, ", ")),
+		Default: "float64",
+	})
+
+	streamTimes := streamCmd.Flag("t", "times", &argparse.Options{Help: "Begin each sample with its time in seconds."})
+
+	streamSpeed := streamCmd.Float("s", "speed", &argparse.Options{Help: "Multiple of real time at which to play the signal.", Default: 1.0})
+
+	streamLoops := streamCmd.Int("l", "loops", &argparse.Options{Help: "Number of times to play the signal, with times which continue from one to the next, 0 to loop until interrupted.", Default: 1})
+
+	streamBatch := streamCmd.Int("b", "batch", &argparse.Options{Help: "Number of samples to write at once, when the last of them is due.", Default: 1})
+
+	/****** dataset sub-command ****************************************/
+	datasetCmd := parser.NewCommand("dataset", "Turn a channel of a wavegen file into a supervised learning dataset, of windows of past samples, each with the later sample to predict. The signal is split by time into train, validation, and test splits, in that order, and windows are taken from within each, so that no sample is in more than one split. The signal must be uniformly sampled.")
+
+	datasetInput := datasetCmd.String("i", "input", &argparse.Options{Help: "File to make a dataset of, '-' for stdin", Default: "-"})
+
+	datasetOutput := datasetCmd.String("o", "output", &argparse.Options{Help: "Where to save the dataset, '-' for stdout", Default: "-"})
+
+	datasetChannel := datasetCmd.String("c", "channel", &argparse.Options{Help: "Channel to make a dataset of, which may be omitted if there is only one."})
+
+	datasetWindow := datasetCmd.Int("n", "window", &argparse.Options{Help: "Number of past samples in each window.", Required: true})
+
+	datasetHorizon := datasetCmd.Int("H", "horizon", &argparse.Options{Help: "Number of samples after the end of each window at which its target is taken.", Default: 1})
+
+	datasetStride := datasetCmd.Int("s", "stride", &argparse.Options{Help: "Number of samples between the start of each window.", Default: 1})
+
+	datasetValidation := datasetCmd.Float("V", "validation", &argparse.Options{Help: "Fraction of the duration of the signal to use for the validation split."})
+
+	datasetTest := datasetCmd.Float("T", "test", &argparse.Options{Help: "Fraction of the duration of the signal to use for the test split."})
+
+	datasetNormalize := datasetCmd.Flag("N", "normalize", &argparse.Options{Help: "Standardize every split by the mean and standard deviation of the train split, which are recorded in the dataset."})
+
+	datasetFormat := datasetCmd.String("f", "format", &argparse.Options{
+		Help:    fmt.Sprintf("Format of the dataset, one of: %s, as described in wavegen(4).", strings.Join(wavegen.DatasetFormats, ", ")),
+		Default: "json",
+	})
+
+	/****** compare sub-command ****************************************/
+	compareCmd := parser.NewCommand("compare", "Compare a candidate signal, such as the predictions of a model, against a reference signal, reporting the RMSE, MAE, largest error, SNR, and correlation of each channel. The signals are compared at the times of the reference within the duration of the candidate, at which the candidate is linearly interpolated. Each channel of the reference is compared with the channel of the candidate of the same name, or its only channel.")
+
+	compareReference := compareCmd.String("r", "reference", &argparse.Options{Help: "File of the reference signal, '-' for stdin", Required: true})
+
+	compareCandidate := compareCmd.String("C", "candidate", &argparse.Options{Help: "File of the candidate signal, '-' for stdin", Required: true})
+
+	compareChannel := compareCmd.String("c", "channel", &argparse.Options{Help: "Channel of the reference to compare, rather than every channel."})
+
+	compareAlign := compareCmd.Flag("a", "align", &argparse.Options{Help: "Estimate the constant lag of the candidate by cross-correlation, and remove it before comparing. The reference must be uniformly sampled."})
+
+	compareMaxLag := compareCmd.Float("m", "max-lag", &argparse.Options{Help: "Largest lag in seconds, either way, to search for when aligning, 0 for a quarter of the duration of the reference."})
+
+	compareHorizons := compareCmd.Flag("H", "horizons", &argparse.Options{Help: "The channels of the candidate are the predictions of a model which forecasts several samples ahead, in order of horizon, from 1 sample ahead, each at the time of the sample it predicts. They are compared with a single channel of the reference, reporting the error of each horizon, and aligned by the lag of the first."})
+
+	compareJSON := compareCmd.Flag("j", "json", &argparse.Options{Help: "Write the comparison of each channel as a JSON object, keyed by the name of the channel of the reference."})
+
+	compareMaxRMSE := compareCmd.Float("x", "max-rmse", &argparse.Options{Help: "Exit with a status of 1 if the RMSE of any channel exceeds this, 0 to never."})
+
+	/****** plot sub-command *******************************************/
+	plotCmd := parser.NewCommand("plot", "Render the signals of one or more wavegen files as an image, overlaid on the same axes with a legend, without needing gnuplot or a display.")
+
+	plotInputs := plotCmd.StringList("i", "inputs", &argparse.Options{Help: "Files to plot, '-' for stdin", Default: []string{"-"}})
+
+	plotOutput := plotCmd.String("o", "output", &argparse.Options{Help: "Where to save the image, '-' for stdout", Required: true})
+
+	plotFormat := plotCmd.String("f", "format", &argparse.Options{Help: fmt.Sprintf("Format of the image, one of: %s. If omitted, it is taken from the extension of the output, or else png.", strings.Join(wavegen.PlotFormats, ", "))})
+
+	plotChannels := plotCmd.StringList("c", "channels", &argparse.Options{Help: "Channels to plot, rather than every channel."})
+
+	plotStart := plotCmd.Float("s", "start", &argparse.Options{Help: "Time in seconds of the first sample to plot."})
+
+	plotEnd := plotCmd.Float("e", "end", &argparse.Options{Help: "Time in seconds of the last sample to plot. If omitted, samples are plotted up to the last."})
+
+	plotTitle := plotCmd.String("T", "title", &argparse.Options{Help: "Title of the plot."})
+
+	plotXLabel := plotCmd.String("x", "xlabel", &argparse.Options{Help: "Label of the time axis.", Default: "Time (s)"})
+
+	plotYLabel := plotCmd.String("y", "ylabel", &argparse.Options{Help: "Label of the value axis.", Default: "Value"})
+
+	plotWidth := plotCmd.Float("W", "width", &argparse.Options{Help: "Width of the image in inches.", Default: 6.0})
+
+	plotHeight := plotCmd.Float("H", "height", &argparse.Options{Help: "Height of the image in inches.", Default: 4.0})
+
 	err := parser.Parse(os.Args)
 	if err != nil {
 		fmt.Fprint(os.Stderr, parser.Usage(err))
@@ -242,14 +766,56 @@ func main() {
 			Frequencies:          *generateFrequencies,
 			Phases:               *generatePhases,
 			Amplitudes:           *generateAmplitudes,
+			Kinds:                *generateKinds,
+			DutyCycles:           *generateDutyCycles,
+			EndFrequencies:       *generateEndFrequencies,
+			AMDepths:             *generateAMDepths,
+			AMRates:              *generateAMRates,
+			FMDeviations:         *generateFMDeviations,
+			FMRates:              *generateFMRates,
 			Noises:               *generateNoises,
 			NoiseMagnitudes:      *generateNoiseMagnitudes,
 			GlobalNoise:          *generateGlobalNoise,
 			GlobalNoiseMagnitude: *generateGlobalNoiseMagnitude,
+			Seed:                 int64(*generateSeed),
+		}
+
+		if defaultSeed {
+			param.Seed = time.Now().UnixNano()
+		}
+
+		if *generateExpr != "" {
+			param.Expression = *generateExpr
+
+			// the expression replaces the default component
+			if defaultFrequencies {
+				param.Frequencies = []float64{}
+				param.Phases = []float64{}
+				param.Amplitudes = []float64{}
+			}
+		}
+
+		for _, c := range *generateConstants {
+			parts := strings.SplitN(c, "=", 2)
+			if len(parts) != 2 {
+				fmt.Fprintf(os.Stderr, "Constant '%s' is not of the form name=value\n", c)
+				os.Exit(1)
+			}
+
+			v, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid value for constant '%s': %v\n", parts[0], err)
+				os.Exit(1)
+			}
+
+			if param.Constants == nil {
+				param.Constants = map[string]float64{}
+			}
+			param.Constants[strings.TrimSpace(parts[0])] = v
 		}
 
 		if *generateLoad != "" {
-			loaded, err := wavegen.ReadJSON(*generateLoad)
+			loaded, err := wavegen.ReadFile(*generateLoad)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to load parameters file '%s': %v\n",
 					*generateLoad, err)
@@ -286,15 +852,71 @@ func main() {
 				param.Amplitudes = append(param.Amplitudes, loaded.Parameters.Frequencies...)
 			}
 
-			if defaultNoises {
-				param.Noises = loaded.Parameters.Noises
-			} else {
-				param.Noises = append(param.Noises, loaded.Parameters.Noises...)
+			// components given on the CLI come before those
+			// loaded from the file, so if they omit any of the
+			// waveform settings, they need defaults of their own
+			cliComponents := 0
+			if !defaultFrequencies {
+				cliComponents = len(*generateFrequencies)
 			}
 
-			if defaultNoiseMagnitudes {
-				param.NoiseMagnitudes = loaded.Parameters.NoiseMagnitudes
-			} else {
+			if defaultKinds {
+				param.Kinds = []string{}
+				for i := 0; i < cliComponents; i++ {
+					param.Kinds = append(param.Kinds, "sine")
+				}
+			}
+			param.Kinds = append(param.Kinds, loaded.Parameters.Kinds...)
+
+			if defaultDutyCycles {
+				param.DutyCycles = []float64{}
+				for i := 0; i < cliComponents; i++ {
+					param.DutyCycles = append(param.DutyCycles, wavegen.DefaultDutyCycle)
+				}
+			}
+			param.DutyCycles = append(param.DutyCycles, loaded.Parameters.DutyCycles...)
+
+			if defaultEndFrequencies {
+				param.EndFrequencies = []float64{}
+				for i := 0; i < cliComponents; i++ {
+					param.EndFrequencies = append(param.EndFrequencies, (*generateFrequencies)[i])
+				}
+			}
+			param.EndFrequencies = append(param.EndFrequencies, loaded.Parameters.EndFrequencies...)
+
+			if defaultAMDepths {
+				param.AMDepths = make([]float64, cliComponents)
+			}
+			param.AMDepths = append(param.AMDepths, loaded.Parameters.AMDepths...)
+
+			if defaultAMRates {
+				param.AMRates = make([]float64, cliComponents)
+			}
+			param.AMRates = append(param.AMRates, loaded.Parameters.AMRates...)
+
+			if defaultFMDeviations {
+				param.FMDeviations = make([]float64, cliComponents)
+			}
+			param.FMDeviations = append(param.FMDeviations, loaded.Parameters.FMDeviations...)
+
+			if defaultFMRates {
+				param.FMRates = make([]float64, cliComponents)
+			}
+			param.FMRates = append(param.FMRates, loaded.Parameters.FMRates...)
+
+			// envelopes can only be given in a loaded file
+			param.AmplitudeEnvelopes = append(make([]wavegen.Envelope, cliComponents), loaded.Parameters.AmplitudeEnvelopes...)
+			param.FrequencyEnvelopes = append(make([]wavegen.Envelope, cliComponents), loaded.Parameters.FrequencyEnvelopes...)
+
+			if defaultNoises {
+				param.Noises = loaded.Parameters.Noises
+			} else {
+				param.Noises = append(param.Noises, loaded.Parameters.Noises...)
+			}
+
+			if defaultNoiseMagnitudes {
+				param.NoiseMagnitudes = loaded.Parameters.NoiseMagnitudes
+			} else {
 				param.NoiseMagnitudes = append(param.NoiseMagnitudes, loaded.Parameters.NoiseMagnitudes...)
 			}
 
@@ -306,6 +928,25 @@ func main() {
 				param.GlobalNoiseMagnitude = loaded.Parameters.GlobalNoiseMagnitude
 			}
 
+			if *generateExpr == "" {
+				param.Expression = loaded.Parameters.Expression
+			}
+
+			// constants given on the CLI take precedence
+			for name, v := range loaded.Parameters.Constants {
+				if _, ok := param.Constants[name]; !ok {
+					if param.Constants == nil {
+						param.Constants = map[string]float64{}
+					}
+					param.Constants[name] = v
+				}
+			}
+
+			if defaultSeed {
+				param.Seed = loaded.Parameters.Seed
+				param.RandomVersion = loaded.Parameters.RandomVersion
+			}
+
 			// if the user didn't specify any noise for the new
 			// frequency, go ahead and add none...
 			for (len(param.Noises) == len(param.NoiseMagnitudes)) && (len(param.Noises) < len(param.Frequencies)) {
@@ -321,55 +962,90 @@ func main() {
 			os.Exit(1)
 		}
 
-		sig, err := param.GenerateSyntheticData()
+		gen, err := param.NewGenerator()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error while generating signal: %v\n", err)
 			os.Exit(1)
 		}
-		wf := wavegen.WaveFile{
-			Version:    0,
-			Parameters: param,
-			Signal:     sig,
+
+		out := os.Stdout
+		if *generateOutput != "-" {
+			out, err = os.Create(*generateOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
 		}
 
-		if *generateDisplay {
-			plot(map[string]*wavegen.Signal{"generated data": wf.Signal})
+		enc, err := wavegen.NewStreamEncoder(out, *generateFormat, &wavegen.WaveFile{Version: 0, Parameters: param}, wavegen.DefaultChannelName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
 		}
 
-		if *generateOutput == "-" {
-			data, err := wf.ToJSON()
+		// the signal is only kept in memory if it is to be displayed
+		displayed := &wavegen.Signal{SampleRate: param.SampleRate}
+		for {
+			chunk, err := gen.Next(wavegen.DefaultChunkSize)
+			if err == io.EOF {
+				break
+			}
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to generate JSON: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Error while generating signal: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Print(string(data))
-			fmt.Print("")
-		} else {
-			err := wf.WriteJSON(*generateOutput)
+
+			err = enc.WriteSignal(chunk)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
 				os.Exit(1)
 			}
+
+			if *generateDisplay {
+				displayed.T = append(displayed.T, chunk.T...)
+				displayed.S = append(displayed.S, chunk.S...)
+			}
+		}
+
+		err = enc.Close()
+		if err == nil && out != os.Stdout {
+			err = out.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+
+		if *generateDisplay {
+			plot(map[string]*wavegen.Signal{"generated data": displayed})
 		}
 
 	} else if viewCmd.Happened() {
 		/***** view sub-command **************************************/
 
-		loaded, err := wavegen.ReadJSON(*viewInput)
+		loaded, err := wavegen.ReadFile(*viewInput)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to load parameters file '%s': %v\n",
 				*generateLoad, err)
 			os.Exit(1)
 		}
 
-		plot(map[string]*wavegen.Signal{"signal": loaded.Signal})
+		if loaded.Channels != nil {
+			data := map[string]*wavegen.Signal{}
+			for _, name := range loaded.Channels.ChannelNames() {
+				data[name] = loaded.Channels.MustChannel(name)
+			}
+			plot(data)
+		} else {
+			plot(map[string]*wavegen.Signal{"signal": loaded.Signal})
+		}
 
 		summarize(loaded)
 
 	} else if summarizeCmd.Happened() {
 		/***** summarize sub-command *********************************/
 
-		loaded, err := wavegen.ReadJSON(*summarizeInput)
+		loaded, err := wavegen.ReadFile(*summarizeInput)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to load parameters file '%s': %v\n",
 				*generateLoad, err)
@@ -399,24 +1075,55 @@ func main() {
 			os.Exit(1)
 		}
 
-		loaded, err := wavegen.FromJSON(data)
+		loaded, err := wavegen.Decode(data)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
 			os.Exit(1)
 		}
 
-		timestamps := make([]float64, 0)
-		period := 1.0 / *interpolateFrequency
-		for i := 0; float64(i) < (loaded.Signal.Duration() / period); i++ {
-			timestamps = append(timestamps, float64(i)*period)
+		channels := loaded.AllChannels()
+		if channels == nil {
+			fmt.Fprintf(os.Stderr, "Input has no signal to interpolate\n")
+			os.Exit(1)
 		}
 
-		interpedSignal := loaded.Signal.Interpolate(timestamps...)
+		// linear interpolation keeps the time base it has always had, from
+		// 0 rather than from the first sample of the input, so that its
+		// output does not change
+		var resampled *wavegen.MultiSignal
+		if *interpolateMethod == "linear" {
+			duration := channels.Duration()
+
+			timestamps := make([]float64, 0)
+			period := 1.0 / *interpolateFrequency
+			for i := 0; float64(i) < (duration / period); i++ {
+				timestamps = append(timestamps, float64(i)*period)
+			}
+
+			resampled = channels.Interpolate(timestamps...)
+		} else {
+			resampled, err = channels.Resample(*interpolateMethod, *interpolateFrequency)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to interpolate: %v\n", err)
+				os.Exit(1)
+			}
+		}
 
 		resfile := &wavegen.WaveFile{
-			Version:    0,
+			Version:    loaded.Version,
 			Parameters: nil,
-			Signal:     wavegen.SampleList(interpedSignal).ToSignal(),
+			Resampling: &wavegen.Resampling{
+				Method:           *interpolateMethod,
+				SampleRate:       *interpolateFrequency,
+				SourceSampleRate: channels.AverageSampleRate(),
+			},
+			Filters: loaded.Filters,
+		}
+
+		if loaded.Channels != nil {
+			resfile.Channels = resampled
+		} else {
+			resfile.Signal = resampled.MustChannel(wavegen.DefaultChannelName)
 		}
 
 		if *interpolateOutput == "-" {
@@ -436,6 +1143,1267 @@ func main() {
 			}
 		}
 
+	} else if regenerateCmd.Happened() {
+		/***** regenerate sub-command ********************************/
+
+		var data []byte
+		var err error
+
+		if *regenerateInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(*regenerateInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		loaded, err := wavegen.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		if loaded.Parameters == nil {
+			fmt.Fprintf(os.Stderr, "Input has no parameters to regenerate from\n")
+			os.Exit(1)
+		}
+
+		if *regenerateVerify {
+			err := loaded.Verify(*regenerateEpsilon)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Verification failed: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
+		err = loaded.Regenerate()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error while generating signal: %v\n", err)
+			os.Exit(1)
+		}
+
+		if *regenerateOutput == "-" {
+			data, err := loaded.ToJSON()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(data))
+			fmt.Print("")
+
+		} else {
+			err := loaded.WriteJSON(*regenerateOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+	} else if importWAVCmd.Happened() {
+		/***** import-wav sub-command ********************************/
+
+		var channels *wavegen.MultiSignal
+		var err error
+
+		if *importWAVInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			channels, err = wavegen.DecodeWAV(os.Stdin)
+		} else {
+			channels, err = wavegen.ReadWAV(*importWAVInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read WAV input: %v\n", err)
+			os.Exit(1)
+		}
+
+		resfile := &wavegen.WaveFile{Version: 1, Channels: channels}
+		if len(channels.Channels) == 1 {
+			resfile = &wavegen.WaveFile{
+				Version: 0,
+				Signal:  channels.MustChannel(channels.Channels[0].Name),
+			}
+		}
+
+		if *importWAVOutput == "-" {
+			data, err := resfile.ToJSON()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(data))
+			fmt.Print("")
+
+		} else {
+			err := resfile.WriteJSON(*importWAVOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+	} else if exportWAVCmd.Happened() {
+		/***** export-wav sub-command ********************************/
+
+		var data []byte
+		var err error
+
+		if *exportWAVInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(*exportWAVInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		loaded, err := wavegen.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		channels := loaded.AllChannels()
+		if channels == nil {
+			fmt.Fprintf(os.Stderr, "Input has no signal to export\n")
+			os.Exit(1)
+		}
+
+		if *exportWAVResample > 0 {
+			timestamps := make([]float64, 0)
+			period := 1.0 / float64(*exportWAVResample)
+			for i := 0; float64(i) < (channels.Duration() / period); i++ {
+				timestamps = append(timestamps, channels.T[0]+float64(i)*period)
+			}
+
+			channels = channels.Interpolate(timestamps...)
+		}
+
+		opts := &wavegen.WAVOptions{
+			BitsPerSample: *exportWAVBits,
+			Float:         *exportWAVFloat,
+			Normalize:     *exportWAVNormalize,
+			Gain:          *exportWAVGain,
+		}
+
+		var clipped int
+		if *exportWAVOutput == "-" {
+			clipped, err = wavegen.EncodeWAV(os.Stdout, channels, opts)
+		} else {
+			clipped, err = wavegen.WriteWAV(*exportWAVOutput, channels, opts)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write WAV output: %v\n", err)
+			os.Exit(1)
+		}
+
+		if clipped > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d samples were clipped, consider --normalize or --gain\n", clipped)
+		}
+
+	} else if importCSVCmd.Happened() {
+		/***** import-csv sub-command ********************************/
+
+		opts := csvOptions(*importCSVDelimiter, *importCSVTSV, *importCSVHeader, *importCSVUnit)
+		opts.TimeColumn = *importCSVTimeColumn
+		opts.ValueColumns = *importCSVColumns
+		opts.ISO8601 = *importCSVISO8601
+
+		if len([]rune(*importCSVComment)) > 1 {
+			fmt.Fprintf(os.Stderr, "Comment must be a single character, not '%s'\n", *importCSVComment)
+			os.Exit(1)
+		} else if *importCSVComment != "" {
+			opts.Comment = []rune(*importCSVComment)[0]
+		}
+
+		var channels *wavegen.MultiSignal
+		var err error
+
+		if *importCSVInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			channels, err = wavegen.DecodeCSV(os.Stdin, opts)
+		} else {
+			channels, err = wavegen.ReadCSV(*importCSVInput, opts)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read delimited input: %v\n", err)
+			os.Exit(1)
+		}
+
+		resfile := &wavegen.WaveFile{Version: 1, Channels: channels}
+		if len(channels.Channels) == 1 {
+			resfile = &wavegen.WaveFile{
+				Version: 0,
+				Signal:  channels.MustChannel(channels.Channels[0].Name),
+			}
+		}
+
+		if *importCSVOutput == "-" {
+			data, err := resfile.ToJSON()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(data))
+			fmt.Print("")
+
+		} else {
+			err := resfile.WriteJSON(*importCSVOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+	} else if exportCSVCmd.Happened() {
+		/***** export-csv sub-command ********************************/
+
+		if *exportCSVHeader == "auto" {
+			fmt.Fprintf(os.Stderr, "Header must be one of yes or no, not 'auto'\n")
+			os.Exit(1)
+		}
+
+		opts := csvOptions(*exportCSVDelimiter, *exportCSVTSV, *exportCSVHeader, *exportCSVUnit)
+		opts.TimeColumn = *exportCSVTimeColumn
+
+		var data []byte
+		var err error
+
+		if *exportCSVInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(*exportCSVInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		loaded, err := wavegen.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		channels := loaded.AllChannels()
+		if channels == nil {
+			fmt.Fprintf(os.Stderr, "Input has no signal to export\n")
+			os.Exit(1)
+		}
+
+		if *exportCSVOutput == "-" {
+			err = wavegen.EncodeCSV(os.Stdout, channels, opts)
+		} else {
+			err = wavegen.WriteCSV(*exportCSVOutput, channels, opts)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write delimited output: %v\n", err)
+			os.Exit(1)
+		}
+
+	} else if importMATCmd.Happened() {
+		/***** import-mat sub-command ********************************/
+
+		opts := &wavegen.MATOptions{
+			TimeVariable:   *importMATTime,
+			SignalVariable: *importMATSignal,
+			SampleRate:     *importMATRate,
+		}
+
+		var channels *wavegen.MultiSignal
+		var err error
+
+		if *importMATInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			channels, err = wavegen.DecodeMAT(os.Stdin, opts)
+		} else {
+			channels, err = wavegen.ReadMAT(*importMATInput, opts)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read MAT-file input: %v\n", err)
+			os.Exit(1)
+		}
+
+		resfile := &wavegen.WaveFile{Version: 1, Channels: channels}
+		if len(channels.Channels) == 1 {
+			resfile = &wavegen.WaveFile{
+				Version: 0,
+				Signal:  channels.MustChannel(channels.Channels[0].Name),
+			}
+		}
+
+		if *importMATOutput == "-" {
+			data, err := resfile.ToJSON()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(data))
+			fmt.Print("")
+
+		} else {
+			err := resfile.WriteJSON(*importMATOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+	} else if exportMATCmd.Happened() {
+		/***** export-mat sub-command ********************************/
+
+		var data []byte
+		var err error
+
+		if *exportMATInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(*exportMATInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		loaded, err := wavegen.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		if *exportMATOutput == "-" {
+			err = wavegen.EncodeMAT(os.Stdout, loaded)
+		} else {
+			err = wavegen.WriteMAT(*exportMATOutput, loaded)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write MAT-file output: %v\n", err)
+			os.Exit(1)
+		}
+
+	} else if importNPYCmd.Happened() {
+		/***** import-npy sub-command ********************************/
+
+		var channels *wavegen.MultiSignal
+
+		info, err := os.Stat(*importNPYInput)
+		if err == nil && info.IsDir() {
+			channels, err = wavegen.ReadNPY(*importNPYInput)
+		} else if err == nil {
+			var f *os.File
+			f, err = os.Open(*importNPYInput)
+			if err == nil {
+				channels, err = wavegen.DecodeSignalNPZ(f)
+				f.Close()
+			}
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read NumPy input: %v\n", err)
+			os.Exit(1)
+		}
+
+		resfile := &wavegen.WaveFile{Version: 1, Channels: channels}
+		if len(channels.Channels) == 1 {
+			resfile = &wavegen.WaveFile{
+				Version: 0,
+				Signal:  channels.MustChannel(channels.Channels[0].Name),
+			}
+		}
+
+		if *importNPYOutput == "-" {
+			data, err := resfile.ToJSON()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(data))
+			fmt.Print("")
+
+		} else {
+			err := resfile.WriteJSON(*importNPYOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+	} else if exportNPYCmd.Happened() {
+		/***** export-npy sub-command ********************************/
+
+		var data []byte
+		var err error
+
+		if *exportNPYInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(*exportNPYInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		loaded, err := wavegen.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		channels := loaded.AllChannels()
+		if channels == nil {
+			fmt.Fprintf(os.Stderr, "Input has no signal to export\n")
+			os.Exit(1)
+		}
+
+		if !*exportNPYNPZ {
+			err = wavegen.WriteNPY(*exportNPYOutput, channels)
+		} else if *exportNPYOutput == "-" {
+			err = wavegen.EncodeSignalNPZ(os.Stdout, channels)
+		} else {
+			var f *os.File
+			f, err = os.Create(*exportNPYOutput)
+			if err == nil {
+				err = wavegen.EncodeSignalNPZ(f, channels)
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+			}
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write NumPy output: %v\n", err)
+			os.Exit(1)
+		}
+
+	} else if spectrumCmd.Happened() {
+		/***** spectrum sub-command **********************************/
+
+		if *spectrumPlot && *spectrumSpectrogram {
+			fmt.Fprintf(os.Stderr, "Spectrograms can only be written as a table\n")
+			os.Exit(1)
+		}
+
+		var data []byte
+		var err error
+
+		if *spectrumInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(*spectrumInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		loaded, err := wavegen.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		channels := loaded.AllChannels()
+		if channels == nil {
+			fmt.Fprintf(os.Stderr, "Input has no signal to analyze\n")
+			os.Exit(1)
+		}
+
+		var expected []float64
+		if *spectrumCheck {
+			if loaded.Parameters == nil {
+				fmt.Fprintf(os.Stderr, "Input has no parameters to check against\n")
+				os.Exit(1)
+			}
+			expected = loaded.Parameters.PeriodicFrequencies()
+		}
+
+		names := channels.ChannelNames()
+		if *spectrumChannel != "" {
+			names = []string{*spectrumChannel}
+		}
+
+		opts := &wavegen.SpectrumOptions{
+			Window:        *spectrumWindow,
+			SegmentLength: *spectrumLength,
+			Step:          *spectrumStep,
+		}
+
+		spectra := []*wavegen.Spectrum{}
+		spectrograms := []*wavegen.Spectrogram{}
+		for _, name := range names {
+			sig, err := channels.Channel(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			sp, err := sig.Welch(opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to analyze channel '%s': %v\n", name, err)
+				os.Exit(1)
+			}
+			spectra = append(spectra, sp)
+
+			if *spectrumSpectrogram {
+				sg, err := sig.STFT(opts)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to analyze channel '%s': %v\n", name, err)
+					os.Exit(1)
+				}
+				spectrograms = append(spectrograms, sg)
+			}
+		}
+
+		out := os.Stdout
+		if *spectrumOutput != "-" {
+			out, err = os.Create(*spectrumOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		w := bufio.NewWriter(out)
+		found := writePeaks(w, names, spectra, *spectrumPeaks, expected)
+		if *spectrumSpectrogram {
+			writeSpectrograms(w, names, spectrograms)
+		} else if !*spectrumPlot {
+			writeSpectra(w, names, spectra)
+		}
+
+		err = w.Flush()
+		if err == nil && out != os.Stdout {
+			err = out.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+
+		if !found {
+			fmt.Fprintf(os.Stderr, "Not every frequency in the parameters was found in the spectrum\n")
+			os.Exit(1)
+		}
+
+		if *spectrumPlot {
+			data := map[string]*wavegen.Signal{}
+			for i, name := range names {
+				db := make([]float64, len(spectra[i].Power))
+				for k, p := range spectra[i].Power {
+					db[k] = wavegen.Decibels(p)
+				}
+				data[name] = &wavegen.Signal{T: spectra[i].Frequencies, S: db}
+			}
+			plot(data)
+		}
+
+	} else if filterCmd.Happened() {
+		/***** filter sub-command ************************************/
+
+		var data []byte
+		var err error
+
+		if *filterInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(*filterInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		loaded, err := wavegen.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		channels := loaded.AllChannels()
+		if channels == nil {
+			fmt.Fprintf(os.Stderr, "Input has no signal to filter\n")
+			os.Exit(1)
+		}
+
+		// only the options which apply to the kind of filter are used
+		spec := &wavegen.FilterSpec{Kind: *filterKind, ZeroPhase: *filterZeroPhase}
+		switch *filterKind {
+		case "fir":
+			spec.Response = *filterResponse
+			spec.Cutoffs = *filterCutoffs
+			spec.Taps = *filterTaps
+			spec.Window = *filterWindow
+		case "butterworth":
+			spec.Response = *filterResponse
+			spec.Cutoffs = *filterCutoffs
+			spec.Order = *filterOrder
+		default:
+			spec.Width = *filterWidth
+		}
+
+		filtered, filter, err := channels.Filter(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to filter: %v\n", err)
+			os.Exit(1)
+		}
+
+		resfile := &wavegen.WaveFile{
+			Version:    loaded.Version,
+			Parameters: nil,
+			Resampling: loaded.Resampling,
+			Filters:    append(loaded.Filters, filter.Spec),
+		}
+
+		if loaded.Channels != nil {
+			resfile.Channels = filtered
+		} else {
+			resfile.Signal = filtered.MustChannel(wavegen.DefaultChannelName)
+		}
+
+		if *filterOutput == "-" {
+			data, err := resfile.ToJSON()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(data))
+
+		} else {
+			err := resfile.WriteJSON(*filterOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+	} else if opsCmd.Happened() {
+		/***** ops sub-command ***************************************/
+
+		// the number of inputs each operation takes, 0 for any
+		inputs := *opsInputs
+		arity := 1
+		switch *opsOperation {
+		case "add", "multiply", "mix", "concat":
+			arity = 0
+		case "subtract":
+			arity = 2
+		}
+
+		if arity != 0 && len(inputs) != arity {
+			fmt.Fprintf(os.Stderr, "Operation '%s' takes %d input(s), not %d\n", *opsOperation, arity, len(inputs))
+			os.Exit(1)
+		}
+
+		loaded := []*wavegen.WaveFile{}
+		signals := []*wavegen.MultiSignal{}
+		readStdin := false
+		for _, input := range inputs {
+			var data []byte
+			var err error
+
+			if input == "-" {
+				if readStdin {
+					fmt.Fprintf(os.Stderr, "Standard in may only be given as one input\n")
+					os.Exit(1)
+				}
+				readStdin = true
+
+				if isatty.IsTerminal(os.Stdin.Fd()) {
+					fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+				}
+
+				data, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				data, err = ioutil.ReadFile(input)
+			}
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read input '%s': %v\n", input, err)
+				os.Exit(1)
+			}
+
+			wf, err := wavegen.Decode(data)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to parse input '%s': %v\n", input, err)
+				os.Exit(1)
+			}
+
+			channels := wf.AllChannels()
+			if channels == nil {
+				fmt.Fprintf(os.Stderr, "Input '%s' has no signal\n", input)
+				os.Exit(1)
+			}
+
+			loaded = append(loaded, wf)
+			signals = append(signals, channels)
+		}
+
+		var op func([]*wavegen.Signal) (*wavegen.Signal, error)
+		switch *opsOperation {
+		case "add", "subtract", "multiply":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) {
+				res := s[0]
+				for _, o := range s[1:] {
+					var err error
+					switch *opsOperation {
+					case "add":
+						res, err = res.Add(o)
+					case "subtract":
+						res, err = res.Subtract(o)
+					default:
+						res, err = res.Multiply(o)
+					}
+					if err != nil {
+						return nil, err
+					}
+				}
+				return res, nil
+			}
+		case "mix":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) { return wavegen.Mix(s, *opsWeights) }
+		case "concat":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) { return wavegen.Concat(s...) }
+		case "slice":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) { return s[0].Slice(*opsStart, *opsEnd) }
+		case "shift":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) { return s[0].Shift(*opsSeconds), nil }
+		case "scale":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) { return s[0].Scale(*opsGain), nil }
+		case "window":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) { return s[0].Window(*opsKind, *opsSeconds) }
+		case "normalize":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) { return s[0].Normalize(*opsGain) }
+		case "standardize":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) { return s[0].Standardize() }
+		case "detrend":
+			op = func(s []*wavegen.Signal) (*wavegen.Signal, error) { return s[0].Detrend(), nil }
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown operation '%s', must be one of: %s\n", *opsOperation, strings.Join(opsOperations, ", "))
+			os.Exit(1)
+		}
+
+		result, err := wavegen.ZipChannels(signals, op)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to %s: %v\n", *opsOperation, err)
+			os.Exit(1)
+		}
+
+		// the result has the channels of the first input, and only an
+		// edit of a single input keeps the record of how it was processed
+		resfile := &wavegen.WaveFile{
+			Version:    loaded[0].Version,
+			Parameters: nil,
+		}
+
+		if len(loaded) == 1 {
+			resfile.Resampling = loaded[0].Resampling
+			resfile.Filters = loaded[0].Filters
+		}
+
+		if loaded[0].Channels != nil {
+			resfile.Channels = result
+		} else {
+			resfile.Signal = result.MustChannel(wavegen.DefaultChannelName)
+		}
+
+		if *opsOutput == "-" {
+			data, err := resfile.ToJSON()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to generate JSON: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(data))
+
+		} else {
+			err := resfile.WriteJSON(*opsOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+	} else if streamCmd.Happened() {
+		/***** stream sub-command ************************************/
+
+		var data []byte
+		var err error
+
+		if *streamInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(*streamInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		loaded, err := wavegen.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		var src wavegen.ChunkSource
+		if *streamRegenerate {
+			if loaded.Parameters == nil {
+				fmt.Fprintf(os.Stderr, "Input has no parameters to regenerate from\n")
+				os.Exit(1)
+			}
+
+			if *streamDuration > 0 {
+				loaded.Parameters.Duration = *streamDuration
+			}
+
+			gen, err := loaded.Parameters.NewGenerator()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to regenerate signal: %v\n", err)
+				os.Exit(1)
+			}
+			src = gen.Source()
+
+		} else {
+			channels := loaded.AllChannels()
+			if channels == nil {
+				fmt.Fprintf(os.Stderr, "Input has no signal to play\n")
+				os.Exit(1)
+			}
+			src = wavegen.NewSignalSource(channels)
+		}
+
+		var out io.Writer
+		switch *streamTransport {
+		case "stdout":
+			out = os.Stdout
+
+		case "unix", "tcp":
+			if *streamAddress == "" {
+				fmt.Fprintf(os.Stderr, "The %s transport requires an address\n", *streamTransport)
+				os.Exit(1)
+			}
+
+			listener, err := net.Listen(*streamTransport, *streamAddress)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to listen: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Fprintf(os.Stderr, "Waiting for a client on %s.\n", listener.Addr())
+			conn, err := listener.Accept()
+			listener.Close()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to accept a client: %v\n", err)
+				os.Exit(1)
+			}
+			defer conn.Close()
+			out = conn
+
+		case "udp":
+			if *streamAddress == "" {
+				fmt.Fprintf(os.Stderr, "The udp transport requires an address\n")
+				os.Exit(1)
+			}
+
+			conn, err := net.Dial("udp", *streamAddress)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to connect: %v\n", err)
+				os.Exit(1)
+			}
+			defer conn.Close()
+			out = conn
+
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown transport '%s', must be one of: %s\n", *streamTransport, strings.Join(streamTransports, ", "))
+			os.Exit(1)
+		}
+
+		loops := *streamLoops
+		if loops == 0 {
+			loops = -1
+		}
+
+		err = wavegen.Play(out, src, &wavegen.PlayOptions{
+			Framing: *streamFraming,
+			Times:   *streamTimes,
+			Speed:   *streamSpeed,
+			Loops:   loops,
+			Batch:   *streamBatch,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to stream: %v\n", err)
+			os.Exit(1)
+		}
+
+	} else if datasetCmd.Happened() {
+		/***** dataset sub-command ***********************************/
+
+		var data []byte
+		var err error
+
+		if *datasetInput == "-" {
+			if isatty.IsTerminal(os.Stdin.Fd()) {
+				fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+			}
+
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(*datasetInput)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read input: %v\n", err)
+			os.Exit(1)
+		}
+
+		loaded, err := wavegen.Decode(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse input: %v\n", err)
+			os.Exit(1)
+		}
+
+		channels := loaded.AllChannels()
+		if channels == nil {
+			fmt.Fprintf(os.Stderr, "Input has no signal to make a dataset of\n")
+			os.Exit(1)
+		}
+
+		name := *datasetChannel
+		if name == "" {
+			if len(channels.Channels) != 1 {
+				fmt.Fprintf(os.Stderr, "Input has channels %s, so one must be chosen\n", strings.Join(channels.ChannelNames(), ", "))
+				os.Exit(1)
+			}
+			name = channels.Channels[0].Name
+		}
+
+		sig, err := channels.Channel(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+
+		dataset, err := sig.Dataset(&wavegen.DatasetOptions{
+			Window:     *datasetWindow,
+			Horizon:    *datasetHorizon,
+			Stride:     *datasetStride,
+			Validation: *datasetValidation,
+			Test:       *datasetTest,
+			Normalize:  *datasetNormalize,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to make dataset: %v\n", err)
+			os.Exit(1)
+		}
+
+		var result []byte
+		switch *datasetFormat {
+		case "json":
+			result, err = dataset.ToJSON()
+		case "binary":
+			buf := &bytes.Buffer{}
+			err = dataset.EncodeBinary(buf)
+			result = buf.Bytes()
+		default:
+			err = fmt.Errorf("unknown format '%s', must be one of: %s", *datasetFormat, strings.Join(wavegen.DatasetFormats, ", "))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode dataset: %v\n", err)
+			os.Exit(1)
+		}
+
+		if *datasetOutput == "-" {
+			os.Stdout.Write(result)
+		} else {
+			err := ioutil.WriteFile(*datasetOutput, result, 0644)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+	} else if compareCmd.Happened() {
+		/***** compare sub-command ***********************************/
+
+		if *compareReference == "-" && *compareCandidate == "-" {
+			fmt.Fprintf(os.Stderr, "Standard in can only be read for one of the reference and the candidate\n")
+			os.Exit(1)
+		}
+
+		files := []*wavegen.MultiSignal{}
+		for _, input := range []string{*compareReference, *compareCandidate} {
+			var data []byte
+			var err error
+
+			if input == "-" {
+				if isatty.IsTerminal(os.Stdin.Fd()) {
+					fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+				}
+
+				data, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				data, err = ioutil.ReadFile(input)
+			}
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read input '%s': %v\n", input, err)
+				os.Exit(1)
+			}
+
+			loaded, err := wavegen.Decode(data)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to parse input '%s': %v\n", input, err)
+				os.Exit(1)
+			}
+
+			channels := loaded.AllChannels()
+			if channels == nil {
+				fmt.Fprintf(os.Stderr, "Input '%s' has no signal to compare\n", input)
+				os.Exit(1)
+			}
+			files = append(files, channels)
+		}
+		reference, candidate := files[0], files[1]
+
+		names := reference.ChannelNames()
+		if *compareChannel != "" {
+			names = []string{*compareChannel}
+		}
+
+		if *compareHorizons && len(names) != 1 {
+			fmt.Fprintf(os.Stderr, "Reference has channels %s, so one must be chosen to compare horizons with\n", strings.Join(names, ", "))
+			os.Exit(1)
+		}
+
+		opts := &wavegen.CompareOptions{Align: *compareAlign, MaxLag: *compareMaxLag}
+		comparisons := map[string]*wavegen.Comparison{}
+		exceeded := false
+
+		for _, name := range names {
+			ref, err := reference.Channel(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			var c *wavegen.Comparison
+			if *compareHorizons {
+				horizons := []*wavegen.Signal{}
+				for _, h := range candidate.ChannelNames() {
+					horizons = append(horizons, candidate.MustChannel(h))
+				}
+
+				c, err = wavegen.CompareHorizons(ref, horizons, opts)
+			} else {
+				candidateName := name
+				if len(candidate.Channels) == 1 {
+					candidateName = candidate.Channels[0].Name
+				}
+				var cand *wavegen.Signal
+				cand, err = candidate.Channel(candidateName)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Candidate has no channel to compare with '%s': %v\n", name, err)
+					os.Exit(1)
+				}
+
+				c, err = wavegen.Compare(ref, cand, opts)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to compare channel '%s': %v\n", name, err)
+				os.Exit(1)
+			}
+
+			comparisons[name] = c
+			if *compareMaxRMSE > 0 && !(c.RMSE <= *compareMaxRMSE) {
+				exceeded = true
+			}
+		}
+
+		if *compareJSON {
+			result, err := json.MarshalIndent(comparisons, "", "\t")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to encode comparison: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s\n", result)
+		} else {
+			for i, name := range names {
+				if i > 0 {
+					fmt.Printf("\n")
+				}
+				if len(names) > 1 {
+					fmt.Printf("CHANNEL '%s'\n\n", name)
+				}
+				fmt.Print(comparisons[name].Summarize())
+			}
+		}
+
+		if exceeded {
+			fmt.Fprintf(os.Stderr, "RMSE exceeds %f\n", *compareMaxRMSE)
+			os.Exit(1)
+		}
+
+	} else if plotCmd.Happened() {
+		/***** plot sub-command **************************************/
+
+		format := *plotFormat
+		if format == "" {
+			format = "png"
+			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(*plotOutput), "."))
+			for _, f := range wavegen.PlotFormats {
+				if ext == f {
+					format = ext
+				}
+			}
+		}
+
+		names := []string{}
+		signals := []*wavegen.Signal{}
+		readStdin := false
+		for _, input := range *plotInputs {
+			var data []byte
+			var err error
+
+			if input == "-" {
+				if readStdin {
+					fmt.Fprintf(os.Stderr, "Standard in may only be given as one input\n")
+					os.Exit(1)
+				}
+				readStdin = true
+
+				if isatty.IsTerminal(os.Stdin.Fd()) {
+					fmt.Fprintf(os.Stderr, "Reading input from standard in.\n")
+				}
+
+				data, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				data, err = ioutil.ReadFile(input)
+			}
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read input '%s': %v\n", input, err)
+				os.Exit(1)
+			}
+
+			wf, err := wavegen.Decode(data)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to parse input '%s': %v\n", input, err)
+				os.Exit(1)
+			}
+
+			channels := wf.AllChannels()
+			if channels == nil {
+				fmt.Fprintf(os.Stderr, "Input '%s' has no signal\n", input)
+				os.Exit(1)
+			}
+
+			selected := channels.ChannelNames()
+			if len(*plotChannels) > 0 {
+				selected = *plotChannels
+			}
+
+			for _, name := range selected {
+				sig, err := channels.Channel(name)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Input '%s': %v\n", input, err)
+					os.Exit(1)
+				}
+
+				// the legend names the file of each channel if
+				// there are several
+				if len(*plotInputs) > 1 {
+					name = fmt.Sprintf("%s: %s", input, name)
+				}
+
+				names = append(names, name)
+				signals = append(signals, sig)
+			}
+		}
+
+		buf := &bytes.Buffer{}
+		err := wavegen.Plot(buf, names, signals, &wavegen.PlotOptions{
+			Format: format,
+			Title:  *plotTitle,
+			XLabel: *plotXLabel,
+			YLabel: *plotYLabel,
+			Start:  *plotStart,
+			End:    *plotEnd,
+			Width:  *plotWidth,
+			Height: *plotHeight,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to plot: %v\n", err)
+			os.Exit(1)
+		}
+
+		if *plotOutput == "-" {
+			os.Stdout.Write(buf.Bytes())
+		} else {
+			err := ioutil.WriteFile(*plotOutput, buf.Bytes(), 0644)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 	} else {
 		err := fmt.Errorf("no command specified")
 		fmt.Fprint(os.Stderr, parser.Usage(err))
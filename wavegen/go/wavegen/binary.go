@@ -0,0 +1,252 @@
+package wavegen
+
+import (
+	"bufio"
+	"bytes"
+	bin "encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// This file implements the binary variant of the wavegen file, which is
+// quicker to write and read than JSON, and can be read a chunk at a time.
+//
+// A binary file begins with binaryMagic, followed by the length of a JSON
+// header as a little endian uint32, and the header itself, which is a
+// binaryHeader. Then follows a record for each sample, which is the time
+// followed by the value of each channel in order, each a little endian
+// float64. The number of samples is not recorded, as the file may be
+// written to a pipe, so records continue until the end of the file.
+
+// binaryMagic begins every binary wavegen file.
+const binaryMagic = "WAVEGENB"
+
+// maxBinaryHeaderLength bounds the header which will be read, so that a
+// corrupt length does not exhaust memory.
+const maxBinaryHeaderLength = 1 << 24
+
+// binaryHeader is the JSON header of a binary wavegen file.
+type binaryHeader struct {
+	Version    int
+	Parameters *WaveParameters `json:",omitempty"`
+	Resampling *Resampling     `json:",omitempty"`
+	Filters    []FilterSpec    `json:",omitempty"`
+	Channels   []string
+	SampleRate float64
+}
+
+// writeBinaryHeader writes everything which comes before the first record
+// of a binary wavegen file.
+func writeBinaryHeader(w io.Writer, wf *WaveFile, channels []string, sampleRate float64) error {
+	header, err := json.Marshal(&binaryHeader{
+		Version:    wf.Version,
+		Parameters: wf.Parameters,
+		Resampling: wf.Resampling,
+		Filters:    wf.Filters,
+		Channels:   channels,
+		SampleRate: sampleRate,
+	})
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(binaryMagic)
+	bin.Write(buf, bin.LittleEndian, uint32(len(header)))
+	buf.Write(header)
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// StreamDecoder reads a binary wavegen file a chunk at a time, as written by
+// StreamEncoder.
+type StreamDecoder struct {
+	r      *bufio.Reader
+	header *WaveFile
+	names  []string
+	rate   float64
+	record []byte
+}
+
+// NewStreamDecoder reads the header of a binary wavegen file from r, leaving
+// its samples to be read by Next().
+func NewStreamDecoder(r io.Reader) (*StreamDecoder, error) {
+	br := bufio.NewReader(r)
+
+	prefix := make([]byte, len(binaryMagic)+4)
+	_, err := io.ReadFull(br, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read binary wave file header: %v", err)
+	}
+
+	if string(prefix[:len(binaryMagic)]) != binaryMagic {
+		return nil, fmt.Errorf("Not a binary wave file")
+	}
+
+	length := bin.LittleEndian.Uint32(prefix[len(binaryMagic):])
+	if length > maxBinaryHeaderLength {
+		return nil, fmt.Errorf("Binary wave file header of %d bytes is too long", length)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(br, data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read binary wave file header: %v", err)
+	}
+
+	header := &binaryHeader{}
+	err = json.Unmarshal(data, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Version != 0 && header.Version != 1 {
+		return nil, fmt.Errorf("Don't know how to read a wave file with version %d", header.Version)
+	}
+
+	if len(header.Channels) == 0 || (header.Version == 0 && len(header.Channels) != 1) {
+		return nil, fmt.Errorf("Version %d wave file cannot have %d channels", header.Version, len(header.Channels))
+	}
+
+	empty := &MultiSignal{}
+	for _, name := range header.Channels {
+		err = empty.AddChannel(name, []float64{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if header.Parameters != nil {
+		header.Parameters.setDefaults()
+	}
+
+	return &StreamDecoder{
+		r: br,
+		header: &WaveFile{
+			Version:    header.Version,
+			Parameters: header.Parameters,
+			Resampling: header.Resampling,
+			Filters:    header.Filters,
+		},
+		names:  header.Channels,
+		rate:   header.SampleRate,
+		record: make([]byte, 8*(len(header.Channels)+1)),
+	}, nil
+}
+
+// Header returns the version, parameters, resampling, and filters of the
+// file, without its signal.
+func (d *StreamDecoder) Header() *WaveFile {
+	return d.header
+}
+
+// ChannelNames returns the names of the channels of the file, in order.
+func (d *StreamDecoder) ChannelNames() []string {
+	return append([]string{}, d.names...)
+}
+
+// SampleRate returns the sample rate recorded in the file.
+func (d *StreamDecoder) SampleRate() float64 {
+	return d.rate
+}
+
+// Next reads the next chunk of the signal, of n samples, or fewer if there
+// are not that many remaining. It returns io.EOF once every sample has been
+// read.
+func (d *StreamDecoder) Next(n int) (*MultiSignal, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("Chunk size must be positive, not %d", n)
+	}
+
+	chunk := &MultiSignal{T: []float64{}, Channels: make([]Channel, len(d.names)), SampleRate: d.rate}
+	for j, name := range d.names {
+		chunk.Channels[j] = Channel{Name: name, S: []float64{}}
+	}
+
+	for i := 0; i < n; i++ {
+		_, err := io.ReadFull(d.r, d.record)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("Binary wave file ends part way through a sample")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		chunk.T = append(chunk.T, math.Float64frombits(bin.LittleEndian.Uint64(d.record)))
+		for j := range chunk.Channels {
+			v := math.Float64frombits(bin.LittleEndian.Uint64(d.record[8*(j+1):]))
+			chunk.Channels[j].S = append(chunk.Channels[j].S, v)
+		}
+	}
+
+	if chunk.Size() == 0 {
+		return nil, io.EOF
+	}
+
+	return chunk, nil
+}
+
+// FromBinary loads a binary wavegen file held in memory. As with FromJSON(),
+// the signal of a version 0 file is stored in Signal, and that of a version 1
+// file in Channels.
+func FromBinary(data []byte) (*WaveFile, error) {
+	d, err := NewStreamDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	all := &MultiSignal{T: []float64{}, SampleRate: d.SampleRate()}
+	for _, name := range d.names {
+		all.Channels = append(all.Channels, Channel{Name: name, S: []float64{}})
+	}
+
+	for {
+		chunk, err := d.Next(DefaultChunkSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		all.T = append(all.T, chunk.T...)
+		for j, c := range chunk.Channels {
+			all.Channels[j].S = append(all.Channels[j].S, c.S...)
+		}
+	}
+
+	wf := d.Header()
+	if wf.Version == 0 {
+		wf.Signal = all.MustChannel(d.names[0])
+	} else {
+		wf.Channels = all
+	}
+
+	return wf, nil
+}
+
+// Decode loads a wavegen file in either the JSON or the binary format.
+func Decode(data []byte) (*WaveFile, error) {
+	if bytes.HasPrefix(data, []byte(binaryMagic)) {
+		return FromBinary(data)
+	}
+	return FromJSON(data)
+}
+
+// ReadFile loads a wavegen file on disk in either the JSON or the binary
+// format.
+func ReadFile(path string) (*WaveFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Decode(data)
+}
@@ -0,0 +1,361 @@
+package wavegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// This file implements comparing a candidate signal, such as the predictions
+// of a model running on hardware, against a reference signal, such as the
+// ground truth, after removing any constant lag between them.
+//
+// A model which forecasts several samples ahead gives one candidate per
+// horizon, as in a Dataset, the horizon being the number of samples after the
+// last input at which the prediction is taken. CompareHorizons() reports the
+// error of each, so that error which grows with the horizon can be seen.
+
+// CompareOptions controls how Compare() aligns and compares two signals.
+type CompareOptions struct {
+	// Align is true if a constant lag between the signals is estimated
+	// by cross-correlation, and removed before comparing them.
+	Align bool
+
+	// MaxLag is the largest lag in seconds, either way, which is searched
+	// for. If 0, a quarter of the duration of the reference is used.
+	MaxLag float64
+}
+
+// Comparison holds the metrics of a comparison of a candidate signal against
+// a reference.
+type Comparison struct {
+	// Lag is the time in seconds by which the candidate was delayed
+	// relative to the reference, which was removed before comparing them.
+	Lag float64
+
+	// Samples is the number of samples of the reference at which the
+	// signals were compared, those within the duration of the candidate.
+	Samples int
+
+	// RMSE, MAE, and MaxError are the root mean square, mean absolute, and
+	// largest absolute difference of the candidate from the reference.
+	RMSE     float64
+	MAE      float64
+	MaxError float64
+
+	// SNR is the ratio of the power of the reference to that of the error,
+	// in decibels.
+	SNR float64
+
+	// Correlation is the Pearson correlation coefficient of the signals.
+	// It is NaN if either is constant.
+	Correlation float64
+
+	// Horizons holds the error of the candidate for each horizon, if it
+	// was made by CompareHorizons().
+	Horizons []HorizonError
+}
+
+// HorizonError holds the error of the candidate for one horizon.
+type HorizonError struct {
+	// Horizon is the number of samples ahead which were predicted.
+	Horizon int
+
+	Samples  int
+	RMSE     float64
+	MAE      float64
+	MaxError float64
+}
+
+// Compare aligns the candidate with the reference, and compares them at the
+// times of the reference which are within the duration of the candidate,
+// linearly interpolating the candidate at those times. If opts.Align is set,
+// the reference must be uniformly sampled.
+func Compare(reference, candidate *Signal, opts *CompareOptions) (*Comparison, error) {
+	if opts == nil {
+		opts = &CompareOptions{}
+	}
+
+	if reference.Size() == 0 || candidate.Size() == 0 {
+		return nil, fmt.Errorf("Cannot compare empty signals")
+	}
+
+	c := &Comparison{}
+	if opts.Align {
+		lag, err := EstimateLag(reference, candidate, opts.MaxLag)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Lag = lag
+		candidate = candidate.Shift(-lag)
+	}
+
+	first := candidate.T[0]
+	last := candidate.T[candidate.Size()-1]
+	overlap, err := reference.Slice(first, last)
+	if err != nil {
+		return nil, fmt.Errorf("The candidate does not overlap the reference: %v", err)
+	}
+
+	errors, err := overlap.Subtract(candidate)
+	if err != nil {
+		return nil, err
+	}
+	aligned := overlap.align(candidate)
+	c.Samples = overlap.Size()
+
+	c.RMSE, c.MAE, c.MaxError = errorMetrics(errors.S)
+
+	signalPower, errorPower := 0.0, 0.0
+	for i, v := range overlap.S {
+		signalPower += v * v
+		errorPower += errors.S[i] * errors.S[i]
+	}
+	c.SNR = 10 * math.Log10(signalPower/errorPower)
+
+	c.Correlation = correlation(overlap.S, aligned)
+
+	return c, nil
+}
+
+// CompareHorizons compares the predictions of a model which forecasts several
+// samples ahead against the reference. candidates[h-1] holds the predictions h
+// samples ahead, each at the time of the sample of the reference which it
+// predicts. The metrics of the comparison are those of the first horizon, as
+// Compare() gives, and Horizons holds the error of each. If opts.Align is set,
+// the lag is estimated from the first horizon, and removed from each, as the
+// latency of a pipeline is the same for every horizon.
+func CompareHorizons(reference *Signal, candidates []*Signal, opts *CompareOptions) (*Comparison, error) {
+	if opts == nil {
+		opts = &CompareOptions{}
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("Must compare at least one horizon")
+	}
+
+	c, err := Compare(reference, candidates[0], opts)
+	if err != nil {
+		return nil, fmt.Errorf("Horizon 1: %v", err)
+	}
+
+	for i, candidate := range candidates {
+		h, err := Compare(reference, candidate.Shift(-c.Lag), &CompareOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("Horizon %d: %v", i+1, err)
+		}
+
+		c.Horizons = append(c.Horizons, HorizonError{
+			Horizon:  i + 1,
+			Samples:  h.Samples,
+			RMSE:     h.RMSE,
+			MAE:      h.MAE,
+			MaxError: h.MaxError,
+		})
+	}
+
+	return c, nil
+}
+
+// errorMetrics computes the root mean square, mean absolute, and largest
+// absolute values of the errors, which are NaN if there are none.
+func errorMetrics(errors []float64) (float64, float64, float64) {
+	if len(errors) == 0 {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+
+	squares, absolutes, largest := 0.0, 0.0, 0.0
+	for _, e := range errors {
+		squares += e * e
+		absolutes += math.Abs(e)
+		largest = math.Max(largest, math.Abs(e))
+	}
+
+	n := float64(len(errors))
+	return math.Sqrt(squares / n), absolutes / n, largest
+}
+
+// correlation computes the Pearson correlation coefficient of a and b, which
+// is NaN if either is constant.
+func correlation(a, b []float64) float64 {
+	meanA, meanB := 0.0, 0.0
+	for i := range a {
+		meanA += a[i] / float64(len(a))
+		meanB += b[i] / float64(len(b))
+	}
+
+	cov, varA, varB := 0.0, 0.0, 0.0
+	for i := range a {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+		varA += (a[i] - meanA) * (a[i] - meanA)
+		varB += (b[i] - meanB) * (b[i] - meanB)
+	}
+
+	if varA == 0 || varB == 0 {
+		return math.NaN()
+	}
+
+	return cov / math.Sqrt(varA*varB)
+}
+
+// EstimateLag estimates the time in seconds by which the candidate is delayed
+// relative to the reference, up to maxLag either way, by the peak of their
+// cross-correlation, refined to a fraction of a sample by fitting a parabola.
+// If maxLag is 0, a quarter of the duration of the reference is used. The
+// reference must be uniformly sampled, and the candidate is linearly
+// interpolated at its times.
+func EstimateLag(reference, candidate *Signal, maxLag float64) (float64, error) {
+	rate, err := reference.ToMultiSignal(DefaultChannelName).UniformSampleRate(1e-6)
+	if err != nil {
+		return 0, fmt.Errorf("Estimating lag requires a uniformly sampled reference, see interpolate: %v", err)
+	}
+
+	if maxLag < 0 {
+		return 0, fmt.Errorf("Largest lag must not be negative, not %f", maxLag)
+	}
+	if maxLag == 0 {
+		maxLag = reference.Duration() / 4
+	}
+
+	n := reference.Size()
+	maxShift := int(math.Round(maxLag * rate))
+	if maxShift > n-1 {
+		maxShift = n - 1
+	}
+
+	// both are zero-mean, so that their offsets do not dominate the
+	// correlation
+	ref := reference.S
+	cand := reference.align(candidate)
+	meanRef, meanCand := 0.0, 0.0
+	for i := range ref {
+		meanRef += ref[i] / float64(n)
+		meanCand += cand[i] / float64(n)
+	}
+
+	// padded so that the circular correlation computed by the FFT is
+	// the same as the linear one
+	m := 1
+	for m < 2*n {
+		m <<= 1
+	}
+	a := make([]complex128, m)
+	b := make([]complex128, m)
+	for i := range ref {
+		a[i] = complex(ref[i]-meanRef, 0)
+		b[i] = complex(cand[i]-meanCand, 0)
+	}
+
+	fa := FFT(a)
+	fb := FFT(b)
+	for i := range fa {
+		fa[i] = cmplx.Conj(fa[i]) * fb[i]
+	}
+	xcorr := IFFT(fa)
+
+	// the mean correlation at a shift of k samples, over the n-|k|
+	// samples which overlap, so that the candidate delayed by k samples
+	// peaks at k, without the peak being biased towards no shift
+	at := func(k int) float64 {
+		overlap := float64(n - k)
+		if k < 0 {
+			overlap = float64(n + k)
+			k += m
+		}
+		return real(xcorr[k]) / overlap
+	}
+
+	best := 0
+	for k := -maxShift; k <= maxShift; k++ {
+		if at(k) > at(best) {
+			best = k
+		}
+	}
+
+	shift := float64(best)
+	if best > -maxShift && best < maxShift {
+		y0, y1, y2 := at(best-1), at(best), at(best+1)
+		if d := y0 - 2*y1 + y2; d < 0 {
+			shift += 0.5 * (y0 - y2) / d
+		}
+	}
+
+	return shift / rate, nil
+}
+
+// Summarize describes the comparison in the same way as Signal.Summarize().
+func (c *Comparison) Summarize() string {
+	str := "COMPARISON SUMMARY:\n\n"
+	str = fmt.Sprintf("%s\tLag  . . . . . . . . . . %fs\n", str, c.Lag)
+	str = fmt.Sprintf("%s\t# of Samples . . . . . . %d\n", str, c.Samples)
+	str = fmt.Sprintf("%s\tRMSE . . . . . . . . . . %f\n", str, c.RMSE)
+	str = fmt.Sprintf("%s\tMAE  . . . . . . . . . . %f\n", str, c.MAE)
+	str = fmt.Sprintf("%s\tMax Error  . . . . . . . %f\n", str, c.MaxError)
+	str = fmt.Sprintf("%s\tSNR  . . . . . . . . . . %fdB\n", str, c.SNR)
+	str = fmt.Sprintf("%s\tCorrelation  . . . . . . %f\n", str, c.Correlation)
+
+	if len(c.Horizons) > 0 {
+		str = fmt.Sprintf("%s\n\tERROR BY HORIZON:\n\n", str)
+		str = fmt.Sprintf("%s\t%8s %8s %12s %12s %12s\n", str, "Horizon", "Samples", "RMSE", "MAE", "Max Error")
+		for _, h := range c.Horizons {
+			str = fmt.Sprintf("%s\t%8d %8d %12f %12f %12f\n", str, h.Horizon, h.Samples, h.RMSE, h.MAE, h.MaxError)
+		}
+	}
+
+	return str
+}
+
+// finite returns a pointer to v, or nil if v is infinite or NaN, which JSON
+// cannot represent.
+func finite(v float64) *float64 {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+// horizonJSON is a HorizonError as it is written as JSON.
+type horizonJSON struct {
+	Horizon  int
+	Samples  int
+	RMSE     *float64
+	MAE      *float64
+	MaxError *float64
+}
+
+// MarshalJSON implements json.Marshaler, writing metrics which are infinite or
+// NaN, such as the SNR of identical signals, as null.
+func (c *Comparison) MarshalJSON() ([]byte, error) {
+	horizons := []horizonJSON{}
+	for _, h := range c.Horizons {
+		horizons = append(horizons, horizonJSON{
+			Horizon:  h.Horizon,
+			Samples:  h.Samples,
+			RMSE:     finite(h.RMSE),
+			MAE:      finite(h.MAE),
+			MaxError: finite(h.MaxError),
+		})
+	}
+
+	return json.Marshal(&struct {
+		Lag         float64
+		Samples     int
+		RMSE        *float64
+		MAE         *float64
+		MaxError    *float64
+		SNR         *float64
+		Correlation *float64
+		Horizons    []horizonJSON
+	}{
+		Lag:         c.Lag,
+		Samples:     c.Samples,
+		RMSE:        finite(c.RMSE),
+		MAE:         finite(c.MAE),
+		MaxError:    finite(c.MaxError),
+		SNR:         finite(c.SNR),
+		Correlation: finite(c.Correlation),
+		Horizons:    horizons,
+	})
+}
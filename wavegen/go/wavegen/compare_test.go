@@ -0,0 +1,168 @@
+package wavegen
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testSine returns 2s of a 3Hz sine sampled at 100Hz, delayed by lag seconds.
+func testSine(lag float64) *Signal {
+	sig := &Signal{SampleRate: 100}
+	for i := 0; i < 200; i++ {
+		t := float64(i) / 100
+		sig.T = append(sig.T, t)
+		sig.S = append(sig.S, math.Sin(2*math.Pi*3*(t-lag))+0.2*math.Sin(2*math.Pi*7*(t-lag)))
+	}
+	return sig
+}
+
+func TestCompareMetrics(t *testing.T) {
+	reference := &Signal{T: []float64{0, 1, 2, 3}, S: []float64{1, 2, 3, 4}}
+	candidate := &Signal{T: []float64{0, 1, 2, 3}, S: []float64{1, 3, 3, 2}}
+
+	c, err := Compare(reference, candidate, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := &Comparison{
+		Samples:     4,
+		RMSE:        math.Sqrt(5.0 / 4),
+		MAE:         3.0 / 4,
+		MaxError:    2,
+		SNR:         10 * math.Log10(30.0/5),
+		Correlation: 0.3 / math.Sqrt(0.55),
+	}
+	if !cmp.Equal(c, expect, approxEqual) {
+		t.Errorf("comparison differs:\n%s", cmp.Diff(expect, c, approxEqual))
+	}
+
+	// only the samples of the reference within the candidate are compared
+	short := &Signal{T: []float64{0.5, 2.5}, S: []float64{1.5, 3.5}}
+	c, err = Compare(reference, short, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Samples != 2 || c.RMSE != 0 || !math.IsInf(c.SNR, 1) {
+		t.Errorf("comparison with a shorter candidate is %+v", c)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"SNR":null`) || !strings.Contains(string(data), `"RMSE":0`) {
+		t.Errorf("comparison is written as %s", data)
+	}
+}
+
+func TestEstimateLag(t *testing.T) {
+	reference := testSine(0)
+	for _, lag := range []float64{0, 0.05, -0.13, 0.075} {
+		got, err := EstimateLag(reference, testSine(lag), 0.2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-lag) > 0.003 {
+			t.Errorf("estimated lag %f, expected %f", got, lag)
+		}
+	}
+
+	c, err := Compare(reference, testSine(0.05), &CompareOptions{Align: true, MaxLag: 0.2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(c.Lag-0.05) > 1e-3 || c.RMSE > 1e-3 || c.Correlation < 0.999 {
+		t.Errorf("aligned comparison is %+v", c)
+	}
+
+	c, err = Compare(reference, testSine(0.05), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RMSE < 0.1 {
+		t.Errorf("unaligned comparison has RMSE %f", c.RMSE)
+	}
+}
+
+// testForecast returns predictions of testSine(lag) for horizons 1 to n, each
+// of which is off by its horizon times offset, alternating in sign from one
+// sample to the next if alternate is set.
+func testForecast(lag, offset float64, n int, alternate bool) []*Signal {
+	candidates := []*Signal{}
+	for h := 1; h <= n; h++ {
+		sig := testSine(lag)
+		for i := range sig.S {
+			e := float64(h) * offset
+			if alternate && i%2 == 1 {
+				e = -e
+			}
+			sig.S[i] += e
+		}
+		candidates = append(candidates, sig)
+	}
+	return candidates
+}
+
+func TestCompareHorizons(t *testing.T) {
+	reference := testSine(0)
+
+	c, err := CompareHorizons(reference, testForecast(0, 0.01, 3, true), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []HorizonError{
+		{Horizon: 1, Samples: 200, RMSE: 0.01, MAE: 0.01, MaxError: 0.01},
+		{Horizon: 2, Samples: 200, RMSE: 0.02, MAE: 0.02, MaxError: 0.02},
+		{Horizon: 3, Samples: 200, RMSE: 0.03, MAE: 0.03, MaxError: 0.03},
+	}
+	if !cmp.Equal(c.Horizons, expect, approxEqual) {
+		t.Errorf("horizon errors differ:\n%s", cmp.Diff(expect, c.Horizons, approxEqual))
+	}
+	if c.RMSE != c.Horizons[0].RMSE || c.Lag != 0 {
+		t.Errorf("comparison is not that of the first horizon: %+v", c)
+	}
+
+	// the lag of the first horizon is removed from every horizon
+	c, err = CompareHorizons(reference, testForecast(0.05, 0.01, 3, false), &CompareOptions{Align: true, MaxLag: 0.2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(c.Lag-0.05) > 1e-3 {
+		t.Errorf("estimated lag %f, expected 0.05", c.Lag)
+	}
+	for i, h := range c.Horizons {
+		if math.Abs(h.MAE-0.01*float64(i+1)) > 5e-3 {
+			t.Errorf("horizon %d has MAE %f", h.Horizon, h.MAE)
+		}
+	}
+}
+
+func TestCompareErrors(t *testing.T) {
+	reference := testSine(0)
+	if _, err := Compare(reference, &Signal{}, nil); err == nil {
+		t.Errorf("empty candidate should have errored")
+	}
+	if _, err := CompareHorizons(reference, nil, nil); err == nil {
+		t.Errorf("no horizons should have errored")
+	}
+	if _, err := CompareHorizons(reference, []*Signal{reference, reference.Shift(10)}, nil); err == nil {
+		t.Errorf("horizon which does not overlap should have errored")
+	}
+	if _, err := Compare(reference, reference.Shift(10), nil); err == nil {
+		t.Errorf("candidate which does not overlap should have errored")
+	}
+	if _, err := EstimateLag(reference, reference, -1); err == nil {
+		t.Errorf("negative largest lag should have errored")
+	}
+
+	uneven := &Signal{T: []float64{0, 1, 3}, S: []float64{0, 1, 0}}
+	if _, err := EstimateLag(uneven, uneven, 0); err == nil {
+		t.Errorf("reference which is not uniformly sampled should have errored")
+	}
+}
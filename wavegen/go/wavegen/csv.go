@@ -0,0 +1,366 @@
+package wavegen
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file implements reading and writing signals as delimited text, such as
+// CSV or TSV files, with one row per sample, one column for the time, and one
+// column for each channel.
+
+// CSVHeader specifies whether delimited text has a header row naming its
+// columns.
+type CSVHeader int
+
+const (
+	// CSVHeaderAuto detects a header when reading, by checking if any
+	// column of the first row cannot be parsed as a number. When writing,
+	// it is the same as CSVHeaderPresent.
+	CSVHeaderAuto CSVHeader = iota
+
+	// CSVHeaderPresent indicates that there is a header row.
+	CSVHeaderPresent
+
+	// CSVHeaderAbsent indicates that there is no header row.
+	CSVHeaderAbsent
+)
+
+// TimeUnits maps the names of units of time to their length in seconds, for
+// use with CSVOptions.TimeScale.
+var TimeUnits = map[string]float64{
+	"s":  1,
+	"ms": 1e-3,
+	"us": 1e-6,
+	"µs": 1e-6,
+	"ns": 1e-9,
+}
+
+// iso8601Layouts are the layouts accepted for ISO-8601 timestamps. Those
+// without a time zone are read as UTC.
+var iso8601Layouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// CSVOptions controls how delimited text is read and written.
+type CSVOptions struct {
+	// Delimiter separates columns. If 0, ',' is used.
+	Delimiter rune
+
+	// Comment begins lines which should be skipped when reading. If 0,
+	// no lines are skipped.
+	Comment rune
+
+	// Header specifies whether there is a header row.
+	Header CSVHeader
+
+	// TimeColumn selects the column holding the time, by its name in the
+	// header, or by its index counting from 0. If empty, the first column
+	// is used. When writing, it is the name of the time column, or "time"
+	// if empty.
+	TimeColumn string
+
+	// ValueColumns selects the columns holding the channels, as for
+	// TimeColumn. If empty, every column other than the time is used.
+	// It is ignored when writing.
+	ValueColumns []string
+
+	// TimeScale is the length in seconds of the unit of the time column,
+	// see TimeUnits. If 0, 1 is used, meaning the times are in seconds.
+	TimeScale float64
+
+	// ISO8601 indicates that the time column holds absolute ISO-8601
+	// timestamps, rather than numbers. The times of the signal are the
+	// number of seconds since the first timestamp. It is ignored when
+	// writing.
+	ISO8601 bool
+}
+
+func (opts *CSVOptions) delimiter() rune {
+	if opts.Delimiter == 0 {
+		return ','
+	}
+	return opts.Delimiter
+}
+
+func (opts *CSVOptions) timeScale() float64 {
+	if opts.TimeScale == 0 {
+		return 1
+	}
+	return opts.TimeScale
+}
+
+// csvColumn finds the index of the column selected by name or index.
+func csvColumn(sel string, header []string, columns int) (int, error) {
+	for i, name := range header {
+		if name == sel {
+			return i, nil
+		}
+	}
+
+	i, err := strconv.Atoi(sel)
+	if err != nil {
+		return 0, fmt.Errorf("No column named '%s'", sel)
+	}
+
+	if i < 0 || i >= columns {
+		return 0, fmt.Errorf("Column %d out of bounds for %d columns", i, columns)
+	}
+
+	return i, nil
+}
+
+// parseISO8601 parses an ISO-8601 timestamp.
+func parseISO8601(s string) (time.Time, error) {
+	for _, layout := range iso8601Layouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid ISO-8601 timestamp '%s'", s)
+}
+
+// DecodeCSV reads delimited text as a multi-channel signal. The channels are
+// named by the header, or if there is none, column0, column1, and so on by the
+// index of their column. The times must be in increasing order.
+func DecodeCSV(r io.Reader, opts *CSVOptions) (*MultiSignal, error) {
+	if opts == nil {
+		opts = &CSVOptions{}
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = opts.delimiter()
+	reader.Comment = opts.Comment
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("Input has no rows")
+	}
+
+	columns := len(records[0])
+	var header []string
+
+	switch opts.Header {
+	case CSVHeaderPresent:
+		header = records[0]
+
+	case CSVHeaderAuto:
+		// ISO-8601 timestamps are not numbers, but are not a header
+		isoColumn := -1
+		if opts.ISO8601 {
+			isoColumn = 0
+			if opts.TimeColumn != "" {
+				isoColumn, err = strconv.Atoi(opts.TimeColumn)
+				if err != nil {
+					isoColumn = -1
+				}
+			}
+		}
+
+		for i, field := range records[0] {
+			_, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil && i != isoColumn {
+				header = records[0]
+				break
+			}
+		}
+	}
+
+	if header != nil {
+		records = records[1:]
+		for i := range header {
+			header[i] = strings.TrimSpace(header[i])
+		}
+	}
+
+	timeColumn := 0
+	if opts.TimeColumn != "" {
+		timeColumn, err = csvColumn(opts.TimeColumn, header, columns)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	valueColumns := []int{}
+	if len(opts.ValueColumns) == 0 {
+		for i := 0; i < columns; i++ {
+			if i != timeColumn {
+				valueColumns = append(valueColumns, i)
+			}
+		}
+	} else {
+		for _, sel := range opts.ValueColumns {
+			i, err := csvColumn(sel, header, columns)
+			if err != nil {
+				return nil, err
+			}
+			valueColumns = append(valueColumns, i)
+		}
+	}
+
+	if len(valueColumns) == 0 {
+		return nil, fmt.Errorf("Input has no value columns")
+	}
+
+	m := &MultiSignal{
+		T:        make([]float64, len(records)),
+		Channels: make([]Channel, len(valueColumns)),
+	}
+	for i, col := range valueColumns {
+		name := fmt.Sprintf("column%d", col)
+		if header != nil && col < len(header) && header[col] != "" {
+			name = header[col]
+		}
+		m.Channels[i] = Channel{Name: name, S: make([]float64, len(records))}
+	}
+
+	scale := opts.timeScale()
+	var start time.Time
+	for row, record := range records {
+		field := func(col int) (string, error) {
+			if col >= len(record) {
+				return "", fmt.Errorf("Row %d has %d columns, but column %d is needed", row+1, len(record), col)
+			}
+			return strings.TrimSpace(record[col]), nil
+		}
+
+		s, err := field(timeColumn)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.ISO8601 {
+			ts, err := parseISO8601(s)
+			if err != nil {
+				return nil, fmt.Errorf("Row %d: %v", row+1, err)
+			}
+			if row == 0 {
+				start = ts
+			}
+			m.T[row] = ts.Sub(start).Seconds()
+		} else {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Row %d: invalid time '%s'", row+1, s)
+			}
+			m.T[row] = v * scale
+		}
+
+		if row > 0 && m.T[row] < m.T[row-1] {
+			return nil, fmt.Errorf("Row %d: time %f is before that of the previous row", row+1, m.T[row])
+		}
+
+		for i, col := range valueColumns {
+			s, err := field(col)
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Row %d: invalid value '%s' in column %d", row+1, s, col)
+			}
+			m.Channels[i].S[row] = v
+		}
+	}
+
+	if m.Size() > 1 {
+		m.SampleRate = m.AverageSampleRate()
+	}
+
+	err = m.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// EncodeCSV writes a multi-channel signal as delimited text, with the time in
+// the first column, followed by a column for each channel. Times are written
+// in the unit given by TimeScale.
+func EncodeCSV(w io.Writer, m *MultiSignal, opts *CSVOptions) error {
+	if opts == nil {
+		opts = &CSVOptions{}
+	}
+
+	err := m.Validate()
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = opts.delimiter()
+
+	if opts.Header != CSVHeaderAbsent {
+		name := opts.TimeColumn
+		if name == "" {
+			name = "time"
+		}
+
+		err = writer.Write(append([]string{name}, m.ChannelNames()...))
+		if err != nil {
+			return err
+		}
+	}
+
+	scale := opts.timeScale()
+	record := make([]string, len(m.Channels)+1)
+	for i, t := range m.T {
+		record[0] = strconv.FormatFloat(t/scale, 'g', -1, 64)
+		for j, c := range m.Channels {
+			record[j+1] = strconv.FormatFloat(c.S[i], 'g', -1, 64)
+		}
+
+		err = writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadCSV reads delimited text from disk using DecodeCSV().
+func ReadCSV(path string, opts *CSVOptions) (*MultiSignal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return DecodeCSV(f, opts)
+}
+
+// WriteCSV writes the signal to disk as delimited text using EncodeCSV().
+func WriteCSV(path string, m *MultiSignal, opts *CSVOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = EncodeCSV(f, m, opts)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,149 @@
+package wavegen
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeCSV(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		opts   *CSVOptions
+		times  []float64
+		expect map[string][]float64
+	}{
+		{
+			"header detected",
+			"time,a,b\n0,1,2\n0.5,3,4\n",
+			nil,
+			[]float64{0, 0.5},
+			map[string][]float64{"a": {1, 3}, "b": {2, 4}},
+		},
+		{
+			"no header",
+			"0,1\n1,2\n2,3\n",
+			nil,
+			[]float64{0, 1, 2},
+			map[string][]float64{"column1": {1, 2, 3}},
+		},
+		{
+			"tsv with comments and milliseconds",
+			"# scope export\nms\tch1\n# trigger\n0\t5\n250\t6\n",
+			&CSVOptions{Delimiter: '\t', Comment: '#', TimeScale: TimeUnits["ms"]},
+			[]float64{0, 0.25},
+			map[string][]float64{"ch1": {5, 6}},
+		},
+		{
+			"selected columns",
+			"a,t,b,c\n1,0,2,3\n4,1,5,6\n",
+			&CSVOptions{TimeColumn: "t", ValueColumns: []string{"c", "0"}},
+			[]float64{0, 1},
+			map[string][]float64{"c": {3, 6}, "a": {1, 4}},
+		},
+		{
+			"header forced absent",
+			"0,1\n1,2\n",
+			&CSVOptions{Header: CSVHeaderAbsent, TimeColumn: "1"},
+			[]float64{1, 2},
+			map[string][]float64{"column0": {0, 1}},
+		},
+		{
+			"iso-8601",
+			"2020-03-01T12:00:00Z,1\n2020-03-01T12:00:00.5Z,2\n2020-03-01 12:00:01,3\n",
+			&CSVOptions{ISO8601: true},
+			[]float64{0, 0.5, 1},
+			map[string][]float64{"column1": {1, 2, 3}},
+		},
+	}
+
+	for _, c := range cases {
+		m, err := DecodeCSV(strings.NewReader(c.input), c.opts)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if !cmp.Equal(m.T, c.times) {
+			t.Errorf("%s: times are %v, expected %v", c.name, m.T, c.times)
+		}
+
+		if len(m.Channels) != len(c.expect) {
+			t.Errorf("%s: channels are %v", c.name, m.ChannelNames())
+		}
+
+		for name, samples := range c.expect {
+			ch, err := m.Channel(name)
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+				continue
+			}
+			if !cmp.Equal(ch.S, samples) {
+				t.Errorf("%s: channel %s is %v, expected %v", c.name, name, ch.S, samples)
+			}
+		}
+	}
+}
+
+func TestDecodeCSVErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		opts  *CSVOptions
+	}{
+		{"", nil},
+		{"0,1\n1,x\n", nil},
+		{"0,1\n1\n", nil},
+		{"1,1\n0,1\n", nil},
+		{"t,a\n0,1\n", &CSVOptions{TimeColumn: "time"}},
+		{"t,a\n0,1\n", &CSVOptions{ValueColumns: []string{"5"}}},
+		{"yesterday,1\n", &CSVOptions{ISO8601: true}},
+	}
+
+	for i, c := range cases {
+		_, err := DecodeCSV(strings.NewReader(c.input), c.opts)
+		if err == nil {
+			t.Errorf("Test case %d should have errored", i)
+		}
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	m := testStereo(t, 20, 100)
+
+	var buf bytes.Buffer
+	opts := &CSVOptions{Delimiter: '\t', TimeScale: TimeUnits["us"]}
+	err := EncodeCSV(&buf, m, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "time\tleft\tright\n0\t") {
+		t.Errorf("TSV begins %q", buf.String()[:30])
+	}
+
+	decoded, err := DecodeCSV(&buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(decoded.ChannelNames(), m.ChannelNames()) {
+		t.Fatalf("channels are %v", decoded.ChannelNames())
+	}
+	for i := range m.T {
+		if math.Abs(decoded.T[i]-m.T[i]) > 1e-12 {
+			t.Fatalf("time %d is %v, expected %v", i, decoded.T[i], m.T[i])
+		}
+		for ch := range m.Channels {
+			if decoded.Channels[ch].S[i] != m.Channels[ch].S[i] {
+				t.Fatalf("channel %d sample %d is %v, expected %v", ch, i, decoded.Channels[ch].S[i], m.Channels[ch].S[i])
+			}
+		}
+	}
+	if math.Abs(decoded.SampleRate-100) > 0.001 {
+		t.Errorf("sample rate is %f", decoded.SampleRate)
+	}
+}
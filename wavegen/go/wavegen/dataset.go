@@ -0,0 +1,353 @@
+package wavegen
+
+import (
+	"bytes"
+	bin "encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/montanaflynn/stats"
+)
+
+// This file implements turning a signal into a supervised learning dataset,
+// of windows of past samples, each labelled with a later sample to predict.
+//
+// The signal is split by time into consecutive train, validation, and test
+// segments, and windows are taken from within each segment, so that no
+// sample appears in more than one split.
+
+// DatasetFormats lists the formats in which a Dataset can be written.
+var DatasetFormats = []string{"json", "binary"}
+
+// datasetMagic begins every binary dataset file.
+const datasetMagic = "WAVEGEND"
+
+// DatasetOptions controls how a signal is divided into a dataset.
+type DatasetOptions struct {
+	// Window is the number of past samples which are the inputs of each
+	// example.
+	Window int
+
+	// Horizon is the number of samples after the last input at which the
+	// target of each example is taken, so that 1 predicts the next
+	// sample. If 0, 1 is used.
+	Horizon int
+
+	// Stride is the number of samples between the start of each window.
+	// If 0, 1 is used.
+	Stride int
+
+	// Validation and Test are the fractions of the duration of the signal
+	// used for the validation and test splits, which follow the train
+	// split, which has the rest.
+	Validation float64
+	Test       float64
+
+	// Normalize is true if the inputs and targets are standardized by the
+	// mean and standard deviation of the train split.
+	Normalize bool
+}
+
+// Normalization is the mean and standard deviation by which a dataset was
+// standardized, so that a value v of the dataset is v*StandardDeviation + Mean
+// in the original signal.
+type Normalization struct {
+	Mean              float64
+	StandardDeviation float64
+}
+
+// DatasetSplit holds the examples of one split of a dataset.
+type DatasetSplit struct {
+	// Start and End are the times of the first and last samples of the
+	// segment of the signal from which the examples were taken.
+	Start float64
+	End   float64
+
+	// Inputs is the window of past samples of each example.
+	Inputs [][]float64
+
+	// Targets is the sample to be predicted from each window.
+	Targets []float64
+
+	// Times is the time of each target.
+	Times []float64
+}
+
+// Dataset is a supervised learning dataset of windows of a signal.
+type Dataset struct {
+	Window     int
+	Horizon    int
+	Stride     int
+	SampleRate float64
+
+	// Normalization is omitted if the dataset is not normalized.
+	Normalization *Normalization `json:",omitempty"`
+
+	Train      *DatasetSplit
+	Validation *DatasetSplit
+	Test       *DatasetSplit
+}
+
+// Splits returns the train, validation, and test splits in order.
+func (d *Dataset) Splits() []*DatasetSplit {
+	return []*DatasetSplit{d.Train, d.Validation, d.Test}
+}
+
+// Size returns the number of examples in the split.
+func (ds *DatasetSplit) Size() int {
+	return len(ds.Targets)
+}
+
+// Dataset divides the signal into a supervised learning dataset as described
+// by opts. The signal must be uniformly sampled, and the train split, and the
+// validation and test splits if they are requested, must be long enough to
+// hold at least one example.
+func (s *Signal) Dataset(opts *DatasetOptions) (*Dataset, error) {
+	horizon := opts.Horizon
+	if horizon == 0 {
+		horizon = 1
+	}
+
+	stride := opts.Stride
+	if stride == 0 {
+		stride = 1
+	}
+
+	if opts.Window < 1 || horizon < 1 || stride < 1 {
+		return nil, fmt.Errorf("Window, horizon, and stride must be positive, not %d, %d, and %d", opts.Window, horizon, stride)
+	}
+
+	if opts.Validation < 0 || opts.Test < 0 || opts.Validation+opts.Test >= 1 {
+		return nil, fmt.Errorf("Validation and test fractions %f and %f must not be negative, and must leave some of the signal to train on", opts.Validation, opts.Test)
+	}
+
+	rate, err := s.ToMultiSignal(DefaultChannelName).UniformSampleRate(1e-6)
+	if err != nil {
+		return nil, fmt.Errorf("Datasets require a uniformly sampled signal, see interpolate: %v", err)
+	}
+
+	// each split ends where the next begins, and the train and
+	// validation splits take every sample if the splits after them are
+	// empty
+	bounds := []int{0, s.Size(), s.Size(), s.Size()}
+	for i, fraction := range []float64{1 - opts.Validation - opts.Test, 1 - opts.Test} {
+		if fraction < 1 {
+			bounds[i+1] = s.searchIndex(s.T[0] + fraction*s.Duration())
+		}
+	}
+
+	d := &Dataset{Window: opts.Window, Horizon: horizon, Stride: stride, SampleRate: rate}
+	splits := []**DatasetSplit{&d.Train, &d.Validation, &d.Test}
+	names := []string{"train", "validation", "test"}
+	requested := []bool{true, opts.Validation > 0, opts.Test > 0}
+
+	for i, split := range splits {
+		*split = &DatasetSplit{Inputs: [][]float64{}, Targets: []float64{}, Times: []float64{}}
+		first, end := bounds[i], bounds[i+1]
+		if first < end {
+			(*split).Start = s.T[first]
+			(*split).End = s.T[end-1]
+		}
+
+		for start := first; start+opts.Window-1+horizon < end; start += stride {
+			target := start + opts.Window - 1 + horizon
+			(*split).Inputs = append((*split).Inputs, append([]float64{}, s.S[start:start+opts.Window]...))
+			(*split).Targets = append((*split).Targets, s.S[target])
+			(*split).Times = append((*split).Times, s.T[target])
+		}
+
+		if requested[i] && (*split).Size() == 0 {
+			return nil, fmt.Errorf("The %s split of %d samples is too short for a window of %d and a horizon of %d", names[i], end-first, opts.Window, horizon)
+		}
+	}
+
+	if opts.Normalize {
+		mean, err := stats.Mean(s.S[bounds[0]:bounds[1]])
+		if err != nil {
+			return nil, err
+		}
+
+		stdev, err := stats.StandardDeviation(s.S[bounds[0]:bounds[1]])
+		if err != nil {
+			return nil, err
+		}
+
+		if stdev == 0 {
+			return nil, fmt.Errorf("Cannot normalize a train split which is constant")
+		}
+
+		d.Normalization = &Normalization{Mean: mean, StandardDeviation: stdev}
+		for _, split := range d.Splits() {
+			for _, window := range split.Inputs {
+				for j := range window {
+					window[j] = (window[j] - mean) / stdev
+				}
+			}
+			for j := range split.Targets {
+				split.Targets[j] = (split.Targets[j] - mean) / stdev
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// ToJSON converts the dataset to an in-memory JSON representation and
+// returns it.
+func (d *Dataset) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "\t")
+}
+
+// datasetHeader is the JSON header of a binary dataset file, which is the
+// dataset without the examples of its splits.
+type datasetHeader struct {
+	Window        int
+	Horizon       int
+	Stride        int
+	SampleRate    float64
+	Normalization *Normalization `json:",omitempty"`
+
+	// Splits holds the start, end, and number of examples of the train,
+	// validation, and test splits
+	Splits []datasetSplitHeader
+}
+
+// datasetSplitHeader describes a split in the header of a binary dataset
+// file.
+type datasetSplitHeader struct {
+	Start float64
+	End   float64
+	Size  int
+}
+
+// EncodeBinary writes the dataset as a binary dataset file.
+//
+// A binary dataset file begins with the 8 bytes "WAVEGEND", followed by the
+// length of a JSON header as a little endian uint32, and the header itself,
+// which holds the fields of the dataset, with a list of the Start, End, and
+// Size of the train, validation, and test splits in place of the splits. The
+// examples of each split follow in order, each a record of little endian
+// float64 values, of the time of the target, the Window inputs, and the
+// target.
+func (d *Dataset) EncodeBinary(w io.Writer) error {
+	header := &datasetHeader{
+		Window:        d.Window,
+		Horizon:       d.Horizon,
+		Stride:        d.Stride,
+		SampleRate:    d.SampleRate,
+		Normalization: d.Normalization,
+	}
+	for _, split := range d.Splits() {
+		header.Splits = append(header.Splits, datasetSplitHeader{Start: split.Start, End: split.End, Size: split.Size()})
+	}
+
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(datasetMagic)
+	bin.Write(buf, bin.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+
+	record := make([]byte, 8*(d.Window+2))
+	for _, split := range d.Splits() {
+		for i, window := range split.Inputs {
+			if len(window) != d.Window {
+				return fmt.Errorf("Example %d has %d inputs, but the window is %d", i, len(window), d.Window)
+			}
+
+			bin.LittleEndian.PutUint64(record, math.Float64bits(split.Times[i]))
+			for j, v := range window {
+				bin.LittleEndian.PutUint64(record[8*(j+1):], math.Float64bits(v))
+			}
+			bin.LittleEndian.PutUint64(record[8*(d.Window+1):], math.Float64bits(split.Targets[i]))
+			buf.Write(record)
+		}
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// DecodeDataset loads a dataset in either the JSON or the binary format.
+func DecodeDataset(data []byte) (*Dataset, error) {
+	if !bytes.HasPrefix(data, []byte(datasetMagic)) {
+		d := &Dataset{}
+		err := json.Unmarshal(data, d)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, split := range d.Splits() {
+			if split == nil || len(split.Inputs) != len(split.Targets) || len(split.Times) != len(split.Targets) {
+				return nil, fmt.Errorf("Dataset is corrupt, a split is missing or has differing numbers of inputs, targets, and times")
+			}
+		}
+
+		return d, nil
+	}
+
+	r := bytes.NewReader(data[len(datasetMagic):])
+	var length uint32
+	err := bin.Read(r, bin.LittleEndian, &length)
+	if err != nil || int(length) > r.Len() {
+		return nil, fmt.Errorf("Failed to read binary dataset header")
+	}
+
+	headerData := make([]byte, length)
+	r.Read(headerData)
+
+	header := &datasetHeader{}
+	err = json.Unmarshal(headerData, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(header.Splits) != 3 || header.Window < 1 {
+		return nil, fmt.Errorf("Binary dataset header is corrupt")
+	}
+
+	total := 0
+	for _, split := range header.Splits {
+		if split.Size < 0 {
+			return nil, fmt.Errorf("Binary dataset header is corrupt")
+		}
+		total += split.Size
+	}
+	if r.Len() != 8*(header.Window+2)*total {
+		return nil, fmt.Errorf("Binary dataset has %d bytes of examples, but its header calls for %d examples of %d inputs", r.Len(), total, header.Window)
+	}
+
+	d := &Dataset{
+		Window:        header.Window,
+		Horizon:       header.Horizon,
+		Stride:        header.Stride,
+		SampleRate:    header.SampleRate,
+		Normalization: header.Normalization,
+	}
+
+	record := make([]float64, header.Window+2)
+	splits := []**DatasetSplit{&d.Train, &d.Validation, &d.Test}
+	for i, split := range splits {
+		*split = &DatasetSplit{
+			Start:   header.Splits[i].Start,
+			End:     header.Splits[i].End,
+			Inputs:  [][]float64{},
+			Targets: []float64{},
+			Times:   []float64{},
+		}
+
+		for j := 0; j < header.Splits[i].Size; j++ {
+			bin.Read(r, bin.LittleEndian, record)
+			(*split).Times = append((*split).Times, record[0])
+			(*split).Inputs = append((*split).Inputs, append([]float64{}, record[1:header.Window+1]...))
+			(*split).Targets = append((*split).Targets, record[header.Window+1])
+		}
+	}
+
+	return d, nil
+}
@@ -0,0 +1,162 @@
+package wavegen
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testRamp returns a signal of n samples at 10Hz, each equal to its index.
+func testRamp(n int) *Signal {
+	sig := &Signal{SampleRate: 10}
+	for i := 0; i < n; i++ {
+		sig.T = append(sig.T, float64(i)/10)
+		sig.S = append(sig.S, float64(i))
+	}
+	return sig
+}
+
+func TestDataset(t *testing.T) {
+	d, err := testRamp(100).Dataset(&DatasetOptions{Window: 5, Horizon: 2, Stride: 3, Validation: 0.2, Test: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Window != 5 || d.Horizon != 2 || d.Stride != 3 || math.Abs(d.SampleRate-10) > 1e-9 || d.Normalization != nil {
+		t.Errorf("dataset has window %d, horizon %d, stride %d, and sample rate %f", d.Window, d.Horizon, d.Stride, d.SampleRate)
+	}
+
+	cases := []struct {
+		split *DatasetSplit
+		first int
+		end   int
+	}{
+		{d.Train, 0, 70},
+		{d.Validation, 70, 90},
+		{d.Test, 90, 100},
+	}
+
+	for i, c := range cases {
+		if c.split.Start != float64(c.first)/10 || math.Abs(c.split.End-float64(c.end-1)/10) > 1e-9 {
+			t.Errorf("split %d is from %fs to %fs", i, c.split.Start, c.split.End)
+		}
+
+		expect := 0
+		for start := c.first; start+6 < c.end; start += 3 {
+			expect++
+		}
+		if c.split.Size() != expect || len(c.split.Inputs) != expect || len(c.split.Times) != expect {
+			t.Errorf("split %d has %d examples, expected %d", i, c.split.Size(), expect)
+			continue
+		}
+
+		for j, window := range c.split.Inputs {
+			start := c.first + 3*j
+			if !cmp.Equal(window, []float64{float64(start), float64(start + 1), float64(start + 2), float64(start + 3), float64(start + 4)}) {
+				t.Errorf("split %d example %d has inputs %v", i, j, window)
+			}
+			if c.split.Targets[j] != float64(start+6) || math.Abs(c.split.Times[j]-float64(start+6)/10) > 1e-9 {
+				t.Errorf("split %d example %d has target %f at %fs", i, j, c.split.Targets[j], c.split.Times[j])
+			}
+
+			// no example uses samples of another split
+			if window[0] < float64(c.first) || c.split.Targets[j] >= float64(c.end) {
+				t.Errorf("split %d example %d leaks outside of its split", i, j)
+			}
+		}
+	}
+
+	// without validation and test splits, every sample is used to train
+	d, err = testRamp(10).Dataset(&DatasetOptions{Window: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Train.Size() != 1 || d.Train.Targets[0] != 9 || d.Validation.Size() != 0 || d.Test.Size() != 0 {
+		t.Errorf("dataset without splits is %v", d)
+	}
+}
+
+func TestDatasetNormalization(t *testing.T) {
+	d, err := testRamp(100).Dataset(&DatasetOptions{Window: 2, Test: 0.3, Normalize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the 70 samples of the train split are used
+	stdev := math.Sqrt((70*70 - 1) / 12.0)
+	if math.Abs(d.Normalization.Mean-34.5) > 1e-9 || math.Abs(d.Normalization.StandardDeviation-stdev) > 1e-9 {
+		t.Errorf("normalization is %v", d.Normalization)
+	}
+
+	if math.Abs(d.Test.Inputs[0][0]-(70-34.5)/stdev) > 1e-9 || math.Abs(d.Test.Targets[0]-(72-34.5)/stdev) > 1e-9 {
+		t.Errorf("test split is not normalized by the train split: %v, %f", d.Test.Inputs[0], d.Test.Targets[0])
+	}
+}
+
+func TestDatasetEncoding(t *testing.T) {
+	d, err := testRamp(50).Dataset(&DatasetOptions{Window: 4, Validation: 0.2, Test: 0.2, Normalize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := d.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeDataset(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, d) {
+		t.Errorf("JSON dataset differs: %s", cmp.Diff(d, got))
+	}
+
+	buf := &bytes.Buffer{}
+	err = d.EncodeBinary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = DecodeDataset(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, d) {
+		t.Errorf("binary dataset differs: %s", cmp.Diff(d, got))
+	}
+
+	if _, err := DecodeDataset(buf.Bytes()[:buf.Len()-8]); err == nil {
+		t.Errorf("truncated binary dataset should have errored")
+	}
+	if _, err := DecodeDataset([]byte(`{"Train": {"Inputs": [[1]], "Targets": []}}`)); err == nil {
+		t.Errorf("corrupt JSON dataset should have errored")
+	}
+}
+
+func TestDatasetErrors(t *testing.T) {
+	cases := []DatasetOptions{
+		{Window: 0},
+		{Window: 2, Horizon: -1},
+		{Window: 2, Stride: -1},
+		{Window: 2, Validation: 0.5, Test: 0.5},
+		{Window: 2, Test: -0.1},
+		{Window: 2, Test: 0.01},
+		{Window: 100},
+	}
+
+	for i, c := range cases {
+		if _, err := testRamp(100).Dataset(&c); err == nil {
+			t.Errorf("Test case %d should have errored", i)
+		}
+	}
+
+	if _, err := testRamp(10).Scale(0).Dataset(&DatasetOptions{Window: 2, Normalize: true}); err == nil {
+		t.Errorf("normalizing a constant should have errored")
+	}
+
+	irregular := &Signal{T: []float64{0, 1, 3, 4}, S: []float64{0, 1, 2, 3}}
+	if _, err := irregular.Dataset(&DatasetOptions{Window: 2}); err == nil {
+		t.Errorf("irregular signal should have errored")
+	}
+}
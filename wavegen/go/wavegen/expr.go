@@ -0,0 +1,596 @@
+package wavegen
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file implements the expression language which may be used to
+// describe a synthetic wave, see WaveParameters.Expression.
+//
+// An expression is built from numbers, the variable t (the time in seconds),
+// constants, the operators + - * / % and ^ (exponentiation, which is right
+// associative and binds tighter than unary minus), parentheses, and calls to
+// the functions listed in ExpressionFunctions and ExpressionNoises. For
+// example:
+//
+//	2*sin(2*pi*5*t + 0.3) + 0.1*gauss() + step(t-0.5)
+
+// exprFunction describes a function which may be called in an expression.
+type exprFunction struct {
+	// minArgs and maxArgs are the number of arguments accepted, maxArgs
+	// being -1 if there is no limit
+	minArgs int
+	maxArgs int
+
+	fn func(args []float64) float64
+}
+
+func unary(f func(float64) float64) exprFunction {
+	return exprFunction{1, 1, func(args []float64) float64 { return f(args[0]) }}
+}
+
+func binary(f func(float64, float64) float64) exprFunction {
+	return exprFunction{2, 2, func(args []float64) float64 { return f(args[0], args[1]) }}
+}
+
+// ExpressionFunctions lists the names of the deterministic functions which
+// may be called in an expression. The waveform functions square, sawtooth
+// and triangle take an angle in radians, like sin, and square takes an
+// optional duty cycle. step(x) is 1 if x >= 0, and 0 otherwise.
+var ExpressionFunctions []string
+
+// ExpressionNoises lists the names of the noise functions which may be called
+// in an expression. Each takes an optional magnitude, which defaults to 1,
+// with the same meaning as for the noise kind of the same name; gauss is an
+// alias for gaussian. Each call in an expression has its own sequence of
+// noise.
+var ExpressionNoises []string
+
+// ExpressionConstants are the constants which are always available in an
+// expression, in addition to any given in WaveParameters.Constants.
+var ExpressionConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+var exprFunctions map[string]exprFunction
+
+var exprNoises = map[string]string{
+	"pseudo":    "pseudo",
+	"uniform":   "uniform",
+	"gaussian":  "gaussian",
+	"gauss":     "gaussian",
+	"pink":      "pink",
+	"brown":     "brown",
+	"impulsive": "impulsive",
+}
+
+func init() {
+	exprFunctions = map[string]exprFunction{
+		"sin":   unary(math.Sin),
+		"cos":   unary(math.Cos),
+		"tan":   unary(math.Tan),
+		"asin":  unary(math.Asin),
+		"acos":  unary(math.Acos),
+		"atan":  unary(math.Atan),
+		"sinh":  unary(math.Sinh),
+		"cosh":  unary(math.Cosh),
+		"tanh":  unary(math.Tanh),
+		"exp":   unary(math.Exp),
+		"log":   unary(math.Log),
+		"log2":  unary(math.Log2),
+		"log10": unary(math.Log10),
+		"sqrt":  unary(math.Sqrt),
+		"abs":   unary(math.Abs),
+		"floor": unary(math.Floor),
+		"ceil":  unary(math.Ceil),
+		"round": unary(math.Round),
+		"atan2": binary(math.Atan2),
+		"pow":   binary(math.Pow),
+		"mod":   binary(math.Mod),
+		"hypot": binary(math.Hypot),
+		"min": {1, -1, func(args []float64) float64 {
+			m := args[0]
+			for _, a := range args[1:] {
+				m = math.Min(m, a)
+			}
+			return m
+		}},
+		"max": {1, -1, func(args []float64) float64 {
+			m := args[0]
+			for _, a := range args[1:] {
+				m = math.Max(m, a)
+			}
+			return m
+		}},
+		"sign": unary(func(x float64) float64 {
+			if x > 0 {
+				return 1
+			} else if x < 0 {
+				return -1
+			}
+			return 0
+		}),
+		"step": unary(func(x float64) float64 {
+			if x >= 0 {
+				return 1
+			}
+			return 0
+		}),
+		"square": {1, 2, func(args []float64) float64 {
+			duty := DefaultDutyCycle
+			if len(args) > 1 {
+				duty = args[1]
+			}
+			if cycles(args[0]) < duty {
+				return 1
+			}
+			return -1
+		}},
+		"sawtooth": unary(func(theta float64) float64 {
+			return 2*cycles(theta+math.Pi) - 1
+		}),
+		"triangle": unary(func(theta float64) float64 {
+			return 2 / math.Pi * math.Asin(math.Sin(theta))
+		}),
+	}
+
+	for name := range exprFunctions {
+		ExpressionFunctions = append(ExpressionFunctions, name)
+	}
+	for name := range exprNoises {
+		ExpressionNoises = append(ExpressionNoises, name)
+	}
+	sort.Strings(ExpressionFunctions)
+	sort.Strings(ExpressionNoises)
+}
+
+// exprNode is a node of the syntax tree of an expression.
+type exprNode interface {
+	eval(e *Expression, t float64) float64
+}
+
+type exprNumber float64
+
+type exprTime struct{}
+
+type exprUnary struct {
+	op      byte
+	operand exprNode
+}
+
+type exprBinary struct {
+	op          byte
+	left, right exprNode
+}
+
+type exprCall struct {
+	fn   exprFunction
+	args []exprNode
+}
+
+type exprNoise struct {
+	// index is the index of the generator in Expression.noises
+	index int
+
+	// magnitude is nil if no magnitude was given
+	magnitude exprNode
+}
+
+func (n exprNumber) eval(e *Expression, t float64) float64 {
+	return float64(n)
+}
+
+func (n exprTime) eval(e *Expression, t float64) float64 {
+	return t
+}
+
+func (n *exprUnary) eval(e *Expression, t float64) float64 {
+	return -n.operand.eval(e, t)
+}
+
+func (n *exprBinary) eval(e *Expression, t float64) float64 {
+	l := n.left.eval(e, t)
+	r := n.right.eval(e, t)
+	switch n.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	case '/':
+		return l / r
+	case '%':
+		return math.Mod(l, r)
+	default:
+		return math.Pow(l, r)
+	}
+}
+
+func (n *exprCall) eval(e *Expression, t float64) float64 {
+	args := make([]float64, len(n.args))
+	for i, a := range n.args {
+		args[i] = a.eval(e, t)
+	}
+	return n.fn.fn(args)
+}
+
+func (n *exprNoise) eval(e *Expression, t float64) float64 {
+	v := e.noises[n.index].Next()
+	if n.magnitude != nil {
+		v *= n.magnitude.eval(e, t)
+	}
+	return v
+}
+
+// Expression is a parsed expression, which can be evaluated at any time t.
+// Since noise depends on previous values, an expression should be evaluated
+// at increasing times, and each Expression should be used for one signal
+// only.
+type Expression struct {
+	// Source is the text from which the expression was parsed.
+	Source string
+
+	root   exprNode
+	noises []*NoiseGenerator
+}
+
+// ParseExpression parses an expression. Any identifier other than t, a
+// function, or a constant in ExpressionConstants must be given in constants,
+// which may be nil. Constants given take precedence over those in
+// ExpressionConstants.
+//
+// Noise uses the global source of the math/rand package until Seed() is
+// called.
+func ParseExpression(source string, constants map[string]float64) (*Expression, error) {
+	p := &exprParser{source: source, constants: constants}
+	p.expr = &Expression{Source: source}
+
+	err := p.tokenize()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected '%s'", p.peek().text)
+	}
+
+	p.expr.root = root
+	return p.expr, nil
+}
+
+// MustParseExpression works identically to ParseExpression(), but calls
+// panic() if an error occurs.
+func MustParseExpression(source string, constants map[string]float64) *Expression {
+	e, err := ParseExpression(source, constants)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Seed makes the noise of the expression reproducible, by giving each noise
+// call its own stream of the given version of the pseudo-random number
+// generator, numbered consecutively from firstStream.
+func (e *Expression) Seed(version int, seed int64, firstStream int) error {
+	for i, gen := range e.noises {
+		rng, err := newRandom(version, seed, firstStream+i)
+		if err != nil {
+			return err
+		}
+		gen.rng = rng
+	}
+	return nil
+}
+
+// NoiseCount returns the number of noise calls in the expression, each of
+// which has its own stream of random numbers.
+func (e *Expression) NoiseCount() int {
+	return len(e.noises)
+}
+
+// Evaluate returns the value of the expression at time t.
+func (e *Expression) Evaluate(t float64) float64 {
+	return e.root.eval(e, t)
+}
+
+type exprToken struct {
+	// kind is 'n' for a number, 'i' for an identifier, or the character
+	// of an operator or punctuation
+	kind  byte
+	text  string
+	value float64
+	pos   int
+}
+
+type exprParser struct {
+	source    string
+	constants map[string]float64
+	tokens    []exprToken
+	pos       int
+	expr      *Expression
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	pos := len(p.source)
+	if p.pos < len(p.tokens) {
+		pos = p.tokens[p.pos].pos
+	}
+	return fmt.Errorf("Expression error at position %d: %s", pos+1, fmt.Sprintf(format, args...))
+}
+
+// isIdentifierStart returns true if c may begin an identifier, that is if it
+// is an ASCII letter or an underscore. Identifiers continue with any of those
+// or ASCII digits.
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *exprParser) tokenize() error {
+	s := p.source
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		start := i
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case (c >= '0' && c <= '9') || c == '.':
+			for i < len(s) && ((s[i] >= '0' && s[i] <= '9') || s[i] == '.') {
+				i++
+			}
+			// exponent
+			if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+				j := i + 1
+				if j < len(s) && (s[j] == '+' || s[j] == '-') {
+					j++
+				}
+				if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+					i = j
+					for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+						i++
+					}
+				}
+			}
+			v, err := strconv.ParseFloat(s[start:i], 64)
+			if err != nil {
+				return fmt.Errorf("Expression error at position %d: invalid number '%s'", start+1, s[start:i])
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 'n', text: s[start:i], value: v, pos: start})
+
+		case isIdentifierStart(c):
+			for i < len(s) && (isIdentifierStart(s[i]) || (s[i] >= '0' && s[i] <= '9')) {
+				i++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: 'i', text: s[start:i], pos: start})
+
+		case strings.IndexByte("+-*/%^(),", c) >= 0:
+			i++
+			p.tokens = append(p.tokens, exprToken{kind: c, text: string(c), pos: start})
+
+		default:
+			r, _ := utf8.DecodeRuneInString(s[i:])
+			return fmt.Errorf("Expression error at position %d: unexpected character '%c'", start+1, r)
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) peek() exprToken {
+	if p.pos >= len(p.tokens) {
+		return exprToken{kind: 0, text: "end of expression", pos: len(p.source)}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) expect(kind byte) error {
+	if p.peek().kind != kind {
+		return p.errorf("expected '%c', found '%s'", kind, p.peek().text)
+	}
+	p.pos++
+	return nil
+}
+
+// parseSum parses terms separated by + or -.
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == '+' || p.peek().kind == '-' {
+		op := p.peek().kind
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprBinary{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseProduct parses factors separated by *, / or %.
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == '*' || p.peek().kind == '/' || p.peek().kind == '%' {
+		op := p.peek().kind
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprBinary{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseUnary parses an optionally negated power.
+func (p *exprParser) parseUnary() (exprNode, error) {
+	switch p.peek().kind {
+	case '-':
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprUnary{op: '-', operand: operand}, nil
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+
+	return p.parsePower()
+}
+
+// parsePower parses a primary, optionally raised to a power.
+func (p *exprParser) parsePower() (exprNode, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == '^' {
+		p.pos++
+		// right associative, and allows -x as the exponent
+		exponent, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprBinary{op: '^', left: base, right: exponent}, nil
+	}
+
+	return base, nil
+}
+
+// parsePrimary parses a number, identifier, call, or parenthesized
+// expression.
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case 'n':
+		p.pos++
+		return exprNumber(tok.value), nil
+
+	case '(':
+		p.pos++
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expect(')')
+		if err != nil {
+			return nil, err
+		}
+		return inner, nil
+
+	case 'i':
+		p.pos++
+		if p.peek().kind == '(' {
+			return p.parseCall(tok)
+		}
+
+		if tok.text == "t" {
+			return exprTime{}, nil
+		}
+
+		if v, ok := p.constants[tok.text]; ok {
+			return exprNumber(v), nil
+		}
+
+		if v, ok := ExpressionConstants[tok.text]; ok {
+			return exprNumber(v), nil
+		}
+
+		p.pos--
+		return nil, p.errorf("unknown identifier '%s'", tok.text)
+	}
+
+	return nil, p.errorf("unexpected '%s'", tok.text)
+}
+
+// parseCall parses the arguments of a call to the named function, the
+// current token being the opening parenthesis.
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	p.pos++
+
+	args := []exprNode{}
+	if p.peek().kind != ')' {
+		for {
+			arg, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+
+			if p.peek().kind != ',' {
+				break
+			}
+			p.pos++
+		}
+	}
+
+	err := p.expect(')')
+	if err != nil {
+		return nil, err
+	}
+
+	if kind, ok := exprNoises[name.text]; ok {
+		if len(args) > 1 {
+			return nil, fmt.Errorf("Expression error at position %d: %s() takes at most 1 argument, but %d were given", name.pos+1, name.text, len(args))
+		}
+
+		gen, err := NewNoiseGenerator(kind, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		n := &exprNoise{index: len(p.expr.noises)}
+		if len(args) == 1 {
+			n.magnitude = args[0]
+		}
+		p.expr.noises = append(p.expr.noises, gen)
+		return n, nil
+	}
+
+	fn, ok := exprFunctions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("Expression error at position %d: unknown function '%s'", name.pos+1, name.text)
+	}
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("Expression error at position %d: wrong number of arguments to %s(), %d were given", name.pos+1, name.text, len(args))
+	}
+
+	return &exprCall{fn: fn, args: args}, nil
+}
+
+// sortedConstants returns the names of the constants in sorted order.
+func sortedConstants(constants map[string]float64) []string {
+	names := make([]string, 0, len(constants))
+	for name := range constants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,133 @@
+package wavegen
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestExpressionEvaluate(t *testing.T) {
+	constants := map[string]float64{"k": 3, "pi": 4}
+
+	cases := []struct {
+		source string
+		t      float64
+		expect float64
+	}{
+		{"1 + 2 * 3", 0, 7},
+		{"(1 + 2) * 3", 0, 9},
+		{"2 ^ 3 ^ 2", 0, 512},
+		{"-2 ^ 2", 0, -4},
+		{"2 ^ -1", 0, 0.5},
+		{"7 % 4 - 1.5e1 / 3", 0, -2},
+		{"k * t", 2, 6},
+		{"pi", 0, 4},
+		{"e", 0, math.E},
+		{"2*sin(2*3.141592653589793*5*t + 0.3)", 0.1, 2 * math.Sin(math.Pi+0.3)},
+		{"step(t-0.5)", 0.4, 0},
+		{"step(t-0.5)", 0.5, 1},
+		{"max(1, t, 3) + min(4, 2)", 5, 7},
+		{"square(1) + square(4, 0.9)", 0, 2},
+		{"atan2(1, 1)", 0, math.Pi / 4},
+	}
+
+	for _, c := range cases {
+		e, err := ParseExpression(c.source, constants)
+		if err != nil {
+			t.Errorf("'%s': %v", c.source, err)
+			continue
+		}
+
+		v := e.Evaluate(c.t)
+		if math.Abs(v-c.expect) > 0.00001 {
+			t.Errorf("'%s' at t=%f is %f, expected %f", c.source, c.t, v, c.expect)
+		}
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	for _, source := range []string{
+		"",
+		"1 +",
+		"(1 + 2",
+		"1 2",
+		"foo",
+		"foo(1)",
+		"sin(1, 2)",
+		"gauss(1, 2)",
+		"1 $ 2",
+		"sin t",
+	} {
+		_, err := ParseExpression(source, nil)
+		if err == nil {
+			t.Errorf("'%s' should not have parsed", source)
+		}
+	}
+
+	// identifiers are ASCII, so a constant named otherwise cannot be used
+	_, err := ParseExpression("2 * µ", map[string]float64{"µ": 1})
+	if err == nil || !strings.Contains(err.Error(), "'µ'") {
+		t.Errorf("non-ASCII identifier gave error %v", err)
+	}
+}
+
+func TestExpressionGeneration(t *testing.T) {
+	w := &WaveParameters{
+		SampleRate: 100,
+		Duration:   10,
+		Expression: "a*sin(2*pi*t) + gauss(0.5) + uniform()",
+		Constants:  map[string]float64{"a": 2},
+		Seed:       11,
+	}
+
+	sig, err := w.GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// subtract the deterministic part, leaving the noise, whose variance
+	// is 0.5² + 1/3
+	residual := 0.0
+	for i, v := range sig.S {
+		r := v - 2*math.Sin(2*math.Pi*sig.T[i])
+		residual += r * r
+	}
+	residual /= float64(sig.Size())
+	if math.Abs(residual-(0.25+1.0/3)) > 0.1 {
+		t.Errorf("noise variance is %f, expected %f", residual, 0.25+1.0/3)
+	}
+
+	// reproducible from the file
+	wf := &WaveFile{Parameters: w, Signal: sig}
+	data, err := wf.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := FromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(0); err != nil {
+		t.Errorf("expression signal could not be regenerated: %v", err)
+	}
+
+	// the classic parameters are added to the expression
+	w.Frequencies = []float64{1}
+	w.Phases = []float64{0}
+	w.Amplitudes = []float64{1}
+	w.Expression = "-sin(2*pi*t)"
+	sig, err = w.GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range sig.S {
+		if math.Abs(v) > 0.00001 {
+			t.Fatalf("sample %d is %f, expected 0", i, v)
+		}
+	}
+
+	w.Expression = "a * b"
+	if w.ValidateParameters() == nil {
+		t.Errorf("expression with an unknown constant should have failed validation")
+	}
+}
@@ -7,27 +7,94 @@ import (
 	"os"
 )
 
+// CurrentVersion is the newest version of the wave file format, which
+// supports multi-channel signals. Version 0 files hold a single channel.
+const CurrentVersion = 1
+
 // WaveFile represents all of the data that could be encoded in a WaveGen JSON
 // file.
 type WaveFile struct {
-	// Version should be the version specifier, currently 0.
+	// Version should be the version specifier, either 0 or 1.
 	Version int
 
 	// Parameters represents the WaveParameters.
 	Parameters *WaveParameters `json:",omitempty"`
 
-	// Signal represents the wave data.
+	// Signal represents the wave data of a version 0 file.
 	Signal *Signal `json:",omitempty"`
+
+	// Channels represents the wave data of a version 1 file, which may
+	// have several channels. It is stored in the file's signal object.
+	Channels *MultiSignal `json:"-"`
+
+	// Resampling records how the wave data was resampled from another
+	// signal, if it was.
+	Resampling *Resampling `json:",omitempty"`
+
+	// Filters records the filters which were applied to the wave data, in
+	// the order they were applied.
+	Filters []FilterSpec `json:",omitempty"`
+}
+
+// waveFileV1 is the JSON representation of a version 1 WaveFile.
+type waveFileV1 struct {
+	Version    int
+	Parameters *WaveParameters `json:",omitempty"`
+	Signal     *MultiSignal    `json:",omitempty"`
+	Resampling *Resampling     `json:",omitempty"`
+	Filters    []FilterSpec    `json:",omitempty"`
+}
+
+// AllChannels returns the wave data as a multi-channel signal, regardless of
+// the version of the file. The single channel of a version 0 file is named
+// DefaultChannelName. It returns nil if the file has no wave data.
+func (wf *WaveFile) AllChannels() *MultiSignal {
+	if wf.Channels != nil {
+		return wf.Channels
+	}
+
+	if wf.Signal != nil {
+		return wf.Signal.ToMultiSignal(DefaultChannelName)
+	}
+
+	return nil
 }
 
 // ToJSON converts a WaveFile to an in-memory JSON representation and returns
 // it.
+//
+// A version 0 file may only have a Signal. A version 1 file is written with
+// its Channels, or if it has none, with its Signal as a single channel.
 func (wf *WaveFile) ToJSON() ([]byte, error) {
-	if wf.Version != 0 {
+	var v interface{}
+
+	switch wf.Version {
+	case 0:
+		if wf.Channels != nil {
+			return nil, fmt.Errorf("Version 0 wave files cannot hold multi-channel signals")
+		}
+		v = wf
+
+	case 1:
+		if wf.Channels != nil && wf.Signal != nil {
+			return nil, fmt.Errorf("Version 1 wave files cannot hold both a signal and channels")
+		}
+
+		channels := wf.AllChannels()
+		if channels != nil {
+			err := channels.Validate()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		v = &waveFileV1{Version: wf.Version, Parameters: wf.Parameters, Signal: channels, Resampling: wf.Resampling, Filters: wf.Filters}
+
+	default:
 		return nil, fmt.Errorf("Don't know how to write a wave file with version %d", wf.Version)
 	}
 
-	b, err := json.MarshalIndent(wf, "", "\t")
+	b, err := json.MarshalIndent(v, "", "\t")
 	if err != nil {
 		return nil, err
 	}
@@ -61,12 +128,52 @@ func (wf *WaveFile) WriteJSON(path string) error {
 }
 
 // FromJSON loads the data stored in a JSON representation of a wavegen file.
+// The signal of a version 0 file is stored in Signal, and that of a version 1
+// file in Channels.
 func FromJSON(data []byte) (*WaveFile, error) {
-	wf := &WaveFile{}
-	err := json.Unmarshal(data, wf)
+	header := &struct {
+		Version    int
+		Parameters *WaveParameters
+		Signal     json.RawMessage
+		Resampling *Resampling
+		Filters    []FilterSpec
+	}{}
+	err := json.Unmarshal(data, header)
 	if err != nil {
 		return nil, err
 	}
+
+	wf := &WaveFile{Version: header.Version, Parameters: header.Parameters, Resampling: header.Resampling, Filters: header.Filters}
+	hasSignal := len(header.Signal) > 0 && string(header.Signal) != "null"
+
+	switch header.Version {
+	case 0:
+		if hasSignal {
+			wf.Signal = &Signal{}
+			err = json.Unmarshal(header.Signal, wf.Signal)
+		}
+
+	case 1:
+		if hasSignal {
+			wf.Channels = &MultiSignal{}
+			err = json.Unmarshal(header.Signal, wf.Channels)
+			if err == nil {
+				err = wf.Channels.Validate()
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("Don't know how to read a wave file with version %d", header.Version)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if wf.Parameters != nil {
+		wf.Parameters.setDefaults()
+	}
+
 	return wf, nil
 }
 
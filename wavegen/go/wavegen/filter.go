@@ -0,0 +1,557 @@
+package wavegen
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// This file implements designing digital filters and applying them to
+// signals.
+
+// FilterKinds lists the kinds of filter understood by NewFilter().
+var FilterKinds = []string{"fir", "butterworth", "moving-average", "median"}
+
+// FilterResponses lists the responses of fir and butterworth filters.
+var FilterResponses = []string{"lowpass", "highpass", "bandpass", "bandstop"}
+
+const (
+	// DefaultFIRTaps is the number of coefficients of FIR filters, if
+	// none is given.
+	DefaultFIRTaps = 101
+
+	// DefaultFIRWindow is the window of FIR filters, if none is given.
+	DefaultFIRWindow = "hamming"
+
+	// MaxButterworthOrder is the highest order of Butterworth filters.
+	MaxButterworthOrder = 8
+)
+
+// FilterSpec describes a digital filter. It is recorded in the Filters of wave
+// files whose signal was filtered.
+type FilterSpec struct {
+	// Kind is the kind of filter, one of FilterKinds.
+	Kind string
+
+	// Response is the response of fir and butterworth filters, one of
+	// FilterResponses.
+	Response string `json:",omitempty"`
+
+	// Cutoffs are the cutoff frequencies in Hz of fir and butterworth
+	// filters, one for lowpass and highpass responses, and the lower and
+	// upper edges of the band for bandpass and bandstop responses.
+	Cutoffs []float64 `json:",omitempty"`
+
+	// Order is the order of butterworth filters, from 1 to
+	// MaxButterworthOrder. Band filters have twice as many poles.
+	Order int `json:",omitempty"`
+
+	// Taps is the number of coefficients of fir filters, which must be
+	// odd. If 0, DefaultFIRTaps is used.
+	Taps int `json:",omitempty"`
+
+	// Window is the window applied to the coefficients of fir filters,
+	// one of WindowKinds. If empty, DefaultFIRWindow is used.
+	Window string `json:",omitempty"`
+
+	// Width is the number of samples, which must be odd, over which
+	// moving-average and median filters are computed. The window is
+	// centered on each sample, and truncated at the ends of the signal.
+	Width int `json:",omitempty"`
+
+	// ZeroPhase removes the delay of fir and butterworth filters. FIR
+	// filters, which have linear phase, are centered on each sample, and
+	// IIR filters are applied forward then backward, which also squares
+	// their magnitude response.
+	ZeroPhase bool `json:",omitempty"`
+}
+
+// Biquad is a second-order section of an IIR filter, with the transfer
+// function (B[0] + B[1]/z + B[2]/z²) / (1 + A[1]/z + A[2]/z²). A[0] is always
+// 1.
+type Biquad struct {
+	B [3]float64
+	A [3]float64
+}
+
+// Filter is a digital filter designed by NewFilter().
+type Filter struct {
+	// Spec describes the filter, with any defaults filled in.
+	Spec FilterSpec
+
+	// SampleRate is the sample rate in Hz of the signals the filter is
+	// designed for.
+	SampleRate float64
+
+	// Taps are the coefficients of fir filters.
+	Taps []float64
+
+	// Sections are the second-order sections of butterworth filters,
+	// which are applied in series.
+	Sections []Biquad
+}
+
+// isOneOf checks if s is one of list.
+func isOneOf(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewFilter designs a filter as described by spec, for signals sampled at
+// sampleRate Hz.
+func NewFilter(spec *FilterSpec, sampleRate float64) (*Filter, error) {
+	f := &Filter{Spec: *spec, SampleRate: sampleRate}
+	f.Spec.Cutoffs = append([]float64{}, spec.Cutoffs...)
+
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("Sample rate must be positive, not %f", sampleRate)
+	}
+
+	// fields which do not apply to the kind of filter must not be given
+	unused := map[string]bool{
+		"fir":            spec.Order != 0 || spec.Width != 0,
+		"butterworth":    spec.Taps != 0 || spec.Window != "" || spec.Width != 0,
+		"moving-average": spec.Response != "" || len(spec.Cutoffs) != 0 || spec.Order != 0 || spec.Taps != 0 || spec.Window != "",
+	}
+	unused["median"] = unused["moving-average"]
+	if unused[spec.Kind] {
+		return nil, fmt.Errorf("Filter specification has parameters which do not apply to %s filters", spec.Kind)
+	}
+
+	switch spec.Kind {
+	case "fir", "butterworth":
+		err := f.validateCutoffs()
+		if err != nil {
+			return nil, err
+		}
+
+		if spec.Kind == "fir" {
+			err = f.designFIR()
+		} else {
+			err = f.designButterworth()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+
+	case "moving-average", "median":
+		if spec.Width < 1 || spec.Width%2 == 0 {
+			return nil, fmt.Errorf("Width of %s filters must be a positive odd number, not %d", spec.Kind, spec.Width)
+		}
+		if spec.ZeroPhase {
+			return nil, fmt.Errorf("%s filters are always centered, and cannot be zero-phase", spec.Kind)
+		}
+		return f, nil
+
+	default:
+		return nil, fmt.Errorf("Unknown filter kind '%s', must be one of %v", spec.Kind, FilterKinds)
+	}
+}
+
+// validateCutoffs checks the response and cutoff frequencies of the filter.
+func (f *Filter) validateCutoffs() error {
+	spec := &f.Spec
+	if !isOneOf(spec.Response, FilterResponses) {
+		return fmt.Errorf("Unknown filter response '%s', must be one of %v", spec.Response, FilterResponses)
+	}
+
+	count := 1
+	if spec.Response == "bandpass" || spec.Response == "bandstop" {
+		count = 2
+	}
+	if len(spec.Cutoffs) != count {
+		return fmt.Errorf("A %s filter must have %d cutoff frequencies, not %d", spec.Response, count, len(spec.Cutoffs))
+	}
+
+	for _, c := range spec.Cutoffs {
+		if c <= 0 || c >= f.SampleRate/2 {
+			return fmt.Errorf("Cutoff frequency %fHz must be between 0 and the Nyquist frequency %fHz", c, f.SampleRate/2)
+		}
+	}
+	if count == 2 && spec.Cutoffs[0] >= spec.Cutoffs[1] {
+		return fmt.Errorf("Lower cutoff frequency %fHz must be below the upper %fHz", spec.Cutoffs[0], spec.Cutoffs[1])
+	}
+
+	return nil
+}
+
+// lowpassTaps computes the coefficients of a windowed-sinc low-pass filter
+// with the given cutoff in Hz, normalized to unit gain at 0Hz.
+func (f *Filter) lowpassTaps(cutoff float64, window []float64) []float64 {
+	fc := 2 * cutoff / f.SampleRate
+	middle := float64(len(window)-1) / 2
+
+	taps := make([]float64, len(window))
+	sum := 0.0
+	for k := range taps {
+		x := float64(k) - middle
+		taps[k] = fc * window[k]
+		if x != 0 {
+			taps[k] *= math.Sin(math.Pi*fc*x) / (math.Pi * fc * x)
+		}
+		sum += taps[k]
+	}
+
+	for k := range taps {
+		taps[k] /= sum
+	}
+	return taps
+}
+
+// designFIR computes the taps of a windowed-sinc filter. High-pass and
+// band-stop responses are found by spectral inversion of low-pass and
+// band-pass responses.
+func (f *Filter) designFIR() error {
+	spec := &f.Spec
+	if spec.Taps == 0 {
+		spec.Taps = DefaultFIRTaps
+	}
+	if spec.Window == "" {
+		spec.Window = DefaultFIRWindow
+	}
+	if spec.Taps < 3 || spec.Taps%2 == 0 {
+		return fmt.Errorf("Number of taps of fir filters must be an odd number of at least 3, not %d", spec.Taps)
+	}
+
+	// the window is symmetric, so that the filter has linear phase
+	window, err := windowCoefficients(spec.Window, spec.Taps, spec.Taps-1)
+	if err != nil {
+		return err
+	}
+
+	switch spec.Response {
+	case "lowpass", "highpass":
+		f.Taps = f.lowpassTaps(spec.Cutoffs[0], window)
+
+	case "bandpass", "bandstop":
+		upper := f.lowpassTaps(spec.Cutoffs[1], window)
+		lower := f.lowpassTaps(spec.Cutoffs[0], window)
+		f.Taps = make([]float64, spec.Taps)
+		for k := range f.Taps {
+			f.Taps[k] = upper[k] - lower[k]
+		}
+	}
+
+	if spec.Response == "highpass" || spec.Response == "bandstop" {
+		for k := range f.Taps {
+			f.Taps[k] = -f.Taps[k]
+		}
+		f.Taps[spec.Taps/2]++
+	}
+
+	return nil
+}
+
+// designButterworth computes the second-order sections of a Butterworth
+// filter, by transforming the poles of the analog low-pass prototype to the
+// desired response, then to digital poles by the bilinear transform, with the
+// cutoffs pre-warped so that the response is -3dB at each of them.
+func (f *Filter) designButterworth() error {
+	spec := &f.Spec
+	if spec.Order < 1 || spec.Order > MaxButterworthOrder {
+		return fmt.Errorf("Order of butterworth filters must be between 1 and %d, not %d", MaxButterworthOrder, spec.Order)
+	}
+
+	fs := f.SampleRate
+	warped := make([]float64, len(spec.Cutoffs))
+	for i, c := range spec.Cutoffs {
+		warped[i] = 2 * fs * math.Tan(math.Pi*c/fs)
+	}
+
+	n := spec.Order
+	analog := []complex128{}
+	zeros := []complex128{}
+	var reference complex128
+
+	for k := 0; k < n; k++ {
+		p := cmplx.Rect(1, math.Pi*float64(2*k+1)/float64(2*n)+math.Pi/2)
+
+		switch spec.Response {
+		case "lowpass":
+			analog = append(analog, complex(warped[0], 0)*p)
+			zeros = append(zeros, -1)
+			reference = 1
+
+		case "highpass":
+			analog = append(analog, complex(warped[0], 0)/p)
+			zeros = append(zeros, 1)
+			reference = -1
+
+		case "bandpass", "bandstop":
+			w0 := math.Sqrt(warped[0] * warped[1])
+			bw := warped[1] - warped[0]
+
+			q := p * complex(bw/2, 0)
+			if spec.Response == "bandstop" {
+				q = complex(bw/2, 0) / p
+			}
+			d := cmplx.Sqrt(q*q - complex(w0*w0, 0))
+			analog = append(analog, q+d, q-d)
+
+			center := cmplx.Rect(1, 2*math.Atan(w0/(2*fs)))
+			if spec.Response == "bandpass" {
+				zeros = append(zeros, 1, -1)
+				reference = center
+			} else {
+				zeros = append(zeros, center, cmplx.Conj(center))
+				reference = 1
+			}
+		}
+	}
+
+	poles := make([]complex128, len(analog))
+	for i, s := range analog {
+		poles[i] = (complex(2*fs, 0) + s) / (complex(2*fs, 0) - s)
+	}
+
+	zeroPairs := pairRoots(zeros)
+	polePairs := pairRoots(poles)
+	f.Sections = make([]Biquad, len(polePairs))
+	for i := range f.Sections {
+		f.Sections[i] = Biquad{B: rootPolynomial(zeroPairs[i]), A: rootPolynomial(polePairs[i])}
+	}
+
+	gain := cmplx.Abs(f.Response(reference))
+	for i := range f.Sections[0].B {
+		f.Sections[0].B[i] /= gain
+	}
+
+	return nil
+}
+
+// pairRoots groups the roots of a real polynomial into pairs, each being a
+// complex root and its conjugate, or two real roots. If there are an odd
+// number of real roots, the last group holds only one.
+func pairRoots(roots []complex128) [][]complex128 {
+	pairs := [][]complex128{}
+	reals := []float64{}
+
+	for _, r := range roots {
+		if math.Abs(imag(r)) <= 1e-12 {
+			reals = append(reals, real(r))
+		} else if imag(r) > 0 {
+			pairs = append(pairs, []complex128{r, cmplx.Conj(r)})
+		}
+	}
+
+	sort.Float64s(reals)
+	for i := 0; i < len(reals); i += 2 {
+		if i+1 < len(reals) {
+			pairs = append(pairs, []complex128{complex(reals[i], 0), complex(reals[i+1], 0)})
+		} else {
+			pairs = append(pairs, []complex128{complex(reals[i], 0)})
+		}
+	}
+
+	return pairs
+}
+
+// rootPolynomial computes the coefficients of the polynomial in 1/z with the
+// given one or two roots, whose leading coefficient is 1.
+func rootPolynomial(roots []complex128) [3]float64 {
+	if len(roots) == 1 {
+		return [3]float64{1, -real(roots[0]), 0}
+	}
+	return [3]float64{1, -real(roots[0] + roots[1]), real(roots[0] * roots[1])}
+}
+
+// Response computes the frequency response of fir and butterworth filters at
+// z, which is usually a point on the unit circle, see FrequencyResponse().
+func (f *Filter) Response(z complex128) complex128 {
+	if f.Taps != nil {
+		h := complex(0, 0)
+		for k, b := range f.Taps {
+			h += complex(b, 0) * cmplx.Pow(z, complex(float64(-k), 0))
+		}
+		return h
+	}
+
+	h := complex(1, 0)
+	zi := 1 / z
+	for _, s := range f.Sections {
+		num := complex(s.B[0], 0) + complex(s.B[1], 0)*zi + complex(s.B[2], 0)*zi*zi
+		den := complex(s.A[0], 0) + complex(s.A[1], 0)*zi + complex(s.A[2], 0)*zi*zi
+		h *= num / den
+	}
+	return h
+}
+
+// FrequencyResponse computes the frequency response of fir and butterworth
+// filters at freq Hz, not including the effect of ZeroPhase.
+func (f *Filter) FrequencyResponse(freq float64) complex128 {
+	return f.Response(cmplx.Rect(1, 2*math.Pi*freq/f.SampleRate))
+}
+
+// Apply filters the samples x, which should be sampled at f.SampleRate,
+// returning the filtered samples. The filter starts in the steady state for a
+// signal holding the first sample, so that constant signals are not subject to
+// a transient.
+func (f *Filter) Apply(x []float64) []float64 {
+	if len(x) == 0 {
+		return []float64{}
+	}
+
+	switch f.Spec.Kind {
+	case "fir":
+		return f.applyFIR(x)
+
+	case "butterworth":
+		if !f.Spec.ZeroPhase {
+			return f.applyIIR(x)
+		}
+
+		// the signal is extended by its odd reflection at either end
+		// to reduce the transients of each pass
+		pad := 3 * (2*len(f.Sections) + 1)
+		if pad > len(x)-1 {
+			pad = len(x) - 1
+		}
+		ext := make([]float64, len(x)+2*pad)
+		for i := 0; i < pad; i++ {
+			ext[i] = 2*x[0] - x[pad-i]
+			ext[len(ext)-1-i] = 2*x[len(x)-1] - x[len(x)-1-pad+i]
+		}
+		copy(ext[pad:], x)
+
+		y := reverse(f.applyIIR(reverse(f.applyIIR(ext))))
+		return y[pad : pad+len(x)]
+
+	default:
+		return f.applyWindowed(x)
+	}
+}
+
+// reverse returns a reversed copy of x.
+func reverse(x []float64) []float64 {
+	res := make([]float64, len(x))
+	for i, v := range x {
+		res[len(x)-1-i] = v
+	}
+	return res
+}
+
+// applyFIR convolves x with the taps of the filter, holding the values of the
+// first and last samples beyond the ends of the signal.
+func (f *Filter) applyFIR(x []float64) []float64 {
+	shift := 0
+	if f.Spec.ZeroPhase {
+		shift = len(f.Taps) / 2
+	}
+
+	y := make([]float64, len(x))
+	for i := range y {
+		for k, b := range f.Taps {
+			j := i - k + shift
+			if j < 0 {
+				j = 0
+			} else if j >= len(x) {
+				j = len(x) - 1
+			}
+			y[i] += b * x[j]
+		}
+	}
+	return y
+}
+
+// applyIIR applies each section of the filter in turn, in transposed direct
+// form II.
+func (f *Filter) applyIIR(x []float64) []float64 {
+	y := append([]float64{}, x...)
+
+	for _, s := range f.Sections {
+		// steady state for a constant input of the first sample
+		u := y[0]
+		out := u * (s.B[0] + s.B[1] + s.B[2]) / (1 + s.A[1] + s.A[2])
+		z1 := out - s.B[0]*u
+		z2 := s.B[2]*u - s.A[2]*out
+
+		for i, v := range y {
+			out := s.B[0]*v + z1
+			z1 = s.B[1]*v - s.A[1]*out + z2
+			z2 = s.B[2]*v - s.A[2]*out
+			y[i] = out
+		}
+	}
+
+	return y
+}
+
+// applyWindowed computes the moving average or median of the window centered
+// on each sample.
+func (f *Filter) applyWindowed(x []float64) []float64 {
+	half := f.Spec.Width / 2
+	y := make([]float64, len(x))
+	window := make([]float64, 0, f.Spec.Width)
+
+	for i := range y {
+		first := i - half
+		if first < 0 {
+			first = 0
+		}
+		last := i + half
+		if last > len(x)-1 {
+			last = len(x) - 1
+		}
+		window = append(window[:0], x[first:last+1]...)
+
+		if f.Spec.Kind == "moving-average" {
+			for _, v := range window {
+				y[i] += v
+			}
+			y[i] /= float64(len(window))
+			continue
+		}
+
+		sort.Float64s(window)
+		if len(window)%2 == 1 {
+			y[i] = window[len(window)/2]
+		} else {
+			y[i] = (window[len(window)/2-1] + window[len(window)/2]) / 2
+		}
+	}
+
+	return y
+}
+
+// Filter applies the filter described by spec to the signal, which must be
+// uniformly sampled, returning a new signal, and the filter which was
+// designed.
+func (s *Signal) Filter(spec *FilterSpec) (*Signal, *Filter, error) {
+	m, f, err := s.ToMultiSignal(DefaultChannelName).Filter(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Signal{T: m.T, S: m.Channels[0].S, SampleRate: s.SampleRate}, f, nil
+}
+
+// Filter applies the filter described by spec to every channel of the
+// signal, which must be uniformly sampled, returning a new signal, and the
+// filter which was designed.
+func (m *MultiSignal) Filter(spec *FilterSpec) (*MultiSignal, *Filter, error) {
+	rate, err := m.UniformSampleRate(1e-6)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Filtering requires a uniformly sampled signal, see interpolate: %v", err)
+	}
+
+	f, err := NewFilter(spec, rate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := &MultiSignal{
+		T:          append([]float64{}, m.T...),
+		Channels:   make([]Channel, len(m.Channels)),
+		SampleRate: m.SampleRate,
+	}
+	for i, c := range m.Channels {
+		res.Channels[i] = Channel{Name: c.Name, S: f.Apply(c.S)}
+	}
+
+	return res, f, nil
+}
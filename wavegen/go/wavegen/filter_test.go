@@ -0,0 +1,210 @@
+package wavegen
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestButterworthResponse(t *testing.T) {
+	cases := []struct {
+		response string
+		cutoffs  []float64
+		pass     float64
+		stop     float64
+	}{
+		{"lowpass", []float64{100}, 10, 400},
+		{"highpass", []float64{100}, 400, 10},
+		{"bandpass", []float64{100, 200}, 141, 450},
+		{"bandstop", []float64{100, 200}, 10, 141},
+	}
+
+	for _, c := range cases {
+		for order := 1; order <= MaxButterworthOrder; order++ {
+			f, err := NewFilter(&FilterSpec{Kind: "butterworth", Response: c.response, Cutoffs: c.cutoffs, Order: order}, 1000)
+			if err != nil {
+				t.Errorf("%s order %d: %v", c.response, order, err)
+				continue
+			}
+
+			for _, s := range f.Sections {
+				if math.Abs(s.A[2]) >= 1 || math.Abs(s.A[1]) >= 1+s.A[2] {
+					t.Errorf("%s order %d: section %v is unstable", c.response, order, s)
+				}
+			}
+
+			for _, cutoff := range c.cutoffs {
+				if gain := cmplx.Abs(f.FrequencyResponse(cutoff)); math.Abs(gain-math.Sqrt(0.5)) > 1e-9 {
+					t.Errorf("%s order %d: gain at the cutoff %fHz is %f", c.response, order, cutoff, gain)
+				}
+			}
+
+			if gain := cmplx.Abs(f.FrequencyResponse(c.pass)); math.Abs(gain-1) > 0.05 {
+				t.Errorf("%s order %d: gain in the passband is %f", c.response, order, gain)
+			}
+			if gain := cmplx.Abs(f.FrequencyResponse(c.stop)); order >= 4 && gain > 0.05 {
+				t.Errorf("%s order %d: gain in the stopband is %f", c.response, order, gain)
+			}
+		}
+	}
+}
+
+func TestFIRResponse(t *testing.T) {
+	cases := []struct {
+		response string
+		cutoffs  []float64
+		pass     []float64
+		stop     []float64
+	}{
+		{"lowpass", []float64{100}, []float64{0, 50}, []float64{200, 500}},
+		{"highpass", []float64{100}, []float64{200, 500}, []float64{0, 50}},
+		{"bandpass", []float64{100, 200}, []float64{150}, []float64{0, 50, 250, 500}},
+		{"bandstop", []float64{100, 200}, []float64{0, 50, 250, 500}, []float64{150}},
+	}
+
+	for _, c := range cases {
+		f, err := NewFilter(&FilterSpec{Kind: "fir", Response: c.response, Cutoffs: c.cutoffs}, 1000)
+		if err != nil {
+			t.Errorf("%s: %v", c.response, err)
+			continue
+		}
+
+		if f.Spec.Taps != DefaultFIRTaps || f.Spec.Window != DefaultFIRWindow || len(f.Taps) != DefaultFIRTaps {
+			t.Errorf("%s: defaults are not filled in: %v", c.response, f.Spec)
+		}
+
+		// linear phase
+		for k := range f.Taps {
+			if math.Abs(f.Taps[k]-f.Taps[len(f.Taps)-1-k]) > 1e-15 {
+				t.Errorf("%s: taps are not symmetric", c.response)
+				break
+			}
+		}
+
+		for _, freq := range c.pass {
+			if gain := cmplx.Abs(f.FrequencyResponse(freq)); math.Abs(gain-1) > 0.01 {
+				t.Errorf("%s: gain at %fHz is %f", c.response, freq, gain)
+			}
+		}
+		for _, freq := range c.stop {
+			if gain := cmplx.Abs(f.FrequencyResponse(freq)); gain > 0.01 {
+				t.Errorf("%s: gain at %fHz is %f", c.response, freq, gain)
+			}
+		}
+	}
+}
+
+func TestFilterApply(t *testing.T) {
+	m := &MultiSignal{SampleRate: 1000}
+	slow := make([]float64, 2000)
+	fast := make([]float64, 2000)
+	for i := range slow {
+		ts := float64(i) / 1000
+		m.T = append(m.T, ts)
+		slow[i] = math.Sin(2 * math.Pi * 5 * ts)
+		fast[i] = slow[i] + 0.5*math.Sin(2*math.Pi*200*ts)
+	}
+	m.AddChannel("slow", slow)
+	m.AddChannel("fast", fast)
+
+	specs := []FilterSpec{
+		{Kind: "butterworth", Response: "lowpass", Cutoffs: []float64{50}, Order: 4, ZeroPhase: true},
+		{Kind: "fir", Response: "lowpass", Cutoffs: []float64{50}, ZeroPhase: true},
+	}
+
+	for _, spec := range specs {
+		res, f, err := m.Filter(&spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !cmp.Equal(res.ChannelNames(), m.ChannelNames()) || !cmp.Equal(res.T, m.T) {
+			t.Errorf("%s: filtered signal has channels %v", spec.Kind, res.ChannelNames())
+		}
+		if f.SampleRate != 1000 {
+			t.Errorf("%s: filter was designed for %fHz", spec.Kind, f.SampleRate)
+		}
+
+		// the 200Hz component is removed without delaying the 5Hz one,
+		// away from the transients at either end
+		for _, name := range []string{"slow", "fast"} {
+			worst := 0.0
+			for i, v := range res.MustChannel(name).S[100:1900] {
+				worst = math.Max(worst, math.Abs(v-slow[i+100]))
+			}
+			if worst > 0.02 {
+				t.Errorf("%s: channel %s differs from the 5Hz component by %f", spec.Kind, name, worst)
+			}
+		}
+	}
+
+	// a constant signal passes through a causal filter without a transient
+	constant := &Signal{T: m.T[:100], S: make([]float64, 100)}
+	for i := range constant.S {
+		constant.S[i] = 3
+	}
+	res, _, err := constant.Filter(&FilterSpec{Kind: "butterworth", Response: "lowpass", Cutoffs: []float64{10}, Order: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range res.S {
+		if math.Abs(v-3) > 1e-9 {
+			t.Fatalf("filtered constant signal is %f at %d", v, i)
+		}
+	}
+}
+
+func TestWindowedFilters(t *testing.T) {
+	sig := &Signal{T: []float64{0, 1, 2, 3, 4, 5}, S: []float64{1, 2, 3, 100, 5, 6}}
+
+	cases := []struct {
+		kind   string
+		expect []float64
+	}{
+		{"moving-average", []float64{1.5, 2, 35, 36, 37, 5.5}},
+		{"median", []float64{1.5, 2, 3, 5, 6, 5.5}},
+	}
+
+	for _, c := range cases {
+		res, _, err := sig.Filter(&FilterSpec{Kind: c.kind, Width: 3})
+		if err != nil {
+			t.Errorf("%s: %v", c.kind, err)
+			continue
+		}
+		if !cmp.Equal(res.S, c.expect) {
+			t.Errorf("%s: filtered signal is %v, expected %v", c.kind, res.S, c.expect)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	cases := []FilterSpec{
+		{Kind: "chebyshev"},
+		{Kind: "fir", Response: "notch", Cutoffs: []float64{10}},
+		{Kind: "fir", Response: "lowpass"},
+		{Kind: "fir", Response: "lowpass", Cutoffs: []float64{600}},
+		{Kind: "fir", Response: "bandpass", Cutoffs: []float64{20, 10}},
+		{Kind: "fir", Response: "lowpass", Cutoffs: []float64{10}, Taps: 100},
+		{Kind: "fir", Response: "lowpass", Cutoffs: []float64{10}, Window: "kaiser"},
+		{Kind: "fir", Response: "lowpass", Cutoffs: []float64{10}, Order: 4},
+		{Kind: "butterworth", Response: "lowpass", Cutoffs: []float64{10}},
+		{Kind: "butterworth", Response: "lowpass", Cutoffs: []float64{10}, Order: 9},
+		{Kind: "butterworth", Response: "lowpass", Cutoffs: []float64{10}, Order: 2, Taps: 11},
+		{Kind: "median", Width: 4},
+		{Kind: "median", Width: 3, ZeroPhase: true},
+		{Kind: "moving-average", Width: 3, Cutoffs: []float64{10}},
+	}
+
+	for i, c := range cases {
+		if f, err := NewFilter(&c, 1000); err == nil || f != nil {
+			t.Errorf("Test case %d should have errored without a filter", i)
+		}
+	}
+
+	irregular := &Signal{T: []float64{0, 1, 3}, S: []float64{0, 1, 2}}
+	if _, _, err := irregular.Filter(&FilterSpec{Kind: "median", Width: 3}); err == nil {
+		t.Errorf("irregular signal should have errored")
+	}
+}
@@ -0,0 +1,855 @@
+package wavegen
+
+import (
+	"bytes"
+	"compress/zlib"
+	bin "encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// This file implements reading and writing MATLAB Level 5 MAT-files, which
+// are also read by GNU Octave and SciPy.
+//
+// Only the subset of the format needed to exchange signals is supported: real
+// numeric and logical arrays, character arrays, 1×1 structures, and cell
+// arrays. MAT-files written by newer versions of MATLAB with compression
+// (-v7) may be read, but HDF5 based MAT-files (-v7.3) may not.
+
+// matHeaderText is the descriptive text at the start of MAT-files written by
+// this library.
+const matHeaderText = "MATLAB 5.0 MAT-file, Platform: Go, Created by: wavegen"
+
+// matMaxNameLength is the longest variable or field name MATLAB allows.
+const matMaxNameLength = 63
+
+// MAT-file data types
+const (
+	miInt8       = 1
+	miUint8      = 2
+	miInt16      = 3
+	miUint16     = 4
+	miInt32      = 5
+	miUint32     = 6
+	miSingle     = 7
+	miDouble     = 9
+	miInt64      = 12
+	miUint64     = 13
+	miMatrix     = 14
+	miCompressed = 15
+	miUTF8       = 16
+	miUTF16      = 17
+	miUTF32      = 18
+)
+
+// MAT-file array classes
+const (
+	mxCell   = 1
+	mxStruct = 2
+	mxChar   = 4
+	mxDouble = 6
+	mxInt64  = 14
+	mxUint64 = 15
+
+	mxFlagComplex = 0x0800
+)
+
+// MATMatrix is a real numeric array in a MAT-file. Data is stored in
+// column-major order, as MATLAB does, so the element at row i and column j of
+// a two-dimensional matrix is Data[i + j*Dims[0]].
+type MATMatrix struct {
+	Dims []int
+	Data []float64
+}
+
+// MATVariable is a named value in a MAT-file, or a field of a MATStruct.
+//
+// When writing, Value may be a *MATMatrix, a float64, an int64 (which is
+// written as an int64 array, so that large integers such as seeds are
+// preserved), a []float64 (which is written as a column vector), a string, a
+// MATStruct, or a MATCell.
+//
+// When reading, Value is a *MATMatrix for numeric and logical arrays of any
+// class, a string for character arrays with a single row, a MATStruct for 1×1
+// structures, or a MATCell for cell arrays. Values of any other kind, such as
+// complex or sparse arrays, are read as nil.
+type MATVariable struct {
+	Name  string
+	Value interface{}
+}
+
+// MATStruct is a 1×1 MATLAB structure, with fields in order.
+type MATStruct []MATVariable
+
+// MATCell is a cell array, which is written as a column.
+type MATCell []interface{}
+
+// Field returns the value of the named field, or nil if there is none.
+func (s MATStruct) Field(name string) interface{} {
+	for _, f := range s {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// isMATName checks if name is a valid MATLAB identifier.
+func isMATName(name string) bool {
+	if name == "" || len(name) > matMaxNameLength {
+		return false
+	}
+
+	for i, c := range name {
+		letter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || (c != '_' && (c < '0' || c > '9'))) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ToMAT converts a value to one which can be written to a MAT-file. Structs
+// become MATStructs of their exported fields, maps with string keys become
+// MATStructs with their keys in sorted order, slices of float64 become row
+// vectors, other slices become MATCells, integers become int64, and nil
+// pointers become empty matrices.
+func ToMAT(v interface{}) interface{} {
+	return toMAT(reflect.ValueOf(v))
+}
+
+func toMAT(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+
+	case reflect.Bool:
+		if v.Bool() {
+			return 1.0
+		}
+		return 0.0
+
+	case reflect.String:
+		return v.String()
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return &MATMatrix{Dims: []int{0, 0}}
+		}
+		return toMAT(v.Elem())
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Float64 {
+			m := &MATMatrix{Dims: []int{1, v.Len()}, Data: make([]float64, v.Len())}
+			for i := range m.Data {
+				m.Data[i] = v.Index(i).Float()
+			}
+			return m
+		}
+
+		c := make(MATCell, v.Len())
+		for i := range c {
+			c[i] = toMAT(v.Index(i))
+		}
+		return c
+
+	case reflect.Map:
+		keys := []string{}
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+
+		s := MATStruct{}
+		for _, k := range keys {
+			s = append(s, MATVariable{k, toMAT(v.MapIndex(reflect.ValueOf(k)))})
+		}
+		return s
+
+	case reflect.Struct:
+		s := MATStruct{}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			s = append(s, MATVariable{f.Name, toMAT(v.Field(i))})
+		}
+		return s
+	}
+
+	return &MATMatrix{Dims: []int{0, 0}}
+}
+
+// matElement appends a data element to buf, using the compact format for data
+// of 4 bytes or less, and padding it to a multiple of 8 bytes.
+func matElement(buf *bytes.Buffer, typ uint32, data []byte) {
+	le := bin.LittleEndian
+	tag := make([]byte, 8)
+
+	if len(data) > 0 && len(data) <= 4 {
+		le.PutUint32(tag, uint32(len(data))<<16|typ)
+		copy(tag[4:], data)
+		buf.Write(tag)
+		return
+	}
+
+	le.PutUint32(tag, typ)
+	le.PutUint32(tag[4:], uint32(len(data)))
+	buf.Write(tag)
+	buf.Write(data)
+	if len(data)%8 != 0 {
+		buf.Write(make([]byte, 8-len(data)%8))
+	}
+}
+
+// encodeMATArray encodes a value as a miMATRIX data element.
+func encodeMATArray(name string, value interface{}) ([]byte, error) {
+	le := bin.LittleEndian
+	var class uint32
+	var dims []int
+	body := &bytes.Buffer{}
+
+	switch v := value.(type) {
+	case float64:
+		return encodeMATArray(name, &MATMatrix{Dims: []int{1, 1}, Data: []float64{v}})
+
+	case []float64:
+		return encodeMATArray(name, &MATMatrix{Dims: []int{len(v), 1}, Data: v})
+
+	case *MATMatrix:
+		size := 1
+		for _, d := range v.Dims {
+			size *= d
+		}
+		if len(v.Dims) < 2 || size != len(v.Data) {
+			return nil, fmt.Errorf("Dimensions %v do not match %d elements", v.Dims, len(v.Data))
+		}
+
+		class = mxDouble
+		dims = v.Dims
+		data := make([]byte, 8*len(v.Data))
+		for i, x := range v.Data {
+			le.PutUint64(data[8*i:], math.Float64bits(x))
+		}
+		matElement(body, miDouble, data)
+
+	case int64:
+		class = mxInt64
+		dims = []int{1, 1}
+		data := make([]byte, 8)
+		le.PutUint64(data, uint64(v))
+		matElement(body, miInt64, data)
+
+	case string:
+		units := utf16.Encode([]rune(v))
+		class = mxChar
+		dims = []int{1, len(units)}
+		if len(units) == 0 {
+			dims = []int{0, 0}
+		}
+		data := make([]byte, 2*len(units))
+		for i, u := range units {
+			le.PutUint16(data[2*i:], u)
+		}
+		matElement(body, miUint16, data)
+
+	case MATStruct:
+		class = mxStruct
+		dims = []int{1, 1}
+
+		length := 1
+		for _, f := range v {
+			if !isMATName(f.Name) {
+				return nil, fmt.Errorf("Invalid field name '%s'", f.Name)
+			}
+			if len(f.Name)+1 > length {
+				length = len(f.Name) + 1
+			}
+		}
+
+		data := make([]byte, 4)
+		le.PutUint32(data, uint32(length))
+		matElement(body, miInt32, data)
+
+		names := make([]byte, length*len(v))
+		for i, f := range v {
+			copy(names[i*length:], f.Name)
+		}
+		matElement(body, miInt8, names)
+
+		for _, f := range v {
+			field, err := encodeMATArray("", f.Value)
+			if err != nil {
+				return nil, fmt.Errorf("field '%s': %v", f.Name, err)
+			}
+			body.Write(field)
+		}
+
+	case MATCell:
+		class = mxCell
+		dims = []int{len(v), 1}
+
+		for i, c := range v {
+			cell, err := encodeMATArray("", c)
+			if err != nil {
+				return nil, fmt.Errorf("cell %d: %v", i+1, err)
+			}
+			body.Write(cell)
+		}
+
+	default:
+		return nil, fmt.Errorf("Unsupported type %T", value)
+	}
+
+	buf := &bytes.Buffer{}
+
+	flags := make([]byte, 8)
+	le.PutUint32(flags, class)
+	matElement(buf, miUint32, flags)
+
+	dimData := make([]byte, 4*len(dims))
+	for i, d := range dims {
+		le.PutUint32(dimData[4*i:], uint32(d))
+	}
+	matElement(buf, miInt32, dimData)
+
+	matElement(buf, miInt8, []byte(name))
+
+	buf.Write(body.Bytes())
+
+	element := &bytes.Buffer{}
+	matElement(element, miMatrix, buf.Bytes())
+	return element.Bytes(), nil
+}
+
+// EncodeMATVariables writes the variables as an uncompressed Level 5 MAT-file.
+func EncodeMATVariables(w io.Writer, vars []MATVariable) error {
+	header := make([]byte, 128)
+	copy(header, matHeaderText)
+	for i := len(matHeaderText); i < 116; i++ {
+		header[i] = ' '
+	}
+	bin.LittleEndian.PutUint16(header[124:], 0x0100)
+	copy(header[126:], "IM")
+
+	_, err := w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range vars {
+		if !isMATName(v.Name) {
+			return fmt.Errorf("Invalid MAT variable name '%s'", v.Name)
+		}
+
+		data, err := encodeMATArray(v.Name, v.Value)
+		if err != nil {
+			return fmt.Errorf("MAT variable '%s': %v", v.Name, err)
+		}
+
+		_, err = w.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matReader parses the data elements of a MAT-file.
+type matReader struct {
+	order bin.ByteOrder
+}
+
+// element splits the data element at the start of data into its type and
+// contents, returning the data following it.
+func (mr *matReader) element(data []byte) (uint32, []byte, []byte, error) {
+	if len(data) < 8 {
+		return 0, nil, nil, fmt.Errorf("MAT-file data element is truncated")
+	}
+
+	typ := mr.order.Uint32(data)
+
+	// the compact format stores the size in the upper half of the type
+	if typ>>16 != 0 {
+		size := int(typ >> 16)
+		if size > 4 {
+			return 0, nil, nil, fmt.Errorf("MAT-file compact data element has size %d", size)
+		}
+		return typ & 0xFFFF, data[4 : 4+size], data[8:], nil
+	}
+
+	size := int(mr.order.Uint32(data[4:]))
+	if size > len(data)-8 {
+		return 0, nil, nil, fmt.Errorf("MAT-file data element of %d bytes is truncated", size)
+	}
+
+	next := 8 + size
+	if typ != miCompressed {
+		next += (8 - size%8) % 8
+	}
+	if next > len(data) {
+		next = len(data)
+	}
+
+	return typ, data[8 : 8+size], data[next:], nil
+}
+
+// numbers converts the contents of a numeric data element to float64s.
+func (mr *matReader) numbers(typ uint32, data []byte) ([]float64, error) {
+	widths := map[uint32]int{
+		miInt8: 1, miUint8: 1, miInt16: 2, miUint16: 2, miInt32: 4,
+		miUint32: 4, miSingle: 4, miDouble: 8, miInt64: 8, miUint64: 8,
+		miUTF8: 1, miUTF16: 2, miUTF32: 4,
+	}
+
+	width, ok := widths[typ]
+	if !ok {
+		return nil, fmt.Errorf("MAT-file data type %d is not numeric", typ)
+	}
+
+	res := make([]float64, len(data)/width)
+	for i := range res {
+		b := data[i*width:]
+		switch typ {
+		case miInt8:
+			res[i] = float64(int8(b[0]))
+		case miUint8, miUTF8:
+			res[i] = float64(b[0])
+		case miInt16:
+			res[i] = float64(int16(mr.order.Uint16(b)))
+		case miUint16, miUTF16:
+			res[i] = float64(mr.order.Uint16(b))
+		case miInt32:
+			res[i] = float64(int32(mr.order.Uint32(b)))
+		case miUint32, miUTF32:
+			res[i] = float64(mr.order.Uint32(b))
+		case miSingle:
+			res[i] = float64(math.Float32frombits(mr.order.Uint32(b)))
+		case miDouble:
+			res[i] = math.Float64frombits(mr.order.Uint64(b))
+		case miInt64:
+			res[i] = float64(int64(mr.order.Uint64(b)))
+		case miUint64:
+			res[i] = float64(mr.order.Uint64(b))
+		}
+	}
+
+	return res, nil
+}
+
+// text converts the contents of a character data element to a string.
+func (mr *matReader) text(typ uint32, data []byte) (string, error) {
+	if typ == miUTF8 {
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("MAT-file character data is not valid UTF-8")
+		}
+		return string(data), nil
+	}
+
+	codes, err := mr.numbers(typ, data)
+	if err != nil {
+		return "", err
+	}
+
+	if typ == miUint16 || typ == miUTF16 {
+		units := make([]uint16, len(codes))
+		for i, c := range codes {
+			units[i] = uint16(c)
+		}
+		return string(utf16.Decode(units)), nil
+	}
+
+	runes := make([]rune, len(codes))
+	for i, c := range codes {
+		runes[i] = rune(c)
+	}
+	return string(runes), nil
+}
+
+// array decodes the contents of a miMATRIX data element.
+func (mr *matReader) array(data []byte) (string, interface{}, error) {
+	// an empty element is an empty array, such as an empty cell
+	if len(data) == 0 {
+		return "", &MATMatrix{Dims: []int{0, 0}}, nil
+	}
+
+	_, flags, data, err := mr.element(data)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(flags) < 4 {
+		return "", nil, fmt.Errorf("MAT-file array flags are truncated")
+	}
+	class := mr.order.Uint32(flags) & 0xFF
+	isComplex := mr.order.Uint32(flags)&mxFlagComplex != 0
+
+	typ, dimData, data, err := mr.element(data)
+	if err != nil {
+		return "", nil, err
+	}
+	dimValues, err := mr.numbers(typ, dimData)
+	if err != nil {
+		return "", nil, err
+	}
+	dims := make([]int, len(dimValues))
+	size := 1
+	for i, d := range dimValues {
+		dims[i] = int(d)
+		size *= dims[i]
+	}
+
+	typ, nameData, data, err := mr.element(data)
+	if err != nil {
+		return "", nil, err
+	}
+	name, err := mr.text(typ, nameData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case class >= mxDouble && class <= mxUint64:
+		if isComplex {
+			return name, nil, nil
+		}
+
+		typ, realPart, _, err := mr.element(data)
+		if err != nil {
+			return "", nil, err
+		}
+		values, err := mr.numbers(typ, realPart)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(values) != size {
+			return "", nil, fmt.Errorf("MAT variable '%s' has dimensions %v, but %d elements", name, dims, len(values))
+		}
+		return name, &MATMatrix{Dims: dims, Data: values}, nil
+
+	case class == mxChar:
+		if len(dims) != 2 || dims[0] > 1 {
+			return name, nil, nil
+		}
+		typ, chars, _, err := mr.element(data)
+		if err != nil {
+			return "", nil, err
+		}
+		s, err := mr.text(typ, chars)
+		return name, s, err
+
+	case class == mxStruct:
+		if size != 1 {
+			return name, nil, nil
+		}
+
+		typ, lengthData, data, err := mr.element(data)
+		if err != nil {
+			return "", nil, err
+		}
+		lengths, err := mr.numbers(typ, lengthData)
+		if err != nil || len(lengths) != 1 || lengths[0] < 1 {
+			return "", nil, fmt.Errorf("MAT variable '%s' has an invalid field name length", name)
+		}
+		length := int(lengths[0])
+
+		_, names, data, err := mr.element(data)
+		if err != nil {
+			return "", nil, err
+		}
+
+		s := MATStruct{}
+		for i := 0; i+length <= len(names); i += length {
+			field := names[i : i+length]
+			if end := bytes.IndexByte(field, 0); end >= 0 {
+				field = field[:end]
+			}
+
+			var contents []byte
+			typ, contents, data, err = mr.element(data)
+			if err != nil {
+				return "", nil, err
+			}
+			if typ != miMatrix {
+				return "", nil, fmt.Errorf("Field '%s' of MAT variable '%s' is not an array", field, name)
+			}
+
+			_, value, err := mr.array(contents)
+			if err != nil {
+				return "", nil, err
+			}
+			s = append(s, MATVariable{string(field), value})
+		}
+		return name, s, nil
+
+	case class == mxCell:
+		c := make(MATCell, size)
+		for i := range c {
+			var contents []byte
+			typ, contents, data, err = mr.element(data)
+			if err != nil {
+				return "", nil, err
+			}
+			if typ != miMatrix {
+				return "", nil, fmt.Errorf("Cell %d of MAT variable '%s' is not an array", i+1, name)
+			}
+
+			_, c[i], err = mr.array(contents)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		return name, c, nil
+	}
+
+	return name, nil, nil
+}
+
+// variables decodes a sequence of data elements as variables.
+func (mr *matReader) variables(data []byte) ([]MATVariable, error) {
+	vars := []MATVariable{}
+
+	for len(data) > 0 {
+		typ, contents, rest, err := mr.element(data)
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+
+		switch typ {
+		case miMatrix:
+			name, value, err := mr.array(contents)
+			if err != nil {
+				return nil, err
+			}
+			vars = append(vars, MATVariable{name, value})
+
+		case miCompressed:
+			z, err := zlib.NewReader(bytes.NewReader(contents))
+			if err != nil {
+				return nil, err
+			}
+			inflated, err := ioutil.ReadAll(z)
+			if err != nil {
+				return nil, err
+			}
+
+			inner, err := mr.variables(inflated)
+			if err != nil {
+				return nil, err
+			}
+			vars = append(vars, inner...)
+		}
+	}
+
+	return vars, nil
+}
+
+// DecodeMATVariables reads every variable from a Level 5 MAT-file, in order.
+func DecodeMATVariables(r io.Reader) ([]MATVariable, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 128 {
+		return nil, fmt.Errorf("Not a MAT-file, it is too short")
+	}
+
+	mr := &matReader{}
+	switch string(data[126:128]) {
+	case "IM":
+		mr.order = bin.LittleEndian
+	case "MI":
+		mr.order = bin.BigEndian
+	default:
+		if bytes.HasPrefix(data, []byte("MATLAB 7.3")) {
+			return nil, fmt.Errorf("HDF5 based MAT-files (-v7.3) are not supported")
+		}
+		return nil, fmt.Errorf("Not a Level 5 MAT-file")
+	}
+
+	if version := mr.order.Uint16(data[124:126]); version != 0x0100 {
+		return nil, fmt.Errorf("Unsupported MAT-file version 0x%04x", version)
+	}
+
+	return mr.variables(data[128:])
+}
+
+// MATOptions controls how a signal is read from a MAT-file.
+type MATOptions struct {
+	// TimeVariable names the vector of times. If empty, "t" is used.
+	TimeVariable string
+
+	// SignalVariable names the samples, either a vector, or a matrix with
+	// a column for each channel. If empty, "s" is used.
+	SignalVariable string
+
+	// SampleRate is used to compute the times, starting at 0, if there is
+	// no time variable. If 0, the time variable is required.
+	SampleRate float64
+}
+
+// EncodeMAT writes the signal and parameters of a wave file as a MAT-file.
+//
+// The times are written as the column vector t, and the samples as s, which
+// has a column for each channel. If the file has multiple channels, their
+// names are written as the cell array channels. If the file has parameters,
+// they are written as the structure parameters, with fields named as in
+// WaveParameters.
+func EncodeMAT(w io.Writer, wf *WaveFile) error {
+	vars := []MATVariable{}
+
+	m := wf.AllChannels()
+	if m != nil {
+		err := m.Validate()
+		if err != nil {
+			return err
+		}
+
+		s := &MATMatrix{Dims: []int{m.Size(), len(m.Channels)}}
+		names := MATCell{}
+		for _, c := range m.Channels {
+			s.Data = append(s.Data, c.S...)
+			names = append(names, c.Name)
+		}
+
+		vars = append(vars, MATVariable{"t", m.T}, MATVariable{"s", s})
+		if wf.Channels != nil {
+			vars = append(vars, MATVariable{"channels", names})
+		}
+	}
+
+	if wf.Parameters != nil {
+		vars = append(vars, MATVariable{"parameters", ToMAT(wf.Parameters)})
+	}
+
+	return EncodeMATVariables(w, vars)
+}
+
+// DecodeMAT reads a signal from a MAT-file, such as one written by
+// EncodeMAT(). If the signal variable is a matrix, each column is a channel,
+// which is named by the cell array channels if there is one, and otherwise as
+// DecodeWAV() names them.
+func DecodeMAT(r io.Reader, opts *MATOptions) (*MultiSignal, error) {
+	if opts == nil {
+		opts = &MATOptions{}
+	}
+
+	timeName := opts.TimeVariable
+	if timeName == "" {
+		timeName = "t"
+	}
+	signalName := opts.SignalVariable
+	if signalName == "" {
+		signalName = "s"
+	}
+
+	vars, err := DecodeMATVariables(r)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]interface{}{}
+	for _, v := range vars {
+		found[v.Name] = v.Value
+	}
+
+	value, ok := found[signalName]
+	if !ok {
+		return nil, fmt.Errorf("MAT-file has no variable '%s'", signalName)
+	}
+	s, ok := value.(*MATMatrix)
+	if !ok || len(s.Dims) != 2 {
+		return nil, fmt.Errorf("MAT variable '%s' is not a real matrix", signalName)
+	}
+
+	// a row vector is a single channel
+	rows, columns := s.Dims[0], s.Dims[1]
+	if rows == 1 {
+		rows, columns = columns, rows
+	}
+
+	m := &MultiSignal{T: make([]float64, rows), Channels: make([]Channel, columns)}
+
+	if value, ok := found[timeName]; ok {
+		t, ok := value.(*MATMatrix)
+		if !ok || len(t.Data) != rows {
+			return nil, fmt.Errorf("MAT variable '%s' is not a vector of %d times", timeName, rows)
+		}
+		copy(m.T, t.Data)
+
+		for i := 1; i < rows; i++ {
+			if m.T[i] < m.T[i-1] {
+				return nil, fmt.Errorf("MAT variable '%s' is not sorted, time %d is before time %d", timeName, i+1, i)
+			}
+		}
+	} else if opts.SampleRate > 0 {
+		for i := range m.T {
+			m.T[i] = float64(i) / opts.SampleRate
+		}
+	} else {
+		return nil, fmt.Errorf("MAT-file has no variable '%s', and no sample rate was given", timeName)
+	}
+
+	names, _ := found["channels"].(MATCell)
+	for c := range m.Channels {
+		m.Channels[c] = Channel{
+			Name: wavChannelName(c, columns),
+			S:    append([]float64{}, s.Data[c*rows:(c+1)*rows]...),
+		}
+		if len(names) == columns {
+			if name, ok := names[c].(string); ok {
+				m.Channels[c].Name = name
+			}
+		}
+	}
+
+	if m.Size() > 1 {
+		m.SampleRate = m.AverageSampleRate()
+	}
+
+	err = m.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// WriteMAT writes a wave file to disk as a MAT-file using EncodeMAT().
+func WriteMAT(path string, wf *WaveFile) error {
+	var buf bytes.Buffer
+	err := EncodeMAT(&buf, wf)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// ReadMAT reads a signal from a MAT-file on disk using DecodeMAT().
+func ReadMAT(path string, opts *MATOptions) (*MultiSignal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return DecodeMAT(f, opts)
+}
@@ -0,0 +1,192 @@
+package wavegen
+
+import (
+	"bytes"
+	"compress/zlib"
+	bin "encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMATRoundTrip(t *testing.T) {
+	params := &WaveParameters{
+		SampleRate:  100,
+		Duration:    0.2,
+		Frequencies: []float64{3, 5},
+		Phases:      []float64{0, 0},
+		Amplitudes:  []float64{1, 1},
+		Kinds:       []string{"sine", "square"},
+		Constants:   map[string]float64{"k": 2},
+		Seed:        1 << 60,
+	}
+	wf := &WaveFile{Version: 1, Parameters: params, Channels: testStereo(t, 21, 100)}
+
+	var buf bytes.Buffer
+	err := EncodeMAT(&buf, wf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := DecodeMATVariables(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, v := range vars {
+		names = append(names, v.Name)
+	}
+	if !cmp.Equal(names, []string{"t", "s", "channels", "parameters"}) {
+		t.Fatalf("variables are %v", names)
+	}
+
+	s := vars[1].Value.(*MATMatrix)
+	if !cmp.Equal(s.Dims, []int{21, 2}) {
+		t.Errorf("s has dimensions %v", s.Dims)
+	}
+
+	p := vars[3].Value.(MATStruct)
+	if rate := p.Field("SampleRate"); rate.(*MATMatrix).Data[0] != 100 {
+		t.Errorf("parameters.SampleRate is %v", rate)
+	}
+	if kinds := p.Field("Kinds"); !cmp.Equal(kinds, MATCell{"sine", "square"}) {
+		t.Errorf("parameters.Kinds is %v", kinds)
+	}
+	if k := p.Field("Constants").(MATStruct).Field("k"); k.(*MATMatrix).Data[0] != 2 {
+		t.Errorf("parameters.Constants.k is %v", k)
+	}
+	if seed := p.Field("Seed"); seed.(*MATMatrix).Data[0] != 1<<60 {
+		t.Errorf("parameters.Seed is %v", seed)
+	}
+
+	m, err := DecodeMAT(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(m.T, wf.Channels.T) || !cmp.Equal(m.Channels, wf.Channels.Channels) {
+		t.Errorf("decoded signal %v differs from %v", m, wf.Channels)
+	}
+	if math.Abs(m.SampleRate-100) > 1e-9 {
+		t.Errorf("sample rate is %f", m.SampleRate)
+	}
+}
+
+func TestMATEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	err := EncodeMATVariables(&buf, []MATVariable{{"x", 1.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if len(data) != 128+64 {
+		t.Fatalf("MAT-file is %d bytes", len(data))
+	}
+	if !bytes.HasPrefix(data, []byte("MATLAB 5.0 MAT-file")) || string(data[124:128]) != "\x00\x01IM" {
+		t.Errorf("header is %q", data[:128])
+	}
+
+	expect := []byte{
+		14, 0, 0, 0, 56, 0, 0, 0, // miMATRIX
+		6, 0, 0, 0, 8, 0, 0, 0, 6, 0, 0, 0, 0, 0, 0, 0, // double class
+		5, 0, 0, 0, 8, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, // 1×1
+		1, 0, 1, 0, 'x', 0, 0, 0, // compact name
+		9, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xF8, 0x3F, // 1.5
+	}
+	if !bytes.Equal(data[128:], expect) {
+		t.Errorf("variable is encoded as\n%v\nexpected\n%v", data[128:], expect)
+	}
+
+	cases := []MATVariable{
+		{"1x", 1.0},
+		{"x", &MATMatrix{Dims: []int{2, 2}, Data: []float64{1}}},
+		{"x", MATStruct{{"bad name", 1.0}}},
+		{"x", []int{1}},
+	}
+	for _, c := range cases {
+		if err := EncodeMATVariables(&buf, []MATVariable{c}); err == nil {
+			t.Errorf("%+v should have errored", c)
+		}
+	}
+}
+
+func TestDecodeMATCompressed(t *testing.T) {
+	// MATLAB stores doubles in the smallest integer type which holds them,
+	// and compresses each variable
+	element := func(name string, data []byte) []byte {
+		var body bytes.Buffer
+		matElement(&body, miUint32, []byte{mxDouble, 0, 0, 0, 0, 0, 0, 0})
+		matElement(&body, miInt32, []byte{1, 0, 0, 0, 3, 0, 0, 0})
+		matElement(&body, miInt8, []byte(name))
+		matElement(&body, miInt16, data)
+
+		var matrix bytes.Buffer
+		matElement(&matrix, miMatrix, body.Bytes())
+
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		w.Write(matrix.Bytes())
+		w.Close()
+
+		tag := make([]byte, 8)
+		bin.LittleEndian.PutUint32(tag, miCompressed)
+		bin.LittleEndian.PutUint32(tag[4:], uint32(z.Len()))
+		return append(tag, z.Bytes()...)
+	}
+
+	var buf bytes.Buffer
+	EncodeMATVariables(&buf, nil)
+	buf.Write(element("volts", []byte{1, 0, 0xFE, 0xFF, 3, 0}))
+	buf.Write(element("t", []byte{0, 0, 2, 0, 4, 0}))
+
+	m, err := DecodeMAT(&buf, &MATOptions{SignalVariable: "volts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(m.T, []float64{0, 2, 4}) || !cmp.Equal(m.Channels, []Channel{{DefaultChannelName, []float64{1, -2, 3}}}) {
+		t.Errorf("decoded %+v", m)
+	}
+}
+
+func TestDecodeMATErrors(t *testing.T) {
+	encode := func(vars ...MATVariable) []byte {
+		var buf bytes.Buffer
+		if err := EncodeMATVariables(&buf, vars); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	noTime := encode(MATVariable{"s", []float64{1, 2, 3}})
+	m, err := DecodeMAT(bytes.NewReader(noTime), &MATOptions{SampleRate: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(m.T, []float64{0, 0.1, 0.2}) {
+		t.Errorf("times are %v", m.T)
+	}
+
+	cases := []struct {
+		data []byte
+		opts *MATOptions
+	}{
+		{[]byte("not a MAT-file"), nil},
+		{append([]byte("MATLAB 7.3 MAT-file"), make([]byte, 128)...), nil},
+		{noTime, nil},
+		{noTime, &MATOptions{SignalVariable: "x", SampleRate: 1}},
+		{encode(MATVariable{"s", "text"}, MATVariable{"t", 1.0}), nil},
+		{encode(MATVariable{"s", []float64{1, 2}}, MATVariable{"t", 1.0}), nil},
+		{encode(MATVariable{"s", []float64{1, 2}}, MATVariable{"t", []float64{1, 0}}), nil},
+		{noTime[:len(noTime)-4], nil},
+	}
+
+	for i, c := range cases {
+		if _, err := DecodeMAT(bytes.NewReader(c.data), c.opts); err == nil {
+			t.Errorf("Test case %d should have errored", i)
+		}
+	}
+}
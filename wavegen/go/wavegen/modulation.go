@@ -0,0 +1,172 @@
+package wavegen
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// This file implements the amplitude and frequency modulation which may be
+// applied to each component of a synthetic wave, see WaveParameters.AMDepths
+// and friends.
+
+// Envelope is a piecewise-linear function of time, given by breakpoints. Its
+// value is linearly interpolated between breakpoints, and held constant
+// before the first breakpoint and after the last. An envelope without any
+// breakpoints has no effect.
+type Envelope struct {
+	// Times is the time of each breakpoint in seconds, in non-decreasing
+	// order. If two breakpoints have the same time, the envelope jumps
+	// from the value of the first to the value of the second.
+	Times []float64
+
+	// Values is the value of the envelope at each breakpoint.
+	Values []float64
+}
+
+// IsEmpty returns true if the envelope has no breakpoints.
+func (e Envelope) IsEmpty() bool {
+	return len(e.Times) == 0
+}
+
+// Validate ensures that the envelope has a value for every breakpoint, and
+// that the breakpoints are in order.
+func (e Envelope) Validate() error {
+	if len(e.Times) != len(e.Values) {
+		return fmt.Errorf("Envelope has %d times, but %d values", len(e.Times), len(e.Values))
+	}
+
+	if !sort.Float64sAreSorted(e.Times) {
+		return fmt.Errorf("Envelope times are not in order")
+	}
+
+	return nil
+}
+
+// At returns the value of the envelope at time t. It must not be empty.
+func (e Envelope) At(t float64) float64 {
+	n := len(e.Times)
+
+	// first breakpoint after t
+	i := sort.Search(n, func(i int) bool { return e.Times[i] > t })
+	if i == 0 {
+		return e.Values[0]
+	}
+	if i == n {
+		return e.Values[n-1]
+	}
+
+	t0, t1 := e.Times[i-1], e.Times[i]
+	v0, v1 := e.Values[i-1], e.Values[i]
+	return v0 + (v1-v0)*(t-t0)/(t1-t0)
+}
+
+// antiderivative returns the integral of the envelope from its first
+// breakpoint to time t, which is negative if t is before the first
+// breakpoint.
+func (e Envelope) antiderivative(t float64) float64 {
+	n := len(e.Times)
+	if t <= e.Times[0] {
+		return e.Values[0] * (t - e.Times[0])
+	}
+
+	area := 0.0
+	for i := 1; i < n; i++ {
+		t0, t1 := e.Times[i-1], e.Times[i]
+		v0, v1 := e.Values[i-1], e.Values[i]
+		if t <= t1 {
+			v := v0 + (v1-v0)*(t-t0)/(t1-t0)
+			return area + (v0+v)/2*(t-t0)
+		}
+		area += (v0 + v1) / 2 * (t1 - t0)
+	}
+
+	return area + e.Values[n-1]*(t-e.Times[n-1])
+}
+
+// Integral returns the integral of the envelope from time 0 to time t. It
+// must not be empty.
+func (e Envelope) Integral(t float64) float64 {
+	return e.antiderivative(t) - e.antiderivative(0)
+}
+
+// validateModulation ensures that the modulation of the index-th component
+// is valid.
+func (w *WaveParameters) validateModulation(index int) error {
+	if w.AMRates[index] < 0 {
+		return fmt.Errorf("AM rate %f for component %d is negative", w.AMRates[index], index)
+	}
+
+	if w.FMRates[index] < 0 {
+		return fmt.Errorf("FM rate %f for component %d is negative", w.FMRates[index], index)
+	}
+
+	err := w.AmplitudeEnvelopes[index].Validate()
+	if err != nil {
+		return fmt.Errorf("amplitude envelope for component %d: %v", index, err)
+	}
+
+	err = w.FrequencyEnvelopes[index].Validate()
+	if err != nil {
+		return fmt.Errorf("frequency envelope for component %d: %v", index, err)
+	}
+
+	return nil
+}
+
+// modulationGain returns the factor by which the amplitude of the index-th
+// component is multiplied at time t, due to AM and its amplitude envelope.
+func (w *WaveParameters) modulationGain(index int, t float64) float64 {
+	gain := 1 + w.AMDepths[index]*math.Sin(2*math.Pi*w.AMRates[index]*t)
+
+	if !w.AmplitudeEnvelopes[index].IsEmpty() {
+		gain *= w.AmplitudeEnvelopes[index].At(t)
+	}
+
+	return gain
+}
+
+// modulationAngle returns the angle in radians which is added to that of the
+// index-th component at time t, due to FM and its frequency envelope. This is
+// the integral of the frequency offset from time 0 to t, so that the phase is
+// continuous.
+func (w *WaveParameters) modulationAngle(index int, t float64) float64 {
+	angle := 0.0
+
+	deviation := w.FMDeviations[index]
+	rate := w.FMRates[index]
+	if rate > 0 {
+		// the integral of 2π × deviation × sin(2π × rate × t)
+		angle += deviation / rate * (1 - math.Cos(2*math.Pi*rate*t))
+	}
+
+	if !w.FrequencyEnvelopes[index].IsEmpty() {
+		angle += 2 * math.Pi * w.FrequencyEnvelopes[index].Integral(t)
+	}
+
+	return angle
+}
+
+// describeModulation returns a human-readable description of the modulation
+// of the index-th component, or an empty string if it is not modulated.
+func (w *WaveParameters) describeModulation(index int) string {
+	s := ""
+
+	if w.AMDepths[index] != 0 {
+		s = fmt.Sprintf("%s, AM(depth=%f, rate=%f)", s, w.AMDepths[index], w.AMRates[index])
+	}
+
+	if w.FMDeviations[index] != 0 {
+		s = fmt.Sprintf("%s, FM(deviation=%f, rate=%f)", s, w.FMDeviations[index], w.FMRates[index])
+	}
+
+	if !w.AmplitudeEnvelopes[index].IsEmpty() {
+		s = fmt.Sprintf("%s, amplitude envelope of %d points", s, len(w.AmplitudeEnvelopes[index].Times))
+	}
+
+	if !w.FrequencyEnvelopes[index].IsEmpty() {
+		s = fmt.Sprintf("%s, frequency envelope of %d points", s, len(w.FrequencyEnvelopes[index].Times))
+	}
+
+	return s
+}
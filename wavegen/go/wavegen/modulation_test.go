@@ -0,0 +1,166 @@
+package wavegen
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	e := Envelope{
+		Times:  []float64{1, 3, 3, 4},
+		Values: []float64{2, 4, 0, 0},
+	}
+
+	if err := e.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		t        float64
+		at       float64
+		integral float64
+	}{
+		{0, 2, 0},
+		{1, 2, 2},
+		{2, 3, 4.5},
+		{3, 0, 8},
+		{5, 0, 8},
+		{-1, 2, -2},
+	}
+
+	for _, c := range cases {
+		if v := e.At(c.t); math.Abs(v-c.at) > 0.00001 {
+			t.Errorf("At(%f) = %f, expected %f", c.t, v, c.at)
+		}
+		if v := e.Integral(c.t); math.Abs(v-c.integral) > 0.00001 {
+			t.Errorf("Integral(%f) = %f, expected %f", c.t, v, c.integral)
+		}
+	}
+
+	bad := []Envelope{
+		{Times: []float64{1, 2}, Values: []float64{1}},
+		{Times: []float64{2, 1}, Values: []float64{1, 1}},
+	}
+	for i, e := range bad {
+		if e.Validate() == nil {
+			t.Errorf("Envelope %d should have failed validation", i)
+		}
+	}
+}
+
+func TestAmplitudeModulation(t *testing.T) {
+	w := &WaveParameters{
+		SampleRate:  1000,
+		Duration:    1,
+		Frequencies: []float64{0},
+		Phases:      []float64{0},
+		Amplitudes:  []float64{2},
+		Kinds:       []string{"dc"},
+		AMDepths:    []float64{0.5},
+		AMRates:     []float64{4},
+		AmplitudeEnvelopes: []Envelope{
+			{Times: []float64{0, 1}, Values: []float64{1, 0}},
+		},
+	}
+
+	sig, err := w.GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range sig.S {
+		tm := sig.T[i]
+		expect := 2 * (1 + 0.5*math.Sin(2*math.Pi*4*tm)) * (1 - tm)
+		if math.Abs(v-expect) > 0.00001 {
+			t.Fatalf("sample %d is %f, expected %f", i, v, expect)
+		}
+	}
+}
+
+func TestFrequencyModulation(t *testing.T) {
+	// count the cycles of a component whose frequency drifts from 10 Hz
+	// up to 20 Hz over 10 seconds, and is also frequency modulated
+	// symmetrically, which should not change the number of cycles
+	w := &WaveParameters{
+		SampleRate:   10000,
+		Duration:     10,
+		Frequencies:  []float64{10},
+		Phases:       []float64{0},
+		Amplitudes:   []float64{1},
+		FMDeviations: []float64{3},
+		FMRates:      []float64{1},
+		FrequencyEnvelopes: []Envelope{
+			{Times: []float64{0, 10}, Values: []float64{0, 10}},
+		},
+	}
+
+	sig, err := w.GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crossings := func(from, to int) int {
+		n := 0
+		for i := from + 1; i < to; i++ {
+			if sig.S[i-1] < 0 && sig.S[i] >= 0 {
+				n++
+			}
+		}
+		return n
+	}
+
+	// the average frequency is 15 Hz, over 10 seconds
+	total := crossings(0, sig.Size())
+	if total < 149 || total > 151 {
+		t.Errorf("%d cycles in total, expected 150", total)
+	}
+
+	// the last second averages 19.5 Hz
+	last := crossings(9*10000, sig.Size())
+	if last < 18 || last > 21 {
+		t.Errorf("%d cycles in the last second, expected about 19.5", last)
+	}
+}
+
+func TestModulationJSON(t *testing.T) {
+	w := &WaveParameters{
+		SampleRate:   10,
+		Duration:     1,
+		Frequencies:  []float64{1, 2},
+		Phases:       []float64{0, 0},
+		Amplitudes:   []float64{1, 1},
+		AMDepths:     []float64{0.1, 0},
+		AMRates:      []float64{2, 0},
+		FMDeviations: []float64{0, 1},
+		FMRates:      []float64{0, 3},
+		AmplitudeEnvelopes: []Envelope{
+			{Times: []float64{0, 1}, Values: []float64{0, 1}},
+			{},
+		},
+	}
+
+	if err := w.ValidateParameters(); err != nil {
+		t.Fatal(err)
+	}
+
+	wf := &WaveFile{Parameters: w}
+	data, err := wf.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := FromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := decoded.Parameters
+	if p.AMDepths[0] != 0.1 || p.FMRates[1] != 3 || p.AmplitudeEnvelopes[0].Values[1] != 1 || !p.FrequencyEnvelopes[1].IsEmpty() {
+		t.Errorf("modulation did not survive JSON encoding: %+v", p)
+	}
+
+	w.FMRates = []float64{0, -1}
+	if w.ValidateParameters() == nil {
+		t.Errorf("negative FM rate should have failed validation")
+	}
+}
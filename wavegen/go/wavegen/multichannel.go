@@ -0,0 +1,179 @@
+package wavegen
+
+import (
+	"fmt"
+)
+
+// DefaultChannelName is the name given to the channel of a single-channel
+// Signal when it is converted to a MultiSignal.
+const DefaultChannelName = "signal"
+
+// Channel is a named series of samples within a MultiSignal.
+type Channel struct {
+	// Name identifies the channel, and must be unique within a
+	// MultiSignal.
+	Name string `json:"name"`
+
+	// signal values
+	S []float64 `json:"samples"`
+}
+
+// MultiSignal represents several time-series signals, called channels, which
+// share the same time base, such as a number of sensors recorded at once.
+//
+// As with Signal, T must be sorted, and every channel must have the same
+// number of samples as T.
+type MultiSignal struct {
+	T []float64 `json:"times"`
+
+	Channels []Channel `json:"channels"`
+
+	// sample rate in Hz, note that this is set by the caller, this library
+	// cannot guarantee the accuracy of this value
+	SampleRate float64
+}
+
+// ToMultiSignal converts a signal to a multi-channel signal with a single
+// channel of the given name. The result shares its data with the signal.
+func (s *Signal) ToMultiSignal(name string) *MultiSignal {
+	return &MultiSignal{
+		T:          s.T,
+		Channels:   []Channel{{Name: name, S: s.S}},
+		SampleRate: s.SampleRate,
+	}
+}
+
+// Validate ensures that every channel has a unique name and the same number
+// of samples as there are times.
+func (m *MultiSignal) Validate() error {
+	seen := map[string]bool{}
+	for _, c := range m.Channels {
+		if c.Name == "" {
+			return fmt.Errorf("Signal is corrupt, a channel has no name")
+		}
+
+		if seen[c.Name] {
+			return fmt.Errorf("Signal is corrupt, channel '%s' appears more than once", c.Name)
+		}
+		seen[c.Name] = true
+
+		if len(c.S) != len(m.T) {
+			return fmt.Errorf("Signal is corrupt, channel '%s' is length %d, but T array is length %d",
+				c.Name, len(c.S), len(m.T))
+		}
+	}
+
+	return nil
+}
+
+// Size returns the number of samples in each channel.
+func (m *MultiSignal) Size() int {
+	return len(m.T)
+}
+
+// Duration returns the number seconds of data in the signal.
+func (m *MultiSignal) Duration() float64 {
+	return m.T[m.Size()-1] - m.T[0]
+}
+
+// AverageSampleRate calculates the average sample rate in Hz of the signal.
+func (m *MultiSignal) AverageSampleRate() float64 {
+	return (&Signal{T: m.T}).AverageSampleRate()
+}
+
+// ChannelNames returns the names of the channels, in order.
+func (m *MultiSignal) ChannelNames() []string {
+	names := make([]string, len(m.Channels))
+	for i, c := range m.Channels {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// AddChannel adds a new channel to the end of the signal.
+func (m *MultiSignal) AddChannel(name string, samples []float64) error {
+	if name == "" {
+		return fmt.Errorf("Channel name must not be empty")
+	}
+
+	if len(samples) != len(m.T) {
+		return fmt.Errorf("Channel '%s' is length %d, but the signal is length %d",
+			name, len(samples), len(m.T))
+	}
+
+	for _, c := range m.Channels {
+		if c.Name == name {
+			return fmt.Errorf("Signal already has a channel named '%s'", name)
+		}
+	}
+
+	m.Channels = append(m.Channels, Channel{Name: name, S: samples})
+	return nil
+}
+
+// Channel returns the named channel as a Signal, which shares its data with
+// the multi-channel signal, so that all of the Signal methods may be used on
+// it.
+func (m *MultiSignal) Channel(name string) (*Signal, error) {
+	for _, c := range m.Channels {
+		if c.Name == name {
+			return &Signal{T: m.T, S: c.S, SampleRate: m.SampleRate}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Signal has no channel named '%s'", name)
+}
+
+// MustChannel works identically to Channel(), but calls panic() if an error
+// occurs
+func (m *MultiSignal) MustChannel(name string) *Signal {
+	s, err := m.Channel(name)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Summarize summarizes each channel in turn, as Signal.Summarize() does.
+func (m *MultiSignal) Summarize() (string, error) {
+	err := m.Validate()
+	if err != nil {
+		return "", err
+	}
+
+	str := fmt.Sprintf("MULTI-CHANNEL SIGNAL: %d channels\n\n", len(m.Channels))
+	for _, name := range m.ChannelNames() {
+		summary, err := m.MustChannel(name).Summarize()
+		if err != nil {
+			return "", fmt.Errorf("channel '%s': %v", name, err)
+		}
+
+		str = fmt.Sprintf("%sCHANNEL '%s':\n\n%s\n", str, name, summary)
+	}
+
+	return str, nil
+}
+
+// Interpolate performs linear interpolation of every channel at each point in
+// times, as Signal.Interpolate() does, returning a new signal with the same
+// channels. Its sample rate is the average sample rate of times.
+func (m *MultiSignal) Interpolate(times ...float64) *MultiSignal {
+	res := &MultiSignal{
+		T:        append([]float64{}, times...),
+		Channels: make([]Channel, len(m.Channels)),
+	}
+
+	for i, c := range m.Channels {
+		sig := &Signal{T: m.T, S: c.S}
+		samples := sig.Interpolate(times...)
+
+		res.Channels[i] = Channel{Name: c.Name, S: make([]float64, len(samples))}
+		for j, s := range samples {
+			res.Channels[i].S[j] = s.S
+		}
+	}
+
+	res.SampleRate = res.AverageSampleRate()
+
+	return res
+}
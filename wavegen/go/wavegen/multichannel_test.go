@@ -0,0 +1,155 @@
+package wavegen
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testMultiSignal(t *testing.T) *MultiSignal {
+	m := &MultiSignal{T: []float64{0, 1, 2, 3}, SampleRate: 1}
+	if err := m.AddChannel("x", []float64{0, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddChannel("y", []float64{3, 2, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMultiSignalChannels(t *testing.T) {
+	m := testMultiSignal(t)
+
+	if !cmp.Equal(m.ChannelNames(), []string{"x", "y"}) {
+		t.Errorf("channel names are %v", m.ChannelNames())
+	}
+
+	y, err := m.Channel("y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if y.MustIndex(1).S != 2 || y.Duration() != 3 {
+		t.Errorf("channel y is %v", y)
+	}
+
+	// channels share data with the signal
+	y.S[0] = 10
+	if m.Channels[1].S[0] != 10 {
+		t.Errorf("channel does not share data")
+	}
+
+	if _, err := m.Channel("z"); err == nil {
+		t.Errorf("missing channel should have errored")
+	}
+	if err := m.AddChannel("x", []float64{0, 0, 0, 0}); err == nil {
+		t.Errorf("duplicate channel should have errored")
+	}
+	if err := m.AddChannel("z", []float64{0}); err == nil {
+		t.Errorf("short channel should have errored")
+	}
+}
+
+func TestMultiSignalInterpolate(t *testing.T) {
+	m := testMultiSignal(t)
+
+	res := m.Interpolate(0.5, 1.5, 2.5)
+	if !cmp.Equal(res.ChannelNames(), []string{"x", "y"}) {
+		t.Fatalf("channel names are %v", res.ChannelNames())
+	}
+
+	expect := map[string][]float64{
+		"x": {0.5, 1.5, 2.5},
+		"y": {2.5, 1.5, 0.5},
+	}
+	for name, samples := range expect {
+		actual := res.MustChannel(name).S
+		for i := range samples {
+			if math.Abs(actual[i]-samples[i]) > 0.00001 {
+				t.Errorf("channel %s interpolated to %v, expected %v", name, actual, samples)
+				break
+			}
+		}
+	}
+
+	if math.Abs(res.SampleRate-1) > 0.00001 {
+		t.Errorf("sample rate is %f", res.SampleRate)
+	}
+}
+
+func TestMultiSignalSummarize(t *testing.T) {
+	s, err := testMultiSignal(t).Summarize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{"CHANNEL 'x'", "CHANNEL 'y'", "2 channels"} {
+		if !strings.Contains(s, expect) {
+			t.Errorf("summary does not contain '%s'", expect)
+		}
+	}
+}
+
+func TestVersion1Encoding(t *testing.T) {
+	wf := &WaveFile{Version: 1, Channels: testMultiSignal(t)}
+
+	data, err := wf.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"channels"`) {
+		t.Errorf("version 1 file has no channels:\n%s", data)
+	}
+
+	decoded, err := FromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(wf, decoded) {
+		t.Errorf("version 1 JSON decoding is not idempotent: %v, %v", wf, decoded)
+	}
+
+	// a version 0 signal is written as a single channel
+	sig := &Signal{T: []float64{0, 1}, S: []float64{5, 6}, SampleRate: 1}
+	data, err = (&WaveFile{Version: 1, Signal: sig}).ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = FromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(decoded.Channels.MustChannel(DefaultChannelName), sig) {
+		t.Errorf("single channel is %v, expected %v", decoded.Channels, sig)
+	}
+
+	// version 0 files can still be read, and viewed as channels
+	decoded, err = FromJSON([]byte(`{"Version": 0, "Signal": {"samples": [1, 2], "times": [0, 1], "SampleRate": 1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Signal == nil || decoded.Channels != nil {
+		t.Fatalf("version 0 file decoded as %v", decoded)
+	}
+	if decoded.AllChannels().MustChannel(DefaultChannelName).S[1] != 2 {
+		t.Errorf("version 0 file viewed as channels is %v", decoded.AllChannels())
+	}
+
+	_, err = (&WaveFile{Version: 0, Channels: testMultiSignal(t)}).ToJSON()
+	if err == nil {
+		t.Errorf("version 0 file with channels should have errored")
+	}
+
+	_, err = FromJSON([]byte(`{"Version": 2}`))
+	if err == nil {
+		t.Errorf("version 2 file should have errored")
+	}
+
+	_, err = FromJSON([]byte(`{"Version": 1, "Signal": {"times": [0, 1], "channels": [{"name": "a", "samples": [1]}]}}`))
+	if err == nil {
+		t.Errorf("corrupt channel should have errored")
+	}
+}
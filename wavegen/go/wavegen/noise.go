@@ -0,0 +1,156 @@
+package wavegen
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// This file implements the noise models which may be applied to each
+// component of a synthetic wave, or to the wave as a whole. See
+// WaveParameters.Noises.
+
+// NoiseKinds lists every noise kind which is understood by NewNoiseGenerator().
+// The meaning of the magnitude for each is described by NewNoiseGenerator().
+var NoiseKinds = []string{
+	"none",
+	"pseudo",
+	"uniform",
+	"gaussian",
+	"pink",
+	"brown",
+	"impulsive",
+}
+
+// ImpulsiveNoiseProbability is the probability that any given sample of
+// impulsive noise is an impulse.
+var ImpulsiveNoiseProbability = 0.01
+
+// pinkGain is the standard deviation of the output of the pink noise filter
+// when its input is white noise with unit standard deviation, so that pink
+// noise can be scaled to have the requested standard deviation.
+const pinkGain = 3.0525
+
+// NoiseGenerator generates a sequence of noise values. Some kinds of noise,
+// such as pink and brown noise, depend on previous values, so a separate
+// generator must be used for each sequence.
+type NoiseGenerator struct {
+	// Kind is the kind of noise, see NoiseKinds.
+	Kind string
+
+	// Magnitude scales the noise, as described by NewNoiseGenerator().
+	Magnitude float64
+
+	// rng is used to generate random values, or the global source of
+	// the math/rand package if nil.
+	rng random
+
+	// pink is the state of the pink noise filter
+	pink [7]float64
+
+	// brown is the current value of a brown noise random walk
+	brown float64
+}
+
+// NewNoiseGenerator creates a new noise generator of the given kind. The
+// magnitude is interpreted as follows:
+//
+// * "none" or "" -- ignored, the noise is always 0.
+//
+// * "pseudo" -- uniform on [0, magnitude). This is retained for compatibility
+// with older files; since it is never negative, it biases the signal upward.
+//
+// * "uniform" -- uniform on [-magnitude, magnitude), with a mean of zero.
+//
+// * "gaussian" -- white Gaussian noise with a mean of zero and a standard
+// deviation of magnitude.
+//
+// * "pink" -- pink (1/f) noise with a mean of zero and a standard deviation
+// of approximately magnitude, once the filter has settled, which takes a few
+// thousand samples.
+//
+// * "brown" -- brown noise, being a random walk starting from zero where each
+// step is Gaussian with a standard deviation of magnitude.
+//
+// * "impulsive" -- salt-and-pepper noise, being 0 except for a fraction
+// ImpulsiveNoiseProbability of samples, which are either magnitude or
+// -magnitude with equal probability.
+func NewNoiseGenerator(kind string, magnitude float64) (*NoiseGenerator, error) {
+	if !isNoiseKind(kind) {
+		return nil, fmt.Errorf("Unknown noise kind '%s'", kind)
+	}
+
+	return &NoiseGenerator{Kind: kind, Magnitude: magnitude}, nil
+}
+
+// isNoiseKind returns true if the kind is listed in NoiseKinds, or is empty.
+func isNoiseKind(kind string) bool {
+	if kind == "" {
+		return true
+	}
+
+	for _, k := range NoiseKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *NoiseGenerator) float64() float64 {
+	if n.rng == nil {
+		return rand.Float64()
+	}
+	return n.rng.Float64()
+}
+
+func (n *NoiseGenerator) normFloat64() float64 {
+	if n.rng == nil {
+		return rand.NormFloat64()
+	}
+	return n.rng.NormFloat64()
+}
+
+// Next returns the next noise value in the sequence.
+func (n *NoiseGenerator) Next() float64 {
+	switch n.Kind {
+	case "pseudo":
+		return n.Magnitude * n.float64()
+
+	case "uniform":
+		return n.Magnitude * (2*n.float64() - 1)
+
+	case "gaussian":
+		return n.Magnitude * n.normFloat64()
+
+	case "pink":
+		// Paul Kellet's refined pink noise filter, which is accurate
+		// to within 0.05dB above 9.2Hz at a 44.1kHz sample rate
+		w := n.normFloat64()
+		p := &n.pink
+		p[0] = 0.99886*p[0] + w*0.0555179
+		p[1] = 0.99332*p[1] + w*0.0750759
+		p[2] = 0.96900*p[2] + w*0.1538520
+		p[3] = 0.86650*p[3] + w*0.3104856
+		p[4] = 0.55000*p[4] + w*0.5329522
+		p[5] = -0.7616*p[5] - w*0.0168980
+		v := p[0] + p[1] + p[2] + p[3] + p[4] + p[5] + p[6] + w*0.5362
+		p[6] = w * 0.115926
+		return n.Magnitude * v / pinkGain
+
+	case "brown":
+		n.brown += n.Magnitude * n.normFloat64()
+		return n.brown
+
+	case "impulsive":
+		if n.float64() >= ImpulsiveNoiseProbability {
+			return 0
+		}
+		if n.float64() < 0.5 {
+			return -n.Magnitude
+		}
+		return n.Magnitude
+
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,133 @@
+package wavegen
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/montanaflynn/stats"
+)
+
+// noiseSamples generates n samples of the given kind of noise with a fixed
+// seed, discarding the first few thousand so that filtered noise has settled.
+func noiseSamples(t *testing.T, kind string, magnitude float64, n int) []float64 {
+	gen, err := NewNoiseGenerator(kind, magnitude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.rng = rand.New(rand.NewSource(1))
+
+	for i := 0; i < 5000; i++ {
+		gen.Next()
+	}
+
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = gen.Next()
+	}
+	return samples
+}
+
+func TestNoiseStatistics(t *testing.T) {
+	cases := []struct {
+		kind     string
+		mean     float64
+		stdev    float64
+		min, max float64
+	}{
+		{"none", 0, 0, 0, 0},
+		{"pseudo", 1, 1 / math.Sqrt(3), 0, 2},
+		{"uniform", 0, 2 / math.Sqrt(3), -2, 2},
+		{"gaussian", 0, 2, math.Inf(-1), math.Inf(1)},
+		{"pink", 0, 2, math.Inf(-1), math.Inf(1)},
+		{"impulsive", 0, 2 * math.Sqrt(ImpulsiveNoiseProbability), -2, 2},
+	}
+
+	for _, c := range cases {
+		samples := noiseSamples(t, c.kind, 2, 200000)
+
+		mean, _ := stats.Mean(samples)
+		stdev, _ := stats.StandardDeviation(samples)
+		min, _ := stats.Min(samples)
+		max, _ := stats.Max(samples)
+
+		if math.Abs(mean-c.mean) > 0.1 {
+			t.Errorf("%s: mean is %f, expected %f", c.kind, mean, c.mean)
+		}
+		if math.Abs(stdev-c.stdev) > 0.1*c.stdev+0.0001 {
+			t.Errorf("%s: standard deviation is %f, expected %f", c.kind, stdev, c.stdev)
+		}
+		if min < c.min || max > c.max {
+			t.Errorf("%s: range is [%f, %f], expected within [%f, %f]", c.kind, min, max, c.min, c.max)
+		}
+	}
+}
+
+func TestBrownNoise(t *testing.T) {
+	samples := noiseSamples(t, "brown", 0.5, 10000)
+
+	// the differences between consecutive samples are white
+	steps := make([]float64, len(samples)-1)
+	for i := range steps {
+		steps[i] = samples[i+1] - samples[i]
+	}
+
+	mean, _ := stats.Mean(steps)
+	stdev, _ := stats.StandardDeviation(steps)
+	if math.Abs(mean) > 0.05 || math.Abs(stdev-0.5) > 0.05 {
+		t.Errorf("brown noise steps have mean %f and standard deviation %f", mean, stdev)
+	}
+}
+
+// TestPinkNoiseSpectrum checks that pink noise has more power at low
+// frequencies than white noise does, by comparing the variance of averages
+// over blocks of samples.
+func TestPinkNoiseSpectrum(t *testing.T) {
+	blockVariance := func(samples []float64, size int) float64 {
+		blocks := []float64{}
+		for i := 0; i+size <= len(samples); i += size {
+			m, _ := stats.Mean(samples[i : i+size])
+			blocks = append(blocks, m)
+		}
+		v, _ := stats.Variance(blocks)
+		return v
+	}
+
+	white := blockVariance(noiseSamples(t, "gaussian", 1, 100000), 100)
+	pink := blockVariance(noiseSamples(t, "pink", 1, 100000), 100)
+
+	if pink < 5*white {
+		t.Errorf("pink noise block variance %f is not much larger than white %f", pink, white)
+	}
+}
+
+func TestGenerateNoise(t *testing.T) {
+	w := &WaveParameters{
+		SampleRate:           100,
+		Duration:             100,
+		Frequencies:          []float64{1},
+		Phases:               []float64{0},
+		Amplitudes:           []float64{0},
+		Noises:               []string{"uniform"},
+		NoiseMagnitudes:      []float64{1},
+		GlobalNoise:          "gaussian",
+		GlobalNoiseMagnitude: 1,
+	}
+
+	sig, err := w.GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the sum of independent noises has the sum of their variances
+	variance, _ := stats.Variance(sig.S)
+	if math.Abs(variance-(1.0/3+1)) > 0.1 {
+		t.Errorf("variance of generated noise is %f, expected %f", variance, 1.0/3+1)
+	}
+
+	w.GlobalNoise = "purple"
+	_, err = w.GenerateSyntheticData()
+	if err == nil {
+		t.Errorf("unknown noise kind should have errored")
+	}
+}
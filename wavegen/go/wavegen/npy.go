@@ -0,0 +1,458 @@
+package wavegen
+
+import (
+	"archive/zip"
+	"bytes"
+	bin "encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file implements reading and writing NumPy .npy arrays, and .npz
+// archives of them, so that signals may be loaded with numpy.load().
+//
+// Arrays are always written as little endian float64 in C order. Arrays of
+// any floating point, integer, or boolean type, in either byte order, and in C
+// or Fortran order, may be read.
+
+// npyMagic begins every .npy file.
+const npyMagic = "\x93NUMPY"
+
+// npyHeaderAlignment is the alignment of the data following the header, as
+// numpy.lib.format uses.
+const npyHeaderAlignment = 64
+
+var (
+	npyDescrPattern   = regexp.MustCompile(`['"]descr['"]\s*:\s*['"]([^'"]*)['"]`)
+	npyFortranPattern = regexp.MustCompile(`['"]fortran_order['"]\s*:\s*(True|False)`)
+	npyShapePattern   = regexp.MustCompile(`['"]shape['"]\s*:\s*\(([^)]*)\)`)
+)
+
+// NPYArray is an N-dimensional array of a .npy file. Data is stored in C
+// order, as NumPy does by default, so the element at row i and column j of a
+// two-dimensional array is Data[i*Shape[1] + j]. A scalar has an empty shape
+// and a single element.
+type NPYArray struct {
+	Shape []int
+	Data  []float64
+}
+
+// Size returns the number of elements the array's shape calls for.
+func (a *NPYArray) Size() int {
+	size := 1
+	for _, d := range a.Shape {
+		size *= d
+	}
+	return size
+}
+
+// EncodeNPY writes the array as a version 1.0 .npy file.
+func EncodeNPY(w io.Writer, a *NPYArray) error {
+	if a.Size() != len(a.Data) {
+		return fmt.Errorf("Array has shape %v, but %d elements", a.Shape, len(a.Data))
+	}
+
+	dims := make([]string, len(a.Shape))
+	for i, d := range a.Shape {
+		dims[i] = strconv.Itoa(d)
+	}
+	shape := strings.Join(dims, ", ")
+	if len(a.Shape) == 1 {
+		shape += ","
+	}
+
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%s), }", shape)
+
+	// the header is padded with spaces and ends in a newline
+	length := len(npyMagic) + 4 + len(header) + 1
+	padding := (npyHeaderAlignment - length%npyHeaderAlignment) % npyHeaderAlignment
+	header += strings.Repeat(" ", padding) + "\n"
+	if len(header) > math.MaxUint16 {
+		return fmt.Errorf("Array has too many dimensions for a .npy header")
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{1, 0})
+	bin.Write(buf, bin.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+
+	data := make([]byte, 8*len(a.Data))
+	for i, x := range a.Data {
+		bin.LittleEndian.PutUint64(data[8*i:], math.Float64bits(x))
+	}
+	buf.Write(data)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// DecodeNPY reads a .npy file of version 1.0, 2.0 or 3.0.
+func DecodeNPY(r io.Reader) (*NPYArray, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 10 || string(data[:6]) != npyMagic {
+		return nil, fmt.Errorf("Not a .npy file")
+	}
+
+	var header string
+	switch data[6] {
+	case 1:
+		length := int(bin.LittleEndian.Uint16(data[8:]))
+		if 10+length > len(data) {
+			return nil, fmt.Errorf(".npy header is truncated")
+		}
+		header = string(data[10 : 10+length])
+		data = data[10+length:]
+
+	case 2, 3:
+		if len(data) < 12 {
+			return nil, fmt.Errorf(".npy header is truncated")
+		}
+		length := int(bin.LittleEndian.Uint32(data[8:]))
+		if 12+length > len(data) {
+			return nil, fmt.Errorf(".npy header is truncated")
+		}
+		header = string(data[12 : 12+length])
+		data = data[12+length:]
+
+	default:
+		return nil, fmt.Errorf("Unsupported .npy version %d.%d", data[6], data[7])
+	}
+
+	descr := npyDescrPattern.FindStringSubmatch(header)
+	fortran := npyFortranPattern.FindStringSubmatch(header)
+	shape := npyShapePattern.FindStringSubmatch(header)
+	if descr == nil || fortran == nil || shape == nil {
+		return nil, fmt.Errorf("Invalid .npy header %q", strings.TrimSpace(header))
+	}
+
+	a := &NPYArray{Shape: []int{}}
+	for _, d := range strings.Split(shape[1], ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid .npy shape (%s)", shape[1])
+		}
+		a.Shape = append(a.Shape, n)
+	}
+
+	a.Data, err = npyValues(descr[1], data, a.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	if fortran[1] == "True" {
+		a.Data = npyFromFortran(a.Shape, a.Data)
+	}
+
+	return a, nil
+}
+
+// npyValues converts n values of the NumPy type descr to float64s.
+func npyValues(descr string, data []byte, n int) ([]float64, error) {
+	if len(descr) < 3 {
+		return nil, fmt.Errorf("Unsupported .npy data type '%s'", descr)
+	}
+
+	var order bin.ByteOrder = bin.LittleEndian
+	switch descr[0] {
+	case '>':
+		order = bin.BigEndian
+	case '<', '|', '=':
+	default:
+		return nil, fmt.Errorf("Unsupported .npy data type '%s'", descr)
+	}
+
+	kind := descr[1]
+	width, err := strconv.Atoi(descr[2:])
+	supported := err == nil && ((kind == 'f' && (width == 4 || width == 8)) ||
+		((kind == 'i' || kind == 'u') && (width == 1 || width == 2 || width == 4 || width == 8)) ||
+		(kind == 'b' && width == 1))
+	if !supported {
+		return nil, fmt.Errorf("Unsupported .npy data type '%s'", descr)
+	}
+
+	if len(data) < n*width {
+		return nil, fmt.Errorf(".npy data is truncated, expected %d bytes, but there are %d", n*width, len(data))
+	}
+
+	res := make([]float64, n)
+	for i := range res {
+		b := data[i*width : (i+1)*width]
+
+		var bits uint64
+		switch width {
+		case 1:
+			bits = uint64(b[0])
+		case 2:
+			bits = uint64(order.Uint16(b))
+		case 4:
+			bits = uint64(order.Uint32(b))
+		case 8:
+			bits = order.Uint64(b)
+		}
+
+		switch {
+		case kind == 'f' && width == 4:
+			res[i] = float64(math.Float32frombits(uint32(bits)))
+		case kind == 'f':
+			res[i] = math.Float64frombits(bits)
+		case kind == 'i':
+			// sign extend from the width of the value
+			shift := uint(64 - 8*width)
+			res[i] = float64(int64(bits<<shift) >> shift)
+		default:
+			res[i] = float64(bits)
+		}
+	}
+
+	return res, nil
+}
+
+// npyFromFortran converts data in Fortran (column-major) order to C order.
+func npyFromFortran(shape []int, data []float64) []float64 {
+	res := make([]float64, len(data))
+	index := make([]int, len(shape))
+
+	for i := range res {
+		// index is the multi-index of the i-th element in C order
+		f := 0
+		stride := 1
+		for d := range shape {
+			f += index[d] * stride
+			stride *= shape[d]
+		}
+		res[i] = data[f]
+
+		for d := len(shape) - 1; d >= 0; d-- {
+			index[d]++
+			if index[d] < shape[d] {
+				break
+			}
+			index[d] = 0
+		}
+	}
+
+	return res
+}
+
+// EncodeNPZ writes the arrays as an uncompressed .npz archive, in order of
+// their names, which are the keys used to look them up after numpy.load().
+func EncodeNPZ(w io.Writer, arrays map[string]*NPYArray) error {
+	names := []string{}
+	for name := range arrays {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	z := zip.NewWriter(w)
+	for _, name := range names {
+		// a fixed time keeps the archive reproducible, and is the
+		// earliest which a zip file can represent
+		f, err := z.CreateHeader(&zip.FileHeader{
+			Name:     name + ".npy",
+			Method:   zip.Store,
+			Modified: time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = EncodeNPY(f, arrays[name])
+		if err != nil {
+			return fmt.Errorf("Array '%s': %v", name, err)
+		}
+	}
+
+	return z.Close()
+}
+
+// DecodeNPZ reads every array in a .npz archive, which may be compressed, by
+// name.
+func DecodeNPZ(r io.Reader) (map[string]*NPYArray, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	arrays := map[string]*NPYArray{}
+	for _, f := range z.File {
+		if !strings.HasSuffix(f.Name, ".npy") {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		a, err := DecodeNPY(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Array '%s': %v", f.Name, err)
+		}
+
+		arrays[strings.TrimSuffix(f.Name, ".npy")] = a
+	}
+
+	return arrays, nil
+}
+
+// ToNPY converts the signal to arrays of its times, t, and its samples, s. If
+// the signal has a single channel, s is one-dimensional, otherwise it has a
+// row for each sample and a column for each channel. The names of the channels
+// are not preserved.
+func (m *MultiSignal) ToNPY() (t, s *NPYArray) {
+	t = &NPYArray{Shape: []int{m.Size()}, Data: append([]float64{}, m.T...)}
+
+	s = &NPYArray{Shape: []int{m.Size(), len(m.Channels)}, Data: make([]float64, m.Size()*len(m.Channels))}
+	if len(m.Channels) == 1 {
+		s.Shape = s.Shape[:1]
+	}
+
+	for c, ch := range m.Channels {
+		for i, v := range ch.S {
+			s.Data[i*len(m.Channels)+c] = v
+		}
+	}
+
+	return t, s
+}
+
+// MultiSignalFromNPY converts arrays of times and samples, as written by
+// ToNPY(), to a signal, whose channels are named as DecodeWAV() names them.
+func MultiSignalFromNPY(t, s *NPYArray) (*MultiSignal, error) {
+	if len(t.Shape) != 1 {
+		return nil, fmt.Errorf("Times must be a one-dimensional array, not shape %v", t.Shape)
+	}
+
+	n := t.Shape[0]
+	columns := 1
+	switch {
+	case len(s.Shape) == 1 && s.Shape[0] == n:
+	case len(s.Shape) == 2 && s.Shape[0] == n:
+		columns = s.Shape[1]
+	default:
+		return nil, fmt.Errorf("Samples must have shape (%d,) or (%d, channels), not %v", n, n, s.Shape)
+	}
+
+	m := &MultiSignal{T: append([]float64{}, t.Data...), Channels: make([]Channel, columns)}
+	for c := range m.Channels {
+		m.Channels[c] = Channel{Name: wavChannelName(c, columns), S: make([]float64, n)}
+		for i := range m.T {
+			m.Channels[c].S[i] = s.Data[i*columns+c]
+		}
+	}
+
+	for i := 1; i < n; i++ {
+		if m.T[i] < m.T[i-1] {
+			return nil, fmt.Errorf("Times are not sorted, time %d is before time %d", i, i-1)
+		}
+	}
+
+	if m.Size() > 1 {
+		m.SampleRate = m.AverageSampleRate()
+	}
+
+	return m, nil
+}
+
+// WriteNPY writes the signal to t.npy and s.npy in the directory dir, which is
+// created if needed, see ToNPY().
+func WriteNPY(dir string, m *MultiSignal) error {
+	err := m.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	t, s := m.ToNPY()
+	for name, a := range map[string]*NPYArray{"t": t, "s": s} {
+		var buf bytes.Buffer
+		err := EncodeNPY(&buf, a)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(filepath.Join(dir, name+".npy"), buf.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadNPY reads a signal from t.npy and s.npy in the directory dir, see
+// MultiSignalFromNPY().
+func ReadNPY(dir string) (*MultiSignal, error) {
+	arrays := map[string]*NPYArray{}
+	for _, name := range []string{"t", "s"} {
+		f, err := os.Open(filepath.Join(dir, name+".npy"))
+		if err != nil {
+			return nil, err
+		}
+
+		arrays[name], err = DecodeNPY(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s.npy: %v", name, err)
+		}
+	}
+
+	return MultiSignalFromNPY(arrays["t"], arrays["s"])
+}
+
+// EncodeSignalNPZ writes the signal as a .npz archive with the arrays t and s,
+// see ToNPY().
+func EncodeSignalNPZ(w io.Writer, m *MultiSignal) error {
+	err := m.Validate()
+	if err != nil {
+		return err
+	}
+
+	t, s := m.ToNPY()
+	return EncodeNPZ(w, map[string]*NPYArray{"t": t, "s": s})
+}
+
+// DecodeSignalNPZ reads a signal from the arrays t and s of a .npz archive,
+// see MultiSignalFromNPY().
+func DecodeSignalNPZ(r io.Reader) (*MultiSignal, error) {
+	arrays, err := DecodeNPZ(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{"t", "s"} {
+		if arrays[name] == nil {
+			return nil, fmt.Errorf(".npz archive has no array '%s'", name)
+		}
+	}
+
+	return MultiSignalFromNPY(arrays["t"], arrays["s"])
+}
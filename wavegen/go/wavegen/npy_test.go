@@ -0,0 +1,161 @@
+package wavegen
+
+import (
+	"bytes"
+	bin "encoding/binary"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// npyFile builds a .npy file with the given header and data.
+func npyFile(major byte, header string, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{major, 0})
+	if major == 1 {
+		bin.Write(buf, bin.LittleEndian, uint16(len(header)))
+	} else {
+		bin.Write(buf, bin.LittleEndian, uint32(len(header)))
+	}
+	buf.WriteString(header)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestEncodeNPY(t *testing.T) {
+	var buf bytes.Buffer
+	err := EncodeNPY(&buf, &NPYArray{Shape: []int{3}, Data: []float64{0, 1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// numpy.save(f, numpy.arange(3.0))
+	header := "{'descr': '<f8', 'fortran_order': False, 'shape': (3,), }"
+	expect := npyFile(1, header+strings.Repeat(" ", 118-len(header)-1)+"\n", []byte{
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0xF0, 0x3F,
+		0, 0, 0, 0, 0, 0, 0, 0x40,
+	})
+
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf(".npy file is\n%q\nexpected\n%q", buf.Bytes(), expect)
+	}
+
+	if err := EncodeNPY(&buf, &NPYArray{Shape: []int{2, 2}, Data: []float64{1}}); err == nil {
+		t.Errorf("mismatched shape should have errored")
+	}
+}
+
+func TestDecodeNPY(t *testing.T) {
+	cases := []struct {
+		name  string
+		file  []byte
+		shape []int
+		data  []float64
+	}{
+		{
+			"big endian int16 in Fortran order",
+			npyFile(1, "{'descr': '>i2', 'fortran_order': True, 'shape': (2, 3), }\n",
+				[]byte{0, 1, 0, 4, 0, 2, 0, 5, 0xFF, 0xFD, 0, 6}),
+			[]int{2, 3},
+			[]float64{1, 2, -3, 4, 5, 6},
+		},
+		{
+			"version 2.0 float32 scalar",
+			npyFile(2, "{'descr': '<f4', 'fortran_order': False, 'shape': (), }\n",
+				[]byte{0, 0, 0xC0, 0x3F}),
+			[]int{},
+			[]float64{1.5},
+		},
+		{
+			"booleans",
+			npyFile(1, "{'descr': '|b1', 'fortran_order': False, 'shape': (3,), }\n",
+				[]byte{1, 0, 1}),
+			[]int{3},
+			[]float64{1, 0, 1},
+		},
+		{
+			"unsigned 64 bit",
+			npyFile(1, "{'descr': '<u8', 'fortran_order': False, 'shape': (1,), }\n",
+				[]byte{0, 1, 0, 0, 0, 0, 0, 0}),
+			[]int{1},
+			[]float64{256},
+		},
+	}
+
+	for _, c := range cases {
+		a, err := DecodeNPY(bytes.NewReader(c.file))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if !cmp.Equal(a.Shape, c.shape) || !cmp.Equal(a.Data, c.data) {
+			t.Errorf("%s: decoded %v %v, expected %v %v", c.name, a.Shape, a.Data, c.shape, c.data)
+		}
+	}
+
+	errors := [][]byte{
+		[]byte("not a .npy file"),
+		npyFile(1, "{'descr': '<c16', 'fortran_order': False, 'shape': (1,), }\n", make([]byte, 16)),
+		npyFile(1, "{'descr': '<f8', 'fortran_order': False, 'shape': (2,), }\n", make([]byte, 8)),
+		npyFile(1, "{'descr': '<f8', 'shape': (1,), }\n", make([]byte, 8)),
+		npyFile(4, "", nil),
+	}
+	for i, e := range errors {
+		if _, err := DecodeNPY(bytes.NewReader(e)); err == nil {
+			t.Errorf("Test case %d should have errored", i)
+		}
+	}
+}
+
+func TestNPYSignal(t *testing.T) {
+	m := testStereo(t, 11, 10)
+
+	ts, s := m.ToNPY()
+	if !cmp.Equal(s.Shape, []int{11, 2}) || s.Data[1] != m.Channels[1].S[0] {
+		t.Errorf("s has shape %v", s.Shape)
+	}
+
+	var buf bytes.Buffer
+	err := EncodeSignalNPZ(&buf, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeSignalNPZ(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(decoded.T, m.T) || !cmp.Equal(decoded.Channels[1].S, m.Channels[1].S) {
+		t.Errorf("decoded signal %v differs from %v", decoded, m)
+	}
+
+	dir, err := ioutil.TempDir("", "wavegen-npy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mono := m.MustChannel("left").ToMultiSignal(DefaultChannelName)
+	err = WriteNPY(dir, mono)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err = ReadNPY(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(decoded.T, mono.T) || !cmp.Equal(decoded.Channels, mono.Channels) {
+		t.Errorf("decoded signal %v differs from %v", decoded, mono)
+	}
+
+	if _, err := MultiSignalFromNPY(ts, &NPYArray{Shape: []int{2, 11}, Data: s.Data}); err == nil {
+		t.Errorf("transposed samples should have errored")
+	}
+}
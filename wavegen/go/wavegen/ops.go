@@ -0,0 +1,326 @@
+package wavegen
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/montanaflynn/stats"
+)
+
+// This file implements operations which combine and edit signals. They all
+// return new signals, leaving their inputs unchanged.
+
+// sameTimes checks if two lists of times are identical.
+func sameTimes(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, t := range a {
+		if b[i] != t {
+			return false
+		}
+	}
+	return true
+}
+
+// align returns the values of o at the times of the signal, interpolating
+// them linearly if the times differ.
+func (s *Signal) align(o *Signal) []float64 {
+	if sameTimes(s.T, o.T) {
+		return o.S
+	}
+
+	values := make([]float64, s.Size())
+	for i, sample := range o.Interpolate(s.T...) {
+		values[i] = sample.S
+	}
+	return values
+}
+
+// combine applies op to the values of the signal and o at each of the times of
+// the signal, or returns an error if o is empty, as it has no values to
+// interpolate.
+func (s *Signal) combine(o *Signal, op func(a, b float64) float64) (*Signal, error) {
+	if o.Size() == 0 {
+		return nil, fmt.Errorf("Cannot combine a signal with an empty signal")
+	}
+
+	res := &Signal{T: append([]float64{}, s.T...), S: make([]float64, s.Size()), SampleRate: s.SampleRate}
+	for i, v := range s.align(o) {
+		res.S[i] = op(s.S[i], v)
+	}
+	return res, nil
+}
+
+// Add returns the sum of the signal and o, at the times of the signal. If their
+// times differ, o is linearly interpolated at the times of the signal, holding
+// its first and last values outside of its duration. It is an error for o to
+// be empty.
+func (s *Signal) Add(o *Signal) (*Signal, error) {
+	return s.combine(o, func(a, b float64) float64 { return a + b })
+}
+
+// Subtract returns the difference of the signal and o, as Add() does.
+func (s *Signal) Subtract(o *Signal) (*Signal, error) {
+	return s.combine(o, func(a, b float64) float64 { return a - b })
+}
+
+// Multiply returns the product of the signal and o, as Add() does.
+func (s *Signal) Multiply(o *Signal) (*Signal, error) {
+	return s.combine(o, func(a, b float64) float64 { return a * b })
+}
+
+// Mix returns the sum of the signals, each multiplied by the corresponding
+// weight, at the times of the first, as Add() does.
+func Mix(signals []*Signal, weights []float64) (*Signal, error) {
+	if len(signals) == 0 {
+		return nil, fmt.Errorf("Must mix at least one signal")
+	}
+	if len(weights) != len(signals) {
+		return nil, fmt.Errorf("Must have one weight for each of the %d signals, not %d", len(signals), len(weights))
+	}
+
+	res := signals[0].Scale(weights[0])
+	for i, o := range signals[1:] {
+		weight := weights[i+1]
+
+		var err error
+		res, err = res.combine(o, func(a, b float64) float64 { return a + weight*b })
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// Concat joins the signals end to end. Each is shifted in time so that its
+// first sample follows the last sample of the one before it by the average
+// sample period of the one before it.
+func Concat(signals ...*Signal) (*Signal, error) {
+	if len(signals) == 0 {
+		return nil, fmt.Errorf("Must concatenate at least one signal")
+	}
+
+	res := &Signal{T: []float64{}, S: []float64{}, SampleRate: signals[0].SampleRate}
+	for i, s := range signals {
+		if s.Size() == 0 {
+			return nil, fmt.Errorf("Cannot concatenate an empty signal")
+		}
+
+		shift := 0.0
+		if i > 0 {
+			prev := signals[i-1]
+			period := 0.0
+			if prev.Size() > 1 {
+				period = 1 / prev.AverageSampleRate()
+			} else if s.Size() > 1 {
+				period = 1 / s.AverageSampleRate()
+			} else if prev.SampleRate > 0 {
+				period = 1 / prev.SampleRate
+			} else {
+				return nil, fmt.Errorf("Cannot find the sample period between signals of a single sample")
+			}
+
+			shift = res.T[res.Size()-1] + period - s.T[0]
+		}
+
+		for j, t := range s.T {
+			res.T = append(res.T, t+shift)
+			res.S = append(res.S, s.S[j])
+		}
+	}
+
+	return res, nil
+}
+
+// Slice returns the samples of the signal from time t0 to t1, inclusive.
+func (s *Signal) Slice(t0, t1 float64) (*Signal, error) {
+	if t1 < t0 {
+		return nil, fmt.Errorf("End of slice %fs must not be before its start %fs", t1, t0)
+	}
+
+	first := s.searchIndex(t0)
+	last := first
+	for last < s.Size() && s.T[last] <= t1 {
+		last++
+	}
+
+	if first == last {
+		return nil, fmt.Errorf("Signal has no samples from %fs to %fs", t0, t1)
+	}
+
+	return &Signal{
+		T:          append([]float64{}, s.T[first:last]...),
+		S:          append([]float64{}, s.S[first:last]...),
+		SampleRate: s.SampleRate,
+	}, nil
+}
+
+// Shift returns the signal delayed by dt seconds, which may be negative.
+func (s *Signal) Shift(dt float64) *Signal {
+	res := &Signal{T: make([]float64, s.Size()), S: append([]float64{}, s.S...), SampleRate: s.SampleRate}
+	for i, t := range s.T {
+		res.T[i] = t + dt
+	}
+	return res
+}
+
+// Scale returns the signal with every sample multiplied by gain.
+func (s *Signal) Scale(gain float64) *Signal {
+	res := &Signal{T: append([]float64{}, s.T...), S: make([]float64, s.Size()), SampleRate: s.SampleRate}
+	for i, v := range s.S {
+		res.S[i] = gain * v
+	}
+	return res
+}
+
+// Window returns the signal with the first and last duration seconds tapered
+// by either half of a window of the given kind, one of WindowKinds.
+func (s *Signal) Window(kind string, duration float64) (*Signal, error) {
+	if duration < 0 {
+		return nil, fmt.Errorf("Taper duration must not be negative, not %f", duration)
+	}
+
+	if !isOneOf(kind, WindowKinds) {
+		return nil, fmt.Errorf("Unknown window '%s', must be one of %v", kind, WindowKinds)
+	}
+
+	res := s.Scale(1)
+	if duration == 0 || s.Size() == 0 {
+		return res, nil
+	}
+
+	for i, t := range s.T {
+		for _, d := range []float64{t - s.T[0], s.T[s.Size()-1] - t} {
+			if d < duration {
+				res.S[i] *= windowAt(kind, 0.5*d/duration)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Normalize returns the signal scaled so that its largest absolute value is
+// peak.
+func (s *Signal) Normalize(peak float64) (*Signal, error) {
+	largest := 0.0
+	for _, v := range s.S {
+		largest = math.Max(largest, math.Abs(v))
+	}
+
+	if largest == 0 {
+		return nil, fmt.Errorf("Cannot normalize a signal which is zero everywhere")
+	}
+
+	return s.Scale(peak / largest), nil
+}
+
+// Standardize returns the signal shifted and scaled to have a mean of 0 and a
+// standard deviation of 1.
+func (s *Signal) Standardize() (*Signal, error) {
+	mean, err := stats.Mean(s.S)
+	if err != nil {
+		return nil, err
+	}
+
+	stdev, err := stats.StandardDeviation(s.S)
+	if err != nil {
+		return nil, err
+	}
+
+	if stdev == 0 {
+		return nil, fmt.Errorf("Cannot standardize a signal which is constant")
+	}
+
+	res := s.Scale(1 / stdev)
+	for i := range res.S {
+		res.S[i] -= mean / stdev
+	}
+	return res, nil
+}
+
+// Detrend returns the signal with its least-squares linear fit against time
+// subtracted.
+func (s *Signal) Detrend() *Signal {
+	res := s.Scale(1)
+	n := float64(s.Size())
+	if n == 0 {
+		return res
+	}
+
+	meanT, meanS := 0.0, 0.0
+	for i, t := range s.T {
+		meanT += t / n
+		meanS += s.S[i] / n
+	}
+
+	cov, variance := 0.0, 0.0
+	for i, t := range s.T {
+		cov += (t - meanT) * (s.S[i] - meanS)
+		variance += (t - meanT) * (t - meanT)
+	}
+
+	slope := 0.0
+	if variance > 0 {
+		slope = cov / variance
+	}
+
+	for i, t := range s.T {
+		res.S[i] -= meanS + slope*(t-meanT)
+	}
+	return res
+}
+
+// MapChannels applies op to every channel of the signal, returning a new
+// signal with the same channels.
+func (m *MultiSignal) MapChannels(op func(*Signal) (*Signal, error)) (*MultiSignal, error) {
+	return ZipChannels([]*MultiSignal{m}, func(channels []*Signal) (*Signal, error) {
+		return op(channels[0])
+	})
+}
+
+// ZipChannels applies op to each channel of the first signal, together with
+// the channel of the same name in each of the other signals, or their only
+// channel, if they have just one. It returns a new signal with the same
+// channels as the first, and the times of the results, which must be the same
+// for every channel.
+func ZipChannels(signals []*MultiSignal, op func([]*Signal) (*Signal, error)) (*MultiSignal, error) {
+	if len(signals) == 0 {
+		return nil, fmt.Errorf("Must have at least one signal")
+	}
+
+	res := &MultiSignal{SampleRate: signals[0].SampleRate, Channels: []Channel{}}
+
+	for _, name := range signals[0].ChannelNames() {
+		channels := make([]*Signal, len(signals))
+		for i, m := range signals {
+			if len(m.Channels) == 1 && i > 0 {
+				channels[i] = m.MustChannel(m.Channels[0].Name)
+				continue
+			}
+
+			c, err := m.Channel(name)
+			if err != nil {
+				return nil, err
+			}
+			channels[i] = c
+		}
+
+		sig, err := op(channels)
+		if err != nil {
+			return nil, fmt.Errorf("Channel '%s': %v", name, err)
+		}
+
+		if len(res.Channels) == 0 {
+			res.T = sig.T
+		} else if !sameTimes(sig.T, res.T) {
+			return nil, fmt.Errorf("Channel '%s' has different times than the others", name)
+		}
+
+		res.Channels = append(res.Channels, Channel{Name: name, S: sig.S})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,212 @@
+package wavegen
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// approxEqual compares floating point values to within rounding error.
+var approxEqual = cmp.Comparer(func(a, b float64) bool { return math.Abs(a-b) < 1e-9 })
+
+func TestBinaryOperations(t *testing.T) {
+	a := &Signal{T: []float64{0, 1, 2, 3}, S: []float64{1, 2, 3, 4}, SampleRate: 1}
+	b := &Signal{T: []float64{0, 2, 4}, S: []float64{10, 20, 30}}
+
+	cases := []struct {
+		name   string
+		op     func(*Signal) (*Signal, error)
+		o      *Signal
+		expect []float64
+	}{
+		{"add", a.Add, b, []float64{11, 17, 23, 29}},
+		{"subtract", a.Subtract, b, []float64{-9, -13, -17, -21}},
+		{"multiply", a.Multiply, b, []float64{10, 30, 60, 100}},
+		{"add to itself", a.Add, a, []float64{2, 4, 6, 8}},
+	}
+
+	for _, c := range cases {
+		res, err := c.op(c.o)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !cmp.Equal(res.T, a.T) || !cmp.Equal(res.S, c.expect, approxEqual) || res.SampleRate != 1 {
+			t.Errorf("%s gave %v, expected %v", c.name, res, c.expect)
+		}
+
+		if _, err := c.op(&Signal{}); err == nil {
+			t.Errorf("%s with an empty signal should have errored", c.name)
+		}
+	}
+
+	// beyond the end of b, its last value is held
+	c, err := b.Add(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(c.S, []float64{11, 23, 34}) {
+		t.Errorf("add gave %v", c.S)
+	}
+
+	mixed, err := Mix([]*Signal{a, b, a}, []float64{0.5, 0.1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(mixed.S, []float64{2.5, 4.5, 6.5, 8.5}, approxEqual) {
+		t.Errorf("mix gave %v", mixed.S)
+	}
+
+	if _, err := Mix([]*Signal{a, b}, []float64{1}); err == nil {
+		t.Errorf("mix with too few weights should have errored")
+	}
+	if _, err := Mix([]*Signal{a, {}}, []float64{1, 1}); err == nil {
+		t.Errorf("mix with an empty signal should have errored")
+	}
+
+	// the inputs are unchanged
+	if !cmp.Equal(a.S, []float64{1, 2, 3, 4}) || !cmp.Equal(b.S, []float64{10, 20, 30}) {
+		t.Errorf("inputs were modified")
+	}
+}
+
+func TestConcat(t *testing.T) {
+	a := &Signal{T: []float64{0, 0.5, 1}, S: []float64{1, 2, 3}}
+	b := &Signal{T: []float64{5, 5.25}, S: []float64{4, 5}}
+
+	res, err := Concat(a, b, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := &Signal{
+		T: []float64{0, 0.5, 1, 1.5, 1.75, 2, 2.5, 3},
+		S: []float64{1, 2, 3, 4, 5, 1, 2, 3},
+	}
+	if !cmp.Equal(res, expect, approxEqual) {
+		t.Errorf("concatenated %v, expected %v", res, expect)
+	}
+
+	single := &Signal{T: []float64{0}, S: []float64{1}}
+	if _, err := Concat(single, single); err == nil {
+		t.Errorf("single samples without a sample rate should have errored")
+	}
+	single.SampleRate = 10
+	res, err = Concat(single, single)
+	if err != nil || !cmp.Equal(res.T, []float64{0, 0.1}) {
+		t.Errorf("concatenated single samples to %v: %v", res, err)
+	}
+}
+
+func TestEditing(t *testing.T) {
+	sig := &Signal{T: []float64{0, 1, 2, 3, 4}, S: []float64{1, -3, 2, 0, 5}, SampleRate: 1}
+
+	sliced, err := sig.Slice(0.5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(sliced.T, []float64{1, 2, 3}) || !cmp.Equal(sliced.S, []float64{-3, 2, 0}) {
+		t.Errorf("sliced %v", sliced)
+	}
+	if _, err := sig.Slice(3, 1); err == nil {
+		t.Errorf("backwards slice should have errored")
+	}
+	if _, err := sig.Slice(4.5, 5); err == nil {
+		t.Errorf("empty slice should have errored")
+	}
+
+	if shifted := sig.Shift(-1.5); !cmp.Equal(shifted.T, []float64{-1.5, -0.5, 0.5, 1.5, 2.5}) {
+		t.Errorf("shifted times are %v", shifted.T)
+	}
+
+	if scaled := sig.Scale(-2); !cmp.Equal(scaled.S, []float64{-2, 6, -4, 0, -10}) {
+		t.Errorf("scaled samples are %v", scaled.S)
+	}
+
+	normalized, err := sig.Normalize(0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(normalized.S, []float64{0.1, -0.3, 0.2, 0, 0.5}, approxEqual) {
+		t.Errorf("normalized samples are %v", normalized.S)
+	}
+	if _, err := sig.Scale(0).Normalize(1); err == nil {
+		t.Errorf("normalizing zero should have errored")
+	}
+
+	standardized, err := sig.Standardize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mean, stdev := 0.0, 0.0
+	for _, v := range standardized.S {
+		mean += v / 5
+		stdev += v * v / 5
+	}
+	if math.Abs(mean) > 1e-12 || math.Abs(stdev-1) > 1e-12 {
+		t.Errorf("standardized signal has mean %f and variance %f", mean, stdev)
+	}
+	if _, err := sig.Scale(0).Standardize(); err == nil {
+		t.Errorf("standardizing a constant should have errored")
+	}
+
+	trend := &Signal{T: []float64{0, 1, 2, 3}, S: []float64{1, 4, 5, 8}}
+	if detrended := trend.Detrend(); !cmp.Equal(detrended.S, []float64{-0.2, 0.6, -0.6, 0.2}, approxEqual) {
+		t.Errorf("detrended samples are %v", detrended.S)
+	}
+}
+
+func TestWindowTaper(t *testing.T) {
+	sig := &Signal{T: []float64{0, 1, 2, 3, 4, 5, 6, 7, 8}, S: []float64{1, 1, 1, 1, 1, 1, 1, 1, 1}}
+
+	tapered, err := sig.Window("hann", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []float64{0, 0.5, 1, 1, 1, 1, 1, 0.5, 0}
+	if !cmp.Equal(tapered.S, expect, approxEqual) {
+		t.Errorf("tapered samples are %v, expected %v", tapered.S, expect)
+	}
+
+	if _, err := sig.Window("kaiser", 2); err == nil {
+		t.Errorf("unknown window should have errored")
+	}
+	if _, err := sig.Window("hann", -1); err == nil {
+		t.Errorf("negative duration should have errored")
+	}
+}
+
+func TestZipChannels(t *testing.T) {
+	stereo := testStereo(t, 10, 10)
+	mono := &Signal{T: stereo.T, S: make([]float64, 10)}
+	for i := range mono.S {
+		mono.S[i] = 1
+	}
+
+	res, err := ZipChannels([]*MultiSignal{stereo, mono.ToMultiSignal(DefaultChannelName)}, func(channels []*Signal) (*Signal, error) {
+		return channels[0].Add(channels[1])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(res.ChannelNames(), []string{"left", "right"}) || res.MustChannel("right").S[0] != stereo.Channels[1].S[0]+1 {
+		t.Errorf("zipped signal is %v", res)
+	}
+
+	scaled, err := stereo.MapChannels(func(s *Signal) (*Signal, error) { return s.Scale(2), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scaled.MustChannel("left").S[3] != 2*stereo.Channels[0].S[3] {
+		t.Errorf("mapped signal is %v", scaled)
+	}
+
+	other := testStereo(t, 10, 10)
+	other.Channels[1].Name = "center"
+	_, err = ZipChannels([]*MultiSignal{stereo, other}, func(channels []*Signal) (*Signal, error) {
+		return channels[0], nil
+	})
+	if err == nil {
+		t.Errorf("missing channel should have errored")
+	}
+}
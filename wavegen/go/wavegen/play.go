@@ -0,0 +1,302 @@
+package wavegen
+
+import (
+	bin "encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// This file implements playing a signal in real time, writing each sample
+// when it is due at the signal's sample rate, as a live sensor would, so that
+// synthetic data can be fed to hardware-in-the-loop tests.
+
+// FramingKinds lists the ways in which Play() can frame each sample.
+var FramingKinds = []string{"float64", "float32", "text"}
+
+// ChunkSource is a signal which can be read a chunk at a time, and rewound to
+// its start, so that it can be played without holding it in memory.
+type ChunkSource interface {
+	// ChannelNames returns the names of the channels of each chunk.
+	ChannelNames() []string
+
+	// SampleRate returns the sample rate of the signal in Hz, or 0 if it
+	// is not known.
+	SampleRate() float64
+
+	// Next returns the next chunk of up to n samples, or io.EOF if there
+	// are none remaining.
+	Next(n int) (*MultiSignal, error)
+
+	// Rewind returns to the start of the signal.
+	Rewind() error
+}
+
+// PlayOptions controls how Play() writes a signal.
+type PlayOptions struct {
+	// Framing is the way each sample is written, one of FramingKinds. For
+	// "float64" and "float32", each value is a little endian float of
+	// that size, and for "text", each sample is a line of values
+	// separated by spaces. If empty, "float64" is used.
+	Framing string
+
+	// Times is true if each sample begins with its time in seconds,
+	// followed by the value of each channel.
+	Times bool
+
+	// Speed is the multiple of real time at which the signal is played,
+	// so that 2 plays it twice as fast. If 0, 1 is used.
+	Speed float64
+
+	// Loops is the number of times the signal is played, one after the
+	// other, with times which continue from the end of the last. If 0,
+	// it is played once, and if negative, it is played until writing
+	// fails.
+	Loops int
+
+	// Batch is the number of samples which are written at once, each
+	// batch being written when its last sample is due. For a datagram
+	// socket, each batch is one datagram. If 0, 1 is used.
+	Batch int
+}
+
+// Play writes the signal of src to w in real time, each batch of samples
+// being written when the last of them is due, relative to the time of the
+// first sample. If writing falls behind, batches are written as quickly as
+// possible until it catches up.
+func Play(w io.Writer, src ChunkSource, opts *PlayOptions) error {
+	if opts == nil {
+		opts = &PlayOptions{}
+	}
+
+	framing := opts.Framing
+	if framing == "" {
+		framing = "float64"
+	}
+	if !isOneOf(framing, FramingKinds) {
+		return fmt.Errorf("Unknown framing '%s', must be one of %v", framing, FramingKinds)
+	}
+
+	speed := opts.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	if speed < 0 || math.IsInf(speed, 0) || math.IsNaN(speed) {
+		return fmt.Errorf("Speed must be positive, not %f", speed)
+	}
+
+	batch := opts.Batch
+	if batch == 0 {
+		batch = 1
+	}
+	if batch < 0 {
+		return fmt.Errorf("Batch must be positive, not %d", batch)
+	}
+
+	loops := opts.Loops
+	if loops == 0 {
+		loops = 1
+	}
+
+	var start time.Time
+	var first, offset float64
+	buf := []byte{}
+
+	for loop := 0; loops < 0 || loop < loops; loop++ {
+		if loop > 0 {
+			err := src.Rewind()
+			if err != nil {
+				return err
+			}
+		}
+
+		// the first and last times of this pass, so that the next can
+		// continue after it
+		passFirst, passLast := math.NaN(), math.NaN()
+		period := 0.0
+
+		for {
+			chunk, err := src.Next(batch)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			if math.IsNaN(passFirst) {
+				passFirst = chunk.T[0]
+				if loop == 0 {
+					start = time.Now()
+					first = passFirst
+				}
+			}
+
+			// the period of the last sample of a pass is that of the
+			// sample rate, or else of the samples before it
+			if n := chunk.Size(); n > 1 {
+				period = chunk.T[n-1] - chunk.T[n-2]
+			} else if !math.IsNaN(passLast) {
+				period = chunk.T[0] - passLast
+			}
+			passLast = chunk.T[chunk.Size()-1]
+
+			due := start.Add(time.Duration((passLast + offset - first) / speed * float64(time.Second)))
+			if wait := time.Until(due); wait > 0 {
+				time.Sleep(wait)
+			}
+
+			buf = appendFrames(buf[:0], chunk, offset, framing, opts.Times)
+			_, err = w.Write(buf)
+			if err != nil {
+				return err
+			}
+		}
+
+		if math.IsNaN(passFirst) {
+			return nil
+		}
+
+		if src.SampleRate() > 0 {
+			period = 1 / src.SampleRate()
+		}
+		if period <= 0 {
+			return fmt.Errorf("Cannot loop a signal of a single sample without a sample rate")
+		}
+
+		offset += passLast - passFirst + period
+	}
+
+	return nil
+}
+
+// appendFrames appends each sample of the chunk to b, with its time shifted
+// by offset.
+func appendFrames(b []byte, chunk *MultiSignal, offset float64, framing string, times bool) []byte {
+	values := make([]float64, 0, len(chunk.Channels)+1)
+	for i, t := range chunk.T {
+		values = values[:0]
+		if times {
+			values = append(values, t+offset)
+		}
+		for _, c := range chunk.Channels {
+			values = append(values, c.S[i])
+		}
+
+		for j, v := range values {
+			switch framing {
+			case "float64":
+				b = append(b, 0, 0, 0, 0, 0, 0, 0, 0)
+				bin.LittleEndian.PutUint64(b[len(b)-8:], math.Float64bits(v))
+			case "float32":
+				b = append(b, 0, 0, 0, 0)
+				bin.LittleEndian.PutUint32(b[len(b)-4:], math.Float32bits(float32(v)))
+			default:
+				if j > 0 {
+					b = append(b, ' ')
+				}
+				b = strconv.AppendFloat(b, v, 'g', -1, 64)
+			}
+		}
+
+		if framing == "text" {
+			b = append(b, '\n')
+		}
+	}
+
+	return b
+}
+
+// signalSource is a ChunkSource of a signal held in memory.
+type signalSource struct {
+	m    *MultiSignal
+	next int
+}
+
+// NewSignalSource returns a ChunkSource of a signal held in memory.
+func NewSignalSource(m *MultiSignal) ChunkSource {
+	return &signalSource{m: m}
+}
+
+// ChannelNames implements ChunkSource.
+func (s *signalSource) ChannelNames() []string {
+	return s.m.ChannelNames()
+}
+
+// SampleRate implements ChunkSource.
+func (s *signalSource) SampleRate() float64 {
+	return s.m.SampleRate
+}
+
+// Next implements ChunkSource.
+func (s *signalSource) Next(n int) (*MultiSignal, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("Chunk size must be positive, not %d", n)
+	}
+
+	if s.next >= s.m.Size() {
+		return nil, io.EOF
+	}
+
+	end := s.next + n
+	if end > s.m.Size() {
+		end = s.m.Size()
+	}
+
+	chunk := &MultiSignal{T: s.m.T[s.next:end], SampleRate: s.m.SampleRate}
+	for _, c := range s.m.Channels {
+		chunk.Channels = append(chunk.Channels, Channel{Name: c.Name, S: c.S[s.next:end]})
+	}
+
+	s.next = end
+	return chunk, nil
+}
+
+// Rewind implements ChunkSource.
+func (s *signalSource) Rewind() error {
+	s.next = 0
+	return nil
+}
+
+// generatorSource is a ChunkSource of the signal of a Generator.
+type generatorSource struct {
+	g *Generator
+}
+
+// Source returns a ChunkSource of the generator's signal, as a single channel
+// named DefaultChannelName. Rewinding it generates the same signal again.
+func (g *Generator) Source() ChunkSource {
+	return &generatorSource{g: g}
+}
+
+// ChannelNames implements ChunkSource.
+func (s *generatorSource) ChannelNames() []string {
+	return []string{DefaultChannelName}
+}
+
+// SampleRate implements ChunkSource.
+func (s *generatorSource) SampleRate() float64 {
+	return s.g.params.SampleRate
+}
+
+// Next implements ChunkSource.
+func (s *generatorSource) Next(n int) (*MultiSignal, error) {
+	sig, err := s.g.Next(n)
+	if err != nil {
+		return nil, err
+	}
+	return sig.ToMultiSignal(DefaultChannelName), nil
+}
+
+// Rewind implements ChunkSource.
+func (s *generatorSource) Rewind() error {
+	g, err := s.g.params.NewGenerator()
+	if err != nil {
+		return err
+	}
+
+	*s.g = *g
+	return nil
+}
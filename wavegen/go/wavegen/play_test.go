@@ -0,0 +1,222 @@
+package wavegen
+
+import (
+	"bytes"
+	bin "encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlayFraming(t *testing.T) {
+	stereo := testStereo(t, 4, 10)
+	left := stereo.Channels[0].S
+	right := stereo.Channels[1].S
+
+	buf := &bytes.Buffer{}
+	err := Play(buf, NewSignalSource(stereo), &PlayOptions{Framing: "text", Times: true, Loops: 2, Speed: 1000, Batch: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := ""
+	for loop := 0; loop < 2; loop++ {
+		for i := range stereo.T {
+			ts := float64(loop)*0.4 + stereo.T[i]
+			expect += string(appendFrames(nil, &MultiSignal{T: []float64{ts}, Channels: []Channel{{"left", left[i : i+1]}, {"right", right[i : i+1]}}}, 0, "text", true))
+		}
+	}
+	if buf.String() != expect {
+		t.Errorf("played text is:\n%s\nexpected:\n%s", buf.String(), expect)
+	}
+
+	buf.Reset()
+	err = Play(buf, NewSignalSource(stereo), &PlayOptions{Speed: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]float64, 8)
+	bin.Read(buf, bin.LittleEndian, values)
+	if !cmp.Equal(values, []float64{left[0], right[0], left[1], right[1], left[2], right[2], left[3], right[3]}) {
+		t.Errorf("played float64 values are %v", values)
+	}
+
+	buf.Reset()
+	err = Play(buf, NewSignalSource(stereo), &PlayOptions{Framing: "float32", Times: true, Speed: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 4*3*4 {
+		t.Errorf("played %d bytes of float32 values", buf.Len())
+	}
+	single := make([]float32, 3)
+	bin.Read(buf, bin.LittleEndian, single)
+	if !cmp.Equal(single, []float32{0, float32(left[0]), float32(right[0])}) {
+		t.Errorf("played float32 values are %v", single)
+	}
+}
+
+func TestPlayErrors(t *testing.T) {
+	src := NewSignalSource(testStereo(t, 4, 10))
+	cases := []PlayOptions{
+		{Framing: "float16"},
+		{Speed: -1},
+		{Batch: -1},
+	}
+
+	for i, c := range cases {
+		if err := Play(ioutil.Discard, src, &c); err == nil {
+			t.Errorf("Test case %d should have errored", i)
+		}
+	}
+
+	single := NewSignalSource((&Signal{T: []float64{0}, S: []float64{1}}).ToMultiSignal(DefaultChannelName))
+	if err := Play(ioutil.Discard, single, &PlayOptions{Loops: 2}); err == nil {
+		t.Errorf("looping a single sample without a sample rate should have errored")
+	}
+}
+
+func TestGeneratorSource(t *testing.T) {
+	params := &WaveParameters{SampleRate: 100, Duration: 0.5, Frequencies: []float64{3}, Phases: []float64{0}, Amplitudes: []float64{1}, GlobalNoise: "pink", GlobalNoiseMagnitude: 0.1, Seed: 7}
+	g, err := params.NewGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Play(buf, g.Source(), &PlayOptions{Loops: 3, Speed: 1000, Batch: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, _ := params.GenerateSyntheticData()
+	values := make([]float64, 3*sig.Size())
+	bin.Read(buf, bin.LittleEndian, values)
+	for loop := 0; loop < 3; loop++ {
+		if !cmp.Equal(values[loop*sig.Size():(loop+1)*sig.Size()], sig.S) {
+			t.Errorf("loop %d differs from the generated signal", loop)
+		}
+	}
+}
+
+// playTo plays 0.2s of a 100Hz signal with the given options to a client of
+// the listener, returning what the client read, and how long it took.
+func playTo(t *testing.T, l net.Listener, opts *PlayOptions) ([]byte, time.Duration) {
+	sig := &Signal{SampleRate: 100}
+	for i := 0; i < 20; i++ {
+		sig.T = append(sig.T, float64(i)/100)
+		sig.S = append(sig.S, float64(i))
+	}
+
+	done := make(chan error)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		err = Play(conn, NewSignalSource(sig.ToMultiSignal(DefaultChannelName)), opts)
+		conn.Close()
+		done <- err
+	}()
+
+	conn, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	data, err := ioutil.ReadAll(conn)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data, elapsed
+}
+
+func TestPlayRealTime(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	data, elapsed := playTo(t, l, &PlayOptions{Framing: "float32"})
+	if len(data) != 4*20 || math.Float32frombits(bin.LittleEndian.Uint32(data[4*19:])) != 19 {
+		t.Errorf("read %d bytes", len(data))
+	}
+
+	// the last sample is due 0.19s after the first, and only the lower
+	// bound is checked, as a loaded machine may take longer
+	if elapsed < 180*time.Millisecond {
+		t.Errorf("playing in real time took %v", elapsed)
+	}
+
+	_, elapsed = playTo(t, l, &PlayOptions{Speed: 4, Batch: 5})
+	if elapsed < 40*time.Millisecond {
+		t.Errorf("playing at 4 times real time took %v", elapsed)
+	}
+
+	dir, err := ioutil.TempDir("", "wavegen-play-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	unix, err := net.Listen("unix", filepath.Join(dir, "socket"))
+	if err != nil {
+		t.Skipf("UNIX sockets are not supported: %v", err)
+	}
+	defer unix.Close()
+
+	data, _ = playTo(t, unix, &PlayOptions{Framing: "text", Speed: 10})
+	if !bytes.HasPrefix(data, []byte("0\n1\n2\n")) || bytes.Count(data, []byte("\n")) != 20 {
+		t.Errorf("read %q from a UNIX socket", data)
+	}
+}
+
+func TestPlayDatagrams(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	stereo := testStereo(t, 10, 100)
+	err = Play(conn, NewSignalSource(stereo), &PlayOptions{Batch: 4, Speed: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each batch is a datagram, the last holding the remainder
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	packet := make([]byte, 1024)
+	for _, samples := range []int{4, 4, 2} {
+		n, _, err := server.ReadFrom(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != samples*2*8 {
+			t.Errorf("datagram has %d bytes, expected %d samples", n, samples)
+		}
+	}
+}
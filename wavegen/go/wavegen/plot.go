@@ -0,0 +1,130 @@
+package wavegen
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// This file implements rendering signals as images with gonum/plot, so that
+// they can be plotted without gnuplot or a display.
+
+// PlotFormats lists the image formats which Plot() can write.
+var PlotFormats = []string{"png", "svg", "pdf"}
+
+// PlotOptions controls how Plot() renders signals.
+type PlotOptions struct {
+	// Format is the image format, one of PlotFormats. If empty, "png" is
+	// used.
+	Format string
+
+	// Title is the title of the plot, which is omitted if empty.
+	Title string
+
+	// XLabel and YLabel are the labels of the axes. If empty, "Time (s)"
+	// and "Value" are used.
+	XLabel string
+	YLabel string
+
+	// Start and End are the times in seconds of the first and last samples
+	// plotted. If End is 0, samples are plotted up to the last.
+	Start float64
+	End   float64
+
+	// Width and Height are the size of the image in inches. If 0, 6 and 4
+	// are used.
+	Width  float64
+	Height float64
+}
+
+// Plot renders the signals as lines overlaid on the same axes, each labelled
+// in the legend by the name with the same index, and writes the image to w.
+// The legend is omitted if there is a single signal.
+func Plot(w io.Writer, names []string, signals []*Signal, opts *PlotOptions) error {
+	if opts == nil {
+		opts = &PlotOptions{}
+	}
+
+	if len(signals) == 0 {
+		return fmt.Errorf("No signals to plot")
+	}
+
+	if len(names) != len(signals) {
+		return fmt.Errorf("Number of names %d differs from the number of signals %d", len(names), len(signals))
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = "png"
+	}
+	if !isOneOf(format, PlotFormats) {
+		return fmt.Errorf("Unknown plot format '%s', must be one of %v", format, PlotFormats)
+	}
+
+	width, height := opts.Width, opts.Height
+	if width == 0 {
+		width = 6
+	}
+	if height == 0 {
+		height = 4
+	}
+	if width < 0 || height < 0 {
+		return fmt.Errorf("Plot size must be positive, not %fx%f", width, height)
+	}
+
+	p, err := plot.New()
+	if err != nil {
+		return err
+	}
+
+	p.Title.Text = opts.Title
+	p.X.Label.Text = opts.XLabel
+	if p.X.Label.Text == "" {
+		p.X.Label.Text = "Time (s)"
+	}
+	p.Y.Label.Text = opts.YLabel
+	if p.Y.Label.Text == "" {
+		p.Y.Label.Text = "Value"
+	}
+	p.Add(plotter.NewGrid())
+
+	end := opts.End
+	if end == 0 {
+		end = math.Inf(1)
+	}
+
+	for i, sig := range signals {
+		if opts.Start != 0 || opts.End != 0 {
+			sig, err = sig.Slice(opts.Start, end)
+			if err != nil {
+				return fmt.Errorf("Failed to select times of '%s': %v", names[i], err)
+			}
+		}
+
+		line, err := plotter.NewLine(sig)
+		if err != nil {
+			return fmt.Errorf("Failed to plot '%s': %v", names[i], err)
+		}
+		line.Color = plotutil.Color(i)
+		line.Dashes = plotutil.Dashes(i / len(plotutil.DefaultColors))
+
+		p.Add(line)
+		if len(signals) > 1 {
+			p.Legend.Add(names[i], line)
+		}
+	}
+	p.Legend.Top = true
+
+	wt, err := p.WriterTo(vg.Length(width)*vg.Inch, vg.Length(height)*vg.Inch, format)
+	if err != nil {
+		return err
+	}
+
+	_, err = wt.WriteTo(w)
+	return err
+}
@@ -0,0 +1,58 @@
+package wavegen
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSignalXY(t *testing.T) {
+	sig := &Signal{T: []float64{0, 0.5}, S: []float64{3, 4}}
+	if x, y := sig.XY(1); x != 0.5 || y != 4 {
+		t.Errorf("XY(1) is (%f, %f)", x, y)
+	}
+}
+
+func TestPlot(t *testing.T) {
+	stereo := testStereo(t, 100, 50)
+	names := stereo.ChannelNames()
+	signals := []*Signal{}
+	for _, name := range names {
+		sig, err := stereo.Channel(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signals = append(signals, sig)
+	}
+
+	magic := map[string]string{"png": "\x89PNG", "svg": "<?xml", "pdf": "%PDF"}
+	for _, format := range PlotFormats {
+		buf := &bytes.Buffer{}
+		err := Plot(buf, names, signals, &PlotOptions{Format: format, Title: "stereo", Start: 0.5, End: 1})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), []byte(magic[format])) {
+			t.Errorf("%s plot begins with %q", format, buf.Bytes()[:8])
+		}
+	}
+
+	cases := []struct {
+		names   []string
+		signals []*Signal
+		opts    PlotOptions
+	}{
+		{nil, nil, PlotOptions{}},
+		{[]string{"left"}, signals, PlotOptions{}},
+		{names, signals, PlotOptions{Format: "gif"}},
+		{names, signals, PlotOptions{Width: -1}},
+		{names, signals, PlotOptions{Start: 10, End: 11}},
+		{names, signals, PlotOptions{Start: 10}},
+		{names, signals, PlotOptions{Start: 1, End: 0.5}},
+	}
+
+	for i, c := range cases {
+		if err := Plot(&bytes.Buffer{}, c.names, c.signals, &c.opts); err == nil {
+			t.Errorf("Test case %d should have errored", i)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package wavegen
+
+import (
+	"fmt"
+	"math"
+)
+
+// This file implements the pseudo-random number generator used for noise.
+// The standard library's math/rand does not promise that its output for a
+// given seed will stay the same between Go versions, so wavegen implements
+// its own, so that a signal can always be re-generated from its parameters.
+//
+// The generator is versioned by WaveParameters.RandomVersion, so that if it
+// ever needs to change, files written with older versions can still be
+// re-generated. Any change to the sequence of values produced must come with
+// a new version.
+
+// CurrentRandomVersion is the newest version of the pseudo-random number
+// generator, which is used for new parameters.
+const CurrentRandomVersion = 1
+
+// random is a source of random values for a NoiseGenerator. *rand.Rand
+// satisfies this interface, which can be useful for testing.
+type random interface {
+	Float64() float64
+	NormFloat64() float64
+}
+
+// newRandom creates the stream-th independent stream of pseudo-random
+// numbers for the given seed, using the given version of the generator.
+//
+// Version 1 is xoshiro256**, with its state initialized from the first four
+// outputs of SplitMix64 seeded with seed XOR (stream × 0x9E3779B97F4A7C15).
+// Uniform values are the top 53 bits of the output divided by 2^53, and
+// Gaussian values use the Box-Muller transform on two uniform values u1 and
+// u2, being sqrt(-2 ln(1 - u1)) × cos(2π u2).
+func newRandom(version int, seed int64, stream int) (random, error) {
+	if version != 1 {
+		return nil, fmt.Errorf("Unknown random number generator version %d", version)
+	}
+
+	sm := uint64(seed) ^ (uint64(stream) * 0x9E3779B97F4A7C15)
+	x := &xoshiro{}
+	for i := range x.s {
+		sm, x.s[i] = splitMix64(sm)
+	}
+
+	return x, nil
+}
+
+// splitMix64 advances the SplitMix64 state, returning the new state and the
+// next output.
+func splitMix64(state uint64) (uint64, uint64) {
+	state += 0x9E3779B97F4A7C15
+	z := state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return state, z ^ (z >> 31)
+}
+
+// xoshiro implements the xoshiro256** generator.
+type xoshiro struct {
+	s [4]uint64
+}
+
+func rotl(x uint64, k uint) uint64 {
+	return (x << k) | (x >> (64 - k))
+}
+
+// Uint64 returns the next 64 pseudo-random bits.
+func (x *xoshiro) Uint64() uint64 {
+	s := &x.s
+	result := rotl(s[1]*5, 7) * 9
+	t := s[1] << 17
+
+	s[2] ^= s[0]
+	s[3] ^= s[1]
+	s[1] ^= s[2]
+	s[0] ^= s[3]
+
+	s[2] ^= t
+	s[3] = rotl(s[3], 45)
+
+	return result
+}
+
+// Float64 returns a uniformly distributed value on [0, 1).
+func (x *xoshiro) Float64() float64 {
+	return float64(x.Uint64()>>11) / (1 << 53)
+}
+
+// NormFloat64 returns a normally distributed value with a mean of 0 and a
+// standard deviation of 1.
+func (x *xoshiro) NormFloat64() float64 {
+	u1 := x.Float64()
+	u2 := x.Float64()
+	return math.Sqrt(-2*math.Log(1-u1)) * math.Cos(2*math.Pi*u2)
+}
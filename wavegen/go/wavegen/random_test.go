@@ -0,0 +1,161 @@
+package wavegen
+
+import (
+	"testing"
+)
+
+func TestRandomVersion1(t *testing.T) {
+	// reference output of SplitMix64 seeded with 0
+	_, v := splitMix64(0)
+	if v != 0xE220A8397B1DCDAF {
+		t.Errorf("SplitMix64 output is %x", v)
+	}
+
+	// these values must never change, since files record only the seed
+	// and version they were generated with
+	r, err := newRandom(1, 42, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := r.(*xoshiro)
+
+	if u := x.Uint64(); u != 1546998764402558742 {
+		t.Errorf("first output is %d", u)
+	}
+	if f := x.Float64(); f != 0.3789802506626686 {
+		t.Errorf("second output is %v", f)
+	}
+	if n := x.NormFloat64(); n != 1.3438117634372808 {
+		t.Errorf("third output is %v", n)
+	}
+
+	_, err = newRandom(2, 42, 0)
+	if err == nil {
+		t.Errorf("unknown version should have errored")
+	}
+}
+
+func TestSeededGeneration(t *testing.T) {
+	params := func(seed int64) *WaveParameters {
+		return &WaveParameters{
+			SampleRate:           100,
+			Duration:             1,
+			Frequencies:          []float64{1, 2},
+			Phases:               []float64{0, 0},
+			Amplitudes:           []float64{1, 1},
+			Noises:               []string{"gaussian", "pink"},
+			NoiseMagnitudes:      []float64{0.1, 0.1},
+			GlobalNoise:          "uniform",
+			GlobalNoiseMagnitude: 0.1,
+			Seed:                 seed,
+		}
+	}
+
+	a, err := params(7).GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := params(7).GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := params(8).GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same := true
+	for i := range a.S {
+		if a.S[i] != b.S[i] {
+			t.Fatalf("sample %d differs with the same seed: %v, %v", i, a.S[i], b.S[i])
+		}
+		if a.S[i] != c.S[i] {
+			same = false
+		}
+	}
+	if same {
+		t.Errorf("different seeds generated the same signal")
+	}
+
+	// each component has its own stream
+	w := params(7)
+	g0, _ := w.NoiseGenerator(0)
+	g1, _ := w.NoiseGenerator(1)
+	g1.Kind = "gaussian"
+	if g0.Next() == g1.Next() {
+		t.Errorf("components share a stream of random numbers")
+	}
+
+	w.RandomVersion = CurrentRandomVersion + 1
+	if w.ValidateParameters() == nil {
+		t.Errorf("unknown random version should have failed validation")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	w := &WaveParameters{
+		SampleRate:           10,
+		Duration:             1,
+		Frequencies:          []float64{1},
+		Phases:               []float64{0},
+		Amplitudes:           []float64{1},
+		GlobalNoise:          "gaussian",
+		GlobalNoiseMagnitude: 1,
+		Seed:                 3,
+	}
+
+	sig, err := w.GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wf := &WaveFile{Parameters: w, Signal: sig}
+
+	// round trip through JSON, as regenerating a file would
+	data, err := wf.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf, err = FromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wf.Verify(0)
+	if err != nil {
+		t.Errorf("unmodified file failed verification: %v", err)
+	}
+
+	wf.Signal.S[4] += 0.001
+	if wf.Verify(0) == nil {
+		t.Errorf("modified file should have failed verification")
+	}
+	if wf.Verify(0.01) != nil {
+		t.Errorf("modified file should be within epsilon")
+	}
+
+	wf.Parameters.Seed = 4
+	if wf.Verify(0.01) == nil {
+		t.Errorf("file with a different seed should have failed verification")
+	}
+
+	// a version 1 file holds its regenerated signal as its only channel
+	wf = &WaveFile{Version: 1, Parameters: w, Channels: sig.ToMultiSignal("left")}
+	err = wf.Regenerate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = wf.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf, err = FromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := wf.Channels.ChannelNames(); len(names) != 1 || names[0] != DefaultChannelName {
+		t.Errorf("regenerated file has channels %v", names)
+	}
+}
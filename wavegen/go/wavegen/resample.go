@@ -0,0 +1,383 @@
+package wavegen
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// This file implements resampling signals by methods other than the linear
+// interpolation of Signal.Interpolate().
+//
+// The band-limited methods, sinc, polyphase, and decimate, all use a
+// Kaiser-windowed sinc kernel, whose cutoff is the lower of the input and
+// output Nyquist frequencies, so that downsampling does not alias. The weights
+// of the kernel are normalized at every output sample, so that the ends of the
+// signal, where the kernel is truncated, are not attenuated.
+
+// ResampleMethods lists the resampling methods understood by Resample().
+var ResampleMethods = []string{"linear", "nearest", "cubic", "sinc", "polyphase", "decimate"}
+
+const (
+	// sincZeroCrossings is the number of zero crossings of the sinc
+	// kernel on either side of its center.
+	sincZeroCrossings = 16
+
+	// kaiserBeta is the shape parameter of the Kaiser window applied to
+	// the sinc kernel, which gives a stopband attenuation of about 90dB.
+	kaiserBeta = 8.6
+
+	// maxPolyphaseFactor is the largest upsampling or downsampling factor
+	// the polyphase method will use to approximate the resampling ratio.
+	maxPolyphaseFactor = 1000
+)
+
+// Resampling describes how the signal of a wave file was resampled from
+// another signal.
+type Resampling struct {
+	// Method is the resampling method, one of ResampleMethods.
+	Method string
+
+	// SampleRate is the sample rate in Hz to which the signal was
+	// resampled.
+	SampleRate float64
+
+	// SourceSampleRate is the average sample rate in Hz of the signal
+	// before it was resampled.
+	SourceSampleRate float64
+}
+
+// Summarize describes how the signal was resampled.
+func (r *Resampling) Summarize() string {
+	str := "RESAMPLING SUMMARY:\n\n"
+	str = fmt.Sprintf("%s\tMethod . . . . . . . . . %s\n", str, r.Method)
+	str = fmt.Sprintf("%s\tSample Rate  . . . . . . %f\n", str, r.SampleRate)
+	str = fmt.Sprintf("%s\tSource Sample Rate . . . %f\n", str, r.SourceSampleRate)
+	return str
+}
+
+// resampleTimes returns the times at which a signal starting at start and
+// lasting duration seconds is sampled at rate Hz.
+func resampleTimes(start, duration, rate float64) []float64 {
+	times := []float64{}
+	for i := 0; float64(i) < duration*rate; i++ {
+		times = append(times, start+float64(i)/rate)
+	}
+	return times
+}
+
+// besselI0 computes the modified Bessel function of the first kind of order
+// 0, by its power series.
+func besselI0(x float64) float64 {
+	sum := 1.0
+	term := 1.0
+	for k := 1; term > 1e-16*sum; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+// windowedSinc computes the low-pass kernel with cutoff fc, relative to the
+// Nyquist frequency, at x samples from its center, windowed to halfWidth
+// samples on either side.
+func windowedSinc(x, fc, halfWidth float64) float64 {
+	r := x / halfWidth
+	if r <= -1 || r >= 1 {
+		return 0
+	}
+
+	sinc := 1.0
+	if x != 0 {
+		sinc = math.Sin(math.Pi*fc*x) / (math.Pi * fc * x)
+	}
+
+	return fc * sinc * besselI0(kaiserBeta*math.Sqrt(1-r*r)) / besselI0(kaiserBeta)
+}
+
+// uniformPeriod returns the sample period of the signal, or an error naming
+// method if it is not uniformly sampled.
+func (s *Signal) uniformPeriod(method string) (float64, error) {
+	rate, err := (&MultiSignal{T: s.T}).UniformSampleRate(1e-6)
+	if err != nil {
+		return 0, fmt.Errorf("The %s method requires a uniformly sampled signal, use linear, nearest or cubic instead: %v", method, err)
+	}
+	return 1 / rate, nil
+}
+
+// sincSample computes the value of a uniformly sampled signal at position u,
+// measured in samples from the first, using a windowed sinc kernel with
+// cutoff fc.
+func (s *Signal) sincSample(u, fc float64) float64 {
+	halfWidth := sincZeroCrossings / fc
+	first := int(math.Max(0, math.Ceil(u-halfWidth)))
+	last := int(math.Min(float64(s.Size()-1), math.Floor(u+halfWidth)))
+
+	sum, weights := 0.0, 0.0
+	for n := first; n <= last; n++ {
+		w := windowedSinc(u-float64(n), fc, halfWidth)
+		sum += w * s.S[n]
+		weights += w
+	}
+
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
+
+// nearestSample returns the value of the sample nearest to t.
+func (s *Signal) nearestSample(t float64) float64 {
+	i := sort.SearchFloat64s(s.T, t)
+	if i == s.Size() || (i > 0 && t-s.T[i-1] <= s.T[i]-t) {
+		i--
+	}
+	return s.S[i]
+}
+
+// cubicSpline returns the natural cubic spline through the samples, which
+// holds the values of the first and last samples outside of the signal.
+func (s *Signal) cubicSpline() func(t float64) float64 {
+	n := s.Size()
+
+	// second derivatives at each sample, found by solving the tridiagonal
+	// system with the Thomas algorithm
+	m := make([]float64, n)
+	if n > 2 {
+		c := make([]float64, n)
+		d := make([]float64, n)
+		for i := 1; i < n-1; i++ {
+			h0 := s.T[i] - s.T[i-1]
+			h1 := s.T[i+1] - s.T[i]
+			a := h0 / 6
+			b := (h0+h1)/3 - a*c[i-1]
+			c[i] = (h1 / 6) / b
+			d[i] = ((s.S[i+1]-s.S[i])/h1 - (s.S[i]-s.S[i-1])/h0 - a*d[i-1]) / b
+		}
+		for i := n - 2; i > 0; i-- {
+			m[i] = d[i] - c[i]*m[i+1]
+		}
+	}
+
+	return func(t float64) float64 {
+		if t <= s.T[0] {
+			return s.S[0]
+		}
+		if t >= s.T[n-1] {
+			return s.S[n-1]
+		}
+
+		i := sort.SearchFloat64s(s.T, t)
+		if s.T[i] == t {
+			return s.S[i]
+		}
+
+		h := s.T[i] - s.T[i-1]
+		a := (s.T[i] - t) / h
+		b := (t - s.T[i-1]) / h
+		return a*s.S[i-1] + b*s.S[i] + ((a*a*a-a)*m[i-1]+(b*b*b-b)*m[i])*h*h/6
+	}
+}
+
+// rationalApproximation finds the fraction p/q with p and q no larger than max
+// which is nearest to r, using its continued fraction expansion.
+func rationalApproximation(r float64, max int) (int, int) {
+	p0, q0, p1, q1 := 0, 1, 1, 0
+	x := r
+	for {
+		a := int(math.Floor(x))
+		p2, q2 := a*p1+p0, a*q1+q0
+		if p2 > max || q2 > max {
+			break
+		}
+		p0, q0, p1, q1 = p1, q1, p2, q2
+
+		if x == float64(a) || math.Abs(float64(p1)/float64(q1)-r) < 1e-12*r {
+			break
+		}
+		x = 1 / (x - float64(a))
+	}
+
+	if q1 == 0 {
+		return 1, 1
+	}
+	return p1, q1
+}
+
+// InterpolateWith computes the value of the signal at each point in times
+// using the given method, which may be linear, as Interpolate() does,
+// nearest, cubic, or sinc. The sinc method requires a uniformly sampled
+// signal, and if times are more widely spaced than the signal's samples, it
+// filters out frequencies above their Nyquist frequency.
+//
+// The polyphase and decimate methods produce uniformly spaced samples, and are
+// only available from Resample().
+func (s *Signal) InterpolateWith(method string, times ...float64) ([]Sample, error) {
+	if s.Size() == 0 {
+		return nil, fmt.Errorf("Cannot interpolate an empty signal")
+	}
+
+	var at func(t float64) float64
+
+	switch method {
+	case "linear":
+		return s.Interpolate(times...), nil
+
+	case "nearest":
+		at = s.nearestSample
+
+	case "cubic":
+		at = s.cubicSpline()
+
+	case "sinc":
+		period, err := s.uniformPeriod(method)
+		if err != nil {
+			return nil, err
+		}
+
+		fc := 1.0
+		if len(times) > 1 {
+			fc = math.Min(1, (&Signal{T: times}).AverageSampleRate()*period)
+		}
+
+		at = func(t float64) float64 {
+			return s.sincSample((t-s.T[0])/period, fc)
+		}
+
+	case "polyphase", "decimate":
+		return nil, fmt.Errorf("The %s method requires a uniform output rate, use Resample() instead", method)
+
+	default:
+		return nil, fmt.Errorf("Unknown resampling method '%s', must be one of %v", method, ResampleMethods)
+	}
+
+	interpolated := make([]Sample, len(times))
+	for i, t := range times {
+		interpolated[i] = Sample{T: t, S: at(t)}
+	}
+
+	return interpolated, nil
+}
+
+// Resample samples the signal at rate Hz using the given method, one of
+// ResampleMethods, returning a new signal with samples from the time of the
+// first sample up to its duration.
+//
+// The linear, nearest, cubic and sinc methods work as InterpolateWith() does.
+// The polyphase method requires a uniformly sampled signal, and approximates
+// the ratio of the sample rates as a fraction L/M, upsampling by L, filtering,
+// and downsampling by M. The decimate method requires a uniformly sampled
+// signal whose sample rate is a whole multiple of rate, which it low-pass
+// filters before keeping every such sample.
+func (s *Signal) Resample(method string, rate float64) (*Signal, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("Sample rate must be positive, not %f", rate)
+	}
+	if s.Size() < 2 {
+		return nil, fmt.Errorf("Signal must have at least 2 samples to be resampled")
+	}
+
+	if method != "polyphase" && method != "decimate" {
+		samples, err := s.InterpolateWith(method, resampleTimes(s.T[0], s.Duration(), rate)...)
+		if err != nil {
+			return nil, err
+		}
+
+		res := SampleList(samples).ToSignal()
+		res.SampleRate = rate
+		return res, nil
+	}
+
+	period, err := s.uniformPeriod(method)
+	if err != nil {
+		return nil, err
+	}
+	ratio := rate * period
+
+	var up, down int
+	if method == "decimate" {
+		down = int(math.Round(1 / ratio))
+		if down < 1 || math.Abs(float64(down)*ratio-1) > 1e-6 {
+			return nil, fmt.Errorf("The decimate method requires the sample rate %fHz to be a whole multiple of %fHz", 1/period, rate)
+		}
+		up = 1
+	} else {
+		up, down = rationalApproximation(ratio, maxPolyphaseFactor)
+		if math.Abs(float64(up)/float64(down)-ratio) > 1e-9*ratio {
+			return nil, fmt.Errorf("The polyphase method cannot approximate the ratio %f of the sample rates with factors of at most %d, use sinc instead",
+				ratio, maxPolyphaseFactor)
+		}
+	}
+
+	// the kernel is tabulated at the upsampled rate, where its cutoff is
+	// the lower of the two Nyquist frequencies
+	fc := 1 / float64(up)
+	if down > up {
+		fc = 1 / float64(down)
+	}
+	halfWidth := int(math.Ceil(sincZeroCrossings / fc))
+	kernel := make([]float64, 2*halfWidth+1)
+	for k := range kernel {
+		kernel[k] = windowedSinc(float64(k-halfWidth), fc, float64(halfWidth))
+	}
+
+	res := &Signal{T: []float64{}, S: []float64{}, SampleRate: rate}
+	for m := 0; float64(m) < s.Duration()*rate; m++ {
+		// the position of the output sample on the upsampled lattice,
+		// and the input samples which contribute to it
+		p := m * down
+		first := (p - halfWidth + up - 1) / up
+		if p-halfWidth < 0 {
+			first = 0
+		}
+		last := (p + halfWidth) / up
+		if last > s.Size()-1 {
+			last = s.Size() - 1
+		}
+
+		sum, weights := 0.0, 0.0
+		for n := first; n <= last; n++ {
+			w := kernel[p-n*up+halfWidth]
+			sum += w * s.S[n]
+			weights += w
+		}
+
+		v := 0.0
+		if weights != 0 {
+			v = sum / weights
+		}
+
+		res.T = append(res.T, s.T[0]+float64(p)*period/float64(up))
+		res.S = append(res.S, v)
+	}
+
+	return res, nil
+}
+
+// Resample resamples every channel of the signal as Signal.Resample() does.
+func (m *MultiSignal) Resample(method string, rate float64) (*MultiSignal, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("Sample rate must be positive, not %f", rate)
+	}
+	if m.Size() < 2 {
+		return nil, fmt.Errorf("Signal must have at least 2 samples to be resampled")
+	}
+
+	res := &MultiSignal{Channels: make([]Channel, len(m.Channels)), SampleRate: rate}
+
+	for i, c := range m.Channels {
+		sig, err := (&Signal{T: m.T, S: c.S}).Resample(method, rate)
+		if err != nil {
+			return nil, err
+		}
+
+		res.T = sig.T
+		res.Channels[i] = Channel{Name: c.Name, S: sig.S}
+	}
+
+	if len(m.Channels) == 0 {
+		res.T = resampleTimes(m.T[0], m.Duration(), rate)
+	}
+
+	return res, nil
+}
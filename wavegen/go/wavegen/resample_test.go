@@ -0,0 +1,216 @@
+package wavegen
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// tones generates a signal sampled at rate Hz for one second, which is the sum
+// of sine waves of unit amplitude at each of the given frequencies.
+func tones(rate float64, freqs ...float64) *Signal {
+	s := &Signal{SampleRate: rate}
+	for i := 0; float64(i) < rate; i++ {
+		t := float64(i) / rate
+		v := 0.0
+		for _, f := range freqs {
+			v += math.Sin(2 * math.Pi * f * t)
+		}
+		s.T = append(s.T, t)
+		s.S = append(s.S, v)
+	}
+	return s
+}
+
+// maxToneError finds the largest difference between the signal and a sine wave
+// of the given frequency, ignoring margin seconds at either end.
+func maxToneError(s *Signal, freq, margin float64) float64 {
+	worst := 0.0
+	for i, t := range s.T {
+		if t < s.T[0]+margin || t > s.T[s.Size()-1]-margin {
+			continue
+		}
+		worst = math.Max(worst, math.Abs(s.S[i]-math.Sin(2*math.Pi*freq*t)))
+	}
+	return worst
+}
+
+func TestInterpolateWith(t *testing.T) {
+	sig := &Signal{T: []float64{0, 1, 3, 4}, S: []float64{0, 2, 6, 8}}
+	times := []float64{-1, 0.4, 0.6, 2, 3.5, 5}
+
+	cases := []struct {
+		method string
+		expect []float64
+	}{
+		{"linear", []float64{0, 0.8, 1.2, 4, 7, 8}},
+		{"nearest", []float64{0, 0, 2, 2, 6, 8}},
+
+		// a natural spline through points on a line is that line
+		{"cubic", []float64{0, 0.8, 1.2, 4, 7, 8}},
+	}
+
+	for _, c := range cases {
+		samples, err := sig.InterpolateWith(c.method, times...)
+		if err != nil {
+			t.Errorf("%s: %v", c.method, err)
+			continue
+		}
+
+		values := SampleList(samples).ToSignal().S
+		if !cmp.Equal(values, c.expect, cmp.Comparer(func(a, b float64) bool { return math.Abs(a-b) < 1e-9 })) {
+			t.Errorf("%s: interpolated %v, expected %v", c.method, values, c.expect)
+		}
+	}
+
+	// the spline passes through every sample, and is smooth between them
+	sig = tones(20, 1)
+	samples, err := sig.InterpolateWith("cubic", 0.3, sig.T[7], 0.52)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples[1].S != sig.S[7] || math.Abs(samples[0].S-math.Sin(2*math.Pi*0.3)) > 1e-3 {
+		t.Errorf("cubic interpolation gave %v", samples)
+	}
+
+	_, err = sig.InterpolateWith("sinc", 0.1, 0.2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, method := range []string{"polyphase", "decimate", "quadratic"} {
+		if _, err := sig.InterpolateWith(method, 0.5); err == nil {
+			t.Errorf("%s should have errored", method)
+		}
+	}
+}
+
+func TestResampleAntiAliasing(t *testing.T) {
+	// the 330Hz tone aliases to 30Hz when sampled at 100Hz, unless it is
+	// filtered out first
+	sig := tones(1000, 10, 330)
+
+	for _, method := range []string{"sinc", "polyphase", "decimate"} {
+		res, err := sig.Resample(method, 100)
+		if err != nil {
+			t.Errorf("%s: %v", method, err)
+			continue
+		}
+
+		if res.Size() != 100 || res.SampleRate != 100 || math.Abs(res.T[99]-0.99) > 1e-9 {
+			t.Errorf("%s: resampled to %d samples at %fHz ending at %f", method, res.Size(), res.SampleRate, res.T[res.Size()-1])
+		}
+
+		worst := maxToneError(res, 10, 0.2)
+		if worst > 1e-3 {
+			t.Errorf("%s: resampled signal differs from a 10Hz tone by %f", method, worst)
+		}
+	}
+
+	res, err := sig.Resample("linear", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxToneError(res, 10, 0.2) < 0.5 {
+		t.Errorf("linear resampling should have aliased")
+	}
+}
+
+func TestResampleUpsampling(t *testing.T) {
+	sig := tones(100, 5)
+
+	for _, method := range []string{"sinc", "polyphase", "cubic"} {
+		res, err := sig.Resample(method, 250)
+		if err != nil {
+			t.Errorf("%s: %v", method, err)
+			continue
+		}
+
+		if res.Size() != 248 {
+			t.Errorf("%s: resampled to %d samples", method, res.Size())
+		}
+
+		worst := maxToneError(res, 5, 0.2)
+		if worst > 1e-3 {
+			t.Errorf("%s: resampled signal differs from a 5Hz tone by %f", method, worst)
+		}
+	}
+}
+
+func TestResampleErrors(t *testing.T) {
+	uniform := tones(100, 5)
+	irregular := &Signal{T: []float64{0, 0.1, 0.3, 0.4}, S: []float64{0, 1, 0, 1}}
+
+	cases := []struct {
+		sig    *Signal
+		method string
+		rate   float64
+	}{
+		{uniform, "quadratic", 50},
+		{uniform, "linear", 0},
+		{uniform, "decimate", 30},
+		{uniform, "decimate", 200},
+		{uniform, "polyphase", 100 * math.Pi},
+		{irregular, "sinc", 10},
+		{irregular, "polyphase", 10},
+		{irregular, "decimate", 5},
+		{&Signal{T: []float64{0}, S: []float64{1}}, "nearest", 10},
+	}
+
+	for i, c := range cases {
+		if _, err := c.sig.Resample(c.method, c.rate); err == nil {
+			t.Errorf("Test case %d should have errored", i)
+		}
+	}
+
+	if _, err := irregular.Resample("cubic", 10); err != nil {
+		t.Errorf("cubic resampling of an irregular signal: %v", err)
+	}
+}
+
+func TestMultiSignalResample(t *testing.T) {
+	m := testStereo(t, 1000, 1000)
+
+	res, err := m.Resample("decimate", 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(res.ChannelNames(), []string{"left", "right"}) || res.Size() != 250 || res.SampleRate != 250 {
+		t.Fatalf("resampled to %v with %d samples at %fHz", res.ChannelNames(), res.Size(), res.SampleRate)
+	}
+	if err := res.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	right := m.MustChannel("right")
+	expect, err := right.Resample("decimate", 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(res.MustChannel("right").S, expect.S) {
+		t.Errorf("channels should be resampled independently")
+	}
+
+	wf := &WaveFile{
+		Version:    1,
+		Channels:   res,
+		Resampling: &Resampling{Method: "decimate", SampleRate: 250, SourceSampleRate: 1000},
+	}
+	b, err := wf.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := FromJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(decoded.Resampling, wf.Resampling) {
+		t.Errorf("decoded resampling %v, expected %v", decoded.Resampling, wf.Resampling)
+	}
+
+	if _, err := (&MultiSignal{}).Resample("linear", 250); err == nil {
+		t.Errorf("empty signal should have errored")
+	}
+}
@@ -0,0 +1,401 @@
+package wavegen
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// This file implements spectral analysis of signals, by the fast Fourier
+// transform, Welch's method for estimating power spectral density, and the
+// short-time Fourier transform.
+
+// WindowKinds lists the window functions understood by Window().
+var WindowKinds = []string{"rectangular", "hann", "hamming", "blackman"}
+
+// DefaultSegmentLength is the number of samples in each segment of a
+// spectral estimate, if none is given and the signal is long enough.
+const DefaultSegmentLength = 256
+
+// SpectrumOptions controls how a signal is divided into segments for spectral
+// analysis.
+type SpectrumOptions struct {
+	// Window is the kind of window applied to each segment, one of
+	// WindowKinds. If empty, "hann" is used.
+	Window string
+
+	// SegmentLength is the number of samples in each segment. If 0, the
+	// smaller of DefaultSegmentLength and the size of the signal is used.
+	SegmentLength int
+
+	// Step is the number of samples between the start of each segment. If
+	// 0, half of SegmentLength is used, so that segments overlap by half.
+	Step int
+}
+
+// Spectrum is a one-sided power spectral density estimate.
+type Spectrum struct {
+	// Frequencies is the frequency of each bin in Hz, from 0 up to the
+	// Nyquist frequency.
+	Frequencies []float64
+
+	// Power is the power spectral density of each bin, in squared units
+	// of the signal per Hz.
+	Power []float64
+
+	// Resolution is the spacing of Frequencies in Hz.
+	Resolution float64
+}
+
+// Spectrogram is a one-sided power spectral density estimate of each segment
+// of a signal.
+type Spectrogram struct {
+	// Times is the time in seconds of the middle of each segment.
+	Times []float64
+
+	// Frequencies is the frequency of each bin in Hz, as in Spectrum.
+	Frequencies []float64
+
+	// Power is the power spectral density of each segment, so that
+	// Power[i][j] is the density at Times[i] and Frequencies[j].
+	Power [][]float64
+}
+
+// Peak is a local maximum of a Spectrum.
+type Peak struct {
+	// Frequency is the frequency of the peak in Hz, which is refined
+	// to lie between bins.
+	Frequency float64
+
+	// Power is the power spectral density of the bin at the peak.
+	Power float64
+}
+
+// FFT computes the discrete Fourier transform of x, which may be of any
+// length. Lengths which are powers of 2 use the radix-2 Cooley-Tukey
+// algorithm, and other lengths Bluestein's algorithm, so that either takes
+// O(n log n) time.
+func FFT(x []complex128) []complex128 {
+	return fft(x, false)
+}
+
+// IFFT computes the inverse discrete Fourier transform of x, scaled so that
+// IFFT(FFT(x)) is x.
+func IFFT(x []complex128) []complex128 {
+	res := fft(x, true)
+	for i := range res {
+		res[i] /= complex(float64(len(res)), 0)
+	}
+	return res
+}
+
+// fft computes the unscaled forward or inverse transform of x.
+func fft(x []complex128, inverse bool) []complex128 {
+	res := append([]complex128{}, x...)
+	if len(res) <= 1 {
+		return res
+	}
+
+	if len(res)&(len(res)-1) == 0 {
+		radix2(res, inverse)
+		return res
+	}
+
+	return bluestein(res, inverse)
+}
+
+// radix2 transforms x in place, whose length must be a power of 2.
+func radix2(x []complex128, inverse bool) {
+	n := len(x)
+
+	// bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		half := size / 2
+		for k := 0; k < half; k++ {
+			w := cmplx.Rect(1, sign*2*math.Pi*float64(k)/float64(size))
+			for start := 0; start < n; start += size {
+				a := x[start+k]
+				b := x[start+k+half] * w
+				x[start+k] = a + b
+				x[start+k+half] = a - b
+			}
+		}
+	}
+}
+
+// bluestein transforms x of any length, by expressing the transform as a
+// convolution with a chirp, which is computed by radix-2 transforms of at
+// least twice the length.
+func bluestein(x []complex128, inverse bool) []complex128 {
+	n := len(x)
+	m := 1
+	for m < 2*n-1 {
+		m <<= 1
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+
+	// k² is taken modulo 2n, which leaves the chirp unchanged, but keeps
+	// its angle small enough to be accurate
+	chirp := make([]complex128, n)
+	for k := range chirp {
+		chirp[k] = cmplx.Rect(1, sign*math.Pi*float64((k*k)%(2*n))/float64(n))
+	}
+
+	a := make([]complex128, m)
+	b := make([]complex128, m)
+	for k := 0; k < n; k++ {
+		a[k] = x[k] * chirp[k]
+		b[k] = cmplx.Conj(chirp[k])
+		if k > 0 {
+			b[m-k] = b[k]
+		}
+	}
+
+	radix2(a, false)
+	radix2(b, false)
+	for i := range a {
+		a[i] *= b[i]
+	}
+	radix2(a, true)
+
+	res := make([]complex128, n)
+	for k := range res {
+		res[k] = a[k] * chirp[k] / complex(float64(m), 0)
+	}
+	return res
+}
+
+// Window computes the n coefficients of a window of the given kind, one of
+// WindowKinds. Windows are periodic, rather than symmetric, as is usual for
+// spectral analysis.
+func Window(kind string, n int) ([]float64, error) {
+	return windowCoefficients(kind, n, n)
+}
+
+// windowCoefficients computes n coefficients of a window with the given
+// period, which is n for a periodic window, and n-1 for a symmetric one.
+func windowCoefficients(kind string, n int, period int) ([]float64, error) {
+	if !isOneOf(kind, WindowKinds) {
+		return nil, fmt.Errorf("Unknown window '%s', must be one of %v", kind, WindowKinds)
+	}
+
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = windowAt(kind, float64(i)/float64(period))
+	}
+
+	return w, nil
+}
+
+// windowAt computes a window of the given kind, one of WindowKinds, at x,
+// the fraction of its period from its start.
+func windowAt(kind string, x float64) float64 {
+	x *= 2 * math.Pi
+
+	switch kind {
+	case "hann":
+		return 0.5 - 0.5*math.Cos(x)
+	case "hamming":
+		return 0.54 - 0.46*math.Cos(x)
+	case "blackman":
+		return 0.42 - 0.5*math.Cos(x) + 0.08*math.Cos(2*x)
+	default:
+		return 1
+	}
+}
+
+// STFT computes the spectrogram of the signal by the short-time Fourier
+// transform, dividing it into segments as described by opts, which may be
+// nil to use the defaults. The signal must be uniformly sampled.
+func (s *Signal) STFT(opts *SpectrumOptions) (*Spectrogram, error) {
+	if opts == nil {
+		opts = &SpectrumOptions{}
+	}
+
+	rate, err := s.ToMultiSignal(DefaultChannelName).UniformSampleRate(1e-6)
+	if err != nil {
+		return nil, fmt.Errorf("Spectral analysis requires a uniformly sampled signal, see interpolate: %v", err)
+	}
+
+	n := opts.SegmentLength
+	if n == 0 {
+		n = DefaultSegmentLength
+		if s.Size() < n {
+			n = s.Size()
+		}
+	}
+	if n < 2 || n > s.Size() {
+		return nil, fmt.Errorf("Segment length must be between 2 and the signal's size %d, not %d", s.Size(), n)
+	}
+
+	step := opts.Step
+	if step == 0 {
+		step = n / 2
+	}
+	if step < 1 {
+		return nil, fmt.Errorf("Step must be positive, not %d", step)
+	}
+
+	kind := opts.Window
+	if kind == "" {
+		kind = "hann"
+	}
+	window, err := Window(kind, n)
+	if err != nil {
+		return nil, err
+	}
+
+	// density scaling, so that the power is independent of the window
+	// and segment length
+	scale := 0.0
+	for _, w := range window {
+		scale += w * w
+	}
+	scale = 1 / (scale * rate)
+
+	bins := n/2 + 1
+	sg := &Spectrogram{Frequencies: make([]float64, bins)}
+	for k := range sg.Frequencies {
+		sg.Frequencies[k] = float64(k) * rate / float64(n)
+	}
+
+	segment := make([]complex128, n)
+	for start := 0; start+n <= s.Size(); start += step {
+		for i := range segment {
+			segment[i] = complex(s.S[start+i]*window[i], 0)
+		}
+
+		power := make([]float64, bins)
+		for k, v := range FFT(segment)[:bins] {
+			power[k] = real(v)*real(v) + imag(v)*imag(v)
+			power[k] *= scale
+
+			// the negative frequencies are folded onto the positive
+			// ones, other than 0 and the Nyquist frequency
+			if k != 0 && !(n%2 == 0 && k == n/2) {
+				power[k] *= 2
+			}
+		}
+
+		sg.Times = append(sg.Times, s.T[start]+float64(n-1)/(2*rate))
+		sg.Power = append(sg.Power, power)
+	}
+
+	return sg, nil
+}
+
+// Welch estimates the power spectral density of the signal by Welch's method,
+// averaging the spectrogram computed by STFT() over every segment.
+func (s *Signal) Welch(opts *SpectrumOptions) (*Spectrum, error) {
+	sg, err := s.STFT(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &Spectrum{
+		Frequencies: sg.Frequencies,
+		Power:       make([]float64, len(sg.Frequencies)),
+		Resolution:  sg.Frequencies[1],
+	}
+	for _, power := range sg.Power {
+		for k, p := range power {
+			sp.Power[k] += p / float64(len(sg.Power))
+		}
+	}
+
+	return sp, nil
+}
+
+// Peaks finds up to n local maxima of the spectrum in order of decreasing
+// power, or all of them if n is 0. The frequency of each peak is refined by
+// fitting a parabola to the logarithm of the power of its bin and those
+// either side of it.
+func (sp *Spectrum) Peaks(n int) []Peak {
+	peaks := []Peak{}
+	last := len(sp.Power) - 1
+
+	for k, p := range sp.Power {
+		if p <= 0 || (k > 0 && p <= sp.Power[k-1]) || (k < last && p < sp.Power[k+1]) {
+			continue
+		}
+
+		peak := Peak{Frequency: sp.Frequencies[k], Power: p}
+		if k > 0 && k < last && sp.Power[k-1] > 0 && sp.Power[k+1] > 0 {
+			a := math.Log(sp.Power[k-1])
+			b := math.Log(p)
+			c := math.Log(sp.Power[k+1])
+			if d := a - 2*b + c; d < 0 {
+				peak.Frequency += 0.5 * (a - c) / d * sp.Resolution
+			}
+		}
+
+		peaks = append(peaks, peak)
+	}
+
+	sort.SliceStable(peaks, func(i, j int) bool { return peaks[i].Power > peaks[j].Power })
+	if n > 0 && len(peaks) > n {
+		peaks = peaks[:n]
+	}
+
+	return peaks
+}
+
+// FindPeak returns the most powerful peak within tolerance Hz of freq, and
+// false if there is none.
+func (sp *Spectrum) FindPeak(freq, tolerance float64) (Peak, bool) {
+	for _, peak := range sp.Peaks(0) {
+		if math.Abs(peak.Frequency-freq) <= tolerance {
+			return peak, true
+		}
+	}
+	return Peak{}, false
+}
+
+// Decibels converts a power to decibels, relative to a power of 1.
+func Decibels(power float64) float64 {
+	return 10 * math.Log10(power)
+}
+
+// PeriodicFrequencies lists the fundamental frequency of each periodic
+// component of the parameters, that is each sine, square, sawtooth, triangle,
+// or impulse train of non-zero amplitude, which should appear as peaks in the
+// spectrum of the generated signal.
+func (w *WaveParameters) PeriodicFrequencies() []float64 {
+	freqs := []float64{}
+	for i, f := range w.Frequencies {
+		kind := "sine"
+		if i < len(w.Kinds) && w.Kinds[i] != "" {
+			kind = w.Kinds[i]
+		}
+
+		switch kind {
+		case "sine", "square", "sawtooth", "triangle", "impulse":
+			if f > 0 && (i >= len(w.Amplitudes) || w.Amplitudes[i] != 0) {
+				freqs = append(freqs, f)
+			}
+		}
+	}
+	return freqs
+}
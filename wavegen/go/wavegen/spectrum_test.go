@@ -0,0 +1,205 @@
+package wavegen
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// dft computes the discrete Fourier transform of x directly, and is used to
+// check FFT().
+func dft(x []complex128) []complex128 {
+	res := make([]complex128, len(x))
+	for k := range res {
+		for j, v := range x {
+			res[k] += v * cmplx.Rect(1, -2*math.Pi*float64(j*k)/float64(len(x)))
+		}
+	}
+	return res
+}
+
+func TestFFT(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for _, n := range []int{0, 1, 2, 8, 12, 17, 100, 256} {
+		x := make([]complex128, n)
+		for i := range x {
+			x[i] = complex(r.NormFloat64(), r.NormFloat64())
+		}
+
+		res := FFT(x)
+		expect := dft(x)
+		for k := range expect {
+			if cmplx.Abs(res[k]-expect[k]) > 1e-9 {
+				t.Errorf("FFT of length %d differs at %d: %v, expected %v", n, k, res[k], expect[k])
+				break
+			}
+		}
+
+		inverse := IFFT(res)
+		for k := range x {
+			if cmplx.Abs(inverse[k]-x[k]) > 1e-9 {
+				t.Errorf("IFFT of length %d differs at %d: %v, expected %v", n, k, inverse[k], x[k])
+				break
+			}
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	approx := cmp.Comparer(func(a, b float64) bool { return math.Abs(a-b) < 1e-12 })
+
+	cases := []struct {
+		kind   string
+		expect []float64
+	}{
+		{"rectangular", []float64{1, 1, 1, 1}},
+		{"hann", []float64{0, 0.5, 1, 0.5}},
+		{"hamming", []float64{0.08, 0.54, 1, 0.54}},
+		{"blackman", []float64{0, 0.34, 1, 0.34}},
+	}
+
+	for _, c := range cases {
+		w, err := Window(c.kind, 4)
+		if err != nil {
+			t.Errorf("%s: %v", c.kind, err)
+			continue
+		}
+		if !cmp.Equal(w, c.expect, approx) {
+			t.Errorf("%s window is %v, expected %v", c.kind, w, c.expect)
+		}
+	}
+
+	if _, err := Window("kaiser", 4); err == nil {
+		t.Errorf("unknown window should have errored")
+	}
+}
+
+func TestWelch(t *testing.T) {
+	sig := &Signal{SampleRate: 1000}
+	for i := 0; i < 4000; i++ {
+		ts := float64(i) / 1000
+		sig.T = append(sig.T, ts)
+		sig.S = append(sig.S, math.Sin(2*math.Pi*50*ts)+0.5*math.Sin(2*math.Pi*123*ts))
+	}
+
+	for _, window := range WindowKinds {
+		sp, err := sig.Welch(&SpectrumOptions{Window: window, SegmentLength: 500})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(sp.Frequencies) != 251 || sp.Resolution != 2 || sp.Frequencies[250] != 500 {
+			t.Errorf("%s: spectrum has %d bins at %fHz", window, len(sp.Frequencies), sp.Resolution)
+		}
+
+		// the total power is the mean square of the signal
+		total := 0.0
+		for _, p := range sp.Power {
+			total += p * sp.Resolution
+		}
+		if math.Abs(total-0.625) > 0.01 {
+			t.Errorf("%s: total power is %f, expected 0.625", window, total)
+		}
+
+		peaks := sp.Peaks(2)
+		if len(peaks) != 2 || math.Abs(peaks[0].Frequency-50) > 0.1 || math.Abs(peaks[1].Frequency-123) > 0.5 {
+			t.Errorf("%s: peaks are %v", window, peaks)
+		}
+	}
+
+	sp, err := sig.Welch(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sp.FindPeak(123, sp.Resolution); !ok {
+		t.Errorf("no peak found at 123Hz")
+	}
+	if _, ok := sp.FindPeak(300, sp.Resolution); ok {
+		t.Errorf("peak found at 300Hz")
+	}
+}
+
+func TestSTFT(t *testing.T) {
+	sig := &Signal{}
+	for i := 0; i < 1000; i++ {
+		ts := float64(i) / 1000
+		f := 50.0
+		if ts >= 0.5 {
+			f = 200
+		}
+		sig.T = append(sig.T, ts)
+		sig.S = append(sig.S, math.Sin(2*math.Pi*f*ts))
+	}
+
+	sg, err := sig.STFT(&SpectrumOptions{SegmentLength: 100, Step: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sg.Times) != 10 || len(sg.Power) != 10 || math.Abs(sg.Times[0]-0.0495) > 1e-9 {
+		t.Fatalf("spectrogram has %d segments at %v", len(sg.Times), sg.Times)
+	}
+
+	for i, power := range sg.Power {
+		sp := &Spectrum{Frequencies: sg.Frequencies, Power: power, Resolution: 10}
+		expect := 50.0
+		if sg.Times[i] > 0.5 {
+			expect = 200
+		}
+		if peak := sp.Peaks(1)[0]; math.Abs(peak.Frequency-expect) > 1 {
+			t.Errorf("segment at %fs peaks at %fHz, expected %fHz", sg.Times[i], peak.Frequency, expect)
+		}
+	}
+
+	cases := []struct {
+		sig  *Signal
+		opts SpectrumOptions
+	}{
+		{&Signal{T: []float64{0, 1, 3}, S: []float64{0, 1, 0}}, SpectrumOptions{}},
+		{sig, SpectrumOptions{SegmentLength: 1001}},
+		{sig, SpectrumOptions{SegmentLength: 1}},
+		{sig, SpectrumOptions{Step: -1}},
+		{sig, SpectrumOptions{Window: "kaiser"}},
+	}
+
+	for i, c := range cases {
+		if _, err := c.sig.STFT(&c.opts); err == nil {
+			t.Errorf("Test case %d should have errored", i)
+		}
+	}
+}
+
+func TestPeriodicFrequencies(t *testing.T) {
+	w := &WaveParameters{
+		SampleRate:  1000,
+		Duration:    2,
+		Frequencies: []float64{40, 110, 5, 300},
+		Phases:      []float64{0, 0, 0, 0},
+		Amplitudes:  []float64{1, 0.5, 1, 0},
+		Kinds:       []string{"sine", "square", "chirp", "sine"},
+	}
+
+	freqs := w.PeriodicFrequencies()
+	if !cmp.Equal(freqs, []float64{40, 110}) {
+		t.Fatalf("periodic frequencies are %v", freqs)
+	}
+
+	sig, err := w.GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp, err := sig.Welch(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range freqs {
+		if _, ok := sp.FindPeak(f, sp.Resolution); !ok {
+			t.Errorf("no peak found at %fHz", f)
+		}
+	}
+}
@@ -0,0 +1,551 @@
+package wavegen
+
+import (
+	"bufio"
+	bin "encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// This file implements generating and writing signals a chunk at a time, so
+// that signals too long to hold in memory, such as hours of data at a high
+// sample rate, can be produced in constant memory.
+
+// DefaultChunkSize is the number of samples which are generated and written
+// at once when streaming a signal.
+const DefaultChunkSize = 4096
+
+// StreamFormats lists the formats written by StreamEncoder. "json" is the
+// usual wavegen file, and "binary" is described by NewStreamDecoder().
+var StreamFormats = []string{"json", "binary"}
+
+// Generator generates the signal described by wave parameters a chunk at a
+// time. The chunks are exactly the samples which GenerateSyntheticData()
+// would generate, in order.
+type Generator struct {
+	params *WaveParameters
+
+	// size is the total number of samples, and next the index of the
+	// next one to generate
+	size int
+	next int
+
+	period float64
+
+	// one noise generator for each component, followed by the global
+	// noise, so that noise which depends on previous values is
+	// continuous for each
+	noises []*NoiseGenerator
+
+	expr *Expression
+}
+
+// NewGenerator creates a generator for the signal described by the
+// parameters, which must not be modified until it is done.
+func (w *WaveParameters) NewGenerator() (*Generator, error) {
+	err := w.ValidateParameters()
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Generator{
+		params: w,
+		size:   int(math.Ceil(w.SampleRate * w.Duration)),
+		period: 1.0 / w.SampleRate,
+		noises: make([]*NoiseGenerator, len(w.Frequencies)+1),
+	}
+
+	for j := range g.noises {
+		index := j
+		if j == len(w.Frequencies) {
+			index = -1
+		}
+
+		g.noises[j], err = w.NoiseGenerator(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the noise of the expression follows that of the components
+	if w.Expression != "" {
+		g.expr, err = ParseExpression(w.Expression, w.Constants)
+		if err != nil {
+			return nil, err
+		}
+
+		err = g.expr.Seed(w.RandomVersion, w.Seed, len(w.Frequencies)+1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// Size returns the total number of samples the generator generates.
+func (g *Generator) Size() int {
+	return g.size
+}
+
+// Remaining returns the number of samples which are yet to be generated.
+func (g *Generator) Remaining() int {
+	return g.size - g.next
+}
+
+// Next generates the next chunk of the signal, of n samples, or fewer if
+// there are not that many remaining. It returns io.EOF once every sample has
+// been generated.
+func (g *Generator) Next(n int) (*Signal, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("Chunk size must be positive, not %d", n)
+	}
+
+	if g.Remaining() == 0 {
+		return nil, io.EOF
+	}
+
+	return g.generate(n)
+}
+
+// generate generates up to n samples, returning an empty signal if there are
+// none remaining.
+func (g *Generator) generate(n int) (*Signal, error) {
+	if n > g.Remaining() {
+		n = g.Remaining()
+	}
+
+	w := g.params
+	sig := &Signal{
+		T:          make([]float64, n),
+		S:          make([]float64, n),
+		SampleRate: w.SampleRate,
+	}
+
+	for i := range sig.S {
+		sig.T[i] = g.period * float64(g.next+i)
+		for j := range w.Frequencies {
+			v, err := w.Waveform(j, sig.T[i], g.period)
+			if err != nil {
+				return nil, err
+			}
+
+			// component noise
+			sig.S[i] += v + g.noises[j].Next()
+		}
+
+		if g.expr != nil {
+			sig.S[i] += g.expr.Evaluate(sig.T[i])
+		}
+
+		// global noise
+		sig.S[i] = sig.S[i] + g.noises[len(w.Frequencies)].Next()
+	}
+
+	g.next += n
+	return sig, nil
+}
+
+// StreamEncoder writes a wave file incrementally, a chunk of its signal at a
+// time, so that only one chunk need be held in memory.
+//
+// In the "json" format, the output is exactly that of WaveFile.ToJSON().
+// Since each array of the signal is written in full before the next, every
+// array but the first is held in a temporary file until Close().
+type StreamEncoder struct {
+	w      *bufio.Writer
+	format string
+	header *WaveFile
+	names  []string
+
+	sampleRate float64
+	started    bool
+	closed     bool
+
+	// the arrays of a JSON signal in the order they are written, the
+	// first to w, and the others to temporary files
+	arrays []*jsonArray
+}
+
+// jsonArray is an array of numbers being written to a JSON document.
+type jsonArray struct {
+	w      *bufio.Writer
+	file   *os.File
+	indent string
+	count  int
+	buf    []byte
+}
+
+// NewStreamEncoder creates an encoder which writes a wave file to w in the
+// given format, one of StreamFormats. The header holds the version,
+// parameters, resampling, and filters of the file, and must not have a
+// signal. The signal has a channel of each of the given names, of which a
+// version 0 file must have exactly one.
+func NewStreamEncoder(w io.Writer, format string, header *WaveFile, channels ...string) (*StreamEncoder, error) {
+	if !isOneOf(format, StreamFormats) {
+		return nil, fmt.Errorf("Unknown stream format '%s', must be one of %v", format, StreamFormats)
+	}
+
+	if header.Signal != nil || header.Channels != nil {
+		return nil, fmt.Errorf("Header of a streamed wave file must not have a signal")
+	}
+
+	switch header.Version {
+	case 0:
+		if len(channels) != 1 {
+			return nil, fmt.Errorf("Version 0 wave files must have exactly one channel, not %d", len(channels))
+		}
+	case 1:
+		if len(channels) == 0 {
+			return nil, fmt.Errorf("Version 1 wave files must have at least one channel")
+		}
+	default:
+		return nil, fmt.Errorf("Don't know how to write a wave file with version %d", header.Version)
+	}
+
+	// an empty signal with the channels validates their names
+	empty := &MultiSignal{}
+	for _, name := range channels {
+		err := empty.AddChannel(name, []float64{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e := &StreamEncoder{
+		w:      bufio.NewWriter(w),
+		format: format,
+		header: header,
+		names:  append([]string{}, channels...),
+	}
+
+	if header.Parameters != nil {
+		e.sampleRate = header.Parameters.SampleRate
+	}
+
+	return e, nil
+}
+
+// Write writes the next chunk of the signal, which must have the encoder's
+// channels in the same order. The sample rate of the file is that of the
+// first chunk.
+func (e *StreamEncoder) Write(chunk *MultiSignal) error {
+	if e.closed {
+		return fmt.Errorf("Cannot write to a closed stream encoder")
+	}
+
+	err := chunk.Validate()
+	if err != nil {
+		return err
+	}
+
+	if len(chunk.Channels) != len(e.names) {
+		return fmt.Errorf("Chunk has %d channels, but the stream has %d", len(chunk.Channels), len(e.names))
+	}
+	for i, c := range chunk.Channels {
+		if c.Name != e.names[i] {
+			return fmt.Errorf("Channel %d of the chunk is '%s', but the stream's is '%s'", i, c.Name, e.names[i])
+		}
+	}
+
+	if !e.started {
+		e.sampleRate = chunk.SampleRate
+		err = e.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	if e.format == "binary" {
+		record := make([]byte, 8*(len(e.names)+1))
+		for i, t := range chunk.T {
+			bin.LittleEndian.PutUint64(record, math.Float64bits(t))
+			for j, c := range chunk.Channels {
+				bin.LittleEndian.PutUint64(record[8*(j+1):], math.Float64bits(c.S[i]))
+			}
+
+			_, err = e.w.Write(record)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, a := range e.arrays {
+		values := chunk.T
+		if a != e.timesArray() {
+			values = chunk.Channels[e.channelIndex(a)].S
+		}
+
+		for _, v := range values {
+			err = a.append(v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteSignal writes the next chunk of a signal with a single channel, as
+// Write() does.
+func (e *StreamEncoder) WriteSignal(chunk *Signal) error {
+	return e.Write(chunk.ToMultiSignal(e.names[0]))
+}
+
+// Close writes the end of the file, and removes any temporary files. It does
+// not close the underlying writer.
+func (e *StreamEncoder) Close() error {
+	if e.closed {
+		return nil
+	}
+
+	defer e.removeTemporaryFiles()
+
+	var err error
+	if !e.started {
+		err = e.start()
+		if err != nil {
+			return err
+		}
+	}
+	e.closed = true
+
+	if e.format == "binary" {
+		return e.w.Flush()
+	}
+
+	err = e.finishJSON()
+	if err != nil {
+		return err
+	}
+
+	return e.w.Flush()
+}
+
+// removeTemporaryFiles removes the temporary files of the arrays, if any.
+func (e *StreamEncoder) removeTemporaryFiles() {
+	for _, a := range e.arrays {
+		if a.file != nil {
+			a.file.Close()
+			os.Remove(a.file.Name())
+		}
+	}
+}
+
+// timesArray returns the array of the times of a JSON signal, which is
+// written first in a version 1 file, and last in a version 0 file.
+func (e *StreamEncoder) timesArray() *jsonArray {
+	if e.header.Version == 0 {
+		return e.arrays[1]
+	}
+	return e.arrays[0]
+}
+
+// channelIndex returns the index of the channel whose samples are held in
+// the array.
+func (e *StreamEncoder) channelIndex(a *jsonArray) int {
+	if e.header.Version == 0 {
+		return 0
+	}
+
+	for i, b := range e.arrays {
+		if a == b {
+			return i - 1
+		}
+	}
+	return -1
+}
+
+// start writes everything which comes before the first sample.
+func (e *StreamEncoder) start() error {
+	e.started = true
+
+	if e.format == "binary" {
+		return writeBinaryHeader(e.w, e.header, e.names, e.sampleRate)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "{\n\t\"Version\": %d,\n", e.header.Version)
+
+	if e.header.Parameters != nil {
+		params, err := json.MarshalIndent(e.header.Parameters, "\t", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "\t\"Parameters\": %s,\n", params)
+	}
+
+	b.WriteString("\t\"Signal\": {\n")
+	if e.header.Version == 0 {
+		b.WriteString("\t\t\"samples\": [")
+	} else {
+		b.WriteString("\t\t\"times\": [")
+	}
+
+	_, err := e.w.WriteString(b.String())
+	if err != nil {
+		return err
+	}
+
+	// the samples of each channel of a version 1 file, and the times of a
+	// version 0 file, follow the first array
+	indent := "\t\t\t"
+	e.arrays = []*jsonArray{{w: e.w, indent: indent}}
+
+	others := 1
+	if e.header.Version == 1 {
+		others = len(e.names)
+		indent = "\t\t\t\t\t"
+	}
+
+	for i := 0; i < others; i++ {
+		f, err := ioutil.TempFile("", "wavegen-stream-")
+		if err != nil {
+			return err
+		}
+
+		e.arrays = append(e.arrays, &jsonArray{w: bufio.NewWriter(f), file: f, indent: indent})
+	}
+
+	return nil
+}
+
+// finishJSON writes the arrays held in temporary files, and everything which
+// comes after them.
+func (e *StreamEncoder) finishJSON() error {
+	var err error
+	write := func(s string) {
+		if err == nil {
+			_, err = e.w.WriteString(s)
+		}
+	}
+
+	write(e.arrays[0].end())
+
+	if e.header.Version == 0 {
+		write(",\n\t\t\"times\": [")
+		if err == nil {
+			err = e.arrays[1].copyTo(e.w)
+		}
+		write(e.arrays[1].end())
+	} else {
+		write(",\n\t\t\"channels\": [")
+		for i, a := range e.arrays[1:] {
+			if i > 0 {
+				write(",")
+			}
+
+			name, _ := json.Marshal(e.names[i])
+			write(fmt.Sprintf("\n\t\t\t{\n\t\t\t\t\"name\": %s,\n\t\t\t\t\"samples\": [", name))
+			if err == nil {
+				err = a.copyTo(e.w)
+			}
+			write(a.end())
+			write("\n\t\t\t}")
+		}
+		write("\n\t\t]")
+	}
+
+	rate, rateErr := appendJSONFloat(nil, e.sampleRate)
+	if rateErr != nil {
+		return rateErr
+	}
+	write(fmt.Sprintf(",\n\t\t\"SampleRate\": %s\n\t}", rate))
+
+	if e.header.Resampling != nil {
+		resampling, err := json.MarshalIndent(e.header.Resampling, "\t", "\t")
+		if err != nil {
+			return err
+		}
+		write(fmt.Sprintf(",\n\t\"Resampling\": %s", resampling))
+	}
+
+	if len(e.header.Filters) > 0 {
+		filters, err := json.MarshalIndent(e.header.Filters, "\t", "\t")
+		if err != nil {
+			return err
+		}
+		write(fmt.Sprintf(",\n\t\"Filters\": %s", filters))
+	}
+
+	write("\n}")
+	return err
+}
+
+// append writes the next element of the array.
+func (a *jsonArray) append(v float64) error {
+	a.buf = a.buf[:0]
+	if a.count > 0 {
+		a.buf = append(a.buf, ',')
+	}
+	a.buf = append(a.buf, '\n')
+	a.buf = append(a.buf, a.indent...)
+
+	var err error
+	a.buf, err = appendJSONFloat(a.buf, v)
+	if err != nil {
+		return err
+	}
+
+	a.count++
+	_, err = a.w.Write(a.buf)
+	return err
+}
+
+// end returns the text which closes the array.
+func (a *jsonArray) end() string {
+	if a.count == 0 {
+		return "]"
+	}
+	return "\n" + a.indent[1:] + "]"
+}
+
+// copyTo copies the elements of an array held in a temporary file to w.
+func (a *jsonArray) copyTo(w io.Writer) error {
+	err := a.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = a.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, a.file)
+	return err
+}
+
+// appendJSONFloat appends v to b formatted as encoding/json formats it.
+func appendJSONFloat(b []byte, v float64) ([]byte, error) {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return nil, fmt.Errorf("Cannot represent %v in JSON", v)
+	}
+
+	// exponents are used for very large and small values, without
+	// leading zeros
+	format := byte('f')
+	if abs := math.Abs(v); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+
+	b = strconv.AppendFloat(b, v, format, -1, 64)
+	if format == 'e' {
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+
+	return b, nil
+}
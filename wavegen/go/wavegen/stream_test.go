@@ -0,0 +1,214 @@
+package wavegen
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testStreamParameters() *WaveParameters {
+	return &WaveParameters{
+		SampleRate:      1000,
+		Duration:        1.2345,
+		Frequencies:     []float64{5, 40},
+		Phases:          []float64{0, 1},
+		Amplitudes:      []float64{1, 0.5},
+		Noises:          []string{"pink", "none"},
+		NoiseMagnitudes: []float64{0.1, 1},
+		GlobalNoise:     "gaussian",
+		Expression:      "1e-9*t + 0.1*gauss()",
+		Seed:            42,
+	}
+}
+
+func TestGeneratorChunks(t *testing.T) {
+	expect, err := testStreamParameters().GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{1, 7, 1000, 5000} {
+		g, err := testStreamParameters().NewGenerator()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if g.Size() != expect.Size() {
+			t.Errorf("generator has %d samples, expected %d", g.Size(), expect.Size())
+		}
+
+		got := &Signal{SampleRate: 1000}
+		for {
+			chunk, err := g.Next(size)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chunk.Size() > size {
+				t.Errorf("chunk of %d samples is larger than %d", chunk.Size(), size)
+			}
+
+			got.T = append(got.T, chunk.T...)
+			got.S = append(got.S, chunk.S...)
+		}
+
+		if !cmp.Equal(got, expect) {
+			t.Errorf("chunks of %d samples differ from the whole signal", size)
+		}
+		if g.Remaining() != 0 {
+			t.Errorf("%d samples remain", g.Remaining())
+		}
+	}
+
+	g, _ := testStreamParameters().NewGenerator()
+	if _, err := g.Next(0); err == nil {
+		t.Errorf("empty chunk should have errored")
+	}
+}
+
+// encodeStream writes wf with a StreamEncoder in chunks of the given size.
+func encodeStream(t *testing.T, wf *WaveFile, format string, size int) []byte {
+	channels := wf.AllChannels()
+	header := &WaveFile{Version: wf.Version, Parameters: wf.Parameters, Resampling: wf.Resampling, Filters: wf.Filters}
+
+	buf := &bytes.Buffer{}
+	e, err := NewStreamEncoder(buf, format, header, channels.ChannelNames()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty signal is written as an empty chunk, for its sample rate
+	for start := 0; start == 0 || start < channels.Size(); start += size {
+		end := start + size
+		if end > channels.Size() {
+			end = channels.Size()
+		}
+
+		chunk := &MultiSignal{T: channels.T[start:end], SampleRate: channels.SampleRate}
+		for _, c := range channels.Channels {
+			chunk.AddChannel(c.Name, c.S[start:end])
+		}
+
+		err = e.Write(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = e.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func testStreamFiles(t *testing.T) []*WaveFile {
+	params := testStreamParameters()
+	sig, err := params.GenerateSyntheticData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// values which encoding/json formats with exponents
+	sig.S[0] = 1.5e-7
+	sig.S[1] = -2e21
+	sig.S[2] = 0
+
+	stereo := testStereo(t, 100, 50)
+
+	return []*WaveFile{
+		{Version: 0, Parameters: params, Signal: sig},
+		{Version: 0, Signal: &Signal{T: []float64{}, S: []float64{}, SampleRate: 10}},
+		{Version: 1, Channels: stereo, Resampling: &Resampling{Method: "sinc", SampleRate: 50, SourceSampleRate: 100}},
+		{Version: 1, Channels: stereo, Filters: []FilterSpec{{Kind: "median", Width: 3}}},
+	}
+}
+
+func TestStreamEncoderJSON(t *testing.T) {
+	for i, wf := range testStreamFiles(t) {
+		expect, err := wf.ToJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, size := range []int{1, 33, DefaultChunkSize} {
+			got := encodeStream(t, wf, "json", size)
+			if !bytes.Equal(got, expect) {
+				t.Errorf("file %d in chunks of %d: streamed JSON differs from ToJSON():\n%s", i, size, cmp.Diff(string(expect), string(got)))
+			}
+		}
+	}
+}
+
+func TestStreamEncoderBinary(t *testing.T) {
+	for i, wf := range testStreamFiles(t) {
+		for _, size := range []int{1, 33, DefaultChunkSize} {
+			data := encodeStream(t, wf, "binary", size)
+
+			got, err := Decode(data)
+			if err != nil {
+				t.Fatalf("file %d: %v", i, err)
+			}
+
+			if !cmp.Equal(got.AllChannels(), wf.AllChannels()) {
+				t.Errorf("file %d in chunks of %d: decoded signal differs", i, size)
+			}
+			if (got.Signal == nil) != (wf.Signal == nil) || got.Version != wf.Version {
+				t.Errorf("file %d: decoded version %d file differs in layout", i, got.Version)
+			}
+			if !cmp.Equal(got.Parameters, wf.Parameters) || !cmp.Equal(got.Resampling, wf.Resampling) || !cmp.Equal(got.Filters, wf.Filters) {
+				t.Errorf("file %d: decoded header differs", i)
+			}
+		}
+	}
+
+	data := encodeStream(t, testStreamFiles(t)[2], "binary", 10)
+	if _, err := Decode(data[:len(data)-3]); err == nil {
+		t.Errorf("truncated file should have errored")
+	}
+	if _, err := FromBinary(data[:10]); err == nil {
+		t.Errorf("truncated header should have errored")
+	}
+}
+
+func TestStreamEncoderErrors(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	if _, err := NewStreamEncoder(buf, "xml", &WaveFile{}, "signal"); err == nil {
+		t.Errorf("unknown format should have errored")
+	}
+	if _, err := NewStreamEncoder(buf, "json", &WaveFile{}, "left", "right"); err == nil {
+		t.Errorf("version 0 with two channels should have errored")
+	}
+	if _, err := NewStreamEncoder(buf, "json", &WaveFile{Version: 1}, "left", "left"); err == nil {
+		t.Errorf("duplicate channels should have errored")
+	}
+	if _, err := NewStreamEncoder(buf, "json", &WaveFile{Signal: &Signal{}}, "signal"); err == nil {
+		t.Errorf("header with a signal should have errored")
+	}
+
+	e, err := NewStreamEncoder(buf, "json", &WaveFile{Version: 1}, "left", "right")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stereo := testStereo(t, 10, 10)
+	stereo.Channels[0], stereo.Channels[1] = stereo.Channels[1], stereo.Channels[0]
+	if err := e.Write(stereo); err == nil {
+		t.Errorf("channels out of order should have errored")
+	}
+
+	e, err = NewStreamEncoder(buf, "json", &WaveFile{}, "signal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteSignal(&Signal{T: []float64{0}, S: []float64{math.NaN()}}); err == nil {
+		t.Errorf("NaN should have errored")
+	}
+	e.Close()
+}
@@ -0,0 +1,366 @@
+package wavegen
+
+import (
+	"bufio"
+	"bytes"
+	bin "encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// This file implements reading and writing signals as RIFF/WAVE audio files,
+// with PCM samples of 8, 16, 24, or 32 bits, or IEEE floating point samples of
+// 32 or 64 bits, and any number of channels.
+//
+// PCM samples are mapped to and from floating point values such that the
+// largest positive PCM value is 1.0.
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// WAVOptions controls how a signal is written as a WAV file.
+type WAVOptions struct {
+	// BitsPerSample is the size of each sample, one of 8, 16, 24 or 32
+	// for PCM, or 32 or 64 for floating point. If 0, 16 is used for PCM
+	// and 32 for floating point.
+	BitsPerSample int
+
+	// Float selects IEEE floating point rather than PCM samples.
+	Float bool
+
+	// Normalize scales the signal so that its largest absolute value
+	// across all channels is 1.0, before Gain is applied.
+	Normalize bool
+
+	// Gain multiplies every sample. If 0, 1 is used.
+	Gain float64
+}
+
+// wavChannelName returns the name of the index-th of n channels read from a
+// WAV file.
+func wavChannelName(index, n int) string {
+	if n == 1 {
+		return DefaultChannelName
+	}
+	return fmt.Sprintf("channel%d", index)
+}
+
+// UniformSampleRate returns the sample rate of the signal, if its samples are
+// uniformly spaced in time, and an error otherwise. The spacing may vary by up
+// to tolerance times the average sample period.
+func (m *MultiSignal) UniformSampleRate(tolerance float64) (float64, error) {
+	if m.Size() < 2 {
+		return 0, fmt.Errorf("Signal must have at least 2 samples to have a sample rate")
+	}
+
+	period := m.Duration() / float64(m.Size()-1)
+	for i := 1; i < m.Size(); i++ {
+		if math.Abs((m.T[i]-m.T[i-1])-period) > tolerance*period {
+			return 0, fmt.Errorf("Signal is not uniformly sampled, samples %d and %d are %fs apart, but the average is %fs",
+				i-1, i, m.T[i]-m.T[i-1], period)
+		}
+	}
+
+	return 1 / period, nil
+}
+
+// EncodeWAV writes the signal as a WAV file. The signal must be uniformly
+// sampled at a whole number of Hz, see MultiSignal.Interpolate() to resample
+// it if not. PCM samples outside of [-1, 1] are clipped, and the number of
+// clipped samples is returned.
+func EncodeWAV(w io.Writer, m *MultiSignal, opts *WAVOptions) (int, error) {
+	if opts == nil {
+		opts = &WAVOptions{}
+	}
+
+	err := m.Validate()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(m.Channels) == 0 {
+		return 0, fmt.Errorf("Signal has no channels")
+	}
+
+	rate, err := m.UniformSampleRate(1e-6)
+	if err != nil {
+		return 0, err
+	}
+	if math.Abs(rate-math.Round(rate)) > 1e-6*rate || math.Round(rate) < 1 {
+		return 0, fmt.Errorf("WAV files require a whole number sample rate, but the signal is sampled at %fHz", rate)
+	}
+
+	bits := opts.BitsPerSample
+	format := uint16(wavFormatPCM)
+	if opts.Float {
+		format = wavFormatFloat
+		if bits == 0 {
+			bits = 32
+		}
+		if bits != 32 && bits != 64 {
+			return 0, fmt.Errorf("Floating point WAV samples must be 32 or 64 bits, not %d", bits)
+		}
+	} else {
+		if bits == 0 {
+			bits = 16
+		}
+		if bits != 8 && bits != 16 && bits != 24 && bits != 32 {
+			return 0, fmt.Errorf("PCM WAV samples must be 8, 16, 24 or 32 bits, not %d", bits)
+		}
+	}
+
+	gain := opts.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	if opts.Normalize {
+		peak := 0.0
+		for _, c := range m.Channels {
+			for _, v := range c.S {
+				peak = math.Max(peak, math.Abs(v))
+			}
+		}
+		if peak > 0 {
+			gain /= peak
+		}
+	}
+
+	channels := len(m.Channels)
+	blockAlign := channels * bits / 8
+	dataSize := m.Size() * blockAlign
+
+	// the fmt chunk of a non-PCM file has a (zero) extension size, and is
+	// followed by a fact chunk giving the number of samples per channel
+	fmtSize := 16
+	factSize := 0
+	if format != wavFormatPCM {
+		fmtSize = 18
+		factSize = 12
+	}
+
+	buf := bufio.NewWriter(w)
+	le := bin.LittleEndian
+	write := func(v interface{}) {
+		if err == nil {
+			err = bin.Write(buf, le, v)
+		}
+	}
+
+	buf.WriteString("RIFF")
+	write(uint32(4 + 8 + fmtSize + factSize + 8 + dataSize + dataSize%2))
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	write(uint32(fmtSize))
+	write(format)
+	write(uint16(channels))
+	write(uint32(math.Round(rate)))
+	write(uint32(int(math.Round(rate)) * blockAlign))
+	write(uint16(blockAlign))
+	write(uint16(bits))
+	if format != wavFormatPCM {
+		write(uint16(0))
+		buf.WriteString("fact")
+		write(uint32(4))
+		write(uint32(m.Size()))
+	}
+
+	buf.WriteString("data")
+	write(uint32(dataSize))
+
+	clipped := 0
+	full := math.Pow(2, float64(bits-1)) - 1
+	sample := make([]byte, 8)
+	for i := 0; i < m.Size() && err == nil; i++ {
+		for _, c := range m.Channels {
+			v := c.S[i] * gain
+
+			if format == wavFormatFloat {
+				if bits == 32 {
+					le.PutUint32(sample, math.Float32bits(float32(v)))
+				} else {
+					le.PutUint64(sample, math.Float64bits(v))
+				}
+			} else {
+				if v > 1 || v < -1 {
+					clipped++
+					v = math.Max(-1, math.Min(1, v))
+				}
+				q := int64(math.Round(v * full))
+				if bits == 8 {
+					// 8 bit samples are unsigned
+					q += 128
+				}
+				le.PutUint64(sample, uint64(q))
+			}
+
+			_, err = buf.Write(sample[:bits/8])
+		}
+	}
+
+	if dataSize%2 == 1 && err == nil {
+		err = buf.WriteByte(0)
+	}
+
+	if err == nil {
+		err = buf.Flush()
+	}
+
+	return clipped, err
+}
+
+// DecodeWAV reads a WAV file as a multi-channel signal, whose times are
+// computed from the sample rate, starting at 0. A mono file has a single
+// channel named DefaultChannelName, otherwise the channels are named channel0,
+// channel1, and so on.
+func DecodeWAV(r io.Reader) (*MultiSignal, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("Not a RIFF/WAVE file")
+	}
+
+	le := bin.LittleEndian
+	var format, channels, bits uint16
+	var rate uint32
+	var samples []byte
+	haveFormat := false
+	haveData := false
+
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(le.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		if size > len(body) {
+			// tolerate a truncated final data chunk
+			if id != "data" {
+				return nil, fmt.Errorf("WAV chunk '%s' is truncated", id)
+			}
+			size = len(body)
+		}
+		body = body[:size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("WAV format chunk is too short")
+			}
+			format = le.Uint16(body[0:2])
+			channels = le.Uint16(body[2:4])
+			rate = le.Uint32(body[4:8])
+			bits = le.Uint16(body[14:16])
+			if format == wavFormatExtensible {
+				if size < 26 {
+					return nil, fmt.Errorf("WAV extensible format chunk is too short")
+				}
+				// the sub-format GUID begins with the format code
+				format = le.Uint16(body[24:26])
+			}
+			haveFormat = true
+
+		case "data":
+			samples = body
+			haveData = true
+		}
+
+		// chunks are padded to an even size
+		pos += 8 + size + size%2
+	}
+
+	if !haveFormat {
+		return nil, fmt.Errorf("WAV file has no format chunk")
+	}
+	if !haveData {
+		return nil, fmt.Errorf("WAV file has no data chunk")
+	}
+	if channels == 0 || rate == 0 {
+		return nil, fmt.Errorf("WAV file has %d channels at %dHz", channels, rate)
+	}
+
+	switch {
+	case format == wavFormatPCM && (bits == 8 || bits == 16 || bits == 24 || bits == 32):
+	case format == wavFormatFloat && (bits == 32 || bits == 64):
+	default:
+		return nil, fmt.Errorf("Unsupported WAV format %d with %d bits per sample", format, bits)
+	}
+
+	width := int(bits) / 8
+	n := len(samples) / (width * int(channels))
+
+	m := &MultiSignal{
+		T:          make([]float64, n),
+		Channels:   make([]Channel, channels),
+		SampleRate: float64(rate),
+	}
+	for i := range m.T {
+		m.T[i] = float64(i) / float64(rate)
+	}
+	for c := range m.Channels {
+		m.Channels[c] = Channel{Name: wavChannelName(c, int(channels)), S: make([]float64, n)}
+	}
+
+	full := math.Pow(2, float64(bits-1)) - 1
+	padded := make([]byte, 8)
+	for i := 0; i < n; i++ {
+		for c := range m.Channels {
+			offset := (i*int(channels) + c) * width
+			b := samples[offset : offset+width]
+
+			var v float64
+			switch {
+			case format == wavFormatFloat && bits == 32:
+				v = float64(math.Float32frombits(le.Uint32(b)))
+			case format == wavFormatFloat:
+				v = math.Float64frombits(le.Uint64(b))
+			case bits == 8:
+				v = float64(int(b[0])-128) / full
+			default:
+				// sign extend the little endian value to 64 bits
+				fill := byte(0)
+				if b[width-1]&0x80 != 0 {
+					fill = 0xFF
+				}
+				copy(padded, b)
+				for j := width; j < 8; j++ {
+					padded[j] = fill
+				}
+				v = float64(int64(le.Uint64(padded))) / full
+			}
+
+			m.Channels[c].S[i] = v
+		}
+	}
+
+	return m, nil
+}
+
+// WriteWAV writes the signal to disk as a WAV file using EncodeWAV().
+func WriteWAV(path string, m *MultiSignal, opts *WAVOptions) (int, error) {
+	var buf bytes.Buffer
+	clipped, err := EncodeWAV(&buf, m, opts)
+	if err != nil {
+		return clipped, err
+	}
+
+	return clipped, ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// ReadWAV reads a WAV file from disk using DecodeWAV().
+func ReadWAV(path string) (*MultiSignal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return DecodeWAV(f)
+}
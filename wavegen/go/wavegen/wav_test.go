@@ -0,0 +1,173 @@
+package wavegen
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func testStereo(t *testing.T, n int, rate float64) *MultiSignal {
+	m := &MultiSignal{T: make([]float64, n), SampleRate: rate}
+	left := make([]float64, n)
+	right := make([]float64, n)
+	for i := range m.T {
+		m.T[i] = float64(i) / rate
+		left[i] = 0.9 * math.Sin(2*math.Pi*3*m.T[i])
+		right[i] = -0.5 * math.Cos(2*math.Pi*5*m.T[i])
+	}
+	if err := m.AddChannel("left", left); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddChannel("right", right); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	cases := []struct {
+		opts      WAVOptions
+		tolerance float64
+	}{
+		{WAVOptions{BitsPerSample: 8}, 1.0 / 127},
+		{WAVOptions{BitsPerSample: 16}, 1.0 / 32767},
+		{WAVOptions{BitsPerSample: 24}, 1.0 / 8388607},
+		{WAVOptions{BitsPerSample: 32}, 1e-9},
+		{WAVOptions{Float: true}, 1e-7},
+		{WAVOptions{Float: true, BitsPerSample: 64}, 0},
+	}
+
+	m := testStereo(t, 101, 100)
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		clipped, err := EncodeWAV(&buf, m, &c.opts)
+		if err != nil {
+			t.Fatalf("%+v: %v", c.opts, err)
+		}
+		if clipped != 0 {
+			t.Errorf("%+v: %d samples clipped", c.opts, clipped)
+		}
+
+		// odd-sized data is padded
+		if buf.Len()%2 != 0 {
+			t.Errorf("%+v: file is %d bytes", c.opts, buf.Len())
+		}
+
+		decoded, err := DecodeWAV(&buf)
+		if err != nil {
+			t.Fatalf("%+v: %v", c.opts, err)
+		}
+
+		if decoded.Size() != m.Size() || len(decoded.Channels) != 2 || decoded.SampleRate != 100 {
+			t.Fatalf("%+v: decoded %d samples of %d channels at %fHz", c.opts, decoded.Size(), len(decoded.Channels), decoded.SampleRate)
+		}
+
+		for i := range m.T {
+			if math.Abs(decoded.T[i]-m.T[i]) > 1e-12 {
+				t.Fatalf("%+v: time %d is %f, expected %f", c.opts, i, decoded.T[i], m.T[i])
+			}
+			for ch := range m.Channels {
+				if math.Abs(decoded.Channels[ch].S[i]-m.Channels[ch].S[i]) > c.tolerance {
+					t.Fatalf("%+v: channel %d sample %d is %v, expected %v", c.opts, ch, i, decoded.Channels[ch].S[i], m.Channels[ch].S[i])
+				}
+			}
+		}
+
+		if decoded.Channels[0].Name != "channel0" || decoded.Channels[1].Name != "channel1" {
+			t.Errorf("%+v: channels are named %v", c.opts, decoded.ChannelNames())
+		}
+	}
+}
+
+func TestWAVHeader(t *testing.T) {
+	m := &MultiSignal{T: []float64{0, 0.125}}
+	if err := m.AddChannel("x", []float64{1, -0.5}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	_, err := EncodeWAV(&buf, m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []byte{
+		'R', 'I', 'F', 'F', 40, 0, 0, 0, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 16, 0, 0, 0,
+		1, 0, // PCM
+		1, 0, // mono
+		8, 0, 0, 0, // 8Hz
+		16, 0, 0, 0, // bytes per second
+		2, 0, // block align
+		16, 0, // bits
+		'd', 'a', 't', 'a', 4, 0, 0, 0,
+		0xFF, 0x7F, // 32767
+		0x00, 0xC0, // -16384
+	}
+
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("WAV file is\n%v\nexpected\n%v", buf.Bytes(), expect)
+	}
+
+	decoded, err := DecodeWAV(bytes.NewReader(expect))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Channels[0].Name != DefaultChannelName {
+		t.Errorf("mono channel is named '%s'", decoded.Channels[0].Name)
+	}
+}
+
+func TestWAVOptions(t *testing.T) {
+	m := &MultiSignal{T: []float64{0, 1, 2}}
+	if err := m.AddChannel("x", []float64{4, -2, 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	clipped, err := EncodeWAV(&buf, m, &WAVOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clipped != 2 {
+		t.Errorf("%d samples clipped, expected 2", clipped)
+	}
+
+	buf.Reset()
+	clipped, err = EncodeWAV(&buf, m, &WAVOptions{Normalize: true, Gain: 0.5, Float: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeWAV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []float64{0.5, -0.25, 0.125}
+	for i, v := range decoded.Channels[0].S {
+		if v != expect[i] {
+			t.Errorf("normalized samples are %v, expected %v", decoded.Channels[0].S, expect)
+			break
+		}
+	}
+
+	// not uniformly sampled
+	m.T[2] = 3
+	if _, err := EncodeWAV(&buf, m, nil); err == nil {
+		t.Errorf("non-uniform signal should have errored")
+	}
+
+	// not a whole number sample rate
+	m.T = []float64{0, 0.3, 0.6}
+	if _, err := EncodeWAV(&buf, m, nil); err == nil {
+		t.Errorf("fractional sample rate should have errored")
+	}
+
+	if _, err := EncodeWAV(&buf, testStereo(t, 10, 10), &WAVOptions{BitsPerSample: 12}); err == nil {
+		t.Errorf("12 bit samples should have errored")
+	}
+
+	if _, err := DecodeWAV(bytes.NewReader([]byte("RIFF\x04\x00\x00\x00WAVE"))); err == nil {
+		t.Errorf("WAV file without chunks should have errored")
+	}
+}
@@ -0,0 +1,156 @@
+package wavegen
+
+import (
+	"fmt"
+	"math"
+)
+
+// This file implements the waveform kinds which may be used for each
+// component of a synthetic wave, see WaveParameters.Kinds.
+
+// WaveformKinds lists every waveform kind which is understood by
+// GenerateSyntheticData().
+var WaveformKinds = []string{
+	"sine",
+	"square",
+	"sawtooth",
+	"triangle",
+	"chirp",
+	"expchirp",
+	"impulse",
+	"step",
+	"dc",
+}
+
+// DefaultDutyCycle is the duty cycle of square waves if none is given.
+const DefaultDutyCycle = 0.5
+
+// isWaveformKind returns true if the kind is listed in WaveformKinds.
+func isWaveformKind(kind string) bool {
+	for _, k := range WaveformKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// cycles returns the fractional part of the number of cycles completed at an
+// angle theta, in [0, 1).
+func cycles(theta float64) float64 {
+	c := theta / (2 * math.Pi)
+	return c - math.Floor(c)
+}
+
+// chirpAngle computes the instantaneous angle, in radians, of the index-th
+// component at time t, for kinds where the frequency varies over time. The
+// frequency sweeps from Frequencies[index] at time 0 to
+// EndFrequencies[index] at time Duration.
+func (w *WaveParameters) chirpAngle(index int, t float64) float64 {
+	f0 := w.Frequencies[index]
+	f1 := w.EndFrequencies[index]
+	phase := w.Phases[index]
+
+	if w.Duration <= 0 || f0 == f1 {
+		return 2*math.Pi*f0*t + phase
+	}
+
+	if w.Kinds[index] == "expchirp" {
+		k := f1 / f0
+		return 2*math.Pi*f0*w.Duration*(math.Pow(k, t/w.Duration)-1)/math.Log(k) + phase
+	}
+
+	return 2*math.Pi*(f0*t+(f1-f0)*t*t/(2*w.Duration)) + phase
+}
+
+// angle computes the instantaneous angle, in radians, of the index-th
+// component at time t, including its frequency modulation.
+func (w *WaveParameters) angle(index int, t float64) float64 {
+	theta := 2*math.Pi*w.Frequencies[index]*t + w.Phases[index]
+	if w.Kinds[index] == "chirp" || w.Kinds[index] == "expchirp" {
+		theta = w.chirpAngle(index, t)
+	}
+
+	return theta + w.modulationAngle(index, t)
+}
+
+// Waveform computes the value of the index-th component of the wave, not
+// including its noise, at time t. The sample period is the time between
+// consecutive samples, which is needed to place the impulses of an impulse
+// train.
+func (w *WaveParameters) Waveform(index int, t, samplePeriod float64) (float64, error) {
+	if index < 0 || index >= len(w.Frequencies) {
+		return 0, fmt.Errorf("Index %d out of bound for parameters of %d components", index, len(w.Frequencies))
+	}
+
+	amplitude := w.Amplitudes[index] * w.modulationGain(index, t)
+	theta := w.angle(index, t)
+
+	switch w.Kinds[index] {
+	case "sine", "", "chirp", "expchirp":
+		return amplitude * math.Sin(theta), nil
+
+	case "square":
+		if cycles(theta) < w.DutyCycles[index] {
+			return amplitude, nil
+		}
+		return -amplitude, nil
+
+	case "sawtooth":
+		// shifted by half a cycle, so that it crosses zero rising at
+		// the same time as a sine wave of the same phase
+		return amplitude * (2*cycles(theta+math.Pi) - 1), nil
+
+	case "triangle":
+		return amplitude * 2 / math.Pi * math.Asin(math.Sin(theta)), nil
+
+	case "impulse":
+		// one impulse for each sample in which a new cycle begins
+		prev := w.angle(index, t-samplePeriod)
+		if math.Floor(theta/(2*math.Pi)) > math.Floor(prev/(2*math.Pi)) {
+			return amplitude, nil
+		}
+		return 0, nil
+
+	case "step":
+		if t >= w.Phases[index] {
+			return amplitude, nil
+		}
+		return 0, nil
+
+	case "dc":
+		return amplitude, nil
+
+	default:
+		return 0, fmt.Errorf("Unknown waveform kind '%s'", w.Kinds[index])
+	}
+}
+
+// describeComponent returns a human-readable formula for the index-th
+// component of the wave, not including its noise.
+func (w *WaveParameters) describeComponent(index int) string {
+	a := w.Amplitudes[index]
+	f := w.Frequencies[index]
+	p := w.Phases[index]
+
+	switch w.Kinds[index] {
+	case "square":
+		return fmt.Sprintf("%f × Square(2 × π × %f × t + %f, duty=%f)", a, f, p, w.DutyCycles[index])
+	case "sawtooth":
+		return fmt.Sprintf("%f × Sawtooth(2 × π × %f × t + %f)", a, f, p)
+	case "triangle":
+		return fmt.Sprintf("%f × Triangle(2 × π × %f × t + %f)", a, f, p)
+	case "chirp":
+		return fmt.Sprintf("%f × Sin(2 × π × LinearSweep(%f → %f) × t + %f)", a, f, w.EndFrequencies[index], p)
+	case "expchirp":
+		return fmt.Sprintf("%f × Sin(2 × π × ExponentialSweep(%f → %f) × t + %f)", a, f, w.EndFrequencies[index], p)
+	case "impulse":
+		return fmt.Sprintf("%f × ImpulseTrain(2 × π × %f × t + %f)", a, f, p)
+	case "step":
+		return fmt.Sprintf("%f × Step(t - %f)", a, p)
+	case "dc":
+		return fmt.Sprintf("%f", a)
+	default:
+		return fmt.Sprintf("%f × Sin(2 × π × %f × t + %f)", a, f, p)
+	}
+}
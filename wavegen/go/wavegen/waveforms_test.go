@@ -0,0 +1,160 @@
+package wavegen
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// generateKind generates one second of a single component of the given kind,
+// at 1 Hz, sampled at 8 Hz.
+func generateKind(t *testing.T, kind string, modify func(*WaveParameters)) []float64 {
+	w := &WaveParameters{
+		SampleRate:  8,
+		Duration:    1,
+		Frequencies: []float64{1},
+		Phases:      []float64{0},
+		Amplitudes:  []float64{2},
+		Kinds:       []string{kind},
+	}
+
+	if modify != nil {
+		modify(w)
+	}
+
+	sig, err := w.GenerateSyntheticData()
+	if err != nil {
+		t.Fatalf("kind '%s': %v", kind, err)
+	}
+	return sig.S
+}
+
+func TestWaveformKinds(t *testing.T) {
+	cases := []struct {
+		kind   string
+		modify func(*WaveParameters)
+		expect []float64
+	}{
+		{"square", nil, []float64{2, 2, 2, 2, -2, -2, -2, -2}},
+		{"square", func(w *WaveParameters) {
+			w.DutyCycles = []float64{0.25}
+		}, []float64{2, 2, -2, -2, -2, -2, -2, -2}},
+		{"sawtooth", nil, []float64{0, 0.5, 1, 1.5, -2, -1.5, -1, -0.5}},
+		{"triangle", nil, []float64{0, 1, 2, 1, 0, -1, -2, -1}},
+		{"impulse", func(w *WaveParameters) {
+			w.Frequencies = []float64{2}
+		}, []float64{2, 0, 0, 0, 2, 0, 0, 0}},
+		{"step", func(w *WaveParameters) {
+			w.Phases = []float64{0.5}
+		}, []float64{0, 0, 0, 0, 2, 2, 2, 2}},
+		{"dc", nil, []float64{2, 2, 2, 2, 2, 2, 2, 2}},
+		{"chirp", func(w *WaveParameters) {
+			w.EndFrequencies = []float64{1}
+		}, generateKind(t, "sine", nil)},
+	}
+
+	for i, c := range cases {
+		actual := generateKind(t, c.kind, c.modify)
+		if len(actual) != len(c.expect) {
+			t.Fatalf("Test case %d (%s): %d samples, expected %d", i, c.kind, len(actual), len(c.expect))
+		}
+		for j := range actual {
+			if math.Abs(actual[j]-c.expect[j]) > 0.00001 {
+				t.Errorf("Test case %d (%s): samples %v, expected %v", i, c.kind, actual, c.expect)
+				break
+			}
+		}
+	}
+}
+
+func TestChirp(t *testing.T) {
+	for _, kind := range []string{"chirp", "expchirp"} {
+		w := &WaveParameters{
+			SampleRate:     10000,
+			Duration:       1,
+			Frequencies:    []float64{10},
+			EndFrequencies: []float64{100},
+			Phases:         []float64{0},
+			Amplitudes:     []float64{1},
+			Kinds:          []string{kind},
+		}
+
+		sig, err := w.GenerateSyntheticData()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// count upward zero crossings in the first and last tenth of
+		// a second, to estimate the frequency at each end
+		crossings := func(from, to int) int {
+			n := 0
+			for i := from + 1; i < to; i++ {
+				if sig.S[i-1] < 0 && sig.S[i] >= 0 {
+					n++
+				}
+			}
+			return n
+		}
+
+		start := crossings(0, 1000)
+		end := crossings(9000, 10000)
+		if start > 2 {
+			t.Errorf("%s: %d cycles at the start, expected about 1", kind, start)
+		}
+		if end < 8 || end > 11 {
+			t.Errorf("%s: %d cycles at the end, expected about 10", kind, end)
+		}
+	}
+}
+
+func TestWaveformValidation(t *testing.T) {
+	cases := []func(*WaveParameters){
+		func(w *WaveParameters) { w.Kinds = []string{"cosine"} },
+		func(w *WaveParameters) { w.Kinds = []string{"sine", "sine"} },
+		func(w *WaveParameters) { w.DutyCycles = []float64{1.5} },
+		func(w *WaveParameters) { w.EndFrequencies = []float64{1, 2} },
+		func(w *WaveParameters) {
+			w.Kinds = []string{"expchirp"}
+			w.EndFrequencies = []float64{0}
+		},
+	}
+
+	for i, modify := range cases {
+		w := &WaveParameters{
+			SampleRate:  8,
+			Duration:    1,
+			Frequencies: []float64{1},
+			Phases:      []float64{0},
+			Amplitudes:  []float64{1},
+		}
+		modify(w)
+
+		err := w.ValidateParameters()
+		if err == nil {
+			t.Errorf("Test case %d should have failed validation", i)
+		}
+	}
+}
+
+func TestSummarizeKinds(t *testing.T) {
+	w := &WaveParameters{
+		SampleRate:  8,
+		Duration:    1,
+		Frequencies: []float64{1, 2},
+		Phases:      []float64{0, 0},
+		Amplitudes:  []float64{1, 1},
+		Kinds:       []string{"square", "chirp"},
+		DutyCycles:  []float64{0.25, 0.5},
+	}
+
+	s, err := w.Summarize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{"Square(", "duty=0.250000", "LinearSweep(2.000000 → 2.000000)"} {
+		if !strings.Contains(s, expect) {
+			t.Errorf("summary does not contain '%s':\n%s", expect, s)
+		}
+	}
+}
@@ -5,7 +5,7 @@ package wavegen
 import (
 	"fmt"
 	"math"
-	"math/rand"
+	"sort"
 
 	"github.com/montanaflynn/stats"
 
@@ -28,29 +28,74 @@ type WaveParameters struct {
 	// Duration is the number of seconds of samples that should be generated
 	Duration float64
 
-	// Frequencies is the list of frequencies of Sin wave that should be
-	// generated
+	// Frequencies is the list of frequencies of the components that should
+	// be generated
 	Frequencies []float64
 
-	// Phases is the list of phases of the Sin waves that should be
-	// generated
+	// Phases is the list of phases of the components that should be
+	// generated, in radians. For step components, this is instead the time
+	// in seconds at which the step occurs.
 	Phases []float64
 
-	// Amplitudes is the list of amplitudes of Sin that should be generated
+	// Amplitudes is the list of amplitudes of the components that should
+	// be generated
 	Amplitudes []float64
 
+	// Kinds is the list of waveform kinds of each component, see
+	// WaveformKinds. If empty, all components are "sine".
+	Kinds []string
+
+	// DutyCycles is the fraction of each period for which square
+	// components are high, between 0 and 1. It is ignored for other
+	// kinds. If empty, all duty cycles are DefaultDutyCycle.
+	DutyCycles []float64
+
+	// EndFrequencies is the frequency reached by chirp components at the
+	// end of the duration, the corresponding element of Frequencies being
+	// the frequency at the start. It is ignored for other kinds. If empty,
+	// it is the same as Frequencies.
+	EndFrequencies []float64
+
+	// AMDepths is the depth of the amplitude modulation of each component,
+	// whose amplitude is multiplied by 1 + depth × sin(2π × rate × t). If
+	// empty, all depths are 0, meaning no amplitude modulation.
+	AMDepths []float64
+
+	// AMRates is the rate in Hz of the amplitude modulation of each
+	// component. If empty, all rates are 0.
+	AMRates []float64
+
+	// FMDeviations is the peak frequency deviation in Hz of the frequency
+	// modulation of each component, whose frequency is offset by
+	// deviation × sin(2π × rate × t). If empty, all deviations are 0,
+	// meaning no frequency modulation.
+	FMDeviations []float64
+
+	// FMRates is the rate in Hz of the frequency modulation of each
+	// component. If empty, all rates are 0. A rate of 0 disables frequency
+	// modulation.
+	FMRates []float64
+
+	// AmplitudeEnvelopes is the envelope of each component, by which its
+	// amplitude is multiplied. If empty, or for empty envelopes, the
+	// amplitude is unchanged.
+	AmplitudeEnvelopes []Envelope
+
+	// FrequencyEnvelopes is the envelope of each component, which is added
+	// to its frequency in Hz. If empty, or for empty envelopes, the
+	// frequency is unchanged.
+	FrequencyEnvelopes []Envelope
+
 	// Noises stores a list of noise functions which are applied on a
 	// per-signal basis.  if this field is left empty, then no noise will
-	// be generated for the given signal. These noise functions are
-	// understood:
-	//
-	// * "pseudo" (rand.Float64)
-	// * "none" (no noise)
-	// * "" (no noise)
+	// be generated for the given signal. The noise functions which are
+	// understood are listed in NoiseKinds, and described by
+	// NewNoiseGenerator(). "none" and "" both mean no noise.
 	Noises []string
 
 	// NoiseMagnitues is a list of coefficients to the given noise function
-	// for a particular signal.  If empty, it is assumed that all
+	// for a particular signal, see NewNoiseGenerator() for their meaning
+	// for each noise function.  If empty, it is assumed that all
 	// magnitudes are 1.0.
 	NoiseMagnitudes []float64
 
@@ -61,6 +106,23 @@ type WaveParameters struct {
 	// GlobalNoiseMagnitude works similarly to NoiseMagnitudes, but applies
 	// to the global noise.
 	GlobalNoiseMagnitude float64
+
+	// Expression is an expression in terms of the time t, whose value is
+	// added to that of the components, see ParseExpression(). It may be
+	// empty, and it may be used instead of any components.
+	Expression string
+
+	// Constants gives the value of constants which may be used in
+	// Expression.
+	Constants map[string]float64
+
+	// Seed is the seed from which all noise is generated, so that the same
+	// parameters always generate the same signal.
+	Seed int64
+
+	// RandomVersion is the version of the pseudo-random number generator
+	// used with Seed. If 0, CurrentRandomVersion is used.
+	RandomVersion int
 }
 
 func (w *WaveParameters) Summarize() (string, error) {
@@ -75,15 +137,21 @@ func (w *WaveParameters) Summarize() (string, error) {
 	s = fmt.Sprintf("%s\tDuration  . . . . . . %fs\n", s, w.Duration)
 	s = fmt.Sprintf("%s\tGlobal Noise  . . . . %s\n", s, w.GlobalNoise)
 	s = fmt.Sprintf("%s\t|Global Noise|  . . . %f\n", s, w.GlobalNoiseMagnitude)
+	s = fmt.Sprintf("%s\tSeed  . . . . . . . . %d (v%d)\n", s, w.Seed, w.RandomVersion)
+	if w.Expression != "" {
+		s = fmt.Sprintf("%s\tExpression  . . . . . %s\n", s, w.Expression)
+		for _, name := range sortedConstants(w.Constants) {
+			s = fmt.Sprintf("%s\t\t%s = %f\n", s, name, w.Constants[name])
+		}
+	}
 	s = fmt.Sprintf("%s\n\tCOMPONENTS:\n", s)
 
 	for i := range w.Frequencies {
 		if w.Noises[i] == "" || w.Noises[i] == "none" {
-			s = fmt.Sprintf("%s\t\t%f × Sin(2 × π × %f × t + %f)\n",
-				s, w.Amplitudes[i], w.Frequencies[i], w.Phases[i])
+			s = fmt.Sprintf("%s\t\t%s%s\n", s, w.describeComponent(i), w.describeModulation(i))
 		} else {
-			s = fmt.Sprintf("%s\t\t%f × Sin(2 × π × %f × t + %f) + %f × %s()\n",
-				s, w.Amplitudes[i], w.Frequencies[i], w.Phases[i], w.NoiseMagnitudes[i], w.Noises[i])
+			s = fmt.Sprintf("%s\t\t%s + %f × %s()%s\n",
+				s, w.describeComponent(i), w.NoiseMagnitudes[i], w.Noises[i], w.describeModulation(i))
 		}
 	}
 
@@ -116,7 +184,7 @@ func (s *Signal) Len() int {
 
 // XY implements gonum's plotter.XYer interface
 func (s *Signal) XY(i int) (float64, float64) {
-	return s.T[i], s.T[i]
+	return s.T[i], s.S[i]
 }
 
 func (s *Signal) Summarize() (string, error) {
@@ -285,42 +353,69 @@ func (s *Signal) MustIndex(i int) Sample {
 //
 // Note that time includes the offset, so time=0 when the offset is 1 second
 // will return 0, since it is before the beginning of the signal data.
+//
+// The index is found by binary search, so T must be sorted.
 func (s *Signal) NearestIndex(time float64, overshoot bool) int {
-	if s.Size() == 0 {
-		return 0
+	under, over := s.nearestIndices(time, s.searchIndex(time))
+	if overshoot {
+		return over
 	}
+	return under
+}
 
-	if time < s.T[0] {
-		return 0
-	}
+// searchIndex returns the index of the first sample at or after time, or
+// s.Size() if there is none, by binary search.
+func (s *Signal) searchIndex(time float64) int {
+	return sort.Search(s.Size(), func(i int) bool { return s.T[i] >= time })
+}
 
-	i := 0
-	for {
-		t := s.T[i]
+// nearestIndices returns the indices which NearestIndex() returns for time
+// when overshoot is false and true, given the index of the first sample at or
+// after time, or s.Size() if there is none.
+func (s *Signal) nearestIndices(time float64, next int) (int, int) {
+	if s.Size() == 0 || time < s.T[0] {
+		return 0, 0
+	}
 
-		if t == time {
-			return i
-		} else if overshoot && (t >= time) {
-			return i
-		} else if (t != time) && (i+1 >= s.Size()) {
-			// prevent the next case from going out of bounds
-			return s.Size() - 1
-		} else if (!overshoot) && ((s.T[i+1]) > time) {
-			return i
-		}
+	if next >= s.Size() {
+		return s.Size() - 1, s.Size() - 1
+	}
 
-		i++
+	if s.T[next] == time {
+		return next, next
 	}
+
+	return next - 1, next
 }
 
 // Interpolate can be used to perform linear interpolation. It will compute a
 // separate linear interpolation for each point in times, and return an
 // appropriate sample for each.
+//
+// If times are sorted, they are merged with the signal's samples in a single
+// pass, otherwise the samples around each time are found by binary search.
 func (s *Signal) Interpolate(times ...float64) []Sample {
+	sorted := true
+	for i := 1; i < len(times); i++ {
+		// also false if either is NaN
+		if !(times[i] >= times[i-1]) {
+			sorted = false
+			break
+		}
+	}
+
 	interpolated := make([]Sample, len(times))
+	next := 0
 	for i, t := range times {
-		i0 := s.NearestIndex(t, false) // undershoot
-		i1 := s.NearestIndex(t, true)  // overshoot
+		if sorted {
+			for next < s.Size() && s.T[next] < t {
+				next++
+			}
+		} else {
+			next = s.searchIndex(t)
+		}
+
+		i0, i1 := s.nearestIndices(t, next)
 
 		s0 := s.MustIndex(i0)
 		s1 := s.MustIndex(i1)
@@ -348,11 +443,11 @@ func (s *Signal) Interpolate(times ...float64) []Sample {
 	return interpolated
 }
 
-// ValidateParameters will ensure that the parameters are valid.
-//
-// If the noises or noise magnitudes are empty, then they will be filled to
-// an appropriate length with default values.
-func (w *WaveParameters) ValidateParameters() error {
+// setDefaults fills any optional per-component lists which are empty to an
+// appropriate length with default values. This is also done when reading a
+// file, so that files written before a list was introduced are read as if it
+// held the defaults.
+func (w *WaveParameters) setDefaults() {
 	// if omitted, assume no noise is desired
 	if len(w.Noises) == 0 {
 		w.Noises = make([]string, len(w.Frequencies))
@@ -369,6 +464,54 @@ func (w *WaveParameters) ValidateParameters() error {
 		}
 	}
 
+	// if omitted, assume sine waves
+	if len(w.Kinds) == 0 {
+		w.Kinds = make([]string, len(w.Frequencies))
+		for i := 0; i < len(w.Frequencies); i++ {
+			w.Kinds[i] = "sine"
+		}
+	}
+
+	if len(w.DutyCycles) == 0 {
+		w.DutyCycles = make([]float64, len(w.Frequencies))
+		for i := 0; i < len(w.Frequencies); i++ {
+			w.DutyCycles[i] = DefaultDutyCycle
+		}
+	}
+
+	// if omitted, assume chirps do not change frequency
+	if len(w.EndFrequencies) == 0 {
+		w.EndFrequencies = append([]float64{}, w.Frequencies...)
+	}
+
+	// if omitted, assume no modulation
+	for _, l := range []*[]float64{&w.AMDepths, &w.AMRates, &w.FMDeviations, &w.FMRates} {
+		if len(*l) == 0 {
+			*l = make([]float64, len(w.Frequencies))
+		}
+	}
+
+	if len(w.AmplitudeEnvelopes) == 0 {
+		w.AmplitudeEnvelopes = make([]Envelope, len(w.Frequencies))
+	}
+
+	if len(w.FrequencyEnvelopes) == 0 {
+		w.FrequencyEnvelopes = make([]Envelope, len(w.Frequencies))
+	}
+
+	if w.RandomVersion == 0 {
+		w.RandomVersion = CurrentRandomVersion
+	}
+}
+
+// ValidateParameters will ensure that the parameters are valid.
+//
+// If the noises, noise magnitudes, kinds, duty cycles, end frequencies, or
+// any of the modulation lists are empty, then they will be filled to an
+// appropriate length with default values.
+func (w *WaveParameters) ValidateParameters() error {
+	w.setDefaults()
+
 	if len(w.Noises) != len(w.Frequencies) {
 		return fmt.Errorf("Invalid parameters: length of noises does not match length of frequencies")
 	}
@@ -385,89 +528,212 @@ func (w *WaveParameters) ValidateParameters() error {
 		return fmt.Errorf("Invalid parameters: length of noise magnitudes does not match length of frequencies")
 	}
 
+	if len(w.Kinds) != len(w.Frequencies) {
+		return fmt.Errorf("Invalid parameters: length of kinds does not match length of frequencies")
+	}
+
+	if len(w.DutyCycles) != len(w.Frequencies) {
+		return fmt.Errorf("Invalid parameters: length of duty cycles does not match length of frequencies")
+	}
+
+	if len(w.EndFrequencies) != len(w.Frequencies) {
+		return fmt.Errorf("Invalid parameters: length of end frequencies does not match length of frequencies")
+	}
+
+	if len(w.AMDepths) != len(w.Frequencies) {
+		return fmt.Errorf("Invalid parameters: length of AM depths does not match length of frequencies")
+	}
+
+	if len(w.AMRates) != len(w.Frequencies) {
+		return fmt.Errorf("Invalid parameters: length of AM rates does not match length of frequencies")
+	}
+
+	if len(w.FMDeviations) != len(w.Frequencies) {
+		return fmt.Errorf("Invalid parameters: length of FM deviations does not match length of frequencies")
+	}
+
+	if len(w.FMRates) != len(w.Frequencies) {
+		return fmt.Errorf("Invalid parameters: length of FM rates does not match length of frequencies")
+	}
+
+	if len(w.AmplitudeEnvelopes) != len(w.Frequencies) {
+		return fmt.Errorf("Invalid parameters: length of amplitude envelopes does not match length of frequencies")
+	}
+
+	if len(w.FrequencyEnvelopes) != len(w.Frequencies) {
+		return fmt.Errorf("Invalid parameters: length of frequency envelopes does not match length of frequencies")
+	}
+
+	for i := range w.Frequencies {
+		err := w.validateModulation(i)
+		if err != nil {
+			return fmt.Errorf("Invalid parameters: %v", err)
+		}
+	}
+
+	for i, kind := range w.Noises {
+		if !isNoiseKind(kind) {
+			return fmt.Errorf("Invalid parameters: unknown noise kind '%s' for component %d", kind, i)
+		}
+	}
+
+	if !isNoiseKind(w.GlobalNoise) {
+		return fmt.Errorf("Invalid parameters: unknown global noise kind '%s'", w.GlobalNoise)
+	}
+
+	if w.Expression != "" {
+		_, err := ParseExpression(w.Expression, w.Constants)
+		if err != nil {
+			return fmt.Errorf("Invalid parameters: %v", err)
+		}
+	}
+
+	if w.RandomVersion < 0 || w.RandomVersion > CurrentRandomVersion {
+		return fmt.Errorf("Invalid parameters: don't know how to generate noise with random version %d", w.RandomVersion)
+	}
+
+	for i, kind := range w.Kinds {
+		if !isWaveformKind(kind) {
+			return fmt.Errorf("Invalid parameters: unknown waveform kind '%s' for component %d", kind, i)
+		}
+
+		if w.DutyCycles[i] < 0 || w.DutyCycles[i] > 1 {
+			return fmt.Errorf("Invalid parameters: duty cycle %f for component %d is not between 0 and 1", w.DutyCycles[i], i)
+		}
+
+		if kind == "expchirp" && (w.Frequencies[i] <= 0 || w.EndFrequencies[i] <= 0) {
+			return fmt.Errorf("Invalid parameters: exponential chirp component %d must have positive start and end frequencies", i)
+		}
+	}
+
 	return nil
 }
 
-// Noise generates a randomized noise value for the index-th component of
-// the wave parameter. An index of -1 indicates that the global noise should
-// be generated instead.
-func (w *WaveParameters) Noise(index int) (float64, error) {
+// NoiseGenerator creates a new generator for the noise of the index-th
+// component of the wave parameter. An index of -1 indicates that the global
+// noise should be generated instead.
+//
+// Each generator draws from its own stream of pseudo-random numbers derived
+// from Seed, so a given generator always produces the same sequence, and the
+// noise of each component does not depend on that of any other.
+func (w *WaveParameters) NoiseGenerator(index int) (*NoiseGenerator, error) {
 	err := w.ValidateParameters()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if index < -1 || index >= len(w.Frequencies) {
-		return 0, fmt.Errorf("Index %d out of bound for parameters of %d components", index, len(w.Frequencies))
+		return nil, fmt.Errorf("Index %d out of bound for parameters of %d components", index, len(w.Frequencies))
 	}
 
-	kind := ""
+	var gen *NoiseGenerator
 	if index == -1 {
-		kind = w.GlobalNoise
+		gen, err = NewNoiseGenerator(w.GlobalNoise, w.GlobalNoiseMagnitude)
 	} else {
-		kind = w.Noises[index]
+		gen, err = NewNoiseGenerator(w.Noises[index], w.NoiseMagnitudes[index])
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	v := 0.0
-	switch kind {
-	case "pseudo":
-		v = rand.Float64()
-	case "none":
-		v = 0
-	case "":
-		v = 0
-	default:
-		return 0, fmt.Errorf("Unknown noise kind '%s'", kind)
-
+	// the global noise is stream 0, and each component follows
+	gen.rng, err = newRandom(w.RandomVersion, w.Seed, index+1)
+	if err != nil {
+		return nil, err
 	}
 
-	if index == -1 {
-		return w.GlobalNoiseMagnitude * v, nil
+	return gen, nil
+}
+
+// Noise generates a randomized noise value for the index-th component of
+// the wave parameter. An index of -1 indicates that the global noise should
+// be generated instead.
+//
+// Each call is independent of the last, so for noise kinds which depend on
+// previous values, such as "pink" and "brown", this only returns the first
+// value of a new sequence. Use NoiseGenerator() to generate a sequence.
+//
+// Unlike NoiseGenerator(), this does not use Seed, but the global source of
+// the math/rand package, so that each call gives a different value.
+func (w *WaveParameters) Noise(index int) (float64, error) {
+	gen, err := w.NoiseGenerator(index)
+	if err != nil {
+		return 0, err
 	}
-	return w.NoiseMagnitudes[index] * v, nil
+	gen.rng = nil
+
+	return gen.Next(), nil
 }
 
 // GenerateSyntheticData generates a signal which is a composition of several
-// Sin functions of the given frequencies, phases, and amplitudes, with noise
-// optionally applied to each signal, and optionally applied to the data
-// overall.
+// waveforms of the given kinds, frequencies, phases, and amplitudes, with
+// noise optionally applied to each signal, and optionally applied to the data
+// overall. The value of the expression, if any, is added to the result.
+//
+// The whole signal is held in memory, see NewGenerator() to generate it in
+// chunks instead.
 func (w *WaveParameters) GenerateSyntheticData() (*Signal, error) {
-	// number of points to generate
-	points := int(math.Ceil(w.SampleRate * w.Duration))
-	samplePeriod := 1.0 / w.SampleRate
-
-	err := w.ValidateParameters()
+	g, err := w.NewGenerator()
 	if err != nil {
 		return nil, err
 	}
 
-	sig := &Signal{
-		T:          make([]float64, points),
-		S:          make([]float64, points),
-		SampleRate: w.SampleRate,
+	return g.generate(g.Size())
+}
+
+// Regenerate replaces the wave data of a wave file with the signal generated
+// by its parameters. As the parameters generate a single channel, any channels
+// of a version 1 file are discarded, and it holds that signal instead.
+func (wf *WaveFile) Regenerate() error {
+	if wf.Parameters == nil {
+		return fmt.Errorf("Wave file has no parameters to regenerate from")
 	}
 
-	for i := 0; i < points; i++ {
-		sig.S[i] = 0
-		sig.T[i] = samplePeriod * float64(i)
-		for j, freq := range w.Frequencies {
+	sig, err := wf.Parameters.GenerateSyntheticData()
+	if err != nil {
+		return err
+	}
 
-			// component noise
-			n, err := w.Noise(j)
-			if err != nil {
-				return nil, err
-			}
+	wf.Signal = sig
+	wf.Channels = nil
+	return nil
+}
+
+// Verify checks that the signal of a wave file is the one generated by its
+// parameters. Samples may differ by up to epsilon, to allow for differences in
+// floating point arithmetic between platforms.
+func (wf *WaveFile) Verify(epsilon float64) error {
+	if wf.Parameters == nil {
+		return fmt.Errorf("Wave file has no parameters to verify against")
+	}
 
-			sig.S[i] += w.Amplitudes[j]*math.Sin(2*math.Pi*freq*sig.T[i]+w.Phases[j]) + n
+	if wf.Signal == nil {
+		return fmt.Errorf("Wave file has no signal to verify")
+	}
+
+	err := wf.Signal.ValidateIndex(0)
+	if err != nil {
+		return err
+	}
+
+	expected, err := wf.Parameters.GenerateSyntheticData()
+	if err != nil {
+		return err
+	}
+
+	if expected.Size() != wf.Signal.Size() {
+		return fmt.Errorf("Signal has %d samples, but its parameters generate %d", wf.Signal.Size(), expected.Size())
+	}
+
+	for i := range expected.S {
+		if math.Abs(expected.T[i]-wf.Signal.T[i]) > epsilon {
+			return fmt.Errorf("Sample %d is at time %v, but its parameters generate time %v", i, wf.Signal.T[i], expected.T[i])
 		}
 
-		// global noise
-		n, err := w.Noise(-1)
-		if err != nil {
-			return nil, err
+		if math.Abs(expected.S[i]-wf.Signal.S[i]) > epsilon {
+			return fmt.Errorf("Sample %d has value %v, but its parameters generate %v", i, wf.Signal.S[i], expected.S[i])
 		}
-		sig.S[i] = sig.S[i] + n
 	}
 
-	return sig, nil
+	return nil
 }
@@ -2,8 +2,12 @@ package wavegen
 
 import (
 	"math"
+	"math/rand"
+	"sort"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/montanaflynn/stats"
 )
 
@@ -172,6 +176,148 @@ func TestInterpolation(t *testing.T) {
 	}
 }
 
+// scanNearestIndex finds the nearest index as NearestIndex() does, by scanning
+// the signal from the start, and is used to check its results.
+func scanNearestIndex(s *Signal, time float64, overshoot bool) int {
+	if s.Size() == 0 || time < s.T[0] {
+		return 0
+	}
+
+	for i, t := range s.T {
+		if t == time || (overshoot && t >= time) {
+			return i
+		} else if i+1 >= s.Size() {
+			return s.Size() - 1
+		} else if !overshoot && s.T[i+1] > time {
+			return i
+		}
+	}
+	return s.Size() - 1
+}
+
+// scanInterpolate interpolates the signal as Interpolate() does, using
+// scanNearestIndex().
+func scanInterpolate(s *Signal, t float64) Sample {
+	s0 := s.MustIndex(scanNearestIndex(s, t, false))
+	s1 := s.MustIndex(scanNearestIndex(s, t, true))
+
+	if s0.T == t && s1.T == t {
+		return Sample{T: t, S: s0.S}
+	}
+
+	d0 := math.Abs(s0.T - t)
+	d1 := math.Abs(s1.T - t)
+	if s0.T == s1.T {
+		return Sample{T: t, S: s0.S}
+	}
+
+	return Sample{T: t, S: (d0*s1.S)/(d0+d1) + (d1*s0.S)/(d0+d1)}
+}
+
+// randomSignal generates a signal of n samples at random sorted times, with
+// some repeated times.
+func randomSignal(r *rand.Rand, n int) *Signal {
+	s := &Signal{T: make([]float64, n), S: make([]float64, n)}
+	for i := range s.T {
+		s.T[i] = math.Round(r.Float64()*100) / 10
+		s.S[i] = r.NormFloat64()
+	}
+	sort.Float64s(s.T)
+	return s
+}
+
+func TestSearchMatchesScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for trial := 0; trial < 50; trial++ {
+		sig := randomSignal(r, 1+r.Intn(40))
+
+		// exact hits, points between and outside of the samples, and
+		// NaN
+		times := append([]float64{}, sig.T...)
+		for i := 0; i < 40; i++ {
+			times = append(times, r.Float64()*12-1)
+		}
+		times = append(times, math.NaN())
+
+		for _, time := range times {
+			for _, overshoot := range []bool{false, true} {
+				res := sig.NearestIndex(time, overshoot)
+				expect := scanNearestIndex(sig, time, overshoot)
+				if res != expect {
+					t.Fatalf("NearestIndex(%f, %v)=%d, but scanning gives %d for %v",
+						time, overshoot, res, expect, sig.T)
+				}
+			}
+		}
+
+		// both unsorted and sorted times, which are merged with the
+		// signal in a single pass
+		for _, sorted := range []bool{false, true} {
+			if sorted {
+				times = times[:len(times)-1]
+				sort.Float64s(times)
+			}
+
+			res := sig.Interpolate(times...)
+			for i, time := range times {
+				expect := scanInterpolate(sig, time)
+				if !cmp.Equal(res[i], expect, cmpopts.EquateNaNs()) {
+					t.Fatalf("Interpolate(%f)=%v, but scanning gives %v for %v",
+						time, res[i], expect, sig.T)
+				}
+			}
+		}
+	}
+}
+
+// benchmarkSignal generates a uniformly sampled signal of n samples.
+func benchmarkSignal(n int) *Signal {
+	s := &Signal{T: make([]float64, n), S: make([]float64, n), SampleRate: 1000}
+	for i := range s.T {
+		s.T[i] = float64(i) / 1000
+		s.S[i] = math.Sin(float64(i) / 100)
+	}
+	return s
+}
+
+func BenchmarkNearestIndex(b *testing.B) {
+	sig := benchmarkSignal(100000)
+	r := rand.New(rand.NewSource(1))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sig.NearestIndex(r.Float64()*sig.Duration(), i%2 == 0)
+	}
+}
+
+func BenchmarkInterpolateSorted(b *testing.B) {
+	sig := benchmarkSignal(10000)
+	times := make([]float64, 25000)
+	for i := range times {
+		times[i] = float64(i) / 2500
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sig.Interpolate(times...)
+	}
+}
+
+func BenchmarkInterpolateUnsorted(b *testing.B) {
+	sig := benchmarkSignal(10000)
+	r := rand.New(rand.NewSource(1))
+	times := make([]float64, 25000)
+	for i := range times {
+		times[i] = r.Float64() * sig.Duration()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sig.Interpolate(times...)
+	}
+}
+
 func TestValidateParameters(t *testing.T) {
 	// make sure filling in the noises and noise magnitudes works
 	w := &WaveParameters{